@@ -1,21 +1,25 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/acl"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/sharedcareplan"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/terminology"
 	"net/http"
 	"strconv"
 
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/customers"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/dossier"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/episode"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/export"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/notification"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/patients"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/reports"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/outbox"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/receiver"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/sender"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
@@ -54,12 +58,18 @@ type Wrapper struct {
 	TransferSenderService   sender.TransferService
 	TransferReceiverService receiver.TransferService
 	TransferReceiverRepo    receiver.TransferRepository
+	NotificationOutbox      *outbox.Dispatcher
 	ZorginzageService       domain.ZorginzageService
 	SharedCarePlanService   *sharedcareplan.Service
 	FHIRService             fhir.Service
 	EpisodeService          episode.Service
+	ExportService           export.Service
+	Terminology             terminology.Lookup
 	NotificationHandler     notification.Handler
-	TenantInitializer       func(tenant string) error
+	// IntrospectNotifications makes the notification endpoint introspect the access token itself,
+	// instead of reading the introspection result a PEP added to the X-Userinfo header.
+	IntrospectNotifications bool
+	TenantInitializer       func(ctx context.Context, tenant string) error
 }
 
 func (w Wrapper) CheckSession(ctx echo.Context) error {
@@ -78,7 +88,7 @@ func (w Wrapper) SetCustomer(ctx echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	if err := w.TenantInitializer(customer.Id); err != nil {
+	if err := w.TenantInitializer(ctx.Request().Context(), customer.Id); err != nil {
 		return fmt.Errorf("unable to initialize tenant: %w", err)
 	}
 
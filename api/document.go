@@ -0,0 +1,67 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/document"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+)
+
+type GetTransferDocumentParams = types.GetTransferDocumentParams
+type GetTransferRequestDocumentParams = types.GetTransferRequestDocumentParams
+
+// GetTransferDocument renders a transfer of the sending care organization as HTML page or PDF.
+func (w Wrapper) GetTransferDocument(ctx echo.Context, transferID string, params GetTransferDocumentParams) error {
+	cid, err := w.getCustomerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	transfer, err := w.TransferSenderService.GetTransferByID(ctx.Request().Context(), cid, transferID)
+	if err != nil {
+		return err
+	}
+
+	return renderDocument(ctx, document.FromTransfer(transfer), params.Format)
+}
+
+// GetTransferRequestDocument renders a transfer request received from another care organization as HTML page or PDF.
+func (w Wrapper) GetTransferRequestDocument(ctx echo.Context, requestorDID string, fhirTaskID string, params GetTransferRequestDocumentParams) error {
+	cid, err := w.getCustomerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	transferRequest, err := w.TransferReceiverService.GetTransferRequest(ctx.Request().Context(), cid, requestorDID, fhirTaskID, params.Token)
+	if err != nil {
+		return fmt.Errorf("unable to get transferRequest: %w", err)
+	}
+
+	return renderDocument(ctx, document.FromTransferRequest(*transferRequest), params.Format)
+}
+
+func renderDocument(ctx echo.Context, doc document.Document, format *types.DocumentFormat) error {
+	buf := new(bytes.Buffer)
+	if format == nil {
+		format = new(types.DocumentFormat)
+		*format = types.Html
+	}
+	switch *format {
+	case types.Html:
+		if err := document.RenderHTML(buf, doc); err != nil {
+			return fmt.Errorf("unable to render HTML: %w", err)
+		}
+		return ctx.HTMLBlob(http.StatusOK, buf.Bytes())
+	case types.Pdf:
+		if err := document.RenderPDF(buf, doc); err != nil {
+			return fmt.Errorf("unable to render PDF: %w", err)
+		}
+		ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`inline; filename="%s.pdf"`, doc.Title))
+		return ctx.Blob(http.StatusOK, "application/pdf", buf.Bytes())
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unsupported document format: %s", *format))
+	}
+}
@@ -75,11 +75,14 @@ type ServerInterface interface {
 	SearchOrganizations(ctx echo.Context) error
 
 	// (GET /private/network/inbox)
-	GetInbox(ctx echo.Context) error
+	GetInbox(ctx echo.Context, params GetInboxParams) error
 
 	// (GET /private/network/inbox/info)
 	GetInboxInfo(ctx echo.Context) error
 
+	// (PUT /private/network/inbox/{resourceID})
+	UpdateInboxEntry(ctx echo.Context, resourceID string) error
+
 	// (GET /private/network/patient)
 	GetRemotePatient(ctx echo.Context, params GetRemotePatientParams) error
 
@@ -89,6 +92,9 @@ type ServerInterface interface {
 	// (PUT /private/patient/{patientID})
 	UpdatePatient(ctx echo.Context, patientID string) error
 
+	// (GET /private/patient/{patientID}/export)
+	ExportPatient(ctx echo.Context, patientID string) error
+
 	// (GET /private/patients)
 	GetPatients(ctx echo.Context, params GetPatientsParams) error
 
@@ -101,18 +107,36 @@ type ServerInterface interface {
 	// (POST /private/reports/{patientID})
 	CreateReport(ctx echo.Context, patientID string) error
 
+	// (GET /private/terminology/{valueSet})
+	LookupConcepts(ctx echo.Context, valueSet string, params LookupConceptsParams) error
+
 	// (GET /private/transfer)
 	GetPatientTransfers(ctx echo.Context, params GetPatientTransfersParams) error
 
 	// (POST /private/transfer)
 	CreateTransfer(ctx echo.Context) error
 
+	// (GET /private/transfer-notifications)
+	ListFailedTransferNotifications(ctx echo.Context) error
+
+	// (POST /private/transfer-notifications/{notificationID}/resend)
+	ResendTransferNotification(ctx echo.Context, notificationID string) error
+
 	// (GET /private/transfer-request/{requestorDID}/{fhirTaskID})
 	GetTransferRequest(ctx echo.Context, requestorDID string, fhirTaskID string, params GetTransferRequestParams) error
 
 	// (POST /private/transfer-request/{requestorDID}/{fhirTaskID})
 	ChangeTransferRequestState(ctx echo.Context, requestorDID string, fhirTaskID string, params ChangeTransferRequestStateParams) error
 
+	// (GET /private/transfer-request/{requestorDID}/{fhirTaskID}/document)
+	GetTransferRequestDocument(ctx echo.Context, requestorDID string, fhirTaskID string, params GetTransferRequestDocumentParams) error
+
+	// (GET /private/transfer-request/{requestorDID}/{fhirTaskID}/history)
+	GetTransferRequestHistory(ctx echo.Context, requestorDID string, fhirTaskID string) error
+
+	// (POST /private/transfer-request/{requestorDID}/{fhirTaskID}/import)
+	ImportTransferRequest(ctx echo.Context, requestorDID string, fhirTaskID string, params ImportTransferRequestParams) error
+
 	// (DELETE /private/transfer/{transferID})
 	CancelTransfer(ctx echo.Context, transferID string) error
 
@@ -125,12 +149,21 @@ type ServerInterface interface {
 	// (PUT /private/transfer/{transferID}/assign)
 	AssignTransferDirect(ctx echo.Context, transferID string) error
 
+	// (GET /private/transfer/{transferID}/document)
+	GetTransferDocument(ctx echo.Context, transferID string, params GetTransferDocumentParams) error
+
+	// (GET /private/transfer/{transferID}/history)
+	GetTransferHistory(ctx echo.Context, transferID string) error
+
 	// (GET /private/transfer/{transferID}/negotiation)
 	ListTransferNegotiations(ctx echo.Context, transferID string) error
 
 	// (POST /private/transfer/{transferID}/negotiation)
 	StartTransferNegotiation(ctx echo.Context, transferID string) error
 
+	// (POST /private/transfer/{transferID}/negotiation/broadcast)
+	BroadcastTransferNegotiation(ctx echo.Context, transferID string) error
+
 	// (PUT /private/transfer/{transferID}/negotiation/{negotiationID})
 	UpdateTransferNegotiationStatus(ctx echo.Context, transferID string, negotiationID string) error
 }
@@ -471,8 +504,59 @@ func (w *ServerInterfaceWrapper) GetInbox(ctx echo.Context) error {
 
 	ctx.Set(BearerAuthScopes, []string{})
 
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetInboxParams
+	// ------------- Optional query parameter "status" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "status", ctx.QueryParams(), &params.Status)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter status: %s", err))
+	}
+
+	// ------------- Optional query parameter "sender" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "sender", ctx.QueryParams(), &params.Sender)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter sender: %s", err))
+	}
+
+	// ------------- Optional query parameter "from" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "from", ctx.QueryParams(), &params.From)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter from: %s", err))
+	}
+
+	// ------------- Optional query parameter "to" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "to", ctx.QueryParams(), &params.To)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter to: %s", err))
+	}
+
+	// ------------- Optional query parameter "archived" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "archived", ctx.QueryParams(), &params.Archived)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter archived: %s", err))
+	}
+
+	// ------------- Optional query parameter "page" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "page", ctx.QueryParams(), &params.Page)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter page: %s", err))
+	}
+
+	// ------------- Optional query parameter "pageSize" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "pageSize", ctx.QueryParams(), &params.PageSize)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter pageSize: %s", err))
+	}
+
 	// Invoke the callback with all the unmarshaled arguments
-	err = w.Handler.GetInbox(ctx)
+	err = w.Handler.GetInbox(ctx, params)
 	return err
 }
 
@@ -487,6 +571,24 @@ func (w *ServerInterfaceWrapper) GetInboxInfo(ctx echo.Context) error {
 	return err
 }
 
+// UpdateInboxEntry converts echo context to params.
+func (w *ServerInterfaceWrapper) UpdateInboxEntry(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "resourceID" -------------
+	var resourceID string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "resourceID", ctx.Param("resourceID"), &resourceID, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter resourceID: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{})
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.UpdateInboxEntry(ctx, resourceID)
+	return err
+}
+
 // GetRemotePatient converts echo context to params.
 func (w *ServerInterfaceWrapper) GetRemotePatient(ctx echo.Context) error {
 	var err error
@@ -539,6 +641,24 @@ func (w *ServerInterfaceWrapper) GetPatient(ctx echo.Context) error {
 	return err
 }
 
+// ExportPatient converts echo context to params.
+func (w *ServerInterfaceWrapper) ExportPatient(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "patientID" -------------
+	var patientID string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "patientID", ctx.Param("patientID"), &patientID, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter patientID: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{})
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ExportPatient(ctx, patientID)
+	return err
+}
+
 // UpdatePatient converts echo context to params.
 func (w *ServerInterfaceWrapper) UpdatePatient(ctx echo.Context) error {
 	var err error
@@ -572,6 +692,55 @@ func (w *ServerInterfaceWrapper) GetPatients(ctx echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter name: %s", err))
 	}
 
+	// ------------- Optional query parameter "ssn" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "ssn", ctx.QueryParams(), &params.Ssn)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter ssn: %s", err))
+	}
+
+	// ------------- Optional query parameter "birthDate" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "birthDate", ctx.QueryParams(), &params.BirthDate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter birthDate: %s", err))
+	}
+
+	// ------------- Optional query parameter "postalCode" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "postalCode", ctx.QueryParams(), &params.PostalCode)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter postalCode: %s", err))
+	}
+
+	// ------------- Optional query parameter "gender" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "gender", ctx.QueryParams(), &params.Gender)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter gender: %s", err))
+	}
+
+	// ------------- Optional query parameter "sort" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "sort", ctx.QueryParams(), &params.Sort)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter sort: %s", err))
+	}
+
+	// ------------- Optional query parameter "pageSize" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "pageSize", ctx.QueryParams(), &params.PageSize)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter pageSize: %s", err))
+	}
+
+	// ------------- Optional query parameter "cursor" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "cursor", ctx.QueryParams(), &params.Cursor)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter cursor: %s", err))
+	}
+
 	// Invoke the callback with all the unmarshaled arguments
 	err = w.Handler.GetPatients(ctx, params)
 	return err
@@ -633,6 +802,33 @@ func (w *ServerInterfaceWrapper) CreateReport(ctx echo.Context) error {
 	return err
 }
 
+// LookupConcepts converts echo context to params.
+func (w *ServerInterfaceWrapper) LookupConcepts(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "valueSet" -------------
+	var valueSet string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "valueSet", ctx.Param("valueSet"), &valueSet, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter valueSet: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params LookupConceptsParams
+	// ------------- Optional query parameter "query" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "query", ctx.QueryParams(), &params.Query)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter query: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.LookupConcepts(ctx, valueSet, params)
+	return err
+}
+
 // GetPatientTransfers converts echo context to params.
 func (w *ServerInterfaceWrapper) GetPatientTransfers(ctx echo.Context) error {
 	var err error
@@ -664,6 +860,35 @@ func (w *ServerInterfaceWrapper) CreateTransfer(ctx echo.Context) error {
 	return err
 }
 
+// ListFailedTransferNotifications converts echo context to params.
+func (w *ServerInterfaceWrapper) ListFailedTransferNotifications(ctx echo.Context) error {
+	var err error
+
+	ctx.Set(BearerAuthScopes, []string{})
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ListFailedTransferNotifications(ctx)
+	return err
+}
+
+// ResendTransferNotification converts echo context to params.
+func (w *ServerInterfaceWrapper) ResendTransferNotification(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "notificationID" -------------
+	var notificationID string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "notificationID", ctx.Param("notificationID"), &notificationID, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter notificationID: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{})
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ResendTransferNotification(ctx, notificationID)
+	return err
+}
+
 // GetTransferRequest converts echo context to params.
 func (w *ServerInterfaceWrapper) GetTransferRequest(ctx echo.Context) error {
 	var err error
@@ -734,6 +959,109 @@ func (w *ServerInterfaceWrapper) ChangeTransferRequestState(ctx echo.Context) er
 	return err
 }
 
+// GetTransferRequestDocument converts echo context to params.
+func (w *ServerInterfaceWrapper) GetTransferRequestDocument(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "requestorDID" -------------
+	var requestorDID string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "requestorDID", ctx.Param("requestorDID"), &requestorDID, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter requestorDID: %s", err))
+	}
+
+	// ------------- Path parameter "fhirTaskID" -------------
+	var fhirTaskID string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "fhirTaskID", ctx.Param("fhirTaskID"), &fhirTaskID, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter fhirTaskID: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetTransferRequestDocumentParams
+	// ------------- Required query parameter "token" -------------
+
+	err = runtime.BindQueryParameter("form", true, true, "token", ctx.QueryParams(), &params.Token)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter token: %s", err))
+	}
+
+	// ------------- Optional query parameter "format" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "format", ctx.QueryParams(), &params.Format)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter format: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.GetTransferRequestDocument(ctx, requestorDID, fhirTaskID, params)
+	return err
+}
+
+// GetTransferRequestHistory converts echo context to params.
+func (w *ServerInterfaceWrapper) GetTransferRequestHistory(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "requestorDID" -------------
+	var requestorDID string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "requestorDID", ctx.Param("requestorDID"), &requestorDID, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter requestorDID: %s", err))
+	}
+
+	// ------------- Path parameter "fhirTaskID" -------------
+	var fhirTaskID string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "fhirTaskID", ctx.Param("fhirTaskID"), &fhirTaskID, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter fhirTaskID: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{})
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.GetTransferRequestHistory(ctx, requestorDID, fhirTaskID)
+	return err
+}
+
+// ImportTransferRequest converts echo context to params.
+func (w *ServerInterfaceWrapper) ImportTransferRequest(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "requestorDID" -------------
+	var requestorDID string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "requestorDID", ctx.Param("requestorDID"), &requestorDID, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter requestorDID: %s", err))
+	}
+
+	// ------------- Path parameter "fhirTaskID" -------------
+	var fhirTaskID string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "fhirTaskID", ctx.Param("fhirTaskID"), &fhirTaskID, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter fhirTaskID: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params ImportTransferRequestParams
+	// ------------- Required query parameter "token" -------------
+
+	err = runtime.BindQueryParameter("form", true, true, "token", ctx.QueryParams(), &params.Token)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter token: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.ImportTransferRequest(ctx, requestorDID, fhirTaskID, params)
+	return err
+}
+
 // CancelTransfer converts echo context to params.
 func (w *ServerInterfaceWrapper) CancelTransfer(ctx echo.Context) error {
 	var err error
@@ -806,6 +1134,51 @@ func (w *ServerInterfaceWrapper) AssignTransferDirect(ctx echo.Context) error {
 	return err
 }
 
+// GetTransferDocument converts echo context to params.
+func (w *ServerInterfaceWrapper) GetTransferDocument(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "transferID" -------------
+	var transferID string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "transferID", ctx.Param("transferID"), &transferID, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter transferID: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{})
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetTransferDocumentParams
+	// ------------- Optional query parameter "format" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "format", ctx.QueryParams(), &params.Format)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter format: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.GetTransferDocument(ctx, transferID, params)
+	return err
+}
+
+// GetTransferHistory converts echo context to params.
+func (w *ServerInterfaceWrapper) GetTransferHistory(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "transferID" -------------
+	var transferID string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "transferID", ctx.Param("transferID"), &transferID, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter transferID: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{})
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.GetTransferHistory(ctx, transferID)
+	return err
+}
+
 // ListTransferNegotiations converts echo context to params.
 func (w *ServerInterfaceWrapper) ListTransferNegotiations(ctx echo.Context) error {
 	var err error
@@ -842,6 +1215,24 @@ func (w *ServerInterfaceWrapper) StartTransferNegotiation(ctx echo.Context) erro
 	return err
 }
 
+// BroadcastTransferNegotiation converts echo context to params.
+func (w *ServerInterfaceWrapper) BroadcastTransferNegotiation(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "transferID" -------------
+	var transferID string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "transferID", ctx.Param("transferID"), &transferID, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter transferID: %s", err))
+	}
+
+	ctx.Set(BearerAuthScopes, []string{})
+
+	// Invoke the callback with all the unmarshaled arguments
+	err = w.Handler.BroadcastTransferNegotiation(ctx, transferID)
+	return err
+}
+
 // UpdateTransferNegotiationStatus converts echo context to params.
 func (w *ServerInterfaceWrapper) UpdateTransferNegotiationStatus(ctx echo.Context) error {
 	var err error
@@ -918,23 +1309,34 @@ func RegisterHandlersWithBaseURL(router EchoRouter, si ServerInterface, baseURL
 	router.POST(baseURL+"/private/network/discovery", wrapper.SearchOrganizations)
 	router.GET(baseURL+"/private/network/inbox", wrapper.GetInbox)
 	router.GET(baseURL+"/private/network/inbox/info", wrapper.GetInboxInfo)
+	router.PUT(baseURL+"/private/network/inbox/:resourceID", wrapper.UpdateInboxEntry)
 	router.GET(baseURL+"/private/network/patient", wrapper.GetRemotePatient)
 	router.GET(baseURL+"/private/patient/:patientID", wrapper.GetPatient)
 	router.PUT(baseURL+"/private/patient/:patientID", wrapper.UpdatePatient)
+	router.GET(baseURL+"/private/patient/:patientID/export", wrapper.ExportPatient)
 	router.GET(baseURL+"/private/patients", wrapper.GetPatients)
 	router.POST(baseURL+"/private/patients", wrapper.NewPatient)
 	router.GET(baseURL+"/private/reports/:patientID", wrapper.GetReports)
 	router.POST(baseURL+"/private/reports/:patientID", wrapper.CreateReport)
+	router.GET(baseURL+"/private/terminology/:valueSet", wrapper.LookupConcepts)
 	router.GET(baseURL+"/private/transfer", wrapper.GetPatientTransfers)
 	router.POST(baseURL+"/private/transfer", wrapper.CreateTransfer)
+	router.GET(baseURL+"/private/transfer-notifications", wrapper.ListFailedTransferNotifications)
+	router.POST(baseURL+"/private/transfer-notifications/:notificationID/resend", wrapper.ResendTransferNotification)
 	router.GET(baseURL+"/private/transfer-request/:requestorDID/:fhirTaskID", wrapper.GetTransferRequest)
 	router.POST(baseURL+"/private/transfer-request/:requestorDID/:fhirTaskID", wrapper.ChangeTransferRequestState)
+	router.GET(baseURL+"/private/transfer-request/:requestorDID/:fhirTaskID/document", wrapper.GetTransferRequestDocument)
+	router.GET(baseURL+"/private/transfer-request/:requestorDID/:fhirTaskID/history", wrapper.GetTransferRequestHistory)
+	router.POST(baseURL+"/private/transfer-request/:requestorDID/:fhirTaskID/import", wrapper.ImportTransferRequest)
 	router.DELETE(baseURL+"/private/transfer/:transferID", wrapper.CancelTransfer)
 	router.GET(baseURL+"/private/transfer/:transferID", wrapper.GetTransfer)
 	router.PUT(baseURL+"/private/transfer/:transferID", wrapper.UpdateTransfer)
 	router.PUT(baseURL+"/private/transfer/:transferID/assign", wrapper.AssignTransferDirect)
+	router.GET(baseURL+"/private/transfer/:transferID/document", wrapper.GetTransferDocument)
+	router.GET(baseURL+"/private/transfer/:transferID/history", wrapper.GetTransferHistory)
 	router.GET(baseURL+"/private/transfer/:transferID/negotiation", wrapper.ListTransferNegotiations)
 	router.POST(baseURL+"/private/transfer/:transferID/negotiation", wrapper.StartTransferNegotiation)
+	router.POST(baseURL+"/private/transfer/:transferID/negotiation/broadcast", wrapper.BroadcastTransferNegotiation)
 	router.PUT(baseURL+"/private/transfer/:transferID/negotiation/:negotiationID", wrapper.UpdateTransferNegotiationStatus)
 
 }
@@ -1,9 +1,12 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/receiver"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
 	"github.com/sirupsen/logrus"
 
@@ -12,6 +15,8 @@ import (
 
 type GetTransferRequestParams types.GetTransferRequestParams
 type ChangeTransferRequestStateParams types.ChangeTransferRequestStateParams
+type ImportTransferRequestParams types.ImportTransferRequestParams
+type GetInboxParams = types.GetInboxParams
 
 // GetTransferRequest handles requests to receive a transfer request.
 func (w Wrapper) GetTransferRequest(ctx echo.Context, requestorDID string, fhirTaskID string, params GetTransferRequestParams) error {
@@ -31,16 +36,43 @@ func (w Wrapper) GetTransferRequest(ctx echo.Context, requestorDID string, fhirT
 		return fmt.Errorf("unable to get transferRequest: %w", err)
 	}
 
+	read := true
+	err = w.TransferReceiverRepo.UpdateFlags(ctx.Request().Context(), session.CustomerID, session.UserInfo.Identifier, fhirTaskID, &read, nil)
+	if err != nil {
+		logrus.Warnf("Unable to mark inbox entry as read: %s", err)
+	}
+
 	return ctx.JSON(http.StatusOK, transferRequest)
 }
 
+// ImportTransferRequest imports the nursing handoff of a transfer request into the local record.
+func (w Wrapper) ImportTransferRequest(ctx echo.Context, requestorDID string, fhirTaskID string, params ImportTransferRequestParams) error {
+	session, err := w.getSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	dossier, err := w.TransferReceiverService.ImportTransferRequest(
+		w.actorContext(ctx),
+		session.CustomerID,
+		requestorDID,
+		fhirTaskID,
+		params.Token,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to import transferRequest: %w", err)
+	}
+
+	return ctx.JSON(http.StatusOK, dossier)
+}
+
 func (w Wrapper) GetInboxInfo(ctx echo.Context) error {
-	customer, err := w.getCustomer(ctx)
+	session, err := w.getSession(ctx)
 	if err != nil {
 		return err
 	}
 
-	count, err := w.TransferReceiverRepo.GetNotCompletedCount(ctx.Request().Context(), customer.Id)
+	count, err := w.TransferReceiverRepo.CountUnread(ctx.Request().Context(), session.CustomerID, session.UserInfo.Identifier)
 	if err != nil {
 		return err
 	}
@@ -48,35 +80,79 @@ func (w Wrapper) GetInboxInfo(ctx echo.Context) error {
 	return ctx.JSON(http.StatusOK, types.InboxInfo{MessageCount: count})
 }
 
-func (w Wrapper) GetInbox(ctx echo.Context) error {
-	customer, err := w.getCustomer(ctx)
+const (
+	defaultInboxPageSize = 20
+	maxInboxPageSize     = 100
+)
+
+func (w Wrapper) GetInbox(ctx echo.Context, params GetInboxParams) error {
+	session, err := w.getSession(ctx)
 	if err != nil {
 		return err
 	}
 
-	transfers, err := w.TransferReceiverRepo.GetAll(ctx.Request().Context(), customer.Id)
+	query := receiver.InboxQuery{UserID: session.UserInfo.Identifier, Limit: defaultInboxPageSize}
+	if params.Status != nil {
+		for _, status := range *params.Status {
+			query.Statuses = append(query.Statuses, string(status))
+		}
+	}
+	if params.Sender != nil {
+		query.SenderDID = *params.Sender
+	}
+	// Dates are received in the local time zone of the care organization
+	if params.From != nil {
+		from := time.Date(params.From.Year(), params.From.Month(), params.From.Day(), 0, 0, 0, 0, time.Local)
+		query.From = &from
+	}
+	if params.To != nil {
+		to := time.Date(params.To.Year(), params.To.Month(), params.To.Day(), 0, 0, 0, 0, time.Local)
+		query.To = &to
+	}
+	if params.Archived != nil {
+		query.Archived = *params.Archived
+	}
+	if params.PageSize != nil {
+		if *params.PageSize < 1 || *params.PageSize > maxInboxPageSize {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("pageSize must be between 1 and %d", maxInboxPageSize))
+		}
+		query.Limit = *params.PageSize
+	}
+	if params.Page != nil {
+		if *params.Page < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "page must be 1 or higher")
+		}
+		query.Offset = (*params.Page - 1) * query.Limit
+	}
+
+	transfers, total, err := w.TransferReceiverRepo.FindInbox(ctx.Request().Context(), session.CustomerID, query)
 	if err != nil {
 		return err
 	}
 
-	var entries []types.InboxEntry
+	// We need to fetch the organizations as we only have their DIDs, every sender is only looked up once
+	senders := map[string]types.Organization{}
+	entries := make([]types.InboxEntry, 0, len(transfers))
 
 	for _, transfer := range transfers {
-		sender := transfer.Sender
-
-		// We need to fetch the organization as we only have it's ID
-		organization, err := w.OrganizationRegistry.Get(ctx.Request().Context(), transfer.Sender.Did)
-		if err != nil {
-			logrus.Errorf("failed to get organization: %s", err.Error())
-		}
-
-		if organization != nil {
-			sender = types.FromNutsOrganization(*organization)
+		sender, ok := senders[transfer.Sender.Did]
+		if !ok {
+			sender = transfer.Sender
+			organization, err := w.OrganizationRegistry.Get(ctx.Request().Context(), transfer.Sender.Did)
+			if err != nil {
+				logrus.Errorf("failed to get organization: %s", err.Error())
+			}
+			if organization != nil {
+				sender = types.FromNutsOrganization(*organization)
+			}
+			senders[transfer.Sender.Did] = sender
 		}
 
 		entries = append(entries, types.InboxEntry{
 			Date:              transfer.CreatedAt.Format("02-01-2006 15:04:05"),
-			RequiresAttention: true,
+			RequiresAttention: transfer.RequiresAttention(),
+			Read:              transfer.Read,
+			Archived:          transfer.Archived,
 			ResourceID:        transfer.FhirTaskID,
 			Sender:            sender,
 			Title:             "Overdracht van zorg",
@@ -85,5 +161,27 @@ func (w Wrapper) GetInbox(ctx echo.Context) error {
 		})
 	}
 
-	return ctx.JSON(http.StatusOK, entries)
+	return ctx.JSON(http.StatusOK, types.InboxPage{Entries: entries, Total: total})
+}
+
+// UpdateInboxEntry updates the flags of an inbox entry for the user of the session.
+func (w Wrapper) UpdateInboxEntry(ctx echo.Context, resourceID string) error {
+	update := types.InboxEntryUpdate{}
+	if err := ctx.Bind(&update); err != nil {
+		return err
+	}
+	session, err := w.getSession(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = w.TransferReceiverRepo.UpdateFlags(ctx.Request().Context(), session.CustomerID, session.UserInfo.Identifier, resourceID, update.Read, update.Archived)
+	if errors.Is(err, receiver.ErrTransferNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
 }
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/history"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/receiver"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// importingTransferService records the user that imports the transfer request.
+type importingTransferService struct {
+	receiver.TransferService
+	actor string
+}
+
+func (i *importingTransferService) ImportTransferRequest(ctx context.Context, _, _, _, _ string) (*types.Dossier, error) {
+	i.actor = history.ActorFromContext(ctx)
+	return &types.Dossier{}, nil
+}
+
+func TestWrapper_ImportTransferRequest(t *testing.T) {
+	service := &importingTransferService{}
+	auth := &Auth{sessions: map[string]Session{"session-1": {CustomerID: "c1", UserInfo: UserInfo{Identifier: "t.tester@example.com"}}}}
+	wrapper := Wrapper{APIAuth: auth, TransferReceiverService: service}
+	ctx := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+	ctx.Set(SessionID, "session-1")
+
+	err := wrapper.ImportTransferRequest(ctx, "did:web:sender", "task-1", ImportTransferRequestParams{Token: "token"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "t.tester@example.com", service.actor)
+}
@@ -3,10 +3,12 @@ package api
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir/eoverdracht"
 )
 
 func (w Wrapper) TaskUpdate(ctx echo.Context, customerID string, taskID string) error {
@@ -31,8 +33,14 @@ func (w Wrapper) TaskUpdate(ctx echo.Context, customerID string, taskID string)
 	}
 	status := *task.Status
 
+	// the receiver adds the proposed date as output when it puts the task on-hold
+	alternativeDate, err := eoverdracht.AlternativeDateFromTask(task)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
 	// update existing task
-	err = w.TransferSenderService.UpdateTaskState(ctx.Request().Context(), *customer, taskID, string(status))
+	err = w.TransferSenderService.UpdateTaskState(ctx.Request().Context(), *customer, taskID, string(status), alternativeDate)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return echo.NewHTTPError(http.StatusNotFound, err)
@@ -42,7 +50,7 @@ func (w Wrapper) TaskUpdate(ctx echo.Context, customerID string, taskID string)
 
 	updatedTask, err := w.FHIRService.GetTask(ctx.Request().Context(), customerID, taskID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "error retrieving FHIR task: "+err.Error())
+		return fmt.Errorf("error retrieving FHIR task: %w", err)
 	}
 
 	return ctx.JSON(http.StatusOK, updatedTask)
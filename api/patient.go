@@ -1,14 +1,15 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"sort"
-	"strings"
 
 	"github.com/labstack/echo/v4"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/patients"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	openapi_types "github.com/oapi-codegen/runtime/types"
 )
 
 // GetPatientsParams defines parameters for GetPatients.
@@ -16,32 +17,86 @@ type GetPatientsParams struct {
 
 	// Search patients by name
 	Name *string `json:"name,omitempty"`
+
+	// Search patients by social security number (BSN)
+	Ssn *string `json:"ssn,omitempty"`
+
+	// Search patients by date of birth
+	BirthDate *openapi_types.Date `json:"birthDate,omitempty"`
+
+	// Search patients by postal code, patients with a postal code that starts with it are returned.
+	PostalCode *string `json:"postalCode,omitempty"`
+
+	// Search patients by gender
+	Gender *types.Gender `json:"gender,omitempty"`
+
+	// Order of the patients, prefix with a minus sign for descending order. Defaults to surname.
+	Sort *string `json:"sort,omitempty"`
+
+	// Number of patients per page. Defaults to 20, at most 100.
+	PageSize *int `json:"pageSize,omitempty"`
+
+	// Cursor of the page to return, the next cursor of the previous page. The cursor contains the search, so the other parameters are ignored.
+	Cursor *string `json:"cursor,omitempty"`
 }
 
 type GetRemotePatientParams = types.GetRemotePatientParams
 
+const (
+	defaultPatientPageSize = 20
+	maxPatientPageSize     = 100
+)
+
 func (w Wrapper) GetPatients(ctx echo.Context, params GetPatientsParams) error {
 	customerID, err := w.getCustomerID(ctx)
 	if err != nil {
 		return err
 	}
-	patients, err := w.PatientRepository.All(ctx.Request().Context(), customerID, params.Name)
-	if err != nil {
-		return err
+	query := patients.Query{Limit: defaultPatientPageSize}
+	if params.Name != nil {
+		query.Name = *params.Name
+	}
+	if params.Ssn != nil {
+		query.SSN = *params.Ssn
+	}
+	if params.BirthDate != nil {
+		query.BirthDate = &params.BirthDate.Time
+	}
+	if params.PostalCode != nil {
+		query.PostalCode = *params.PostalCode
+	}
+	if params.Gender != nil {
+		query.Gender = *params.Gender
 	}
-	// Sort patients by surname
-	sort.Slice(patients, func(i, j int) bool {
-		s1 := patients[i].Surname
-		s2 := patients[j].Surname
-		if s1 == "" {
-			return true
+	if params.Sort != nil {
+		switch sortOrder := patients.Sort(*params.Sort); sortOrder {
+		case patients.SortBySurname, patients.SortBySurnameDesc, patients.SortByBirthDate, patients.SortByBirthDateDesc:
+			query.Sort = sortOrder
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unsupported sort: %s", *params.Sort))
 		}
-		if s2 == "" {
-			return false
+	}
+	if params.PageSize != nil {
+		if *params.PageSize < 1 || *params.PageSize > maxPatientPageSize {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("pageSize must be between 1 and %d", maxPatientPageSize))
 		}
-		return strings.Compare(s1, s2) < 0
-	})
-	return ctx.JSON(http.StatusOK, patients)
+		query.Limit = *params.PageSize
+	}
+	if params.Cursor != nil {
+		query.Cursor = *params.Cursor
+	}
+	result, err := w.PatientRepository.Search(ctx.Request().Context(), customerID, query)
+	if errors.Is(err, patients.ErrInvalidCursor) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	page := types.PatientPage{Patients: result.Patients, Total: result.Total}
+	if result.Next != "" {
+		page.Next = &result.Next
+	}
+	return ctx.JSON(http.StatusOK, page)
 }
 
 func (w Wrapper) NewPatient(ctx echo.Context) error {
@@ -102,6 +157,26 @@ func (w Wrapper) GetPatient(ctx echo.Context, patientID string) error {
 	return ctx.JSON(http.StatusOK, patient)
 }
 
+func (w Wrapper) ExportPatient(ctx echo.Context, patientID string) error {
+	cid, err := w.getCustomerID(ctx)
+	if err != nil {
+		return err
+	}
+	bundle, err := w.ExportService.Export(ctx.Request().Context(), cid, patientID)
+	if err != nil {
+		return err
+	}
+	if bundle == nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return err
+	}
+	ctx.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="patient-%s.json"`, patientID))
+	return ctx.Blob(http.StatusOK, "application/fhir+json", data)
+}
+
 func (w Wrapper) GetRemotePatient(ctx echo.Context, params GetRemotePatientParams) error {
 	customer, err := w.getCustomer(ctx)
 	if err != nil {
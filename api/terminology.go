@@ -0,0 +1,30 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/terminology"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+)
+
+type LookupConceptsParams = types.LookupConceptsParams
+
+// maxConcepts is the maximum number of concepts returned when autocompleting
+const maxConcepts = 20
+
+func (w Wrapper) LookupConcepts(ctx echo.Context, valueSet string, params LookupConceptsParams) error {
+	var query string
+	if params.Query != nil {
+		query = *params.Query
+	}
+	concepts, err := w.Terminology.Search(valueSet, query, maxConcepts)
+	if errors.Is(err, terminology.ErrUnknownValueSet) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, concepts)
+}
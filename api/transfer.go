@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -10,11 +11,19 @@ import (
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
 	"net/http"
 	"net/url"
+	"path"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/notification"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/history"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/outbox"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/sender"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	nutsClient "github.com/nuts-foundation/nuts-demo-ehr/nuts/client"
+	sqlUtil "github.com/nuts-foundation/nuts-demo-ehr/sql"
 	"github.com/sirupsen/logrus"
 
 	"github.com/labstack/echo/v4"
@@ -31,7 +40,7 @@ func (w Wrapper) CreateTransfer(ctx echo.Context) error {
 	if err != nil {
 		return err
 	}
-	transfer, err := w.TransferSenderService.CreateTransfer(ctx.Request().Context(), cid, request)
+	transfer, err := w.TransferSenderService.CreateTransfer(w.actorContext(ctx), cid, request)
 	if err != nil {
 		return err
 	}
@@ -65,7 +74,7 @@ func (w Wrapper) GetTransfer(ctx echo.Context, transferID string) error {
 }
 
 func (w Wrapper) ChangeTransferRequestState(ctx echo.Context, requesterDID string, fhirTaskID string, params ChangeTransferRequestStateParams) error {
-	updateRequest := &types.TransferNegotiationStatus{}
+	updateRequest := &types.TransferRequestStateChange{}
 	err := ctx.Bind(updateRequest)
 	if err != nil {
 		return err
@@ -75,7 +84,11 @@ func (w Wrapper) ChangeTransferRequestState(ctx echo.Context, requesterDID strin
 		return err
 	}
 
-	err = w.TransferReceiverService.UpdateTransferRequestState(ctx.Request().Context(), cid, requesterDID, fhirTaskID, string(updateRequest.Status))
+	var alternativeDate *time.Time
+	if updateRequest.AlternativeDate != nil {
+		alternativeDate = &updateRequest.AlternativeDate.Time
+	}
+	err = w.TransferReceiverService.UpdateTransferRequestState(w.actorContext(ctx), cid, requesterDID, fhirTaskID, string(updateRequest.Status), alternativeDate)
 	if err != nil {
 		return err
 	}
@@ -93,14 +106,16 @@ func (w Wrapper) UpdateTransfer(ctx echo.Context, transferID string) error {
 		return err
 	}
 
-	_, err = w.TransferSenderRepo.Update(ctx.Request().Context(), cid, transferID, func(t *types.Transfer) (*types.Transfer, error) {
-		//t.Description = updateRequest.Description
-		t.TransferDate = updateRequest.TransferDate
-		return t, nil
-	})
+	err = w.TransferSenderService.UpdateTransferDate(w.actorContext(ctx), cid, transferID, updateRequest.TransferDate.Time)
 	if err != nil {
 		return err
 	}
+	if updateRequest.HandoffContent != nil {
+		err = w.TransferSenderService.UpdateHandoffContent(w.actorContext(ctx), cid, transferID, *updateRequest.HandoffContent)
+		if err != nil {
+			return err
+		}
+	}
 
 	transfer, err := w.TransferSenderService.GetTransferByID(ctx.Request().Context(), cid, transferID)
 	if err != nil {
@@ -115,7 +130,7 @@ func (w Wrapper) CancelTransfer(ctx echo.Context, transferID string) error {
 	if err != nil {
 		return err
 	}
-	transfer, err := w.TransferSenderRepo.Cancel(ctx.Request().Context(), cid, transferID)
+	transfer, err := w.TransferSenderService.CancelTransfer(w.actorContext(ctx), cid, transferID)
 	if err != nil {
 		return err
 	}
@@ -131,13 +146,73 @@ func (w Wrapper) StartTransferNegotiation(ctx echo.Context, transferID string) e
 	if err != nil {
 		return err
 	}
-	negotiation, err := w.TransferSenderService.CreateNegotiation(ctx.Request().Context(), cid, transferID, request.OrganizationID)
+	negotiation, err := w.TransferSenderService.CreateNegotiation(w.actorContext(ctx), cid, transferID, request.OrganizationID)
 	if err != nil {
 		return err
 	}
 	return ctx.JSON(http.StatusOK, *negotiation)
 }
 
+// BroadcastTransferNegotiation starts a negotiation with every care organization matching the Discovery Service query.
+// A negotiation that can't be started doesn't fail the request, its error is reported in the result of the organization.
+func (w Wrapper) BroadcastTransferNegotiation(ctx echo.Context, transferID string) error {
+	request := types.BroadcastTransferNegotiationRequest{}
+	if err := ctx.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	customer, err := w.getCustomer(ctx)
+	if err != nil {
+		return err
+	}
+	organizations, err := w.NutsClient.SearchDiscoveryService(ctx.Request().Context(), request.Query, request.DiscoveryServiceID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	// our own organization must never receive a transfer request
+	dids, err := w.NutsClient.ListSubjectDIDs(ctx.Request().Context(), customer.Id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return ctx.JSON(http.StatusOK, w.requestNegotiations(w.actorContext(ctx), customer.Id, transferID, organizations, dids))
+}
+
+// requestNegotiations starts a negotiation with every organization, except those identified by the excluded DIDs.
+// The negotiations are started independently: each of them is started in its own savepoint, so the database changes
+// of a failed negotiation are rolled back while those of the other negotiations are committed.
+func (w Wrapper) requestNegotiations(ctx context.Context, customerID, transferID string, organizations []nutsClient.DiscoverySearchResult, excludedDIDs []string) []types.TransferNegotiationResult {
+	results := make([]types.TransferNegotiationResult, 0)
+	requested := make(map[string]bool)
+	for _, organization := range organizations {
+		// an organization is listed once for every Discovery Service it registered for
+		if requested[organization.ID] || slices.Contains(excludedDIDs, organization.ID) {
+			continue
+		}
+		requested[organization.ID] = true
+
+		result := types.TransferNegotiationResult{
+			OrganizationID: organization.ID,
+			Organization:   types.FromNutsOrganization(organization.NutsOrganization),
+		}
+		var negotiation *types.TransferNegotiation
+		err := sqlUtil.Savepoint(ctx, func(ctx context.Context) error {
+			var err error
+			negotiation, err = w.TransferSenderService.CreateNegotiation(ctx, customerID, transferID, organization.ID)
+			return err
+		})
+		if err != nil {
+			logrus.Warnf("Unable to start transfer negotiation (transfer=%s, DID=%s): %v", transferID, organization.ID, err)
+			reason := err.Error()
+			result.Error = &reason
+		} else {
+			negotiation.Organization = result.Organization
+			result.Negotiation = negotiation
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
 func (w Wrapper) AssignTransferDirect(ctx echo.Context, transferID string) error {
 	request := types.CreateTransferNegotiationRequest{}
 	if err := ctx.Bind(&request); err != nil {
@@ -147,7 +222,7 @@ func (w Wrapper) AssignTransferDirect(ctx echo.Context, transferID string) error
 	if err != nil {
 		return err
 	}
-	_, err = w.TransferSenderService.AssignTransfer(ctx.Request().Context(), *customer, transferID, request.OrganizationID)
+	_, err = w.TransferSenderService.AssignTransfer(w.actorContext(ctx), *customer, transferID, request.OrganizationID)
 	if err != nil {
 		return err
 	}
@@ -185,10 +260,16 @@ func (w Wrapper) UpdateTransferNegotiationStatus(ctx echo.Context, transferID st
 		return err
 	}
 	newState := request.Status
+	actorCtx := w.actorContext(ctx)
 	if newState == transfer.InProgressState {
-		_, err = w.TransferSenderService.ConfirmNegotiation(ctx.Request().Context(), cid, transferID, negotiationID)
+		_, err = w.TransferSenderService.ConfirmNegotiation(actorCtx, cid, transferID, negotiationID)
 	} else if newState == transfer.CancelledState {
-		_, err = w.TransferSenderService.CancelNegotiation(ctx.Request().Context(), cid, transferID, negotiationID)
+		_, err = w.TransferSenderService.CancelNegotiation(actorCtx, cid, transferID, negotiationID)
+	} else if newState == transfer.RequestedState {
+		_, err = w.TransferSenderService.AcceptAlternateDate(actorCtx, cid, transferID, negotiationID)
+	}
+	if errors.Is(err, sender.ErrNegotiationNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
 	if err != nil {
 		return fmt.Errorf("unable to update transfer negotiation state: %w", err)
@@ -201,90 +282,234 @@ func (w Wrapper) UpdateTransferNegotiationStatus(ctx echo.Context, transferID st
 	return ctx.JSON(http.StatusOK, negotiation)
 }
 
+func (w Wrapper) GetTransferHistory(ctx echo.Context, transferID string) error {
+	cid, err := w.getCustomerID(ctx)
+	if err != nil {
+		return err
+	}
+	dbTransfer, err := w.TransferSenderRepo.FindByID(ctx.Request().Context(), cid, transferID)
+	if err != nil {
+		return err
+	}
+	if dbTransfer == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "transfer not found")
+	}
+	events, err := w.TransferSenderService.GetTransferHistory(ctx.Request().Context(), cid, transferID)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, events)
+}
+
+func (w Wrapper) GetTransferRequestHistory(ctx echo.Context, requestorDID string, fhirTaskID string) error {
+	cid, err := w.getCustomerID(ctx)
+	if err != nil {
+		return err
+	}
+	events, err := w.TransferReceiverService.GetTransferRequestHistory(ctx.Request().Context(), cid, requestorDID, fhirTaskID)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, events)
+}
+
+// actorContext returns the request context with the user of the session, so it is recorded in the transfer history.
+func (w Wrapper) actorContext(ctx echo.Context) context.Context {
+	session, err := w.getSession(ctx)
+	if err != nil {
+		return ctx.Request().Context()
+	}
+	return history.WithActor(ctx.Request().Context(), session.UserInfo.Identifier)
+}
+
+func (w Wrapper) ListFailedTransferNotifications(ctx echo.Context) error {
+	cid, err := w.getCustomerID(ctx)
+	if err != nil {
+		return err
+	}
+	notifications, err := w.NotificationOutbox.ListFailed(ctx.Request().Context(), cid)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(http.StatusOK, notifications)
+}
+
+func (w Wrapper) ResendTransferNotification(ctx echo.Context, notificationID string) error {
+	cid, err := w.getCustomerID(ctx)
+	if err != nil {
+		return err
+	}
+	notification, err := w.NotificationOutbox.Resend(ctx.Request().Context(), cid, notificationID)
+	if errors.Is(err, outbox.ErrNotFailed) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return err
+	}
+	if notification == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "notification not found")
+	}
+	return ctx.JSON(http.StatusOK, notification)
+}
+
 func (w Wrapper) NotifyTransferUpdate(ctx echo.Context, taskID string) error {
 	// This gets called by a transfer sending XIS to inform the local node there's FHIR tasks to be retrieved.
-	// The PEP added introspection result to the X-Userinfo header
+	var claims *notificationClaims
+	var err error
+	if w.IntrospectNotifications {
+		claims, err = w.introspectNotificationToken(ctx)
+	} else {
+		claims, err = pepNotificationClaims(ctx)
+	}
+	if err != nil {
+		return respondWithOperationOutcome(ctx, err)
+	}
+
+	// client_id for senderDID and the issuer URL for the customer
+	senderClientID := claims.clientID
+	// we need the subjectID, which is at the end of the path of the issuer URL
+	issuerURL, err := url.Parse(claims.issuer)
+	if err != nil || path.Base(issuerURL.Path) == "/" || path.Base(issuerURL.Path) == "." {
+		return respondWithOperationOutcome(ctx, outcomeError{status: http.StatusBadRequest, code: "invalid", err: fmt.Errorf("invalid iss claim: %s", claims.issuer)})
+	}
+	customerID := path.Base(issuerURL.Path)
+
+	customer, err := w.CustomerRepository.FindByID(customerID)
+	if err != nil {
+		return respondWithOperationOutcome(ctx, outcomeError{status: http.StatusInternalServerError, code: "exception", err: err})
+	}
+
+	if customer == nil {
+		logrus.Warnf("Received transfer notification for unknown customer: %s", customerID)
+		return respondWithOperationOutcome(ctx, outcomeError{
+			status: http.StatusNotFound,
+			code:   "not-found",
+			err:    fmt.Errorf("received transfer notification for unknown taskOwner with ID: %s", customerID),
+		})
+	}
+
+	err = w.NotificationHandler.Handle(ctx.Request().Context(), notification.Notification{
+		TaskID:     taskID,
+		SenderID:   senderClientID,
+		CustomerID: customerID,
+	})
+	if errors.Is(err, notification.ErrNotTaskOwner) {
+		logrus.Warnf("Received transfer notification for a Task not owned by the customer (task=%s, customer=%s, sender=%s)", taskID, customerID, senderClientID)
+		return respondWithOperationOutcome(ctx, outcomeError{status: http.StatusForbidden, code: "forbidden", err: err})
+	} else if err != nil {
+		return respondWithOperationOutcome(ctx, outcomeError{status: http.StatusInternalServerError, code: "exception", err: err})
+	}
+
+	return ctx.NoContent(http.StatusAccepted)
+}
+
+// notificationClaims are the claims of the access token of a notification which identify the sender and the addressed customer.
+type notificationClaims struct {
+	issuer   string
+	clientID string
+}
+
+// pepNotificationClaims reads the claims from the introspection result the PEP added to the X-Userinfo header.
+func pepNotificationClaims(ctx echo.Context) (*notificationClaims, error) {
 	b64IntrospectionResult := ctx.Request().Header.Get("X-Userinfo")
-	//log.Errorf("X-Userinfo: %s", b64IntrospectionResult)
 	if b64IntrospectionResult == "" {
-		return errors.New("missing X-Userinfo header")
+		return nil, outcomeError{status: http.StatusUnauthorized, code: "login", err: errors.New("missing X-Userinfo header")}
 	}
 
 	// b64 -> json string
 	introspectionResult, err := base64.URLEncoding.DecodeString(b64IntrospectionResult)
 	if err != nil {
-		return fmt.Errorf("failed to base64 decode X-Userinfo header: %w", err)
+		return nil, outcomeError{status: http.StatusBadRequest, code: "invalid", err: fmt.Errorf("failed to base64 decode X-Userinfo header: %w", err)}
 	}
 
 	// json string -> map
 	target := map[string]interface{}{}
 	err = json.Unmarshal(introspectionResult, &target)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal X-Userinfo header: %w", err)
+		return nil, outcomeError{status: http.StatusBadRequest, code: "invalid", err: fmt.Errorf("failed to unmarshal X-Userinfo header: %w", err)}
 	}
 
-	// client_id for senderDID and sub for customerDID
-	_ = json.Unmarshal([]byte(introspectionResult), &target)
-	issuerURLStr := target["iss"].(string)
-	// get senderDID via custom policy param
-	senderClientID := target["client_id"].(string)
-	// we need the subjectID, which is at the end of the path, not panic safe
-	issuerURL, _ := url.Parse(issuerURLStr)
-	idx := strings.LastIndex(issuerURL.Path, "/")
-	customerID := issuerURL.Path[idx+1:]
+	issuer, _ := target["iss"].(string)
+	clientID, _ := target["client_id"].(string)
+	return validateNotificationClaims(issuer, clientID)
+}
+
+// introspectNotificationToken introspects the bearer token of the notification at the Nuts node,
+// for deployments without a PEP in front of the notification endpoint.
+func (w Wrapper) introspectNotificationToken(ctx echo.Context) (*notificationClaims, error) {
+	authorization := ctx.Request().Header.Get("Authorization")
+	accessToken, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || accessToken == "" {
+		return nil, outcomeError{status: http.StatusUnauthorized, code: "login", err: errors.New("missing bearer token")}
+	}
 
-	codeError := datatypes.Code("error")
-	codeInvalid := datatypes.Code("invalid")
-	severityError := datatypes.Code("error")
-	customer, err := w.CustomerRepository.FindByID(customerID)
+	introspectionResult, err := w.NutsClient.IntrospectAccessToken(ctx.Request().Context(), accessToken)
 	if err != nil {
+		return nil, outcomeError{status: http.StatusInternalServerError, code: "exception", err: fmt.Errorf("unable to introspect access token: %w", err)}
+	}
+	if !introspectionResult.Active {
+		return nil, outcomeError{status: http.StatusUnauthorized, code: "login", err: errors.New("access token is not active")}
+	}
+	var scopes []string
+	if introspectionResult.Scope != nil {
+		scopes = strings.Fields(*introspectionResult.Scope)
+	}
+	if !slices.Contains(scopes, transfer.ReceiverServiceScope) {
+		return nil, outcomeError{status: http.StatusForbidden, code: "forbidden", err: fmt.Errorf("access token does not grant scope %s", transfer.ReceiverServiceScope)}
+	}
 
-		return ctx.JSON(http.StatusInternalServerError, &resources.OperationOutcome{
-			Domain: resources.Domain{
-				Text: &datatypes.Narrative{
-					Div: fhir.ToStringPtr("an error occurred"),
-				},
-			},
-			Issue: []resources.OperationOutcomeIssue{
-				{
-					Code:     &codeError,
-					Severity: &severityError,
-					Details: &datatypes.CodeableConcept{
-						Text: fhir.ToStringPtr(err.Error()),
-					},
-				},
-			},
-		})
+	var issuer, clientID string
+	if introspectionResult.Iss != nil {
+		issuer = *introspectionResult.Iss
 	}
+	if introspectionResult.ClientId != nil {
+		clientID = *introspectionResult.ClientId
+	}
+	return validateNotificationClaims(issuer, clientID)
+}
 
-	if customer == nil {
-		logrus.Warnf("Received transfer notification for unknown customer: %s", customerID)
+func validateNotificationClaims(issuer, clientID string) (*notificationClaims, error) {
+	if issuer == "" {
+		return nil, outcomeError{status: http.StatusBadRequest, code: "invalid", err: errors.New("missing iss claim")}
+	}
+	if clientID == "" {
+		return nil, outcomeError{status: http.StatusBadRequest, code: "invalid", err: errors.New("missing client_id claim")}
+	}
+	return &notificationClaims{issuer: issuer, clientID: clientID}, nil
+}
 
-		return ctx.JSON(http.StatusNotFound, &resources.OperationOutcome{
-			Domain: resources.Domain{
-				Text: &datatypes.Narrative{
-					Div: fhir.ToStringPtr("taskOwner unknown on this server"),
-				},
+// outcomeError is answered with a FHIR OperationOutcome, so the sending XIS gets an error it can interpret.
+type outcomeError struct {
+	status int
+	// code is the type of the issue, see https://hl7.org/fhir/STU3/valueset-issue-type.html
+	code string
+	err  error
+}
+
+func (e outcomeError) Error() string {
+	return e.err.Error()
+}
+
+func respondWithOperationOutcome(ctx echo.Context, err error) error {
+	outcome := outcomeError{status: http.StatusInternalServerError, code: "exception", err: err}
+	_ = errors.As(err, &outcome)
+	code := datatypes.Code(outcome.code)
+	severityError := datatypes.Code("error")
+
+	return ctx.JSON(outcome.status, &resources.OperationOutcome{
+		Domain: resources.Domain{
+			Base: resources.Base{ResourceType: "OperationOutcome"},
+			Text: &datatypes.Narrative{
+				Div: fhir.ToStringPtr(outcome.Error()),
 			},
-			Issue: []resources.OperationOutcomeIssue{
-				{
-					Code:     &codeInvalid,
-					Severity: &codeError,
-					Details: &datatypes.CodeableConcept{
-						Text: fhir.ToStringPtr(fmt.Sprintf("received transfer notification for unknown taskOwner with ID: %s", senderClientID)),
-					},
+		},
+		Issue: []resources.OperationOutcomeIssue{
+			{
+				Code:     &code,
+				Severity: &severityError,
+				Details: &datatypes.CodeableConcept{
+					Text: fhir.ToStringPtr(outcome.Error()),
 				},
 			},
-		})
-	}
-
-	if err := w.NotificationHandler.Handle(ctx.Request().Context(), notification.Notification{
-		TaskID:     taskID,
-		SenderID:   senderClientID,
-		CustomerID: customerID,
-	}); err != nil {
-		return err
-	}
-
-	return ctx.NoContent(http.StatusAccepted)
+		},
+	})
 }
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/notification"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/sender"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	"github.com/nuts-foundation/nuts-demo-ehr/nuts"
+	nutsClient "github.com/nuts-foundation/nuts-demo-ehr/nuts/client"
+	sqlUtil "github.com/nuts-foundation/nuts-demo-ehr/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+// failingTransferService stores the negotiation like the real service, but then fails for some organizations.
+type failingTransferService struct {
+	sender.TransferService
+	repo       sender.TransferRepository
+	failingFor map[string]bool
+	undone     []string
+}
+
+func (f *failingTransferService) CreateNegotiation(ctx context.Context, customerID, transferID, organizationID string) (*types.TransferNegotiation, error) {
+	negotiation, err := f.repo.CreateNegotiation(ctx, customerID, transferID, organizationID, time.Now(), "task-"+organizationID)
+	if err != nil {
+		return nil, err
+	}
+	tm, _ := sqlUtil.GetTransactionManager(ctx)
+	tm.OnRollback(func() {
+		f.undone = append(f.undone, organizationID)
+	})
+	if f.failingFor[organizationID] {
+		return nil, errors.New("notification failed")
+	}
+	return negotiation, nil
+}
+
+func TestWrapper_requestNegotiations(t *testing.T) {
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	repo := sender.NewTransferRepository(db)
+	service := &failingTransferService{repo: repo, failingFor: map[string]bool{"did:web:b": true}}
+	wrapper := Wrapper{TransferSenderService: service}
+	organization := func(did string) nutsClient.DiscoverySearchResult {
+		return nutsClient.DiscoverySearchResult{NutsOrganization: nuts.NutsOrganization{ID: did}}
+	}
+
+	var transferID string
+	var results []types.TransferNegotiationResult
+	err := sqlUtil.ExecuteTransactional(db, func(ctx context.Context) error {
+		dbTransfer, err := repo.Create(ctx, "c1", "dossier", time.Now(), "composition")
+		if err != nil {
+			return err
+		}
+		transferID = dbTransfer.Id
+		organizations := []nutsClient.DiscoverySearchResult{organization("did:web:a"), organization("did:web:b"), organization("did:web:a"), organization("did:web:self"), organization("did:web:c")}
+		results = wrapper.requestNegotiations(ctx, "c1", transferID, organizations, []string{"did:web:self"})
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Len(t, results, 3)
+	assert.NotNil(t, results[0].Negotiation)
+	assert.Nil(t, results[0].Error)
+	assert.Nil(t, results[1].Negotiation)
+	assert.Equal(t, "notification failed", *results[1].Error)
+	assert.NotNil(t, results[2].Negotiation)
+	// only the changes of the failed negotiation are undone
+	assert.Equal(t, []string{"did:web:b"}, service.undone)
+	_ = sqlUtil.ExecuteTransactional(db, func(ctx context.Context) error {
+		negotiations, err := repo.ListNegotiations(ctx, "c1", transferID)
+		require.NoError(t, err)
+		var organizationIDs []string
+		for _, negotiation := range negotiations {
+			organizationIDs = append(organizationIDs, negotiation.OrganizationID)
+		}
+		assert.ElementsMatch(t, []string{"did:web:a", "did:web:c"}, organizationIDs)
+		return nil
+	})
+}
+
+type stubCustomerRepository map[string]types.Customer
+
+func (s stubCustomerRepository) FindByID(id string) (*types.Customer, error) {
+	customer, ok := s[id]
+	if !ok {
+		return nil, nil
+	}
+	return &customer, nil
+}
+
+func (s stubCustomerRepository) All() ([]types.Customer, error) {
+	return nil, nil
+}
+
+// stubNotificationHandler records the handled notifications and returns err.
+type stubNotificationHandler struct {
+	handled []notification.Notification
+	err     error
+}
+
+func (s *stubNotificationHandler) Handle(_ context.Context, n notification.Notification) error {
+	s.handled = append(s.handled, n)
+	return s.err
+}
+
+func TestWrapper_NotifyTransferUpdate(t *testing.T) {
+	userinfo := func(claims map[string]string) string {
+		data, _ := json.Marshal(claims)
+		return base64.URLEncoding.EncodeToString(data)
+	}
+	validUserinfo := userinfo(map[string]string{"iss": "https://ehr.example.com/oauth2/c1", "client_id": "did:web:sender"})
+	notify := func(wrapper Wrapper, header, value string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/web/external/transfer/notify/task-1", nil)
+		if header != "" {
+			request.Header.Set(header, value)
+		}
+		recorder := httptest.NewRecorder()
+		require.NoError(t, wrapper.NotifyTransferUpdate(echo.New().NewContext(request, recorder), "task-1"))
+		return recorder
+	}
+	assertOutcome := func(t *testing.T, recorder *httptest.ResponseRecorder, status int, code, text string) {
+		assert.Equal(t, status, recorder.Code)
+		outcome := gjson.ParseBytes(recorder.Body.Bytes())
+		assert.Equal(t, "OperationOutcome", outcome.Get("resourceType").String())
+		assert.Equal(t, code, outcome.Get("issue.0.code").String())
+		assert.Equal(t, "error", outcome.Get("issue.0.severity").String())
+		assert.Equal(t, text, outcome.Get("issue.0.details.text").String())
+	}
+	customerRepository := stubCustomerRepository{"c1": {Id: "c1"}}
+
+	t.Run("PEP", func(t *testing.T) {
+		t.Run("ok", func(t *testing.T) {
+			handler := &stubNotificationHandler{}
+			wrapper := Wrapper{CustomerRepository: customerRepository, NotificationHandler: handler}
+
+			recorder := notify(wrapper, "X-Userinfo", validUserinfo)
+
+			assert.Equal(t, http.StatusAccepted, recorder.Code)
+			assert.Equal(t, []notification.Notification{{TaskID: "task-1", SenderID: "did:web:sender", CustomerID: "c1"}}, handler.handled)
+		})
+		t.Run("missing X-Userinfo header", func(t *testing.T) {
+			recorder := notify(Wrapper{}, "", "")
+
+			assertOutcome(t, recorder, http.StatusUnauthorized, "login", "missing X-Userinfo header")
+		})
+		t.Run("X-Userinfo header isn't base64", func(t *testing.T) {
+			recorder := notify(Wrapper{}, "X-Userinfo", "not base64!")
+
+			assertOutcome(t, recorder, http.StatusBadRequest, "invalid", "failed to base64 decode X-Userinfo header: illegal base64 data at input byte 3")
+		})
+		t.Run("X-Userinfo header isn't JSON", func(t *testing.T) {
+			recorder := notify(Wrapper{}, "X-Userinfo", base64.URLEncoding.EncodeToString([]byte("claims")))
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			assert.Equal(t, "invalid", gjson.GetBytes(recorder.Body.Bytes(), "issue.0.code").String())
+		})
+		t.Run("missing iss claim", func(t *testing.T) {
+			recorder := notify(Wrapper{}, "X-Userinfo", userinfo(map[string]string{"client_id": "did:web:sender"}))
+
+			assertOutcome(t, recorder, http.StatusBadRequest, "invalid", "missing iss claim")
+		})
+		t.Run("missing client_id claim", func(t *testing.T) {
+			recorder := notify(Wrapper{}, "X-Userinfo", userinfo(map[string]string{"iss": "https://ehr.example.com/oauth2/c1"}))
+
+			assertOutcome(t, recorder, http.StatusBadRequest, "invalid", "missing client_id claim")
+		})
+		t.Run("iss claim without customer", func(t *testing.T) {
+			recorder := notify(Wrapper{}, "X-Userinfo", userinfo(map[string]string{"iss": "https://ehr.example.com", "client_id": "did:web:sender"}))
+
+			assertOutcome(t, recorder, http.StatusBadRequest, "invalid", "invalid iss claim: https://ehr.example.com")
+		})
+		t.Run("unknown customer", func(t *testing.T) {
+			wrapper := Wrapper{CustomerRepository: stubCustomerRepository{}}
+
+			recorder := notify(wrapper, "X-Userinfo", validUserinfo)
+
+			assertOutcome(t, recorder, http.StatusNotFound, "not-found", "received transfer notification for unknown taskOwner with ID: c1")
+		})
+		t.Run("Task not owned by the customer", func(t *testing.T) {
+			wrapper := Wrapper{CustomerRepository: customerRepository, NotificationHandler: &stubNotificationHandler{err: notification.ErrNotTaskOwner}}
+
+			recorder := notify(wrapper, "X-Userinfo", validUserinfo)
+
+			assertOutcome(t, recorder, http.StatusForbidden, "forbidden", notification.ErrNotTaskOwner.Error())
+		})
+		t.Run("handling fails", func(t *testing.T) {
+			wrapper := Wrapper{CustomerRepository: customerRepository, NotificationHandler: &stubNotificationHandler{err: errors.New("FHIR server unavailable")}}
+
+			recorder := notify(wrapper, "X-Userinfo", validUserinfo)
+
+			assertOutcome(t, recorder, http.StatusInternalServerError, "exception", "FHIR server unavailable")
+		})
+	})
+	t.Run("introspection", func(t *testing.T) {
+		introspectionResults := map[string]string{
+			"valid":     `{"active":true,"iss":"https://ehr.example.com/oauth2/c1","client_id":"did:web:sender","scope":"openid eOverdracht-receiver"}`,
+			"inactive":  `{"active":false}`,
+			"scopeless": `{"active":true,"iss":"https://ehr.example.com/oauth2/c1","client_id":"did:web:sender","scope":"openid"}`,
+		}
+		nutsNode := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.URL.Path != "/internal/auth/v2/accesstoken/introspect" {
+				writer.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writer.Header().Set("Content-Type", "application/json")
+			_, _ = writer.Write([]byte(introspectionResults[request.FormValue("token")]))
+		}))
+		t.Cleanup(nutsNode.Close)
+		newWrapper := func(handler notification.Handler) Wrapper {
+			return Wrapper{
+				NutsClient:              &nutsClient.HTTPClient{NutsNodeAddress: nutsNode.URL},
+				CustomerRepository:      customerRepository,
+				NotificationHandler:     handler,
+				IntrospectNotifications: true,
+			}
+		}
+
+		t.Run("ok", func(t *testing.T) {
+			handler := &stubNotificationHandler{}
+
+			recorder := notify(newWrapper(handler), "Authorization", "Bearer valid")
+
+			assert.Equal(t, http.StatusAccepted, recorder.Code)
+			assert.Equal(t, []notification.Notification{{TaskID: "task-1", SenderID: "did:web:sender", CustomerID: "c1"}}, handler.handled)
+		})
+		t.Run("missing bearer token", func(t *testing.T) {
+			recorder := notify(newWrapper(nil), "X-Userinfo", validUserinfo)
+
+			assertOutcome(t, recorder, http.StatusUnauthorized, "login", "missing bearer token")
+		})
+		t.Run("inactive access token", func(t *testing.T) {
+			recorder := notify(newWrapper(nil), "Authorization", "Bearer inactive")
+
+			assertOutcome(t, recorder, http.StatusUnauthorized, "login", "access token is not active")
+		})
+		t.Run("access token without the receiver scope", func(t *testing.T) {
+			recorder := notify(newWrapper(nil), "Authorization", "Bearer scopeless")
+
+			assertOutcome(t, recorder, http.StatusForbidden, "forbidden", "access token does not grant scope eOverdracht-receiver")
+		})
+		t.Run("Task not owned by the customer", func(t *testing.T) {
+			recorder := notify(newWrapper(&stubNotificationHandler{err: notification.ErrNotTaskOwner}), "Authorization", "Bearer valid")
+
+			assertOutcome(t, recorder, http.StatusForbidden, "forbidden", notification.ErrNotTaskOwner.Error())
+		})
+	})
+}
@@ -13,7 +13,9 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
 	"github.com/sirupsen/logrus"
 
 	"github.com/knadh/koanf"
@@ -52,6 +54,21 @@ func defaultConfig() Config {
 		DBConnectionString: "demo-ehr.db?cache=shared",
 		LoadTestPatients:   false,
 		NutsNodeKeyPath:    "",
+		Notifications: Notifications{
+			Interval:       2 * time.Second,
+			MaxAttempts:    10,
+			InitialBackoff: 5 * time.Second,
+			MaxBackoff:     time.Hour,
+		},
+		Scheduler: Scheduler{
+			Interval:      time.Minute,
+			CompleteAfter: 7 * 24 * time.Hour,
+		},
+		Reconciler: Reconciler{
+			Interval:       5 * time.Minute,
+			InitialBackoff: time.Minute,
+			MaxBackoff:     time.Hour,
+		},
 	}
 }
 
@@ -66,6 +83,13 @@ type Config struct {
 	SharedCarePlanning SharedCarePlanning `koanf:"sharedcareplanning"`
 	CustomersFile      string             `koanf:"customersfile"`
 	Branding           Branding           `koanf:"branding"`
+	Notifications      Notifications      `koanf:"notifications"`
+	Scheduler          Scheduler          `koanf:"scheduler"`
+	Reconciler         Reconciler         `koanf:"reconciler"`
+	// IncomingNotifications configures the authentication of notifications from sending care organizations.
+	IncomingNotifications IncomingNotifications `koanf:"incomingnotifications"`
+	// Validation configures the validation of outgoing eOverdracht resources against the Nictiz profiles.
+	Validation Validation `koanf:"validation"`
 	// Database connection string, accepts all options for the sqlite3 driver
 	// https://github.com/mattn/go-sqlite3#connection-string
 	DBConnectionString string `koanf:"dbConnectionString"`
@@ -102,10 +126,89 @@ type FHIR struct {
 type FHIRServer struct {
 	Type    string `koanf:"type"`
 	Address string `koanf:"address"`
+	// Version is the FHIR version of the server: STU3 or R4. If empty, it's read from the server's CapabilityStatement.
+	Version string `koanf:"version"`
+	// TenancyMode isolates the resources of the customers on a FHIR server without partitions (hapi or other): with "tag"
+	// their resources are tagged with the customer, if it's empty the customers share the resources.
+	TenancyMode string `koanf:"tenancy"`
 }
 
 func (server FHIRServer) SupportsMultiTenancy() bool {
-	return server.Type == "hapi-multi-tenant"
+	return server.Type == "hapi-multi-tenant" || server.Type == embeddedFHIRServerType
+}
+
+// Tenancy returns how the resources of the customers are isolated on the FHIR server: in partitions if the server
+// supports them, otherwise as configured. Tagging is opt-in, since resources which were stored without the tag aren't
+// visible anymore once it's enabled.
+func (server FHIRServer) Tenancy(partitions fhir.Partitions) (fhir.Tenancy, error) {
+	if server.SupportsMultiTenancy() {
+		if server.TenancyMode != "" {
+			return nil, fmt.Errorf("fhir.server.tenancy can't be set for FHIR server type %s, it has partitions", server.Type)
+		}
+		return fhir.PartitionTenancy{Partitions: partitions}, nil
+	}
+	switch server.TenancyMode {
+	case "":
+		return fhir.SharedTenancy{}, nil
+	case tagTenancy:
+		return fhir.TagTenancy{}, nil
+	}
+	return nil, fmt.Errorf("unsupported fhir.server.tenancy: %s", server.TenancyMode)
+}
+
+// tagTenancy isolates the resources of the customers by tagging them, see fhir.TagTenancy.
+const tagTenancy = "tag"
+
+// embeddedFHIRServerType selects the in-memory FHIR server which is started by the demo EHR itself, it listens on the
+// host and port of the FHIR server address.
+const embeddedFHIRServerType = "embedded"
+
+// Notifications configures the delivery of eOverdracht notifications to receiving care organizations.
+type Notifications struct {
+	// Interval at which pending notifications are delivered.
+	Interval time.Duration `koanf:"interval"`
+	// MaxAttempts is the number of delivery attempts after which a notification is marked as failed.
+	MaxAttempts int `koanf:"maxattempts"`
+	// InitialBackoff is the delay after the first failed attempt, it doubles after every next failed attempt.
+	InitialBackoff time.Duration `koanf:"initialbackoff"`
+	// MaxBackoff is the maximum delay between two attempts.
+	MaxBackoff time.Duration `koanf:"maxbackoff"`
+}
+
+// IncomingNotifications configures the authentication of eOverdracht notifications from sending care organizations.
+type IncomingNotifications struct {
+	// Introspect makes the app introspect the access token of a notification at the Nuts node, and check it grants the
+	// eOverdracht-receiver scope. It is used when there is no PEP in front of the notification endpoint which adds
+	// the introspection result as X-Userinfo header.
+	Introspect bool `koanf:"introspect"`
+}
+
+// Validation configures the validation of outgoing eOverdracht resources against the Nictiz profiles bundled with the app.
+type Validation struct {
+	// Strict refuses to store or share resources which don't conform to the profiles. Otherwise, violations are only logged.
+	Strict bool `koanf:"strict"`
+}
+
+// Scheduler configures the automatic completion and cancellation of eOverdracht negotiations.
+type Scheduler struct {
+	// Interval at which the negotiations are checked, 0 disables the scheduler.
+	Interval time.Duration `koanf:"interval"`
+	// CompleteAfter is the period after the transfer date after which an in-progress negotiation is completed, 0 disables it.
+	CompleteAfter time.Duration `koanf:"completeafter"`
+	// AnswerBefore is the period before the transfer date in which a requested negotiation must be answered,
+	// otherwise it is cancelled.
+	AnswerBefore time.Duration `koanf:"answerbefore"`
+}
+
+// Reconciler configures the periodic check of incoming eOverdracht transfers against the Task of the sender,
+// which recovers from notifications that never arrived.
+type Reconciler struct {
+	// Interval at which the incoming transfers are checked, 0 disables the reconciler.
+	Interval time.Duration `koanf:"interval"`
+	// InitialBackoff is the period a sender is skipped after it couldn't be reached, it doubles after every next failure.
+	InitialBackoff time.Duration `koanf:"initialbackoff"`
+	// MaxBackoff is the maximum period a sender is skipped.
+	MaxBackoff time.Duration `koanf:"maxbackoff"`
 }
 
 type Credentials struct {
@@ -0,0 +1,279 @@
+// Package export collects everything a care organization holds on a patient, e.g. to answer a patient access request
+// (inzageverzoek) under the GDPR and WGBO.
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monarko/fhirgo/STU3/datatypes"
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/dossier"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/sharedcareplan"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/sender"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// DossierExtensionURL is the URL of the extension on the exported Patient which contains the metadata of a dossier,
+// which is stored by the demo EHR itself instead of on the FHIR server.
+const DossierExtensionURL = "http://nuts.nl/fhir/StructureDefinition/demo-ehr-dossier"
+
+// maxResources limits the number of resources in an export, so following references can't run away.
+const maxResources = 5000
+
+// patientSearches find the resources of a patient on FHIR servers which don't support Patient/$everything.
+var patientSearches = []struct {
+	resourceType string
+	parameter    string
+}{
+	{resourceType: "EpisodeOfCare", parameter: "patient"},
+	{resourceType: "Observation", parameter: "subject"},
+	{resourceType: "Condition", parameter: "subject"},
+	{resourceType: "Procedure", parameter: "subject"},
+	{resourceType: "AllergyIntolerance", parameter: "patient"},
+	{resourceType: "Composition", parameter: "subject"},
+	{resourceType: "CarePlan", parameter: "subject"},
+	{resourceType: "Task", parameter: "patient"},
+}
+
+// Service exports the data of a patient as FHIR collection Bundle.
+type Service struct {
+	FHIRClientFactory  fhir.Factory
+	DossierRepository  dossier.Repository
+	TransferRepository sender.TransferRepository
+	// SharedCarePlanRepository is nil if shared care planning isn't enabled.
+	SharedCarePlanRepository *sharedcareplan.Repository
+}
+
+// Export returns a collection Bundle with the Patient and all resources linked to it: the resources of the patient
+// compartment (using Patient/$everything if the FHIR server supports it), the resources of the transfers of the
+// patient (which refer to an anonymous patient) and every resource these refer to. The dossiers of the patient are
+// added to the Patient as extensions (see DossierExtensionURL). It returns nil if the patient doesn't exist.
+func (s Service) Export(ctx context.Context, customerID, patientID string) (*resources.Bundle, error) {
+	client := s.FHIRClientFactory(fhir.WithTenant(customerID))
+	patientPath := "Patient/" + patientID
+	var patient json.RawMessage
+	if err := client.ReadOne(ctx, patientPath, &patient); err != nil {
+		if fhir.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to read patient (id=%s): %w", patientID, err)
+	}
+	dossierExtensions, linkedPaths, err := s.dossierMetadata(ctx, customerID, patientID)
+	if err != nil {
+		return nil, err
+	}
+	if patient, err = addExtensions(patient, dossierExtensions); err != nil {
+		return nil, fmt.Errorf("unable to add dossiers to patient (id=%s): %w", patientID, err)
+	}
+	result := newCollection()
+	result.add(patientPath, patient)
+
+	var everything []json.RawMessage
+	if err := client.ReadMultiple(ctx, patientPath+"/$everything", nil, &everything); err == nil {
+		for _, resource := range everything {
+			result.addResource(resource)
+		}
+	} else {
+		logrus.Infof("Unable to export patient using $everything, searching its resources instead (patient=%s): %s", patientID, err)
+		for _, search := range patientSearches {
+			var found []json.RawMessage
+			if err := client.ReadMultiple(ctx, search.resourceType, map[string]string{search.parameter: patientPath}, &found); err != nil {
+				return nil, fmt.Errorf("unable to search %s of patient (id=%s): %w", search.resourceType, patientID, err)
+			}
+			for _, resource := range found {
+				result.addResource(resource)
+			}
+		}
+	}
+
+	// follow the references of the resources, including the resources which are only linked to the patient by the
+	// demo EHR, e.g. the compositions of transfers which refer to an anonymous patient.
+	queue := append(linkedPaths, result.references()...)
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		if result.contains(path) {
+			continue
+		}
+		if len(result.paths) >= maxResources {
+			return nil, fmt.Errorf("export of patient exceeds %d resources (id=%s)", maxResources, patientID)
+		}
+		var resource json.RawMessage
+		if err := client.ReadOne(ctx, path, &resource); err != nil {
+			// e.g. the resources of a cancelled transfer, which have been deleted
+			logrus.Debugf("Unable to read resource for export of patient, skipping it (patient=%s,path=%s): %s", patientID, path, err)
+			continue
+		}
+		result.add(path, resource)
+		queue = append(queue, references(gjson.ParseBytes(resource))...)
+	}
+	return result.bundle(client), nil
+}
+
+// dossierMetadata returns the dossiers of the patient as extensions, and the paths of the FHIR resources of the
+// dossiers: their EpisodeOfCare and the compositions and Tasks of their transfers.
+func (s Service) dossierMetadata(ctx context.Context, customerID, patientID string) ([]map[string]interface{}, []string, error) {
+	dossiers, err := s.DossierRepository.AllByPatient(ctx, customerID, patientID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to find dossiers of patient (id=%s): %w", patientID, err)
+	}
+	transfers, err := s.TransferRepository.FindByPatientID(ctx, customerID, patientID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to find transfers of patient (id=%s): %w", patientID, err)
+	}
+	var extensions []map[string]interface{}
+	var paths []string
+	for _, current := range dossiers {
+		paths = append(paths, "EpisodeOfCare/"+current.Id)
+		extension := []map[string]interface{}{
+			{"url": "id", "valueString": current.Id},
+			{"url": "name", "valueString": current.Name},
+		}
+		if s.SharedCarePlanRepository != nil {
+			carePlan, err := s.SharedCarePlanRepository.FindByDossierID(ctx, customerID, current.Id)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return nil, nil, fmt.Errorf("unable to find shared care plan of dossier (id=%s): %w", current.Id, err)
+			}
+			if carePlan != nil {
+				extension = append(extension, map[string]interface{}{
+					"url":            "sharedCarePlan",
+					"valueReference": map[string]string{"reference": carePlan.Reference},
+				})
+			}
+		}
+		for _, transfer := range transfers {
+			if transfer.DossierID != current.Id {
+				continue
+			}
+			paths = append(paths, "Composition/"+transfer.FhirAdvanceNoticeComposition)
+			if transfer.FhirNursingHandoffComposition != nil {
+				paths = append(paths, "Composition/"+*transfer.FhirNursingHandoffComposition)
+			}
+			negotiations, err := s.TransferRepository.ListNegotiations(ctx, customerID, transfer.Id)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to find negotiations of transfer (id=%s): %w", transfer.Id, err)
+			}
+			for _, negotiation := range negotiations {
+				paths = append(paths, "Task/"+negotiation.TaskID)
+			}
+			extension = append(extension, map[string]interface{}{
+				"url": "transfer",
+				"extension": []map[string]interface{}{
+					{"url": "id", "valueString": transfer.Id},
+					{"url": "status", "valueCode": transfer.Status},
+					{"url": "transferDate", "valueDate": transfer.TransferDate.Format("2006-01-02")},
+				},
+			})
+		}
+		extensions = append(extensions, map[string]interface{}{"url": DossierExtensionURL, "extension": extension})
+	}
+	return extensions, paths, nil
+}
+
+// addExtensions adds the extensions to the resource, keeping the other properties of the resource as they are.
+func addExtensions(resourceJSON []byte, extensions []map[string]interface{}) (json.RawMessage, error) {
+	if len(extensions) == 0 {
+		return resourceJSON, nil
+	}
+	resource := map[string]json.RawMessage{}
+	if err := json.Unmarshal(resourceJSON, &resource); err != nil {
+		return nil, err
+	}
+	var allExtensions []interface{}
+	if data, ok := resource["extension"]; ok {
+		if err := json.Unmarshal(data, &allExtensions); err != nil {
+			return nil, err
+		}
+	}
+	for _, extension := range extensions {
+		allExtensions = append(allExtensions, extension)
+	}
+	resource["extension"], _ = json.Marshal(allExtensions)
+	return json.Marshal(resource)
+}
+
+// collection contains the exported resources in the order in which they were found.
+type collection struct {
+	paths     []string
+	resources map[string]json.RawMessage
+}
+
+func newCollection() *collection {
+	return &collection{resources: map[string]json.RawMessage{}}
+}
+
+func (c *collection) contains(path string) bool {
+	_, ok := c.resources[path]
+	return ok
+}
+
+func (c *collection) add(path string, resource json.RawMessage) {
+	if !c.contains(path) {
+		c.paths = append(c.paths, path)
+		c.resources[path] = resource
+	}
+}
+
+// addResource adds a resource which has been found by a search. OperationOutcomes (e.g. warnings) are left out.
+func (c *collection) addResource(resource json.RawMessage) {
+	parsed := gjson.ParseBytes(resource)
+	resourceType := parsed.Get("resourceType").String()
+	if resourceType != "" && resourceType != "OperationOutcome" && parsed.Get("id").String() != "" {
+		c.add(resourceType+"/"+parsed.Get("id").String(), resource)
+	}
+}
+
+// references returns the references of all resources in the collection.
+func (c *collection) references() []string {
+	var result []string
+	for _, path := range c.paths {
+		result = append(result, references(gjson.ParseBytes(c.resources[path]))...)
+	}
+	return result
+}
+
+func (c *collection) bundle(client fhir.Client) *resources.Bundle {
+	lastUpdated := datatypes.Instant(time.Now().UTC().Format(time.RFC3339))
+	bundle := &resources.Bundle{
+		Base: resources.Base{
+			ResourceType: "Bundle",
+			ID:           fhir.ToIDPtr(uuid.NewString()),
+			Meta:         &datatypes.Meta{LastUpdated: &lastUpdated},
+		},
+		Type: fhir.ToCodePtr("collection"),
+	}
+	for _, path := range c.paths {
+		bundle.Entry = append(bundle.Entry, resources.BundleEntry{
+			FullURL:  fhir.ToUriPtr(client.BuildRequestURI(path).String()),
+			Resource: c.resources[path],
+		})
+	}
+	return bundle
+}
+
+// references returns the relative references (e.g. Patient/123) at any depth of the resource. References to other
+// FHIR servers, contained resources and logical references (by identifier) can't be followed, so they are left out.
+func references(value gjson.Result) []string {
+	var result []string
+	value.ForEach(func(key, child gjson.Result) bool {
+		if key.String() == "reference" && child.Type == gjson.String {
+			reference := strings.TrimPrefix(strings.SplitN(child.String(), "/_history/", 2)[0], "/")
+			if parts := strings.Split(reference, "/"); len(parts) == 2 && parts[0] != "" && parts[1] != "" && !strings.Contains(reference, ":") {
+				result = append(result, reference)
+			}
+		} else if child.IsObject() || child.IsArray() {
+			result = append(result, references(child)...)
+		}
+		return true
+	})
+	return result
+}
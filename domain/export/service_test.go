@@ -0,0 +1,113 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/monarko/fhirgo/STU3/datatypes"
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/dossier"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir/embedded"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/sender"
+	"github.com/nuts-foundation/nuts-demo-ehr/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func reference(path string) *datatypes.Reference {
+	return &datatypes.Reference{Reference: fhir.ToStringPtr(path)}
+}
+
+func TestService_Export(t *testing.T) {
+	httpServer := httptest.NewServer(embedded.NewServer())
+	t.Cleanup(httpServer.Close)
+	clientFactory := fhir.NewFactory(fhir.WithURL(httpServer.URL))
+	client := clientFactory()
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	service := Service{
+		FHIRClientFactory:  clientFactory,
+		DossierRepository:  dossier.NewSQLiteDossierRepository(dossier.Factory{}, db),
+		TransferRepository: sender.NewTransferRepository(db),
+	}
+	ctx := context.Background()
+
+	create := func(resource interface{}) {
+		require.NoError(t, client.CreateOrUpdate(ctx, resource, nil))
+	}
+	create(resources.Patient{Domain: resources.Domain{Base: resources.Base{ResourceType: "Patient", ID: fhir.ToIDPtr("p1")}}})
+	create(resources.Patient{Domain: resources.Domain{Base: resources.Base{ResourceType: "Patient", ID: fhir.ToIDPtr("p2")}}})
+	create(resources.Practitioner{Domain: resources.Domain{Base: resources.Base{ResourceType: "Practitioner", ID: fhir.ToIDPtr("nurse")}}})
+	create(resources.Observation{
+		Domain:    resources.Domain{Base: resources.Base{ResourceType: "Observation", ID: fhir.ToIDPtr("o1")}},
+		Status:    fhir.ToCodePtr("final"),
+		Subject:   reference("Patient/p1"),
+		Performer: []datatypes.Reference{*reference("Practitioner/nurse")},
+	})
+	create(resources.Observation{
+		Domain:  resources.Domain{Base: resources.Base{ResourceType: "Observation", ID: fhir.ToIDPtr("o2")}},
+		Status:  fhir.ToCodePtr("final"),
+		Subject: reference("Patient/p2"),
+	})
+
+	var dossierID string
+	err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+		created, err := service.DossierRepository.Create(ctx, "c1", "Transfer", "p1")
+		if err != nil {
+			return err
+		}
+		dossierID = string(created.Id)
+		// the advance notice refers to an anonymous patient, so it's only linked to the patient by the transfer
+		create(map[string]interface{}{"resourceType": "Composition", "id": "advance-notice", "subject": map[string]string{"reference": "Patient/anonymous"}})
+		transfer, err := service.TransferRepository.Create(ctx, "c1", dossierID, time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC), "advance-notice")
+		if err != nil {
+			return err
+		}
+		_, err = service.TransferRepository.CreateNegotiation(ctx, "c1", transfer.Id, "did:web:receiver", transfer.TransferDate.Time, "task")
+		return err
+	})
+	require.NoError(t, err)
+	create(map[string]interface{}{"resourceType": "Task", "id": "task", "status": "requested", "focus": map[string]string{"reference": "Composition/advance-notice"}})
+
+	t.Run("ok", func(t *testing.T) {
+		var bundle *resources.Bundle
+		err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			var err error
+			bundle, err = service.Export(ctx, "c1", "p1")
+			return err
+		})
+		require.NoError(t, err)
+		require.NotNil(t, bundle)
+
+		assert.Equal(t, "collection", string(*bundle.Type))
+		var paths []string
+		for _, entry := range bundle.Entry {
+			resource, _ := json.Marshal(entry.Resource)
+			parsed := gjson.ParseBytes(resource)
+			paths = append(paths, parsed.Get("resourceType").String()+"/"+parsed.Get("id").String())
+			assert.Equal(t, httpServer.URL+"/"+paths[len(paths)-1], string(*entry.FullURL))
+		}
+		assert.ElementsMatch(t, []string{"Patient/p1", "Observation/o1", "Practitioner/nurse", "Composition/advance-notice", "Task/task"}, paths)
+
+		patient, _ := json.Marshal(bundle.Entry[0].Resource)
+		extension := gjson.GetBytes(patient, `extension.#(url=="`+DossierExtensionURL+`").extension`)
+		assert.Equal(t, dossierID, extension.Get(`#(url=="id").valueString`).String())
+		assert.Equal(t, "Transfer", extension.Get(`#(url=="name").valueString`).String())
+		assert.Equal(t, "2024-06-15", extension.Get(`#(url=="transfer").extension.#(url=="transferDate").valueDate`).String())
+	})
+	t.Run("unknown patient", func(t *testing.T) {
+		err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			bundle, err := service.Export(ctx, "c1", "unknown")
+			assert.Nil(t, bundle)
+			return err
+		})
+		require.NoError(t, err)
+	})
+}
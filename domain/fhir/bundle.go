@@ -0,0 +1,195 @@
+package fhir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/monarko/fhirgo/STU3/datatypes"
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/tidwall/gjson"
+)
+
+// Types of the Bundles which are posted to the FHIR server
+const (
+	BundleTypeTransaction = "transaction"
+	BundleTypeBatch       = "batch"
+)
+
+// PutEntry returns a Bundle entry which creates or updates the resource at the given path, e.g. Patient/123.
+func PutEntry(resourcePath string, resource interface{}) resources.BundleEntry {
+	method := datatypes.Code("PUT")
+	return resources.BundleEntry{
+		Resource: resource,
+		Request: &resources.BundleEntryRequest{
+			Method: &method,
+			URL:    ToUriPtr(resourcePath),
+		},
+	}
+}
+
+// PostEntry returns a Bundle entry which creates a resource of the given type, the FHIR server assigns its ID.
+// If ifNoneExist is set to a search query (e.g. identifier=http://fhir.nl/fhir/NamingSystem/bsn|123), the resource
+// is only created when no resource matches the query. Otherwise, the result of the entry refers to the existing resource.
+func PostEntry(resourceType string, resource interface{}, ifNoneExist string) resources.BundleEntry {
+	method := datatypes.Code("POST")
+	entry := resources.BundleEntry{
+		Resource: resource,
+		Request: &resources.BundleEntryRequest{
+			Method: &method,
+			URL:    ToUriPtr(resourceType),
+		},
+	}
+	if ifNoneExist != "" {
+		entry.Request.IfNoneExist = ToStringPtr(ifNoneExist)
+	}
+	return entry
+}
+
+// DeleteEntry returns a Bundle entry which deletes the resource at the given path (e.g. Patient/123), or the resources
+// matching a conditional URL (e.g. Patient?_id=123&name:missing=true).
+func DeleteEntry(url string) resources.BundleEntry {
+	method := datatypes.Code("DELETE")
+	return resources.BundleEntry{
+		Request: &resources.BundleEntryRequest{
+			Method: &method,
+			URL:    ToUriPtr(url),
+		},
+	}
+}
+
+// BundleEntryResult is the outcome of a Bundle entry as returned by the FHIR server.
+type BundleEntryResult struct {
+	// Status is the HTTP status code of the entry, e.g. 201 if the resource was created.
+	Status int
+	// Location is the location of the resource as returned by the server, e.g. Patient/123/_history/1
+	Location string
+	// ResourceType and ID identify the resource, they're resolved from the location.
+	ResourceType string
+	ID           string
+	// VersionID is the version of the resource, it's empty if the server doesn't support versioning.
+	VersionID string
+	// Err is set if the entry of a batch failed.
+	Err error
+}
+
+// Path returns the path of the resource, e.g. Patient/123
+func (r BundleEntryResult) Path() string {
+	return r.ResourceType + "/" + r.ID
+}
+
+// EntryError is the error of a Bundle entry the FHIR server couldn't process.
+type EntryError struct {
+	// Index is the index of the entry in the Bundle.
+	Index int
+	// URL is the request URL of the entry, e.g. Patient/123
+	URL string
+	// Status is the HTTP status code of the entry, e.g. 422
+	Status int
+	// Diagnostics contains the diagnostics of the OperationOutcome the server returned for the entry.
+	Diagnostics string
+}
+
+func (e EntryError) Error() string {
+	return fmt.Sprintf("entry %d (url=%s,http-status=%d) failed: %s", e.Index, e.URL, e.Status, e.Diagnostics)
+}
+
+// Is makes an EntryError match ErrNotFound, ErrGone, ErrConflict or ErrUnauthorized, like Error.
+func (e EntryError) Is(target error) bool {
+	return statusMatches(e.Status, target)
+}
+
+// BatchError is returned by Batch when one or more entries failed, the other entries have been processed.
+type BatchError struct {
+	Entries []EntryError
+}
+
+func (e BatchError) Error() string {
+	var errs []string
+	for _, entry := range e.Entries {
+		errs = append(errs, entry.Error())
+	}
+	return fmt.Sprintf("%d of the batch entries failed: %s", len(e.Entries), strings.Join(errs, "; "))
+}
+
+// Unwrap returns the errors of the failed entries, so errors.Is and errors.As inspect them,
+// e.g. errors.Is(err, fhir.ErrConflict) reports whether an entry failed because of a conflict.
+func (e BatchError) Unwrap() []error {
+	var errs []error
+	for _, entry := range e.Entries {
+		errs = append(errs, entry)
+	}
+	return errs
+}
+
+// parseBundleResponse returns the results of the entries of a transaction-response or batch-response Bundle, in the
+// order of the entries of the request. The errors of failed entries are returned separately.
+func parseBundleResponse(request resources.Bundle, response []byte) ([]BundleEntryResult, []EntryError, error) {
+	entries := gjson.GetBytes(response, "entry").Array()
+	if len(entries) != len(request.Entry) {
+		return nil, nil, fmt.Errorf("FHIR server returned %d entries for a Bundle of %d entries", len(entries), len(request.Entry))
+	}
+	results := make([]BundleEntryResult, len(entries))
+	var entryErrors []EntryError
+	for i, entry := range entries {
+		result := BundleEntryResult{
+			Status:   parseStatus(entry.Get("response.status").String()),
+			Location: entry.Get("response.location").String(),
+		}
+		result.ResourceType, result.ID, result.VersionID = parseLocation(result.Location)
+		if result.ID == "" {
+			// not every server returns a location for updates, then the resource is identified by the entry itself
+			result.ResourceType = entry.Get("resource.resourceType").String()
+			result.ID = entry.Get("resource.id").String()
+			if result.ID == "" && request.Entry[i].Request != nil {
+				result.ResourceType, result.ID, _ = parseLocation(string(*request.Entry[i].Request.URL))
+			}
+		}
+		if result.Status < 200 || result.Status > 299 {
+			entryError := EntryError{
+				Index:       i,
+				Status:      result.Status,
+				Diagnostics: operationOutcomeDiagnostics(entry.Get("response.outcome")),
+			}
+			if request.Entry[i].Request != nil {
+				entryError.URL = string(*request.Entry[i].Request.URL)
+			}
+			result.Err = entryError
+			entryErrors = append(entryErrors, entryError)
+		}
+		results[i] = result
+	}
+	return results, entryErrors, nil
+}
+
+// parseStatus returns the status code of a Bundle entry status, e.g. 201 for "201 Created"
+func parseStatus(status string) int {
+	code, _ := strconv.Atoi(strings.Fields(status + " ")[0])
+	return code
+}
+
+// parseLocation returns the resource type, ID and version of a (relative or absolute) location,
+// e.g. Patient, 123 and 1 for http://localhost/fhir/Patient/123/_history/1
+func parseLocation(location string) (resourceType string, id string, versionID string) {
+	location = strings.SplitN(location, "?", 2)[0]
+	parts := strings.Split(strings.Trim(location, "/"), "/")
+	if len(parts) >= 4 && parts[len(parts)-2] == "_history" {
+		versionID = parts[len(parts)-1]
+		parts = parts[:len(parts)-2]
+	}
+	if len(parts) < 2 {
+		return "", "", ""
+	}
+	return parts[len(parts)-2], parts[len(parts)-1], versionID
+}
+
+// operationOutcomeDiagnostics returns the diagnostics of the issues of an OperationOutcome.
+func operationOutcomeDiagnostics(outcome gjson.Result) string {
+	var diagnostics []string
+	for _, issue := range outcome.Get("issue").Array() {
+		if text := issue.Get("diagnostics").String(); text != "" {
+			diagnostics = append(diagnostics, text)
+		}
+	}
+	return strings.Join(diagnostics, "; ")
+}
@@ -0,0 +1,115 @@
+package fhir
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClient_Transaction(t *testing.T) {
+	var requestBundle map[string]interface{}
+	responseStatus := http.StatusOK
+	responseBody := `{"resourceType":"Bundle","type":"transaction-response","entry":[
+		{"response":{"status":"201 Created","location":"http://localhost/fhir/Patient/1/_history/1"}},
+		{"response":{"status":"200 OK"}}
+	]}`
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		data, _ := io.ReadAll(request.Body)
+		_ = json.Unmarshal(data, &requestBundle)
+		writer.WriteHeader(responseStatus)
+		_, _ = writer.Write([]byte(responseBody))
+	}))
+	defer server.Close()
+	client := NewFactory(WithURL(server.URL), WithVersion(VersionSTU3))()
+	bundle := resources.Bundle{Entry: []resources.BundleEntry{
+		PostEntry("Patient", map[string]interface{}{"resourceType": "Patient"}, "identifier=bsn|123"),
+		PutEntry("Condition/2", map[string]interface{}{"resourceType": "Condition", "id": "2"}),
+	}}
+
+	t.Run("ids and locations are resolved", func(t *testing.T) {
+		results, err := client.Transaction(context.Background(), bundle)
+
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "transaction", requestBundle["type"])
+		assert.Equal(t, "Bundle", requestBundle["resourceType"])
+		if !assert.Len(t, results, 2) {
+			return
+		}
+		assert.Equal(t, BundleEntryResult{Status: 201, Location: "http://localhost/fhir/Patient/1/_history/1", ResourceType: "Patient", ID: "1", VersionID: "1"}, results[0])
+		// the server didn't return a location, so the resource is identified by the request
+		assert.Equal(t, "Condition/2", results[1].Path())
+	})
+	t.Run("failed transaction", func(t *testing.T) {
+		responseStatus = http.StatusUnprocessableEntity
+		responseBody = `{"resourceType":"OperationOutcome","issue":[{"severity":"error","diagnostics":"Condition.subject is required"}]}`
+
+		_, err := client.Transaction(context.Background(), bundle)
+
+		assert.EqualError(t, err, "unable to post FHIR transaction (path="+server.URL+",http-status=422): Condition.subject is required")
+	})
+}
+
+func TestHTTPClient_Batch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`{"resourceType":"Bundle","type":"batch-response","entry":[
+			{"response":{"status":"200 OK","location":"Patient/1/_history/3"}},
+			{"response":{"status":"400 Bad Request","outcome":{"resourceType":"OperationOutcome","issue":[{"diagnostics":"invalid gender"}]}}}
+		]}`))
+	}))
+	defer server.Close()
+	client := NewFactory(WithURL(server.URL), WithVersion(VersionSTU3))()
+	bundle := resources.Bundle{Entry: []resources.BundleEntry{
+		PostEntry("Patient", map[string]interface{}{"resourceType": "Patient"}, "identifier=bsn|123"),
+		PostEntry("Patient", map[string]interface{}{"resourceType": "Patient", "gender": "?"}, ""),
+	}}
+
+	results, err := client.Batch(context.Background(), bundle)
+
+	var batchErr BatchError
+	if !assert.ErrorAs(t, err, &batchErr) || !assert.Len(t, results, 2) {
+		return
+	}
+	assert.Equal(t, []EntryError{{Index: 1, URL: "Patient", Status: 400, Diagnostics: "invalid gender"}}, batchErr.Entries)
+	assert.Equal(t, "Patient/1", results[0].Path())
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, batchErr.Entries[0], results[1].Err)
+	var entryErr EntryError
+	assert.ErrorAs(t, err, &entryErr)
+	assert.Equal(t, 1, entryErr.Index)
+	assert.NotErrorIs(t, err, ErrConflict)
+}
+
+func TestBatchError_Unwrap(t *testing.T) {
+	err := fmt.Errorf("unable to store resources: %w", BatchError{Entries: []EntryError{
+		{Index: 0, URL: "Task/1", Status: http.StatusPreconditionFailed},
+		{Index: 2, URL: "Patient/2", Status: http.StatusNotFound},
+	}})
+
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.True(t, IsNotFound(err))
+	assert.NotErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestParseLocation(t *testing.T) {
+	testCases := map[string][]string{
+		"Patient/1":            {"Patient", "1", ""},
+		"Patient/1/_history/2": {"Patient", "1", "2"},
+		"https://localhost/fhir/Task/abc/_history/1": {"Task", "abc", "1"},
+		"": {"", "", ""},
+	}
+	for location, expected := range testCases {
+		resourceType, id, versionID := parseLocation(location)
+
+		assert.Equal(t, expected, []string{resourceType, id, versionID}, location)
+	}
+}
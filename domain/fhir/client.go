@@ -5,10 +5,14 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/monarko/fhirgo/STU3/resources"
 	"github.com/sirupsen/logrus"
 	"github.com/tidwall/gjson"
 )
@@ -23,9 +27,10 @@ func WithURL(serverURL string) ClientOpt {
 	}
 }
 
-func WithMultiTenancyEnabled(enabled bool) ClientOpt {
+// WithTenancy sets how the resources of the tenants are isolated on the FHIR server. Defaults to SharedTenancy.
+func WithTenancy(tenancy Tenancy) ClientOpt {
 	return func(client *httpClient) {
-		client.multiTenancyEnabled = enabled
+		client.tenancy = tenancy
 	}
 }
 
@@ -47,10 +52,18 @@ func WithAuthToken(authToken string) ClientOpt {
 	}
 }
 
+// WithVersion sets the FHIR version of the server. If not set, it's negotiated from the server's CapabilityStatement.
+func WithVersion(version Version) ClientOpt {
+	return func(client *httpClient) {
+		client.version = version
+	}
+}
+
 func NewFactory(defaultOpts ...ClientOpt) Factory {
 	return func(callerOpts ...ClientOpt) Client {
 		client := &httpClient{
 			restClient: resty.New().SetHeader("Content-Type", "application/json"),
+			tenancy:    SharedTenancy{},
 		}
 		for _, opt := range append(defaultOpts, callerOpts...) {
 			opt(client)
@@ -59,19 +72,42 @@ func NewFactory(defaultOpts ...ClientOpt) Factory {
 	}
 }
 
+// Client performs requests on a FHIR server. If the server replies with an error status, an Error is returned which
+// can be classified with errors.Is, e.g. errors.Is(err, ErrNotFound).
 type Client interface {
 	Create(ctx context.Context, resource interface{}, result interface{}) error
+	// CreateOrUpdate writes the resource to its path. If the resource has a meta.versionId, it's only updated when
+	// that is the current version (If-Match), otherwise a ConflictError is returned. Use RetryOnConflict to reapply
+	// the change to the current version.
 	CreateOrUpdate(ctx context.Context, resource interface{}, result interface{}) error
-	ReadMultiple(ctx context.Context, path string, params map[string]string, results interface{}) error
+	// Transaction posts the Bundle as transaction, the FHIR server processes either all of its entries or none of them.
+	// The results are in the order of the entries.
+	Transaction(ctx context.Context, bundle resources.Bundle) ([]BundleEntryResult, error)
+	// Batch posts the Bundle as batch, the FHIR server processes every entry independently. The results are in the
+	// order of the entries. If one or more entries failed, a BatchError is returned next to the results.
+	Batch(ctx context.Context, bundle resources.Bundle) ([]BundleEntryResult, error)
+	// ReadMultiple reads the resources of a search into the results, which must be a pointer to a slice.
+	// It follows the next links of the search Bundle, use WithMaxResults to limit the number of resources.
+	ReadMultiple(ctx context.Context, path string, params map[string]string, results interface{}, opts ...ReadOpt) error
+	// Iterate returns an Iterator over the resources of a search, which fetches the pages of the search Bundle when needed.
+	Iterate(ctx context.Context, path string, params map[string]string, opts ...ReadOpt) *Iterator
+	// ReadOne reads the resource at the given path into the result. Its meta.versionId contains the version of the
+	// resource, so writing the result back with CreateOrUpdate fails with a ConflictError if it has been modified since.
 	ReadOne(ctx context.Context, path string, result interface{}) error
+	// Delete removes the resource at the given path.
+	Delete(ctx context.Context, path string) error
+	// DeleteWhere removes the resources of the given type which match the search parameters (conditional delete).
+	// Most servers refuse to delete more than one resource at once, so the parameters should identify a single resource.
+	DeleteWhere(ctx context.Context, resourceType string, params map[string]string) error
 	BuildRequestURI(fhirResourcePath string) *url.URL
 }
 
 type httpClient struct {
-	restClient          *resty.Client
-	url                 string
-	tenant              string
-	multiTenancyEnabled bool
+	restClient *resty.Client
+	url        string
+	tenant     string
+	tenancy    Tenancy
+	version    Version
 }
 
 func (h httpClient) Create(ctx context.Context, resource interface{}, result interface{}) error {
@@ -80,16 +116,21 @@ func (h httpClient) Create(ctx context.Context, resource interface{}, result int
 		return fmt.Errorf("unable to determine resource path: %w", err)
 	}
 	requestURI := h.BuildRequestURI(resourcePath)
-	resp, err := h.restClient.R().SetBody(resource).SetContext(ctx).Post(requestURI.String())
+	version := h.resolveVersion(ctx)
+	request, err := h.newResourceRequest(ctx, version, resource)
+	if err != nil {
+		return fmt.Errorf("unable to write FHIR resource (path=%s): %w", requestURI, err)
+	}
+	resp, err := request.Post(requestURI.String())
 	if err != nil {
 		return fmt.Errorf("unable to write FHIR resource (path=%s): %w", requestURI, err)
 	}
 	if !resp.IsSuccess() {
 		logrus.WithField("func", "Create").Warnf("FHIR server replied: %s", resp.String())
-		return fmt.Errorf("unable to write FHIR resource (path=%s,http-status=%d): %s", requestURI, resp.StatusCode(), string(resp.Body()))
+		return newError("write FHIR resource", requestURI.String(), resp)
 	}
 	if result != nil {
-		return json.Unmarshal(resp.Body(), result)
+		return decode(version, resp.Body(), result)
 	}
 	return nil
 }
@@ -100,42 +141,159 @@ func (h httpClient) CreateOrUpdate(ctx context.Context, resource interface{}, re
 		return fmt.Errorf("unable to determine resource path: %w", err)
 	}
 	requestURI := h.BuildRequestURI(resourcePath)
-	resp, err := h.restClient.R().SetBody(resource).SetContext(ctx).Put(requestURI.String())
+	version := h.resolveVersion(ctx)
+	request, err := h.newResourceRequest(ctx, version, resource)
 	if err != nil {
 		return fmt.Errorf("unable to write FHIR resource (path=%s): %w", requestURI, err)
 	}
+	// a resource which has been read has a version, it is only updated if it hasn't been modified in the meantime
+	versionID := resolveVersionID(resource)
+	if versionID != "" {
+		request.SetHeader("If-Match", fmt.Sprintf(`W/"%s"`, versionID))
+	}
+	if err := h.checkOwnership(ctx, []string{resourcePath}); err != nil {
+		return err
+	}
+	resp, err := request.Put(requestURI.String())
+	if err != nil {
+		return fmt.Errorf("unable to write FHIR resource (path=%s): %w", requestURI, err)
+	}
+	if versionID != "" && (resp.StatusCode() == http.StatusPreconditionFailed || resp.StatusCode() == http.StatusConflict) {
+		return ConflictError{Path: resourcePath, Status: resp.StatusCode(), VersionID: versionID}
+	}
 	if !resp.IsSuccess() {
 		logrus.WithField("func", "CreateOrUpdate").Warnf("FHIR server replied: %s", resp.String())
-		return fmt.Errorf("unable to write FHIR resource (path=%s,http-status=%d): %s", requestURI, resp.StatusCode(), string(resp.Body()))
+		return newError("write FHIR resource", requestURI.String(), resp)
 	}
 	if result != nil {
-		return json.Unmarshal(resp.Body(), result)
+		return decode(version, resp.Body(), result)
 	}
 	return nil
 }
 
-func (h httpClient) ReadMultiple(ctx context.Context, path string, params map[string]string, results interface{}) error {
-	raw, err := h.getResource(ctx, path, params)
+func (h httpClient) Transaction(ctx context.Context, bundle resources.Bundle) ([]BundleEntryResult, error) {
+	results, entryErrors, err := h.postBundle(ctx, BundleTypeTransaction, bundle)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(entryErrors) > 0 {
+		// a transaction fails as a whole, so this only happens if the server doesn't follow the spec
+		return nil, fmt.Errorf("FHIR transaction failed: %w", BatchError{Entries: entryErrors})
+	}
+	return results, nil
+}
+
+func (h httpClient) Batch(ctx context.Context, bundle resources.Bundle) ([]BundleEntryResult, error) {
+	results, entryErrors, err := h.postBundle(ctx, BundleTypeBatch, bundle)
+	if err != nil {
+		return nil, err
+	}
+	if len(entryErrors) > 0 {
+		return results, BatchError{Entries: entryErrors}
+	}
+	return results, nil
+}
+
+func (h httpClient) postBundle(ctx context.Context, bundleType string, bundle resources.Bundle) ([]BundleEntryResult, []EntryError, error) {
+	bundle.ResourceType = "Bundle"
+	bundle.Type = ToCodePtr(bundleType)
+	requestURI := h.BuildRequestURI("")
+	version := h.resolveVersion(ctx)
+	restrictedBundle, err := restrictBundle(h.tenancy, h.tenant, bundle)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to post FHIR %s (path=%s): %w", bundleType, requestURI, err)
+	}
+	if err := h.checkOwnership(ctx, putPaths(bundle)); err != nil {
+		return nil, nil, err
 	}
-	resourcesJSON := raw.Get("entry.#.resource").String()
-	if resourcesJSON == "" {
-		resourcesJSON = "[]"
+	request, err := h.newRequest(ctx, version, restrictedBundle)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to post FHIR %s (path=%s): %w", bundleType, requestURI, err)
 	}
-	err = json.Unmarshal([]byte(resourcesJSON), results)
+	resp, err := request.Post(requestURI.String())
 	if err != nil {
-		logrus.WithField("func", "ReadMultiple").Warnf("FHIR server replied: %s", raw.String())
-		return fmt.Errorf("unable to unmarshal FHIR result (path=%s,target-type=%T): %w", path, results, err)
+		return nil, nil, fmt.Errorf("unable to post FHIR %s (path=%s): %w", bundleType, requestURI, err)
+	}
+	if !resp.IsSuccess() {
+		logrus.WithField("func", "postBundle").Warnf("FHIR server replied: %s", resp.String())
+		return nil, nil, newError("post FHIR "+bundleType, requestURI.String(), resp)
+	}
+	body := resp.Body()
+	if version == VersionR4 {
+		if body, err = FromR4(body); err != nil {
+			return nil, nil, err
+		}
+	}
+	return parseBundleResponse(bundle, body)
+}
+
+// checkOwnership returns an error if one of the resources (e.g. Patient/123) exists, but belongs to another tenant.
+// Writing a resource to its path would take it over, since the tenancy only restricts searches and conditional
+// operations.
+func (h httpClient) checkOwnership(ctx context.Context, resourcePaths []string) error {
+	if len(resourcePaths) == 0 || len(h.tenancy.SearchParams(h.tenant)) == 0 {
+		return nil
+	}
+	var resourceTypes []string
+	ids := map[string][]string{}
+	for _, resourcePath := range resourcePaths {
+		resourceType, id, _ := strings.Cut(resourcePath, "/")
+		if id == "" {
+			continue
+		}
+		if _, ok := ids[resourceType]; !ok {
+			resourceTypes = append(resourceTypes, resourceType)
+		}
+		ids[resourceType] = append(ids[resourceType], id)
+	}
+	for _, resourceType := range resourceTypes {
+		// the search isn't restricted to the tenant, so it also finds the resources of other tenants
+		params := map[string]string{"_id": strings.Join(ids[resourceType], ","), "_count": strconv.Itoa(len(ids[resourceType]))}
+		bundle, err := h.getResource(ctx, resourceType, params)
+		if err != nil {
+			return err
+		}
+		for _, resource := range bundle.Get("entry.#.resource").Array() {
+			if !h.tenancy.Owns(h.tenant, resource) {
+				return Error{
+					Operation: "write FHIR resource",
+					Path:      resourceType + "/" + resource.Get("id").String(),
+					Status:    http.StatusForbidden,
+					Issues:    []Issue{{Severity: "error", Code: "forbidden", Diagnostics: "the resource belongs to another tenant"}},
+				}
+			}
+		}
 	}
 	return nil
 }
 
+func (h httpClient) ReadMultiple(ctx context.Context, path string, params map[string]string, results interface{}, opts ...ReadOpt) error {
+	return readAll(h.Iterate(ctx, path, params, opts...), results)
+}
+
+func (h httpClient) Iterate(ctx context.Context, path string, params map[string]string, opts ...ReadOpt) *Iterator {
+	iterator := newIterator(ctx, h.getResource, path, withSearchParams(h.tenancy, h.tenant, params), opts)
+	// the server should only return the resources of the tenant, but it might not support the search parameters
+	iterator.accept = func(resource gjson.Result) bool {
+		return h.tenancy.Owns(h.tenant, resource)
+	}
+	iterator.base = h.BuildRequestURI("")
+	if iterator.options.page != "" {
+		// the page has been passed around, so it's rebased like a next link
+		iterator.nextPath, iterator.err = rebase(iterator.base, iterator.options.page)
+	}
+	return iterator
+}
+
 func (h httpClient) ReadOne(ctx context.Context, path string, result interface{}) error {
 	raw, err := h.getResource(ctx, path, nil)
 	if err != nil {
 		return err
 	}
+	if !h.tenancy.Owns(h.tenant, raw) {
+		// resources of other tenants are treated as if they don't exist
+		return Error{Operation: "read FHIR resource", Path: path, Status: http.StatusNotFound}
+	}
 	err = json.Unmarshal([]byte(raw.String()), &result)
 	if err != nil {
 		logrus.WithField("func", "ReadOne").Warnf("FHIR server replied: %s", raw.String())
@@ -144,6 +302,41 @@ func (h httpClient) ReadOne(ctx context.Context, path string, result interface{}
 	return nil
 }
 
+func (h httpClient) Delete(ctx context.Context, path string) error {
+	if len(h.tenancy.SearchParams(h.tenant)) > 0 {
+		// only delete the resource if it's the tenant's
+		resourceType, id, _ := strings.Cut(path, "/")
+		return h.DeleteWhere(ctx, resourceType, map[string]string{"_id": id})
+	}
+	requestURI := h.BuildRequestURI(path)
+	resp, err := h.restClient.R().SetContext(ctx).Delete(requestURI.String())
+	if err != nil {
+		return fmt.Errorf("unable to delete FHIR resource (path=%s): %w", requestURI, err)
+	}
+	if !resp.IsSuccess() {
+		logrus.WithField("func", "Delete").Warnf("FHIR server replied: %s", resp.String())
+		return newError("delete FHIR resource", requestURI.String(), resp)
+	}
+	return nil
+}
+
+func (h httpClient) DeleteWhere(ctx context.Context, resourceType string, params map[string]string) error {
+	if len(params) == 0 {
+		// without parameters the server would delete all resources of the type
+		return fmt.Errorf("unable to delete FHIR resources (type=%s): no search parameters", resourceType)
+	}
+	requestURI := h.BuildRequestURI(resourceType)
+	resp, err := h.restClient.R().SetContext(ctx).SetQueryParams(withSearchParams(h.tenancy, h.tenant, params)).Delete(requestURI.String())
+	if err != nil {
+		return fmt.Errorf("unable to delete FHIR resources (path=%s): %w", requestURI, err)
+	}
+	if !resp.IsSuccess() {
+		logrus.WithField("func", "DeleteWhere").Warnf("FHIR server replied: %s", resp.String())
+		return newError("delete FHIR resources", requestURI.String(), resp)
+	}
+	return nil
+}
+
 func (h httpClient) getResource(ctx context.Context, path string, params map[string]string) (gjson.Result, error) {
 	requestURL := h.BuildRequestURI(path)
 	logrus.Debugf("Performing FHIR request with url: %s", requestURL)
@@ -154,25 +347,95 @@ func (h httpClient) getResource(ctx context.Context, path string, params map[str
 
 	if !resp.IsSuccess() {
 		logrus.WithField("func", "getResource").Warnf("FHIR server replied: %s", resp.String())
-		return gjson.Result{}, fmt.Errorf("unable to read FHIR resource (path=%s,http-status=%d)", path, resp.StatusCode())
+		return gjson.Result{}, newError("read FHIR resource", path, resp)
 	}
 
 	body := resp.Body()
 	logrus.Debugf("FHIR response: %s", body)
+	if h.resolveVersion(ctx) == VersionR4 {
+		if body, err = FromR4(body); err != nil {
+			return gjson.Result{}, err
+		}
+	}
+	// not every server puts the version of a resource in its meta, it's always in the ETag
+	if etag := resp.Header().Get("ETag"); etag != "" && !gjson.GetBytes(body, "meta.versionId").Exists() {
+		if body, err = setVersionID(body, parseETag(etag)); err != nil {
+			return gjson.Result{}, fmt.Errorf("unable to read FHIR resource (path=%s): %w", path, err)
+		}
+	}
 	return gjson.ParseBytes(body), nil
 }
 
+// newResourceRequest creates a request with the resource as body, stamped as resource of the tenant.
+func (h httpClient) newResourceRequest(ctx context.Context, version Version, resource interface{}) (*resty.Request, error) {
+	body, err := stamp(h.tenancy, h.tenant, resource)
+	if err != nil {
+		return nil, err
+	}
+	return h.newRequest(ctx, version, body)
+}
+
+// newRequest creates a request with the resource as body, converted to the FHIR version of the server.
+func (h httpClient) newRequest(ctx context.Context, version Version, resource interface{}) (*resty.Request, error) {
+	request := h.restClient.R().SetContext(ctx)
+	if version != VersionR4 {
+		return request.SetBody(resource), nil
+	}
+	body, err := ToR4(resource)
+	if err != nil {
+		return nil, err
+	}
+	return request.SetHeader("Content-Type", "application/fhir+json; fhirVersion=4.0").SetBody(body), nil
+}
+
+// resolveVersion returns the FHIR version of the server. If it isn't configured, it's read from the fhirVersion
+// of the server's CapabilityStatement, requested with the access token of the client since the server might be behind
+// a PEP. If that fails the server is assumed to speak STU3, until the negotiation is retried after negotiationRetryInterval.
+func (h httpClient) resolveVersion(ctx context.Context) Version {
+	if h.version != "" {
+		return h.version
+	}
+	metadataURI := h.BuildRequestURI("metadata").String()
+	if cached, ok := negotiatedVersions.Load(metadataURI); ok {
+		if negotiated := cached.(negotiatedVersion); negotiated.retryAfter.IsZero() || time.Now().Before(negotiated.retryAfter) {
+			return negotiated.version
+		}
+	}
+	resp, err := h.restClient.R().SetContext(ctx).SetHeader("Accept", "application/fhir+json").Get(metadataURI)
+	if err == nil && !resp.IsSuccess() {
+		err = fmt.Errorf("http-status=%d", resp.StatusCode())
+	}
+	var version Version
+	if err == nil {
+		version, err = versionOf(gjson.GetBytes(resp.Body(), "fhirVersion").String())
+	}
+	if err != nil {
+		logrus.Warnf("Unable to negotiate FHIR version, assuming STU3 (url=%s): %s", metadataURI, err)
+		negotiatedVersions.Store(metadataURI, negotiatedVersion{version: VersionSTU3, retryAfter: time.Now().Add(negotiationRetryInterval)})
+		return VersionSTU3
+	}
+	negotiatedVersions.Store(metadataURI, negotiatedVersion{version: version})
+	return version
+}
+
+// decode unmarshals the response body of the server into the result, converting it to STU3 if the server speaks R4.
+func decode(version Version, data []byte, result interface{}) error {
+	if version == VersionR4 {
+		var err error
+		if data, err = FromR4(data); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, result)
+}
+
 func (h httpClient) BuildRequestURI(fhirResourcePath string) *url.URL {
 	var requestURL *url.URL
 	if strings.HasPrefix(fhirResourcePath, "http://") ||
 		strings.HasPrefix(fhirResourcePath, "https://") {
 		requestURL, _ = url.Parse(fhirResourcePath)
 	} else {
-		var tenant string
-		if h.multiTenancyEnabled {
-			tenant = h.tenant
-		}
-		return buildRequestURI(h.url, tenant, fhirResourcePath)
+		return h.tenancy.RequestURI(h.url, h.tenant, fhirResourcePath)
 	}
 	return requestURL
 }
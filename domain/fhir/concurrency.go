@@ -0,0 +1,78 @@
+package fhir
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// maxConflictRetries is the number of times RetryOnConflict retries an update which conflicts with a concurrent update.
+const maxConflictRetries = 3
+
+// ConflictError is returned by CreateOrUpdate when the resource has been modified after it was read: the version in
+// its meta.versionId (sent as If-Match) isn't the current version on the FHIR server anymore.
+type ConflictError struct {
+	// Path is the path of the resource, e.g. Task/123
+	Path string
+	// Status is the HTTP status code returned by the server: 412 (Precondition Failed) or 409 (Conflict).
+	Status int
+	// VersionID is the version of the resource the update was based on.
+	VersionID string
+}
+
+func (e ConflictError) Error() string {
+	return fmt.Sprintf("FHIR resource has been modified concurrently (path=%s,version=%s,http-status=%d)", e.Path, e.VersionID, e.Status)
+}
+
+// IsConflict returns whether the error (or one of the errors it wraps) is a ConflictError.
+func IsConflict(err error) bool {
+	var conflictErr ConflictError
+	return errors.As(err, &conflictErr)
+}
+
+// RetryOnConflict calls the update function, which should read the resource, modify it and write it back.
+// If writing fails because the resource was modified concurrently, the update function is called again so the
+// modification is applied to the fresh version. Other errors are returned immediately.
+func RetryOnConflict(update func() error) error {
+	var err error
+	for attempt := 0; attempt <= maxConflictRetries; attempt++ {
+		if err = update(); !IsConflict(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// resolveVersionID returns the meta.versionId of the resource, or an empty string if it isn't set.
+func resolveVersionID(resource interface{}) string {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return ""
+	}
+	return gjson.GetBytes(data, "meta.versionId").String()
+}
+
+// parseETag returns the version of an ETag header, e.g. 3 for W/"3"
+func parseETag(etag string) string {
+	return strings.Trim(strings.TrimPrefix(strings.TrimSpace(etag), "W/"), `"`)
+}
+
+// setVersionID sets the meta.versionId of a resource, keeping the other properties of the resource as they are.
+func setVersionID(resourceJSON []byte, versionID string) ([]byte, error) {
+	resource := map[string]json.RawMessage{}
+	if err := json.Unmarshal(resourceJSON, &resource); err != nil {
+		return nil, err
+	}
+	meta := map[string]json.RawMessage{}
+	if data, ok := resource["meta"]; ok {
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, err
+		}
+	}
+	meta["versionId"], _ = json.Marshal(versionID)
+	resource["meta"], _ = json.Marshal(meta)
+	return json.Marshal(resource)
+}
@@ -0,0 +1,97 @@
+package fhir
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClient_CreateOrUpdate_IfMatch(t *testing.T) {
+	var ifMatch string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet:
+			writer.Header().Set("ETag", `W/"2"`)
+			_, _ = writer.Write([]byte(`{"resourceType":"Task","id":"1","status":"requested"}`))
+		case http.MethodPut:
+			ifMatch = request.Header.Get("If-Match")
+			body, _ := io.ReadAll(request.Body)
+			if ifMatch != "" && ifMatch != `W/"2"` {
+				writer.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			_, _ = writer.Write(body)
+		}
+	}))
+	defer server.Close()
+	client := NewFactory(WithURL(server.URL), WithVersion(VersionSTU3))()
+
+	t.Run("version is read from the ETag and sent as If-Match", func(t *testing.T) {
+		task := resources.Task{}
+		if !assert.NoError(t, client.ReadOne(context.Background(), "Task/1", &task)) {
+			return
+		}
+		assert.Equal(t, "2", FromIDPtr(task.Meta.VersionID))
+
+		err := client.CreateOrUpdate(context.Background(), task, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, `W/"2"`, ifMatch)
+	})
+	t.Run("modified resource", func(t *testing.T) {
+		task := resources.Task{}
+		_ = client.ReadOne(context.Background(), "Task/1", &task)
+		task.Meta.VersionID = ToIDPtr("1")
+
+		err := client.CreateOrUpdate(context.Background(), task, nil)
+
+		assert.True(t, IsConflict(err))
+		assert.Equal(t, ConflictError{Path: "Task/1", Status: http.StatusPreconditionFailed, VersionID: "1"}, err)
+	})
+	t.Run("unversioned resource is written without If-Match", func(t *testing.T) {
+		task := resources.Task{Domain: resources.Domain{Base: resources.Base{ResourceType: "Task", ID: ToIDPtr("1")}}}
+
+		err := client.CreateOrUpdate(context.Background(), task, nil)
+
+		assert.NoError(t, err)
+		assert.Empty(t, ifMatch)
+	})
+}
+
+func TestRetryOnConflict(t *testing.T) {
+	t.Run("retried until there's no conflict", func(t *testing.T) {
+		calls := 0
+		err := RetryOnConflict(func() error {
+			calls++
+			if calls < 3 {
+				return ConflictError{}
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+	t.Run("gives up after the maximum number of retries", func(t *testing.T) {
+		calls := 0
+		err := RetryOnConflict(func() error {
+			calls++
+			return ConflictError{}
+		})
+		assert.True(t, IsConflict(err))
+		assert.Equal(t, maxConflictRetries+1, calls)
+	})
+	t.Run("other errors aren't retried", func(t *testing.T) {
+		calls := 0
+		err := RetryOnConflict(func() error {
+			calls++
+			return io.EOF
+		})
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, 1, calls)
+	})
+}
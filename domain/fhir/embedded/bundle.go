@@ -0,0 +1,123 @@
+package embedded
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// processBundle processes a transaction or batch Bundle. The entries of a transaction are processed completely or not
+// at all, the entries of a batch are processed independently.
+func (p *partition) processBundle(body []byte) ([]byte, *operationError) {
+	bundle := gjson.ParseBytes(body)
+	if bundle.Get("resourceType").String() != "Bundle" {
+		return nil, newError(http.StatusBadRequest, "expected a Bundle, not %s", bundle.Get("resourceType").String())
+	}
+	bundleType := bundle.Get("type").String()
+	if bundleType != "transaction" && bundleType != "batch" {
+		return nil, newError(http.StatusBadRequest, "unsupported Bundle type: %s", bundleType)
+	}
+	transaction := bundleType == "transaction"
+
+	snapshot := p.snapshot()
+	rollback := func() {
+		p.resources = snapshot.resources
+		p.deleted = snapshot.deleted
+	}
+	var responseEntries []map[string]interface{}
+	for i, entry := range bundle.Get("entry").Array() {
+		response, err := p.processEntry(entry, transaction)
+		if err != nil && transaction {
+			rollback()
+			return nil, newError(err.status, "entry %d (url=%s) failed: %s", i, entry.Get("request.url").String(), err.diagnostics)
+		}
+		if err != nil {
+			response = map[string]interface{}{
+				"status":  statusLine(err.status),
+				"outcome": json.RawMessage(operationOutcome(err.diagnostics)),
+			}
+		}
+		responseEntries = append(responseEntries, map[string]interface{}{"response": response})
+	}
+	if transaction {
+		// resources may be deleted together with the resources referring to them, so references are checked afterwards
+		for path := range snapshot.resources {
+			if _, exists := p.resources[path]; exists {
+				continue
+			}
+			if err := p.checkReferences(path); err != nil {
+				rollback()
+				return nil, err
+			}
+		}
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"resourceType": "Bundle",
+		"type":         bundleType + "-response",
+		"entry":        responseEntries,
+	})
+	return data, nil
+}
+
+// processEntry processes a PUT, POST or DELETE entry of a Bundle and returns its response. The references to resources
+// deleted by a transaction are checked after all entries have been processed, since the resources referring to them
+// may be deleted by the same transaction.
+func (p *partition) processEntry(entry gjson.Result, transaction bool) (map[string]interface{}, *operationError) {
+	method := entry.Get("request.method").String()
+	entryURL := strings.TrimPrefix(entry.Get("request.url").String(), "/")
+	entryPath, rawQuery, _ := strings.Cut(entryURL, "?")
+	resourceType, id, _ := strings.Cut(entryPath, "/")
+	if !resourceTypePattern.MatchString(resourceType) {
+		return nil, newError(http.StatusBadRequest, "invalid entry URL: %s", entryURL)
+	}
+
+	var result *readResult
+	var err *operationError
+	switch {
+	case method == http.MethodPost && id == "":
+		result, err = p.create(resourceType, []byte(entry.Get("resource").Raw), entry.Get("request.ifNoneExist").String())
+	case method == http.MethodPut && id != "":
+		result, err = p.update(resourceType, id, []byte(entry.Get("resource").Raw), entry.Get("request.ifMatch").String())
+	case method == http.MethodDelete:
+		paths := []string{entryPath}
+		if id == "" {
+			query, parseErr := url.ParseQuery(rawQuery)
+			if parseErr != nil {
+				return nil, newError(http.StatusBadRequest, "invalid entry URL: %s", parseErr)
+			}
+			if paths, err = p.findOne(resourceType, query); err != nil {
+				return nil, err
+			}
+		}
+		for _, path := range paths {
+			if !transaction {
+				if err = p.checkReferences(path); err != nil {
+					return nil, err
+				}
+			}
+			p.remove(path)
+		}
+		return map[string]interface{}{"status": statusLine(http.StatusNoContent)}, nil
+	default:
+		return nil, newError(http.StatusBadRequest, "unsupported entry (method=%s,url=%s)", method, entryURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resource := gjson.ParseBytes(result.resource)
+	versionID := resource.Get("meta.versionId").String()
+	return map[string]interface{}{
+		"status":   statusLine(result.status),
+		"location": fmt.Sprintf("%s/%s/_history/%s", resourceType, resource.Get("id").String(), versionID),
+		"etag":     fmt.Sprintf(`W/"%s"`, versionID),
+	}, nil
+}
+
+// statusLine returns the status of a Bundle entry response, e.g. "201 Created"
+func statusLine(status int) string {
+	return fmt.Sprintf("%d %s", status, http.StatusText(status))
+}
@@ -0,0 +1,283 @@
+package embedded
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// defaultPageSize is the number of resources in a page of search results if the client doesn't specify _count.
+const defaultPageSize = 20
+
+type parameterKind int
+
+const (
+	tokenParameter parameterKind = iota
+	identifierParameter
+	nameParameter
+	referenceParameter
+	codingParameter
+	stringParameter
+	dateParameter
+)
+
+// searchParameter describes on which elements of a resource a search parameter is evaluated.
+type searchParameter struct {
+	kind  parameterKind
+	paths []string
+}
+
+// searchParameters contains the search parameters the demo EHR uses. Searching with other parameters fails, so a
+// new usage is noticed instead of silently returning too many resources.
+var searchParameters = map[string]searchParameter{
+	"_id":        {kind: tokenParameter, paths: []string{"id"}},
+	"identifier": {kind: identifierParameter, paths: []string{"identifier"}},
+	"name":       {kind: nameParameter, paths: []string{"name"}},
+	"status":     {kind: tokenParameter, paths: []string{"status"}},
+	"subject":    {kind: referenceParameter, paths: []string{"subject.reference"}},
+	"patient":    {kind: referenceParameter, paths: []string{"patient.reference", "subject.reference", "for.reference"}},
+	"context":    {kind: referenceParameter, paths: []string{"context.reference"}},
+	"_tag":       {kind: codingParameter, paths: []string{"meta.tag"}},
+	"gender":     {kind: tokenParameter, paths: []string{"gender"}},
+	"birthdate":  {kind: dateParameter, paths: []string{"birthDate"}},
+
+	"address-postalcode": {kind: stringParameter, paths: []string{"address.#.postalCode"}},
+}
+
+// sortParameters contains the search parameters by which results can be sorted (_sort), with the element they sort on.
+var sortParameters = map[string]string{
+	"_id":       "id",
+	"family":    "name.0.family",
+	"given":     "name.0.given.0",
+	"birthdate": "birthDate",
+}
+
+// resultParameters control the result of a search instead of selecting resources.
+var resultParameters = map[string]bool{"_count": true, "_offset": true, "_getpagesoffset": true, "_sort": true, "_format": true, "_pretty": true}
+
+// search returns a searchset Bundle with a page of the resources matching the query. The Bundle links to the next
+// page, which is selected with _offset.
+func (p *partition) search(base, resourceType string, query url.Values) ([]byte, *operationError) {
+	matches, err := p.find(resourceType, query)
+	if err != nil {
+		return nil, err
+	}
+	if value := query.Get("_sort"); value != "" {
+		if err := sortResources(matches, value); err != nil {
+			return nil, err
+		}
+	}
+	count, offset := defaultPageSize, 0
+	if value := query.Get("_count"); value != "" {
+		if count, _ = strconv.Atoi(value); count <= 0 {
+			return nil, newError(http.StatusBadRequest, "invalid _count: %s", value)
+		}
+	}
+	for _, name := range []string{"_offset", "_getpagesoffset"} {
+		if value := query.Get(name); value != "" {
+			if offset, _ = strconv.Atoi(value); offset < 0 {
+				return nil, newError(http.StatusBadRequest, "invalid %s: %s", name, value)
+			}
+		}
+	}
+
+	entries := []map[string]interface{}{}
+	for i := offset; i < offset+count && i < len(matches); i++ {
+		entries = append(entries, map[string]interface{}{
+			"fullUrl":  base + "/" + resourceType + "/" + matches[i].Get("id").String(),
+			"resource": json.RawMessage(matches[i].Raw),
+			"search":   map[string]string{"mode": "match"},
+		})
+	}
+	links := []map[string]string{{"relation": "self", "url": pageURL(base, resourceType, query, offset)}}
+	if offset+count < len(matches) {
+		links = append(links, map[string]string{"relation": "next", "url": pageURL(base, resourceType, query, offset+count)})
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"resourceType": "Bundle",
+		"type":         "searchset",
+		"total":        len(matches),
+		"link":         links,
+		"entry":        entries,
+	})
+	return data, nil
+}
+
+func pageURL(base, resourceType string, query url.Values, offset int) string {
+	pageQuery := url.Values{}
+	for name, values := range query {
+		if name != "_getpagesoffset" {
+			pageQuery[name] = values
+		}
+	}
+	pageQuery.Set("_offset", strconv.Itoa(offset))
+	return base + "/" + resourceType + "?" + pageQuery.Encode()
+}
+
+// sortResources sorts the resources by a comma separated list of sort parameters, each of which sorts in descending
+// order if it's prefixed with a minus sign (e.g. family,-birthdate). Resources without the element come last.
+func sortResources(matches []gjson.Result, value string) *operationError {
+	type sortKey struct {
+		path       string
+		descending bool
+	}
+	var keys []sortKey
+	for _, name := range strings.Split(value, ",") {
+		descending := strings.HasPrefix(name, "-")
+		path, ok := sortParameters[strings.TrimPrefix(name, "-")]
+		if !ok {
+			return newError(http.StatusBadRequest, "unsupported sort parameter: %s", name)
+		}
+		keys = append(keys, sortKey{path: path, descending: descending})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		for _, key := range keys {
+			left, right := matches[i].Get(key.path), matches[j].Get(key.path)
+			if left.Exists() != right.Exists() {
+				return left.Exists()
+			}
+			if comparison := strings.Compare(strings.ToLower(left.String()), strings.ToLower(right.String())); comparison != 0 {
+				return (comparison < 0) != key.descending
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// find returns the resources of the given type matching all search parameters of the query. Values of a parameter
+// separated by a comma match if any of them matches, a parameter which occurs multiple times must match every time.
+func (p *partition) find(resourceType string, query url.Values) ([]gjson.Result, *operationError) {
+	var matches []gjson.Result
+	for _, path := range p.paths(resourceType) {
+		resource := gjson.ParseBytes(p.resources[path])
+		match := true
+		for name, values := range query {
+			if resultParameters[name] {
+				continue
+			}
+			for _, value := range values {
+				ok, err := p.matches(resource, name, value)
+				if err != nil {
+					return nil, err
+				}
+				match = match && ok
+			}
+		}
+		if match {
+			matches = append(matches, resource)
+		}
+	}
+	return matches, nil
+}
+
+// matches evaluates a search parameter on the resource. The parameter may have a modifier (e.g. name:missing) or be
+// chained (e.g. patient.identifier).
+func (p *partition) matches(resource gjson.Result, name, value string) (bool, *operationError) {
+	name, modifier, _ := strings.Cut(name, ":")
+	name, chained, isChained := strings.Cut(name, ".")
+	parameter, ok := searchParameters[name]
+	if !ok || (isChained && (parameter.kind != referenceParameter || chained != "identifier")) {
+		return false, newError(http.StatusBadRequest, "unsupported search parameter: %s", name)
+	}
+	var actual []gjson.Result
+	for _, path := range parameter.paths {
+		actual = append(actual, flatten(resource.Get(path))...)
+	}
+
+	switch modifier {
+	case "":
+	case "missing":
+		return (len(actual) == 0) == (value == "true"), nil
+	case "above":
+		// a string can't be above a value in FHIR, the patient list uses name:above=_ (like on HAPI) to leave out
+		// the anonymous patients of advance notices, so it selects resources which have a value.
+		if parameter.kind == nameParameter {
+			return len(actual) > 0, nil
+		}
+		fallthrough
+	default:
+		return false, newError(http.StatusBadRequest, "unsupported modifier of search parameter %s: %s", name, modifier)
+	}
+
+	for _, alternative := range strings.Split(value, ",") {
+		if isChained {
+			// the referenced resources must be patients with the identifier
+			patients, err := p.find("Patient", url.Values{"identifier": []string{alternative}})
+			if err != nil {
+				return false, err
+			}
+			for _, patient := range patients {
+				for _, reference := range actual {
+					if refersTo(reference.String(), "Patient/"+patient.Get("id").String()) {
+						return true, nil
+					}
+				}
+			}
+			continue
+		}
+		for _, candidate := range actual {
+			if matchesValue(parameter.kind, candidate, alternative) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func matchesValue(kind parameterKind, actual gjson.Result, value string) bool {
+	switch kind {
+	case identifierParameter, codingParameter:
+		valuePath := "value"
+		if kind == codingParameter {
+			valuePath = "code"
+		}
+		system, code, hasSystem := strings.Cut(value, "|")
+		if !hasSystem {
+			return actual.Get(valuePath).String() == value
+		}
+		return (system == "" || actual.Get("system").String() == system) && (code == "" || actual.Get(valuePath).String() == code)
+	case nameParameter:
+		// names match if a part of it starts with the value, ignoring case
+		var parts []string
+		for _, part := range append(flatten(actual.Get("given")), actual.Get("family"), actual.Get("text")) {
+			parts = append(parts, strings.Fields(part.String())...)
+		}
+		parts = append(parts, actual.Get("family").String(), actual.Get("text").String())
+		for _, part := range parts {
+			if part != "" && strings.HasPrefix(strings.ToLower(part), strings.ToLower(value)) {
+				return true
+			}
+		}
+		return false
+	case stringParameter:
+		// strings match if they start with the value, ignoring case
+		return strings.HasPrefix(strings.ToLower(actual.String()), strings.ToLower(value))
+	case dateParameter:
+		// only equality is supported, a date matches if it's within the precision of the value (e.g. 1980 or 1980-05)
+		return strings.HasPrefix(actual.String(), strings.TrimPrefix(value, "eq"))
+	case referenceParameter:
+		if strings.Contains(value, "/") {
+			return refersTo(actual.String(), strings.TrimPrefix(value, "/"))
+		}
+		return strings.HasSuffix(actual.String(), "/"+value)
+	default:
+		return actual.String() == value
+	}
+}
+
+// flatten returns the elements of an array, or the value itself if it isn't an array.
+func flatten(value gjson.Result) []gjson.Result {
+	if !value.Exists() {
+		return nil
+	}
+	if value.IsArray() {
+		return value.Array()
+	}
+	return []gjson.Result{value}
+}
@@ -0,0 +1,274 @@
+// Package embedded contains an in-memory FHIR server which stands in for a HAPI FHIR server when running the demo EHR
+// or tests. It implements the subset of FHIR STU3 the demo EHR uses:
+//   - read, create, update (with If-Match) and delete (conditional and with referential integrity) of any resource type,
+//   - searching with the search parameters the demo EHR uses (see searchParameters), with paging,
+//   - transaction and batch Bundles,
+//   - partitions for multi-tenancy: the tenant is the first path segment, like HAPI's URL based partitioning.
+//
+// Resources are kept in memory, so they are lost when the server stops. In Go tests it can be started with httptest:
+//
+//	server := httptest.NewServer(embedded.NewServer())
+//	defer server.Close()
+//	client := fhir.NewFactory(fhir.WithURL(server.URL))()
+package embedded
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+)
+
+// DefaultPartition is the partition of requests which don't specify a tenant.
+const DefaultPartition = "DEFAULT"
+
+// fhirVersion is the FHIR version the server advertises in its CapabilityStatement.
+const fhirVersion = "3.0.2"
+
+// resourceTypePattern matches resource types (e.g. Patient or EpisodeOfCare), so they can be told apart from tenants.
+var resourceTypePattern = regexp.MustCompile(`^[A-Z][a-z][A-Za-z]*$`)
+
+// Server is an in-memory FHIR server, it is safe for concurrent use.
+type Server struct {
+	mux        sync.Mutex
+	partitions map[string]*partition
+}
+
+// partition contains the resources of a tenant.
+type partition struct {
+	// resources contains the current version of the resources by path, e.g. Patient/123
+	resources map[string]json.RawMessage
+	// deleted contains the paths of deleted resources, reading them results in 410 Gone like on HAPI.
+	deleted map[string]bool
+}
+
+// NewServer creates an empty in-memory FHIR server.
+func NewServer() *Server {
+	return &Server{partitions: map[string]*partition{}}
+}
+
+// operationError is an error which is returned to the client as OperationOutcome with the given HTTP status code.
+type operationError struct {
+	status      int
+	diagnostics string
+}
+
+func (e operationError) Error() string {
+	return e.diagnostics
+}
+
+func newError(status int, format string, args ...interface{}) *operationError {
+	return &operationError{status: status, diagnostics: fmt.Sprintf(format, args...)}
+}
+
+// request is a parsed FHIR request.
+type request struct {
+	tenant       string
+	resourceType string
+	id           string
+	query        url.Values
+	// base is the absolute URL of the partition, used for the links and locations in responses
+	base string
+}
+
+func (s *Server) ServeHTTP(writer http.ResponseWriter, httpRequest *http.Request) {
+	req, err := parseRequest(httpRequest)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	if req.resourceType == "metadata" {
+		writeJSON(writer, http.StatusOK, capabilityStatement())
+		return
+	}
+	body, readErr := io.ReadAll(httpRequest.Body)
+	if readErr != nil {
+		writeError(writer, newError(http.StatusBadRequest, "unable to read request body: %s", readErr))
+		return
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	p := s.partition(req.tenant)
+	switch {
+	case req.resourceType == "" && httpRequest.Method == http.MethodPost:
+		response, err := p.processBundle(body)
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+		writeJSON(writer, http.StatusOK, response)
+	case req.resourceType == "":
+		writeError(writer, newError(http.StatusMethodNotAllowed, "%s isn't supported on the server base", httpRequest.Method))
+	case req.id == "" && httpRequest.Method == http.MethodGet:
+		bundle, err := p.search(req.base, req.resourceType, req.query)
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+		writeJSON(writer, http.StatusOK, bundle)
+	case req.id == "" && httpRequest.Method == http.MethodPost:
+		result, err := p.create(req.resourceType, body, httpRequest.Header.Get("If-None-Exist"))
+		writeResult(writer, req, result, err)
+	case req.id == "" && httpRequest.Method == http.MethodDelete:
+		if err := p.deleteWhere(req.resourceType, req.query); err != nil {
+			writeError(writer, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	case req.id == "":
+		writeError(writer, newError(http.StatusMethodNotAllowed, "%s isn't supported on resource types", httpRequest.Method))
+	case httpRequest.Method == http.MethodGet:
+		result, err := p.read(req.resourceType, req.id)
+		writeResult(writer, req, result, err)
+	case httpRequest.Method == http.MethodPut:
+		result, err := p.update(req.resourceType, req.id, body, httpRequest.Header.Get("If-Match"))
+		writeResult(writer, req, result, err)
+	case httpRequest.Method == http.MethodDelete:
+		if err := p.delete(req.resourceType + "/" + req.id); err != nil {
+			writeError(writer, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(writer, newError(http.StatusMethodNotAllowed, "%s isn't supported on resources", httpRequest.Method))
+	}
+}
+
+// Resources returns the paths of the resources of the given type in the partition of the tenant, e.g. for asserting
+// in tests. Use DefaultPartition if the client isn't configured for multi-tenancy.
+func (s *Server) Resources(tenant, resourceType string) []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.partition(tenant).paths(resourceType)
+}
+
+// partition returns the partition of the tenant, it's created when the tenant is first used.
+func (s *Server) partition(tenant string) *partition {
+	p, ok := s.partitions[tenant]
+	if !ok {
+		p = &partition{resources: map[string]json.RawMessage{}, deleted: map[string]bool{}}
+		s.partitions[tenant] = p
+	}
+	return p
+}
+
+// writeResult writes a read or written resource with its version as ETag.
+func writeResult(writer http.ResponseWriter, req request, result *readResult, err *operationError) {
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	resource := gjson.ParseBytes(result.resource)
+	versionID := resource.Get("meta.versionId").String()
+	writer.Header().Set("ETag", fmt.Sprintf(`W/"%s"`, versionID))
+	if result.status != http.StatusOK || req.id == "" {
+		writer.Header().Set("Location", fmt.Sprintf("%s/%s/%s/_history/%s", req.base, resource.Get("resourceType").String(), resource.Get("id").String(), versionID))
+	}
+	writeJSON(writer, result.status, result.resource)
+}
+
+// parseRequest resolves the tenant, resource type and ID from the path. The first segment is the tenant if it isn't
+// a resource type (e.g. /1/Patient/123), otherwise the request is for the default partition (e.g. /Patient/123).
+func parseRequest(httpRequest *http.Request) (request, *operationError) {
+	path := httpRequest.URL.Path
+	query := httpRequest.URL.Query()
+	// a search can be part of the (escaped) path, e.g. /Patient%3Fidentifier=123
+	if pathPart, queryPart, ok := strings.Cut(path, "?"); ok {
+		path = pathPart
+		extraQuery, err := url.ParseQuery(queryPart)
+		if err != nil {
+			return request{}, newError(http.StatusBadRequest, "invalid query: %s", err)
+		}
+		for name, values := range extraQuery {
+			query[name] = append(query[name], values...)
+		}
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if segments[0] == "" {
+		segments = nil
+	}
+	req := request{tenant: DefaultPartition, query: query}
+	if len(segments) > 0 && segments[0] != "metadata" && !resourceTypePattern.MatchString(segments[0]) {
+		req.tenant = segments[0]
+		segments = segments[1:]
+	}
+	req.base = requestBase(httpRequest, segments)
+	switch len(segments) {
+	case 0:
+	case 1:
+		req.resourceType = segments[0]
+	case 2:
+		req.resourceType, req.id = segments[0], segments[1]
+	default:
+		return request{}, newError(http.StatusBadRequest, "unsupported path: %s", path)
+	}
+	if req.resourceType != "" && req.resourceType != "metadata" && !resourceTypePattern.MatchString(req.resourceType) {
+		return request{}, newError(http.StatusBadRequest, "invalid resource type: %s", req.resourceType)
+	}
+	return req, nil
+}
+
+// requestBase returns the absolute URL of the partition, including the prefix the server is mounted on (if any).
+func requestBase(httpRequest *http.Request, segments []string) string {
+	scheme := "http"
+	if httpRequest.TLS != nil {
+		scheme = "https"
+	}
+	requestPath := strings.SplitN(httpRequest.RequestURI, "?", 2)[0]
+	if unescaped, err := url.PathUnescape(requestPath); err == nil {
+		requestPath = strings.SplitN(unescaped, "?", 2)[0]
+	}
+	requestPath = strings.TrimSuffix(requestPath, "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		requestPath = strings.TrimSuffix(requestPath, "/"+segments[i])
+	}
+	return scheme + "://" + httpRequest.Host + requestPath
+}
+
+func capabilityStatement() []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"resourceType": "CapabilityStatement",
+		"status":       "active",
+		"date":         time.Now().Format("2006-01-02"),
+		"kind":         "instance",
+		"fhirVersion":  fhirVersion,
+		"format":       []string{"application/fhir+json"},
+		"software":     map[string]string{"name": "Nuts demo EHR embedded FHIR server"},
+	})
+	return data
+}
+
+func writeJSON(writer http.ResponseWriter, status int, body []byte) {
+	writer.Header().Set("Content-Type", "application/fhir+json")
+	writer.WriteHeader(status)
+	_, _ = writer.Write(body)
+}
+
+func writeError(writer http.ResponseWriter, err *operationError) {
+	writeJSON(writer, err.status, operationOutcome(err.diagnostics))
+}
+
+func operationOutcome(diagnostics string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"resourceType": "OperationOutcome",
+		"issue": []map[string]string{{
+			"severity":    "error",
+			"code":        "processing",
+			"diagnostics": diagnostics,
+		}},
+	})
+	return data
+}
+
+func newID() string {
+	return uuid.NewString()
+}
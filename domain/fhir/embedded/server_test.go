@@ -0,0 +1,317 @@
+package embedded
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/monarko/fhirgo/STU3/datatypes"
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, opts ...fhir.ClientOpt) (*Server, fhir.Client) {
+	server := NewServer()
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return server, fhir.NewFactory(append([]fhir.ClientOpt{fhir.WithURL(httpServer.URL)}, opts...)...)()
+}
+
+func patient(id, bsn, family string) resources.Patient {
+	result := resources.Patient{
+		Domain: resources.Domain{Base: resources.Base{ResourceType: "Patient", ID: fhir.ToIDPtr(id)}},
+		Identifier: []datatypes.Identifier{{
+			System: fhir.ToUriPtr("http://fhir.nl/fhir/NamingSystem/bsn"),
+			Value:  fhir.ToStringPtr(bsn),
+		}},
+	}
+	if family != "" {
+		result.Name = []datatypes.HumanName{{Family: fhir.ToStringPtr(family), Given: []datatypes.String{"Henk"}}}
+	}
+	return result
+}
+
+func observation(id, patientID, episodeID string) resources.Observation {
+	return resources.Observation{
+		Domain:  resources.Domain{Base: resources.Base{ResourceType: "Observation", ID: fhir.ToIDPtr(id)}},
+		Status:  fhir.ToCodePtr("final"),
+		Subject: &datatypes.Reference{Reference: fhir.ToStringPtr("Patient/" + patientID)},
+		Context: &datatypes.Reference{Reference: fhir.ToStringPtr("EpisodeOfCare/" + episodeID)},
+	}
+}
+
+func TestServer_CRUD(t *testing.T) {
+	ctx := context.Background()
+	_, client := newTestClient(t)
+
+	require.NoError(t, client.CreateOrUpdate(ctx, patient("1", "123", "de Vries"), nil))
+
+	t.Run("read", func(t *testing.T) {
+		result := resources.Patient{}
+		require.NoError(t, client.ReadOne(ctx, "Patient/1", &result))
+		assert.Equal(t, "de Vries", fhir.FromStringPtr(result.Name[0].Family))
+		assert.Equal(t, "1", fhir.FromIDPtr(result.Meta.VersionID))
+	})
+	t.Run("create assigns an ID", func(t *testing.T) {
+		created := resources.Patient{}
+		require.NoError(t, client.Create(ctx, patient("", "456", "Bouwman"), &created))
+		assert.NotEmpty(t, fhir.FromIDPtr(created.ID))
+	})
+	t.Run("update of a modified resource", func(t *testing.T) {
+		result := resources.Patient{}
+		require.NoError(t, client.ReadOne(ctx, "Patient/1", &result))
+		require.NoError(t, client.CreateOrUpdate(ctx, result, nil))
+
+		// result still has the version that has been read
+		err := client.CreateOrUpdate(ctx, result, nil)
+
+		assert.True(t, fhir.IsConflict(err))
+	})
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, client.CreateOrUpdate(ctx, patient("2", "789", "Grouw"), nil))
+
+		require.NoError(t, client.Delete(ctx, "Patient/2"))
+
+		err := client.ReadOne(ctx, "Patient/2", &resources.Patient{})
+		assert.ErrorContains(t, err, "http-status=410")
+	})
+	t.Run("delete of a resource which is referred to", func(t *testing.T) {
+		require.NoError(t, client.CreateOrUpdate(ctx, observation("o1", "1", "e1"), nil))
+
+		err := client.Delete(ctx, "Patient/1")
+
+		assert.ErrorContains(t, err, "http-status=409")
+	})
+	t.Run("conditional delete", func(t *testing.T) {
+		require.NoError(t, client.CreateOrUpdate(ctx, patient("anonymous", "", ""), nil))
+		require.NoError(t, client.CreateOrUpdate(ctx, patient("3", "", "Oben"), nil))
+
+		// named patients aren't deleted
+		require.NoError(t, client.DeleteWhere(ctx, "Patient", map[string]string{"_id": "3", "name:missing": "true"}))
+		require.NoError(t, client.DeleteWhere(ctx, "Patient", map[string]string{"_id": "anonymous", "name:missing": "true"}))
+
+		assert.NoError(t, client.ReadOne(ctx, "Patient/3", &resources.Patient{}))
+		assert.Error(t, client.ReadOne(ctx, "Patient/anonymous", &resources.Patient{}))
+	})
+}
+
+func TestServer_Search(t *testing.T) {
+	ctx := context.Background()
+	_, client := newTestClient(t)
+	patient1 := patient("1", "123", "de Vries")
+	birthDate1 := datatypes.Date("1980-05-02")
+	patient1.BirthDate, patient1.Gender = &birthDate1, fhir.ToCodePtr("female")
+	patient1.Address = []datatypes.Address{{PostalCode: fhir.ToStringPtr("1234AB")}}
+	patient2 := patient("2", "456", "Bouwman")
+	birthDate2 := datatypes.Date("1975-01-01")
+	patient2.BirthDate, patient2.Gender = &birthDate2, fhir.ToCodePtr("male")
+	require.NoError(t, client.CreateOrUpdate(ctx, patient1, nil))
+	require.NoError(t, client.CreateOrUpdate(ctx, patient2, nil))
+	require.NoError(t, client.CreateOrUpdate(ctx, patient("anonymous", "", ""), nil))
+	require.NoError(t, client.CreateOrUpdate(ctx, observation("o1", "1", "e1"), nil))
+	require.NoError(t, client.CreateOrUpdate(ctx, observation("o2", "1", "e2"), nil))
+	require.NoError(t, client.CreateOrUpdate(ctx, observation("o3", "2", "e1"), nil))
+
+	testCases := []struct {
+		path   string
+		params map[string]string
+		ids    []string
+	}{
+		{path: "Patient", params: map[string]string{"identifier": "http://fhir.nl/fhir/NamingSystem/bsn|123"}, ids: []string{"1"}},
+		{path: "Patient", params: map[string]string{"identifier": "456"}, ids: []string{"2"}},
+		{path: "Patient", params: map[string]string{"name": "vri"}, ids: []string{"1"}},
+		{path: "Patient", params: map[string]string{"name": "henk"}, ids: []string{"1", "2"}},
+		{path: "Patient", params: map[string]string{"name:above": "_"}, ids: []string{"1", "2"}},
+		{path: "Patient", params: map[string]string{"_id": "2,anonymous"}, ids: []string{"2", "anonymous"}},
+		{path: "Patient", params: map[string]string{"gender": "female"}, ids: []string{"1"}},
+		{path: "Patient", params: map[string]string{"birthdate": "1980-05-02"}, ids: []string{"1"}},
+		{path: "Patient", params: map[string]string{"birthdate": "1975"}, ids: []string{"2"}},
+		{path: "Patient", params: map[string]string{"address-postalcode": "1234ab"}, ids: []string{"1"}},
+		{path: "Patient", params: map[string]string{"_sort": "family"}, ids: []string{"2", "1", "anonymous"}},
+		{path: "Patient", params: map[string]string{"_sort": "-birthdate", "name:above": "_"}, ids: []string{"1", "2"}},
+		{path: "Observation", params: map[string]string{"subject": "Patient/1"}, ids: []string{"o1", "o2"}},
+		{path: "Observation", params: map[string]string{"subject": "Patient/1", "context": "EpisodeOfCare/e1"}, ids: []string{"o1"}},
+		{path: "Observation", params: map[string]string{"patient.identifier": "456"}, ids: []string{"o3"}},
+		{path: "Observation?patient.identifier=123", ids: []string{"o1", "o2"}},
+	}
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%s %v", testCase.path, testCase.params), func(t *testing.T) {
+			var results []map[string]interface{}
+
+			err := client.ReadMultiple(ctx, testCase.path, testCase.params, &results)
+
+			require.NoError(t, err)
+			var ids []string
+			for _, result := range results {
+				ids = append(ids, result["id"].(string))
+			}
+			assert.Equal(t, testCase.ids, ids)
+		})
+	}
+	t.Run("paging", func(t *testing.T) {
+		var results []resources.Observation
+
+		err := client.ReadMultiple(ctx, "Observation", map[string]string{"_count": "1"}, &results)
+
+		assert.NoError(t, err)
+		assert.Len(t, results, 3)
+	})
+	t.Run("unsupported search parameter", func(t *testing.T) {
+		var results []resources.Patient
+
+		err := client.ReadMultiple(ctx, "Patient", map[string]string{"telecom": "0612345678"}, &results)
+
+		assert.ErrorContains(t, err, "http-status=400")
+	})
+	t.Run("sorted page", func(t *testing.T) {
+		var results []resources.Patient
+
+		err := client.ReadMultiple(ctx, "Patient", map[string]string{"_sort": "birthdate", "_count": "1", "_offset": "1"}, &results, fhir.WithMaxResults(1))
+
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "1", fhir.FromIDPtr(results[0].ID))
+	})
+	t.Run("unsupported sort parameter", func(t *testing.T) {
+		var results []resources.Patient
+
+		err := client.ReadMultiple(ctx, "Patient", map[string]string{"_sort": "telecom"}, &results)
+
+		assert.ErrorContains(t, err, "http-status=400")
+	})
+}
+
+func TestServer_Bundles(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("transaction", func(t *testing.T) {
+		server, client := newTestClient(t)
+		bundle := resources.Bundle{Entry: []resources.BundleEntry{
+			fhir.PutEntry("Patient/1", patient("1", "123", "de Vries")),
+			fhir.PutEntry("Observation/o1", observation("o1", "1", "e1")),
+		}}
+
+		results, err := client.Transaction(ctx, bundle)
+
+		require.NoError(t, err)
+		assert.Equal(t, "Observation/o1", results[1].Path())
+		assert.Equal(t, "1", results[1].VersionID)
+		assert.Len(t, server.Resources(DefaultPartition, "Patient"), 1)
+	})
+	t.Run("failed transaction is rolled back", func(t *testing.T) {
+		server, client := newTestClient(t)
+		require.NoError(t, client.CreateOrUpdate(ctx, observation("o1", "1", "e1"), nil))
+		bundle := resources.Bundle{Entry: []resources.BundleEntry{
+			fhir.PutEntry("Patient/2", patient("2", "456", "Bouwman")),
+			// Observation/o1 still refers to Patient/1
+			fhir.DeleteEntry("Patient/1"),
+		}}
+		require.NoError(t, client.CreateOrUpdate(ctx, patient("1", "123", "de Vries"), nil))
+
+		_, err := client.Transaction(ctx, bundle)
+
+		assert.ErrorContains(t, err, "http-status=409")
+		assert.Equal(t, []string{"Patient/1"}, server.Resources(DefaultPartition, "Patient"))
+	})
+	t.Run("batch with conditional create", func(t *testing.T) {
+		_, client := newTestClient(t)
+		require.NoError(t, client.CreateOrUpdate(ctx, patient("1", "123", "de Vries"), nil))
+		bundle := resources.Bundle{Entry: []resources.BundleEntry{
+			fhir.PostEntry("Patient", patient("", "123", "de Vries"), "identifier=123"),
+			fhir.PostEntry("Patient", patient("", "456", "Bouwman"), "identifier=456"),
+			fhir.PutEntry("Patient/3", patient("other", "789", "Grouw")),
+		}}
+
+		results, err := client.Batch(ctx, bundle)
+
+		var batchErr fhir.BatchError
+		require.ErrorAs(t, err, &batchErr)
+		assert.Equal(t, 2, batchErr.Entries[0].Index)
+		assert.Equal(t, "1", results[0].ID)
+		assert.Equal(t, 201, results[1].Status)
+	})
+}
+
+func TestServer_Partitions(t *testing.T) {
+	ctx := context.Background()
+	server, _ := newTestClient(t)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	factory := fhir.NewFactory(fhir.WithURL(httpServer.URL), fhir.WithTenancy(fhir.PartitionTenancy{}))
+	require.NoError(t, factory(fhir.WithTenant("1")).CreateOrUpdate(ctx, patient("1", "123", "de Vries"), nil))
+
+	var results []resources.Patient
+	require.NoError(t, factory(fhir.WithTenant("2")).ReadMultiple(ctx, "Patient", nil, &results))
+
+	assert.Empty(t, results)
+	assert.Len(t, server.Resources("1", "Patient"), 1)
+	assert.Empty(t, server.Resources(DefaultPartition, "Patient"))
+}
+
+func TestServer_Tags(t *testing.T) {
+	ctx := context.Background()
+	server, _ := newTestClient(t)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	factory := fhir.NewFactory(fhir.WithURL(httpServer.URL), fhir.WithTenancy(fhir.TagTenancy{}))
+	tenant1, tenant2 := factory(fhir.WithTenant("1")), factory(fhir.WithTenant("2"))
+	require.NoError(t, tenant1.CreateOrUpdate(ctx, patient("1", "123", "de Vries"), nil))
+	require.NoError(t, tenant2.CreateOrUpdate(ctx, patient("2", "123", "Bouwman"), nil))
+
+	t.Run("search", func(t *testing.T) {
+		var results []resources.Patient
+
+		require.NoError(t, tenant2.ReadMultiple(ctx, "Patient", map[string]string{"identifier": "123"}, &results))
+
+		require.Len(t, results, 1)
+		assert.Equal(t, "2", fhir.FromIDPtr(results[0].ID))
+	})
+	t.Run("read resource of other tenant", func(t *testing.T) {
+		err := tenant2.ReadOne(ctx, "Patient/1", &resources.Patient{})
+
+		assert.ErrorContains(t, err, "http-status=404")
+	})
+	t.Run("update resource of other tenant", func(t *testing.T) {
+		err := tenant2.CreateOrUpdate(ctx, patient("1", "456", "Jansen"), nil)
+
+		assert.ErrorIs(t, err, fhir.ErrUnauthorized)
+		result := resources.Patient{}
+		require.NoError(t, tenant1.ReadOne(ctx, "Patient/1", &result))
+		assert.Equal(t, "de Vries", fhir.FromStringPtr(result.Name[0].Family))
+	})
+	t.Run("update resource of other tenant in transaction", func(t *testing.T) {
+		bundle := resources.Bundle{Entry: []resources.BundleEntry{
+			fhir.PutEntry("Patient/3", patient("3", "789", "Jansen")),
+			fhir.PutEntry("Patient/1", patient("1", "456", "Jansen")),
+		}}
+
+		_, err := tenant2.Transaction(ctx, bundle)
+
+		assert.ErrorIs(t, err, fhir.ErrUnauthorized)
+		assert.Equal(t, []string{"Patient/1", "Patient/2"}, server.Resources(DefaultPartition, "Patient"))
+	})
+	t.Run("delete resource of other tenant", func(t *testing.T) {
+		require.NoError(t, tenant2.Delete(ctx, "Patient/1"))
+
+		assert.NoError(t, tenant1.ReadOne(ctx, "Patient/1", &resources.Patient{}))
+	})
+	t.Run("conditional create in batch", func(t *testing.T) {
+		bundle := resources.Bundle{Entry: []resources.BundleEntry{
+			fhir.PostEntry("Patient", patient("", "123", "de Vries"), "identifier=123"),
+		}}
+
+		results, err := tenant1.Batch(ctx, bundle)
+
+		require.NoError(t, err)
+		assert.Equal(t, "1", results[0].ID)
+	})
+	t.Run("delete in transaction", func(t *testing.T) {
+		_, err := tenant1.Transaction(ctx, resources.Bundle{Entry: []resources.BundleEntry{fhir.DeleteEntry("Patient/2")}})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Patient/1", "Patient/2"}, server.Resources(DefaultPartition, "Patient"))
+	})
+}
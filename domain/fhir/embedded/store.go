@@ -0,0 +1,208 @@
+package embedded
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// readResult is the outcome of reading or writing a resource.
+type readResult struct {
+	// status is the HTTP status code: 201 if the resource has been created, 200 otherwise.
+	status   int
+	resource json.RawMessage
+}
+
+func (p *partition) read(resourceType, id string) (*readResult, *operationError) {
+	path := resourceType + "/" + id
+	if resource, ok := p.resources[path]; ok {
+		return &readResult{status: http.StatusOK, resource: resource}, nil
+	}
+	if p.deleted[path] {
+		return nil, newError(http.StatusGone, "resource %s has been deleted", path)
+	}
+	return nil, newError(http.StatusNotFound, "resource %s is not known", path)
+}
+
+// create stores the resource with a new ID. If ifNoneExist contains a search query (e.g. identifier=123) and a resource
+// matches it, that resource is returned instead.
+func (p *partition) create(resourceType string, body []byte, ifNoneExist string) (*readResult, *operationError) {
+	if ifNoneExist != "" {
+		query, err := url.ParseQuery(ifNoneExist)
+		if err != nil {
+			return nil, newError(http.StatusBadRequest, "invalid If-None-Exist: %s", err)
+		}
+		matches, opErr := p.find(resourceType, query)
+		if opErr != nil {
+			return nil, opErr
+		}
+		switch len(matches) {
+		case 0:
+		case 1:
+			return &readResult{status: http.StatusOK, resource: json.RawMessage(matches[0].Raw)}, nil
+		default:
+			return nil, newError(http.StatusPreconditionFailed, "If-None-Exist matches %d resources", len(matches))
+		}
+	}
+	return p.store(resourceType, newID(), body, "")
+}
+
+// update stores the resource at the given path. If ifMatch contains a version (e.g. W/"2"), the resource is only
+// updated when that is its current version.
+func (p *partition) update(resourceType, id string, body []byte, ifMatch string) (*readResult, *operationError) {
+	if bodyID := gjson.GetBytes(body, "id").String(); bodyID != "" && bodyID != id {
+		return nil, newError(http.StatusBadRequest, "resource ID %s doesn't match the ID of the URL %s", bodyID, id)
+	}
+	return p.store(resourceType, id, body, strings.Trim(strings.TrimPrefix(strings.TrimSpace(ifMatch), "W/"), `"`))
+}
+
+// store writes the resource with the next version.
+func (p *partition) store(resourceType, id string, body []byte, expectedVersion string) (*readResult, *operationError) {
+	resource := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &resource); err != nil {
+		return nil, newError(http.StatusBadRequest, "invalid resource: %s", err)
+	}
+	if actualType := gjson.GetBytes(body, "resourceType").String(); actualType != resourceType {
+		return nil, newError(http.StatusBadRequest, "resource type %s doesn't match the type of the URL %s", actualType, resourceType)
+	}
+	path := resourceType + "/" + id
+	current, exists := p.resources[path]
+	currentVersion := gjson.GetBytes(current, "meta.versionId").String()
+	if expectedVersion != "" && expectedVersion != currentVersion {
+		return nil, newError(http.StatusPreconditionFailed, "resource %s has version %s, not %s", path, currentVersion, expectedVersion)
+	}
+	version, _ := strconv.Atoi(currentVersion)
+
+	meta := map[string]json.RawMessage{}
+	if data, ok := resource["meta"]; ok {
+		_ = json.Unmarshal(data, &meta)
+	}
+	meta["versionId"], _ = json.Marshal(strconv.Itoa(version + 1))
+	meta["lastUpdated"], _ = json.Marshal(time.Now().UTC().Format(time.RFC3339Nano))
+	resource["meta"], _ = json.Marshal(meta)
+	resource["id"], _ = json.Marshal(id)
+	data, _ := json.Marshal(resource)
+
+	p.resources[path] = data
+	delete(p.deleted, path)
+	status := http.StatusOK
+	if !exists {
+		status = http.StatusCreated
+	}
+	return &readResult{status: status, resource: data}, nil
+}
+
+// delete removes the resource at the path. Like HAPI, it refuses to delete a resource other resources refer to.
+func (p *partition) delete(path string) *operationError {
+	if err := p.checkReferences(path); err != nil {
+		return err
+	}
+	p.remove(path)
+	return nil
+}
+
+// deleteWhere removes the resource matching the search parameters. Like HAPI, it refuses to delete multiple resources.
+func (p *partition) deleteWhere(resourceType string, query url.Values) *operationError {
+	if len(query) == 0 {
+		return newError(http.StatusBadRequest, "conditional delete of %s without search parameters", resourceType)
+	}
+	paths, err := p.findOne(resourceType, query)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := p.delete(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findOne returns the path of the resource matching the search parameters of a conditional delete. It returns no
+// paths if there's no match, and an error if there are multiple.
+func (p *partition) findOne(resourceType string, query url.Values) ([]string, *operationError) {
+	matches, err := p.find(resourceType, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) > 1 {
+		return nil, newError(http.StatusPreconditionFailed, "conditional delete matches %d resources", len(matches))
+	}
+	var paths []string
+	for _, match := range matches {
+		paths = append(paths, resourceType+"/"+match.Get("id").String())
+	}
+	return paths, nil
+}
+
+func (p *partition) remove(path string) {
+	if _, exists := p.resources[path]; exists {
+		delete(p.resources, path)
+		p.deleted[path] = true
+	}
+}
+
+// checkReferences returns an error if a resource in the partition refers to the resource at the path.
+func (p *partition) checkReferences(path string) *operationError {
+	for _, referrer := range p.paths("") {
+		if referrer == path {
+			continue
+		}
+		for _, reference := range references(gjson.ParseBytes(p.resources[referrer])) {
+			if refersTo(reference, path) {
+				return newError(http.StatusConflict, "unable to delete %s: it is referred to by %s", path, referrer)
+			}
+		}
+	}
+	return nil
+}
+
+// paths returns the sorted paths of the resources of the given type, or of all resources if the type is empty.
+func (p *partition) paths(resourceType string) []string {
+	var paths []string
+	for path := range p.resources {
+		if resourceType == "" || strings.HasPrefix(path, resourceType+"/") {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// snapshot returns a copy of the partition, to restore it when a transaction fails.
+func (p *partition) snapshot() partition {
+	result := partition{resources: map[string]json.RawMessage{}, deleted: map[string]bool{}}
+	for path, resource := range p.resources {
+		result.resources[path] = resource
+	}
+	for path := range p.deleted {
+		result.deleted[path] = true
+	}
+	return result
+}
+
+// references returns the values of all references (at any depth) of the resource.
+func references(value gjson.Result) []string {
+	var result []string
+	value.ForEach(func(key, child gjson.Result) bool {
+		if key.String() == "reference" && child.Type == gjson.String {
+			result = append(result, child.String())
+		} else if child.IsObject() || child.IsArray() {
+			result = append(result, references(child)...)
+		}
+		return true
+	})
+	return result
+}
+
+// refersTo returns whether the reference (relative, e.g. Patient/123 or /Patient/123, or absolute) refers to the path.
+func refersTo(reference, path string) bool {
+	reference = strings.SplitN(reference, "/_history/", 2)[0]
+	return strings.TrimPrefix(reference, "/") == path || strings.HasSuffix(reference, "/"+path)
+}
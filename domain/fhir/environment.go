@@ -4,39 +4,40 @@ import (
 	"fmt"
 	"github.com/go-resty/resty/v2"
 	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/tidwall/gjson"
 	"net/http"
-	"strconv"
 )
 
-// InitializeTenant sets up the FHIR server for the given tenant, if the FHIR server if of a supported type.
-func InitializeTenant(fhirServerURL string, tenant string) error {
+// InitializeTenant sets up the partition with the given ID and name on the FHIR server, if the FHIR server if of a
+// supported type. It fails if a partition with the ID already exists under another name.
+func InitializeTenant(fhirServerURL string, partitionID int, name string) error {
 	restClient := resty.New()
 
 	// Check if tenant already exists
-	response, err := restClient.R().SetQueryParam("id", tenant).Get(buildRequestURI(fhirServerURL, "DEFAULT", "$partition-management-read-partition").String())
+	response, err := restClient.R().SetQueryParam("id", fmt.Sprintf("%d", partitionID)).Get(buildRequestURI(fhirServerURL, "DEFAULT", "$partition-management-read-partition").String())
 	if err != nil {
 		return err
 	}
 	if response.IsSuccess() {
 		// Tenant exists
+		existingName := gjson.GetBytes(response.Body(), `parameter.#(name=="name").valueCode`).String()
+		if existingName != name {
+			return fmt.Errorf("HAPI FHIR Server partition already exists with another name (id=%d,name=%s,existing-name=%s)", partitionID, name, existingName)
+		}
 		return nil
 	}
 	if response.IsError() && response.StatusCode() != http.StatusNotFound {
-		return fmt.Errorf("error while checking for HAPI FHIR Server tenant (status-code=%d,tenant=%s): %s", response.StatusCode(), tenant, string(response.Body()))
+		return fmt.Errorf("error while checking for HAPI FHIR Server tenant (status-code=%d,id=%d): %s", response.StatusCode(), partitionID, string(response.Body()))
 	}
 
 	// Tenant doesn't exist (yet), create it
-	idAsInt, err := strconv.Atoi(tenant)
-	if err != nil {
-		return fmt.Errorf("tenant is not an integer (tenant=%s): %w", tenant, err)
-	}
 	parameters := resources.Parameters{
 		Base: resources.Base{
 			ResourceType: "Parameters",
 		},
 		Parameter: []resources.ParametersParameter{
-			{Name: ToStringPtr("id"), ValueInteger: ToIntegerPtr(idAsInt)},
-			{Name: ToStringPtr("name"), ValueCode: ToCodePtr(tenant)},
+			{Name: ToStringPtr("id"), ValueInteger: ToIntegerPtr(partitionID)},
+			{Name: ToStringPtr("name"), ValueCode: ToCodePtr(name)},
 		},
 	}
 	response, err = restClient.R().SetHeader("Content-Type", "application/json").SetBody(parameters).Post(buildRequestURI(fhirServerURL, "DEFAULT", "$partition-management-create-partition").String())
@@ -44,7 +45,27 @@ func InitializeTenant(fhirServerURL string, tenant string) error {
 		return fmt.Errorf("unable create new HAPI FHIR Server partition: %w", err)
 	}
 	if !response.IsSuccess() {
-		return fmt.Errorf("unable create new HAPI FHIR Server partition (status-code=%d)", response.StatusCode())
+		return fmt.Errorf("unable create new HAPI FHIR Server partition (status-code=%d): %s", response.StatusCode(), string(response.Body()))
+	}
+	return nil
+}
+
+// DropTenant removes the partition with the given ID from the FHIR server. A partition which doesn't exist is ignored.
+func DropTenant(fhirServerURL string, partitionID int) error {
+	parameters := resources.Parameters{
+		Base: resources.Base{
+			ResourceType: "Parameters",
+		},
+		Parameter: []resources.ParametersParameter{
+			{Name: ToStringPtr("id"), ValueInteger: ToIntegerPtr(partitionID)},
+		},
+	}
+	response, err := resty.New().R().SetHeader("Content-Type", "application/json").SetBody(parameters).Post(buildRequestURI(fhirServerURL, "DEFAULT", "$partition-management-delete-partition").String())
+	if err != nil {
+		return fmt.Errorf("unable to delete HAPI FHIR Server partition: %w", err)
+	}
+	if !response.IsSuccess() && response.StatusCode() != http.StatusNotFound {
+		return fmt.Errorf("unable to delete HAPI FHIR Server partition (status-code=%d,id=%d): %s", response.StatusCode(), partitionID, string(response.Body()))
 	}
 	return nil
 }
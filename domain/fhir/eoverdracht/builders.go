@@ -9,6 +9,7 @@ import (
 	"github.com/monarko/fhirgo/STU3/datatypes"
 	"github.com/monarko/fhirgo/STU3/resources"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/document"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
 	"github.com/sirupsen/logrus"
 )
@@ -16,7 +17,8 @@ import (
 type TransferFHIRBuilder interface {
 	BuildTask(props fhir.TaskProperties) resources.Task
 	BuildAdvanceNotice(createRequest types.CreateTransferRequest, patient *types.Patient) AdvanceNotice
-	BuildNursingHandoffComposition(patient *types.Patient, advanceNotice AdvanceNotice) (fhir.Composition, error)
+	BuildNursingHandoff(patient *types.Patient, advanceNotice AdvanceNotice, content types.NursingHandoffContent) (NursingHandoff, error)
+	BuildCarePlanImport(patientID string, nursingHandoff types.TransferProperties, sender types.Organization, sourceURL string) CarePlanImport
 }
 
 type FHIRBuilder struct {
@@ -35,6 +37,20 @@ func (b FHIRBuilder) BuildTask(props fhir.TaskProperties) resources.Task {
 	} else {
 		id = b.IDGenerator.GenerateID()
 	}
+	var owner *datatypes.Reference
+	if props.OwnerID != "" {
+		owner = &datatypes.Reference{Identifier: &datatypes.Identifier{
+			System: &fhir.NutsCodingSystem,
+			Value:  fhir.ToStringPtr(props.OwnerID),
+		}}
+	}
+	var requester *resources.TaskRequester
+	if props.RequesterID != "" {
+		requester = &resources.TaskRequester{Agent: &datatypes.Reference{Identifier: &datatypes.Identifier{
+			System: &fhir.NutsCodingSystem,
+			Value:  fhir.ToStringPtr(props.RequesterID),
+		}}}
+	}
 	return resources.Task{
 		Domain: resources.Domain{
 			Base: resources.Base{
@@ -43,9 +59,10 @@ func (b FHIRBuilder) BuildTask(props fhir.TaskProperties) resources.Task {
 			},
 		},
 		Status:    fhir.ToCodePtr(props.Status),
+		Intent:    fhir.ToCodePtr("order"),
 		Code:      &SnomedTransferType,
-		Requester: &resources.TaskRequester{},
-		Owner:     &datatypes.Reference{},
+		Requester: requester,
+		Owner:     owner,
 		// TODO: patient seems mandatory in the spec, but can only be sent when placed already
 		// has patient in care to protect the identity of the patient during the negotiation phase.
 		//"for": map[string]string{
@@ -57,9 +74,10 @@ func (b FHIRBuilder) BuildTask(props fhir.TaskProperties) resources.Task {
 }
 
 func (b FHIRBuilder) BuildAdvanceNotice(createRequest types.CreateTransferRequest, patient *types.Patient) AdvanceNotice {
-	problems, interventions, careplan := b.buildEOverdrachtCarePlan(createRequest.CarePlan)
-	administrativeData := b.buildAdministrativeData(createRequest)
 	anonymousPatient := b.buildAnonymousPatient(patient)
+	subject := datatypes.Reference{Reference: fhir.ToStringPtr("Patient/" + fhir.FromIDPtr(anonymousPatient.ID))}
+	problems, interventions, careplan := b.buildEOverdrachtCarePlan(createRequest.CarePlan, subject)
+	administrativeData := b.buildAdministrativeData(createRequest)
 
 	an := AdvanceNotice{
 		Patient:       anonymousPatient,
@@ -70,9 +88,25 @@ func (b FHIRBuilder) BuildAdvanceNotice(createRequest types.CreateTransferReques
 	composition := b.buildAdvanceNoticeComposition(anonymousPatient, administrativeData, careplan)
 	an.Composition = composition
 
+	if transfer, err := AdvanceNoticeToDomainTransfer(an); err == nil {
+		// the narrative must not reveal the identity of the patient, just like the anonymous patient
+		transfer.Patient = types.Patient{Zipcode: patient.Zipcode}
+		an.Composition.Text = buildNarrative(document.AdvanceNoticeTitle, transfer)
+	}
+
 	return an
 }
 
+// buildNarrative renders the transfer as narrative of a composition, so the FHIR document can be read by humans.
+func buildNarrative(title string, transfer types.TransferProperties) *datatypes.Narrative {
+	div, err := document.RenderNarrative(document.Document{TransferProperties: transfer, Title: title})
+	if err != nil {
+		logrus.Warnf("Unable to render narrative of %s: %s", title, err)
+		return nil
+	}
+	return &datatypes.Narrative{Status: fhir.ToCodePtr("generated"), Div: fhir.ToStringPtr(div)}
+}
+
 // buildAnonymousPatient only contains address information so the receiving organisation can
 // decide if they can deliver the requested care
 func (b FHIRBuilder) buildAnonymousPatient(patient *types.Patient) resources.Patient {
@@ -106,7 +140,7 @@ func (FHIRBuilder) buildAdministrativeData(request types.CreateTransferRequest)
 
 }
 
-func (b FHIRBuilder) buildNursingHandoffComposition(administrativeData, careplan fhir.CompositionSection, patient resources.Patient) fhir.Composition {
+func (b FHIRBuilder) buildNursingHandoffComposition(patient resources.Patient, sections []fhir.CompositionSection) fhir.Composition {
 	return fhir.Composition{
 		Base: resources.Base{
 			ResourceType: "Composition",
@@ -115,9 +149,11 @@ func (b FHIRBuilder) buildNursingHandoffComposition(administrativeData, careplan
 		Type: datatypes.CodeableConcept{
 			Coding: []datatypes.Coding{{System: &fhir.SnomedCodingSystem, Code: fhir.ToCodePtr("371535009"), Display: fhir.ToStringPtr("verslag van overdracht")}},
 		},
+		Status:  "final",
 		Subject: datatypes.Reference{Reference: fhir.ToStringPtr("Patient/" + fhir.FromIDPtr(patient.ID))},
+		Date:    datatypes.DateTime(time.Now().Format(time.RFC3339)),
 		Title:   "Nursing handoff",
-		Section: []fhir.CompositionSection{administrativeData, careplan},
+		Section: sections,
 	}
 }
 
@@ -131,22 +167,27 @@ func (b FHIRBuilder) buildAdvanceNoticeComposition(patient resources.Patient, ad
 		Type: datatypes.CodeableConcept{
 			Coding: []datatypes.Coding{{System: &fhir.LoincCodingSystem, Code: fhir.ToCodePtr("57830-2")}},
 		},
+		Status:  "final",
 		Title:   "Advance notice",
 		Subject: datatypes.Reference{Reference: fhir.ToStringPtr(fmt.Sprintf("Patient/%s", fhir.FromIDPtr(patient.ID)))},
+		Date:    datatypes.DateTime(time.Now().Format(time.RFC3339)),
 		Section: []fhir.CompositionSection{administrativeData, careplan},
 	}
 }
 
-func (b FHIRBuilder) buildEOverdrachtCarePlan(carePlan types.EOverdrachtCarePlan) (problems []resources.Condition, interventions []fhir.Procedure, section fhir.CompositionSection) {
+func (b FHIRBuilder) buildEOverdrachtCarePlan(carePlan types.EOverdrachtCarePlan, subject datatypes.Reference) (problems []resources.Condition, interventions []fhir.Procedure, section fhir.CompositionSection) {
 	for _, cpPatientProblems := range carePlan.PatientProblems {
 		newProblem := b.buildConditionFromProblem(cpPatientProblems.Problem)
+		newProblem.Subject = &subject
 		problems = append(problems, newProblem)
 
 		for _, i := range cpPatientProblems.Interventions {
 			if strings.TrimSpace(i.Comment) == "" {
 				continue
 			}
-			interventions = append(interventions, b.buildProcedureFromIntervention(i, fhir.FromIDPtr(newProblem.ID)))
+			intervention := b.buildProcedureFromIntervention(i, fhir.FromIDPtr(newProblem.ID))
+			intervention.Subject = subject
+			interventions = append(interventions, intervention)
 		}
 	}
 
@@ -181,31 +222,77 @@ func (b FHIRBuilder) buildEOverdrachtCarePlan(carePlan types.EOverdrachtCarePlan
 }
 
 func (b FHIRBuilder) buildProcedureFromIntervention(intervention types.Intervention, problemID string) fhir.Procedure {
-	return fhir.Procedure{
+	procedure := fhir.Procedure{
 		Domain: resources.Domain{
 			Base: resources.Base{
 				ResourceType: "Procedure",
 				ID:           fhir.ToIDPtr(b.IDGenerator.GenerateID()),
 			},
 		},
+		Status:          "in-progress",
 		ReasonReference: []datatypes.Reference{{Reference: fhir.ToStringPtr("Condition/" + problemID)}},
 		Note:            []datatypes.Annotation{{Text: fhir.ToStringPtr(intervention.Comment)}},
 	}
+	if intervention.Code != nil {
+		procedure.Code = toCodeableConcept(*intervention.Code, intervention.Code.Display)
+	}
+	if intervention.Frequency != nil {
+		period := datatypes.Decimal(intervention.Frequency.Period)
+		procedure.Extension = []datatypes.Extension{{
+			URL: fhir.ToUriPtr(InterventionFrequencyExtension),
+			ValueTiming: &datatypes.Timing{Repeat: &datatypes.Repeat{
+				Frequency:  fhir.ToIntegerPtr(intervention.Frequency.Frequency),
+				Period:     &period,
+				PeriodUnit: fhir.ToCodePtr(string(intervention.Frequency.PeriodUnit)),
+			}},
+		}}
+	}
+	return procedure
 }
 
+// buildConditionFromProblem builds the Condition of a patient problem. The name of the problem is the text of the
+// code, so a problem which isn't coded can still be read by the receiver. It's also kept in the note, which is where
+// receivers of earlier versions read it.
 func (b FHIRBuilder) buildConditionFromProblem(problem types.Problem) resources.Condition {
-	return resources.Condition{
+	code := &datatypes.CodeableConcept{Text: fhir.ToStringPtr(problem.Name)}
+	if problem.Code != nil {
+		code = toCodeableConcept(*problem.Code, problem.Name)
+	}
+	status := string(problem.Status)
+	if status == "" {
+		status = string(types.ProblemStatusActive)
+	}
+	condition := resources.Condition{
 		Domain: resources.Domain{
 			Base: resources.Base{
 				ResourceType: "Condition",
 				ID:           fhir.ToIDPtr(b.IDGenerator.GenerateID()),
 			},
 		},
-		Note: []datatypes.Annotation{{Text: fhir.ToStringPtr(problem.Name)}},
+		ClinicalStatus: fhir.ToCodePtr(status),
+		Code:           code,
+		Note:           []datatypes.Annotation{{Text: fhir.ToStringPtr(problem.Name)}},
+	}
+	if problem.OnsetDate != nil {
+		condition.OnsetDateTime = fhir.ToDateTimePtr(problem.OnsetDate.Format(types.DobFormat))
+	}
+	return condition
+}
+
+func toCodeableConcept(concept types.CodedConcept, text string) *datatypes.CodeableConcept {
+	return &datatypes.CodeableConcept{
+		Coding: []datatypes.Coding{{
+			System:  fhir.ToUriPtr(concept.System),
+			Code:    fhir.ToCodePtr(concept.Code),
+			Display: fhir.ToStringPtr(concept.Display),
+		}},
+		Text: fhir.ToStringPtr(text),
 	}
 }
 
-func (b FHIRBuilder) BuildNursingHandoffComposition(patient *types.Patient, advanceNotice AdvanceNotice) (fhir.Composition, error) {
+// BuildNursingHandoff builds the nursing handoff of a patient. It reuses the administrative data and care plan of
+// the advance notice and adds sections for the clinical content which is not part of the advance notice.
+func (b FHIRBuilder) BuildNursingHandoff(patient *types.Patient, advanceNotice AdvanceNotice, content types.NursingHandoffContent) (NursingHandoff, error) {
 
 	careplan, err := FilterCompositionSectionByType(advanceNotice.Composition.Section, CarePlanCode)
 	if err != nil {
@@ -222,8 +309,336 @@ func (b FHIRBuilder) BuildNursingHandoffComposition(patient *types.Patient, adva
 	}
 
 	fhirPatient := resources.Patient{Domain: resources.Domain{Base: resources.Base{ID: fhir.ToIDPtr(patient.ObjectID)}}}
+	subject := datatypes.Reference{Reference: fhir.ToStringPtr("Patient/" + patient.ObjectID)}
+
+	nursingHandoff := NursingHandoff{
+		Patient:       fhirPatient,
+		Problems:      advanceNotice.Problems,
+		Interventions: advanceNotice.Interventions,
+	}
+	sections := []fhir.CompositionSection{administrativeData, careplan}
+
+	// Entries of which the required field is left empty in the form are skipped
+
+	if content.Medications != nil {
+		for _, medication := range *content.Medications {
+			if strings.TrimSpace(medication.Name) == "" {
+				continue
+			}
+			nursingHandoff.Medications = append(nursingHandoff.Medications, b.buildMedicationStatement(medication, subject))
+		}
+	}
+	if content.Allergies != nil {
+		for _, allergy := range *content.Allergies {
+			if strings.TrimSpace(allergy.Substance) == "" {
+				continue
+			}
+			nursingHandoff.Allergies = append(nursingHandoff.Allergies, b.buildAllergyIntolerance(allergy, subject))
+		}
+	}
+	if content.WoundCare != nil {
+		for _, woundCare := range *content.WoundCare {
+			if strings.TrimSpace(woundCare.Location) == "" {
+				continue
+			}
+			wound := b.buildWound(woundCare, subject)
+			nursingHandoff.Wounds = append(nursingHandoff.Wounds, wound)
+			if woundCare.Treatment != nil && strings.TrimSpace(*woundCare.Treatment) != "" {
+				nursingHandoff.WoundTreatments = append(nursingHandoff.WoundTreatments, b.buildWoundTreatment(*woundCare.Treatment, fhir.FromIDPtr(wound.ID), subject))
+			}
+		}
+	}
+	if content.Mobility != nil && strings.TrimSpace(*content.Mobility) != "" {
+		nursingHandoff.FunctionalStatus = append(nursingHandoff.FunctionalStatus, b.buildObservation(MobilityConcept, *content.Mobility, subject))
+	}
+	if content.DailyActivities != nil && strings.TrimSpace(*content.DailyActivities) != "" {
+		nursingHandoff.FunctionalStatus = append(nursingHandoff.FunctionalStatus, b.buildObservation(DailyActivitiesConcept, *content.DailyActivities, subject))
+	}
+	if content.ContactPersons != nil {
+		for _, contactPerson := range *content.ContactPersons {
+			if strings.TrimSpace(contactPerson.Name) == "" {
+				continue
+			}
+			nursingHandoff.ContactPersons = append(nursingHandoff.ContactPersons, b.buildRelatedPerson(contactPerson, subject))
+		}
+	}
+	if content.ResponsiblePractitioner != nil && strings.TrimSpace(content.ResponsiblePractitioner.Name) != "" {
+		practitioner := b.buildPractitioner(*content.ResponsiblePractitioner)
+		nursingHandoff.ResponsiblePractitioner = &practitioner
+	}
+
+	// Only add the sections which have content
+	var entries []string
+	for _, medication := range nursingHandoff.Medications {
+		entries = append(entries, "MedicationStatement/"+fhir.FromIDPtr(medication.ID))
+	}
+	sections = appendSection(sections, "Medication overview", MedicationOverviewConcept, entries)
+
+	entries = nil
+	for _, allergy := range nursingHandoff.Allergies {
+		entries = append(entries, "AllergyIntolerance/"+fhir.FromIDPtr(allergy.ID))
+	}
+	sections = appendSection(sections, "Allergies", AllergiesConcept, entries)
+
+	entries = nil
+	for _, wound := range nursingHandoff.Wounds {
+		entries = append(entries, "Condition/"+fhir.FromIDPtr(wound.ID))
+	}
+	for _, treatment := range nursingHandoff.WoundTreatments {
+		entries = append(entries, "Procedure/"+fhir.FromIDPtr(treatment.ID))
+	}
+	sections = appendSection(sections, "Wound care", WoundCareConcept, entries)
+
+	entries = nil
+	for _, observation := range nursingHandoff.FunctionalStatus {
+		entries = append(entries, "Observation/"+fhir.FromIDPtr(observation.ID))
+	}
+	sections = appendSection(sections, "Mobility and ADL", FunctionalStatusConcept, entries)
+
+	entries = nil
+	for _, contactPerson := range nursingHandoff.ContactPersons {
+		entries = append(entries, "RelatedPerson/"+fhir.FromIDPtr(contactPerson.ID))
+	}
+	sections = appendSection(sections, "Contact persons", ContactPersonsConcept, entries)
+
+	entries = nil
+	if nursingHandoff.ResponsiblePractitioner != nil {
+		entries = append(entries, "Practitioner/"+fhir.FromIDPtr(nursingHandoff.ResponsiblePractitioner.ID))
+	}
+	sections = appendSection(sections, "Responsible practitioner", ResponsiblePractitionerConcept, entries)
+
+	nursingHandoff.Composition = b.buildNursingHandoffComposition(fhirPatient, sections)
+
+	if transfer, err := NursingHandoffToDomainTransfer(nursingHandoff); err == nil {
+		transfer.Patient = *patient
+		nursingHandoff.Composition.Text = buildNarrative(document.NursingHandoffTitle, transfer)
+	}
+
+	return nursingHandoff, nil
+}
+
+// BuildCarePlanImport builds the resources which copy the care plan and wound care of a received nursing handoff into
+// the local record of the patient. The Provenance refers to the sending organization and to the source of the
+// nursing handoff at the sender's FHIR server.
+func (b FHIRBuilder) BuildCarePlanImport(patientID string, nursingHandoff types.TransferProperties, sender types.Organization, sourceURL string) CarePlanImport {
+	subject := datatypes.Reference{Reference: fhir.ToStringPtr("Patient/" + patientID)}
+	result := CarePlanImport{}
+
+	for _, patientProblem := range nursingHandoff.CarePlan.PatientProblems {
+		problem := b.buildConditionFromProblem(patientProblem.Problem)
+		problem.Subject = &subject
+		result.Problems = append(result.Problems, problem)
+		for _, intervention := range patientProblem.Interventions {
+			if strings.TrimSpace(intervention.Comment) == "" {
+				continue
+			}
+			procedure := b.buildProcedureFromIntervention(intervention, fhir.FromIDPtr(problem.ID))
+			procedure.Subject = subject
+			result.Procedures = append(result.Procedures, procedure)
+		}
+	}
+	if nursingHandoff.HandoffContent != nil && nursingHandoff.HandoffContent.WoundCare != nil {
+		for _, woundCare := range *nursingHandoff.HandoffContent.WoundCare {
+			if strings.TrimSpace(woundCare.Location) == "" {
+				continue
+			}
+			wound := b.buildWound(woundCare, subject)
+			result.Problems = append(result.Problems, wound)
+			if woundCare.Treatment != nil && strings.TrimSpace(*woundCare.Treatment) != "" {
+				result.Procedures = append(result.Procedures, b.buildWoundTreatment(*woundCare.Treatment, fhir.FromIDPtr(wound.ID), subject))
+			}
+		}
+	}
+
+	var targets []datatypes.Reference
+	for _, problem := range result.Problems {
+		targets = append(targets, datatypes.Reference{Reference: fhir.ToStringPtr("Condition/" + fhir.FromIDPtr(problem.ID))})
+	}
+	for _, procedure := range result.Procedures {
+		targets = append(targets, datatypes.Reference{Reference: fhir.ToStringPtr("Procedure/" + fhir.FromIDPtr(procedure.ID))})
+	}
+	result.Provenance = b.buildProvenance(targets, sender, sourceURL)
+	return result
+}
+
+// buildProvenance builds a Provenance which records that the targets are derived from the source of the sender.
+func (b FHIRBuilder) buildProvenance(targets []datatypes.Reference, sender types.Organization, sourceURL string) fhir.Provenance {
+	return fhir.Provenance{
+		Base: resources.Base{
+			ResourceType: "Provenance",
+			ID:           fhir.ToIDPtr(b.IDGenerator.GenerateID()),
+		},
+		Target:   targets,
+		Recorded: datatypes.Instant(time.Now().Format(time.RFC3339)),
+		Agent: []fhir.ProvenanceAgent{{
+			WhoReference: datatypes.Reference{
+				Identifier: &datatypes.Identifier{
+					System: &fhir.NutsCodingSystem,
+					Value:  fhir.ToStringPtr(sender.Did),
+				},
+				Display: fhir.ToStringPtr(sender.Name),
+			},
+		}},
+		Entity: []fhir.ProvenanceEntity{{
+			Role:          "source",
+			WhatReference: datatypes.Reference{Reference: fhir.ToStringPtr(sourceURL)},
+		}},
+	}
+}
+
+// appendSection adds a section referring to the given resource paths, if there are any.
+func appendSection(sections []fhir.CompositionSection, title string, code datatypes.CodeableConcept, resourcePaths []string) []fhir.CompositionSection {
+	if len(resourcePaths) == 0 {
+		return sections
+	}
+	section := fhir.CompositionSection{
+		Title: fhir.ToStringPtr(title),
+		Code:  code,
+	}
+	for _, path := range resourcePaths {
+		section.Entry = append(section.Entry, datatypes.Reference{Reference: fhir.ToStringPtr(path)})
+	}
+	return append(sections, section)
+}
+
+func (b FHIRBuilder) buildMedicationStatement(medication types.Medication, subject datatypes.Reference) fhir.MedicationStatement {
+	statement := fhir.MedicationStatement{
+		Domain: resources.Domain{
+			Base: resources.Base{
+				ResourceType: "MedicationStatement",
+				ID:           fhir.ToIDPtr(b.IDGenerator.GenerateID()),
+			},
+		},
+		Status:                    "active",
+		MedicationCodeableConcept: datatypes.CodeableConcept{Text: fhir.ToStringPtr(medication.Name)},
+		Subject:                   subject,
+		Taken:                     "y",
+	}
+	if medication.Dosage != nil {
+		statement.Dosage = []datatypes.Dosage{{Text: fhir.ToStringPtr(*medication.Dosage)}}
+	}
+	if medication.Comment != nil {
+		statement.Note = []datatypes.Annotation{{Text: fhir.ToStringPtr(*medication.Comment)}}
+	}
+	return statement
+}
+
+func (b FHIRBuilder) buildAllergyIntolerance(allergy types.Allergy, subject datatypes.Reference) resources.AllergyIntolerance {
+	allergyIntolerance := resources.AllergyIntolerance{
+		Domain: resources.Domain{
+			Base: resources.Base{
+				ResourceType: "AllergyIntolerance",
+				ID:           fhir.ToIDPtr(b.IDGenerator.GenerateID()),
+			},
+		},
+		ClinicalStatus:     fhir.ToCodePtr("active"),
+		VerificationStatus: fhir.ToCodePtr("confirmed"),
+		Code:               &datatypes.CodeableConcept{Text: fhir.ToStringPtr(allergy.Substance)},
+		Patient:            &subject,
+	}
+	if allergy.Criticality != nil {
+		allergyIntolerance.Criticality = fhir.ToCodePtr(string(*allergy.Criticality))
+	}
+	if allergy.Reaction != nil {
+		allergyIntolerance.Reaction = []resources.AllergyIntoleranceReaction{{
+			Manifestation: []datatypes.CodeableConcept{{Text: fhir.ToStringPtr(*allergy.Reaction)}},
+		}}
+	}
+	return allergyIntolerance
+}
+
+func (b FHIRBuilder) buildWound(woundCare types.WoundCare, subject datatypes.Reference) resources.Condition {
+	wound := resources.Condition{
+		Domain: resources.Domain{
+			Base: resources.Base{
+				ResourceType: "Condition",
+				ID:           fhir.ToIDPtr(b.IDGenerator.GenerateID()),
+			},
+		},
+		Code:     &WoundConcept,
+		BodySite: &datatypes.CodeableConcept{Text: fhir.ToStringPtr(woundCare.Location)},
+		Subject:  &subject,
+	}
+	if woundCare.Description != nil {
+		wound.Note = []datatypes.Annotation{{Text: fhir.ToStringPtr(*woundCare.Description)}}
+	}
+	return wound
+}
+
+func (b FHIRBuilder) buildWoundTreatment(treatment, woundID string, subject datatypes.Reference) fhir.Procedure {
+	return fhir.Procedure{
+		Domain: resources.Domain{
+			Base: resources.Base{
+				ResourceType: "Procedure",
+				ID:           fhir.ToIDPtr(b.IDGenerator.GenerateID()),
+			},
+		},
+		Status:          "in-progress",
+		Subject:         subject,
+		ReasonReference: []datatypes.Reference{{Reference: fhir.ToStringPtr("Condition/" + woundID)}},
+		Note:            []datatypes.Annotation{{Text: fhir.ToStringPtr(treatment)}},
+	}
+}
+
+func (b FHIRBuilder) buildObservation(code datatypes.CodeableConcept, value string, subject datatypes.Reference) resources.Observation {
+	return resources.Observation{
+		Domain: resources.Domain{
+			Base: resources.Base{
+				ResourceType: "Observation",
+				ID:           fhir.ToIDPtr(b.IDGenerator.GenerateID()),
+			},
+		},
+		Status:            fhir.ToCodePtr("final"),
+		Code:              &code,
+		Subject:           &subject,
+		EffectiveDateTime: fhir.ToDateTimePtr(time.Now().Format(time.RFC3339)),
+		ValueString:       fhir.ToStringPtr(value),
+	}
+}
+
+func (b FHIRBuilder) buildRelatedPerson(contactPerson types.ContactPerson, subject datatypes.Reference) fhir.RelatedPerson {
+	relatedPerson := fhir.RelatedPerson{
+		Domain: resources.Domain{
+			Base: resources.Base{
+				ResourceType: "RelatedPerson",
+				ID:           fhir.ToIDPtr(b.IDGenerator.GenerateID()),
+			},
+		},
+		Patient: subject,
+		Name:    []datatypes.HumanName{{Text: fhir.ToStringPtr(contactPerson.Name)}},
+	}
+	if contactPerson.Relationship != nil {
+		relatedPerson.Relationship = &datatypes.CodeableConcept{Text: fhir.ToStringPtr(*contactPerson.Relationship)}
+	}
+	if contactPerson.Telephone != nil {
+		relatedPerson.Telecom = []datatypes.ContactPoint{phoneContactPoint(*contactPerson.Telephone)}
+	}
+	return relatedPerson
+}
+
+func (b FHIRBuilder) buildPractitioner(responsiblePractitioner types.ResponsiblePractitioner) resources.Practitioner {
+	practitioner := resources.Practitioner{
+		Domain: resources.Domain{
+			Base: resources.Base{
+				ResourceType: "Practitioner",
+				ID:           fhir.ToIDPtr(b.IDGenerator.GenerateID()),
+			},
+		},
+		Name: []datatypes.HumanName{{Text: fhir.ToStringPtr(responsiblePractitioner.Name)}},
+	}
+	if responsiblePractitioner.Role != nil {
+		practitioner.Qualification = []resources.PractitionerQualification{{
+			Code: &datatypes.CodeableConcept{Text: fhir.ToStringPtr(*responsiblePractitioner.Role)},
+		}}
+	}
+	if responsiblePractitioner.Telephone != nil {
+		practitioner.Telecom = []datatypes.ContactPoint{phoneContactPoint(*responsiblePractitioner.Telephone)}
+	}
+	return practitioner
+}
 
-	return b.buildNursingHandoffComposition(administrativeData, careplan, fhirPatient), nil
+func phoneContactPoint(telephone string) datatypes.ContactPoint {
+	return datatypes.ContactPoint{System: fhir.ToCodePtr("phone"), Value: fhir.ToStringPtr(telephone)}
 }
 
 type IDGenerator interface {
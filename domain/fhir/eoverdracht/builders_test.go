@@ -0,0 +1,152 @@
+package eoverdracht
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/monarko/fhirgo/STU3/datatypes"
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	openapiTypes "github.com/oapi-codegen/runtime/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type sequenceGenerator struct {
+	next *int
+}
+
+func (g sequenceGenerator) GenerateID() string {
+	*g.next++
+	return fmt.Sprintf("id-%d", *g.next)
+}
+
+func TestFHIRBuilder_BuildNursingHandoff(t *testing.T) {
+	builder := FHIRBuilder{IDGenerator: sequenceGenerator{next: new(int)}}
+	patient := &types.Patient{ObjectID: "patient-1", Zipcode: "1234AB"}
+	advanceNotice := builder.BuildAdvanceNotice(types.CreateTransferRequest{
+		TransferDate: openapiTypes.Date{},
+		CarePlan: types.EOverdrachtCarePlan{PatientProblems: []types.PatientProblem{{
+			Problem:       types.Problem{Name: "Diabetes"},
+			Interventions: []types.Intervention{{Comment: "Check glucose"}},
+		}}},
+	}, patient)
+
+	t.Run("without content", func(t *testing.T) {
+		nursingHandoff, err := builder.BuildNursingHandoff(patient, advanceNotice, types.NursingHandoffContent{})
+
+		assert.NoError(t, err)
+		assert.Len(t, nursingHandoff.Composition.Section, 2)
+		assert.Equal(t, "Patient/patient-1", fhir.FromStringPtr(nursingHandoff.Composition.Subject.Reference))
+		assert.Len(t, nursingHandoff.Problems, 1)
+		assert.Contains(t, fhir.FromStringPtr(nursingHandoff.Composition.Text.Div), "Check glucose")
+	})
+
+	t.Run("with content", func(t *testing.T) {
+		high := types.High
+		content := types.NursingHandoffContent{
+			Medications:             &[]types.Medication{{Name: "Metformin", Dosage: toPtr("2 times a day 1 tablet")}},
+			Allergies:               &[]types.Allergy{{Substance: "Penicillin", Reaction: toPtr("Rash"), Criticality: &high}},
+			WoundCare:               &[]types.WoundCare{{Location: "Left heel", Description: toPtr("Pressure ulcer"), Treatment: toPtr("Daily dressing")}},
+			Mobility:                toPtr("Walks with a walker"),
+			DailyActivities:         toPtr("Needs help with showering"),
+			ContactPersons:          &[]types.ContactPerson{{Name: "J. Jansen", Relationship: toPtr("Daughter"), Telephone: toPtr("0612345678")}},
+			ResponsiblePractitioner: &types.ResponsiblePractitioner{Name: "Dr. P. Pietersen", Role: toPtr("General practitioner")},
+		}
+
+		nursingHandoff, err := builder.BuildNursingHandoff(patient, advanceNotice, content)
+
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Len(t, nursingHandoff.Composition.Section, 8)
+		woundCare, err := FilterCompositionSectionByType(nursingHandoff.Composition.Section, WoundCareCode)
+		assert.NoError(t, err)
+		assert.Len(t, woundCare.Entry, 2)
+		assert.Len(t, nursingHandoff.FunctionalStatus, 2)
+
+		// the receiver must end up with the same content
+		assert.Equal(t, content, *ToDomainHandoffContent(nursingHandoff))
+	})
+}
+
+func TestFHIRBuilder_BuildCarePlanImport(t *testing.T) {
+	builder := FHIRBuilder{IDGenerator: sequenceGenerator{next: new(int)}}
+	nursingHandoff := types.TransferProperties{
+		CarePlan: types.EOverdrachtCarePlan{PatientProblems: []types.PatientProblem{{
+			Problem:       types.Problem{Name: "Diabetes"},
+			Interventions: []types.Intervention{{Comment: "Check glucose"}, {Comment: " "}},
+		}}},
+		HandoffContent: &types.NursingHandoffContent{
+			WoundCare: &[]types.WoundCare{{Location: "Left heel", Treatment: toPtr("Daily dressing")}, {Location: " ", Treatment: toPtr("Weekly dressing")}},
+		},
+	}
+	sender := types.Organization{Did: "did:web:sender", Name: "Sender"}
+
+	carePlanImport := builder.BuildCarePlanImport("patient-1", nursingHandoff, sender, "https://sender/fhir/Task/1")
+
+	assert.Len(t, carePlanImport.Problems, 2)
+	assert.Len(t, carePlanImport.Procedures, 2)
+	for _, problem := range carePlanImport.Problems {
+		assert.Equal(t, "Patient/patient-1", fhir.FromStringPtr(problem.Subject.Reference))
+	}
+	for _, procedure := range carePlanImport.Procedures {
+		assert.Equal(t, "Patient/patient-1", fhir.FromStringPtr(procedure.Subject.Reference))
+	}
+	provenance := carePlanImport.Provenance
+	assert.Len(t, provenance.Target, 4)
+	assert.Equal(t, "did:web:sender", fhir.FromStringPtr(provenance.Agent[0].WhoReference.Identifier.Value))
+	assert.Equal(t, "https://sender/fhir/Task/1", fhir.FromStringPtr(provenance.Entity[0].WhatReference.Reference))
+}
+
+func TestFHIRBuilder_BuildAdvanceNotice(t *testing.T) {
+	builder := FHIRBuilder{IDGenerator: sequenceGenerator{next: new(int)}}
+	onset, _ := time.Parse(types.DobFormat, "2021-03-01")
+	patientProblem := types.PatientProblem{
+		Problem: types.Problem{
+			Name:      "Diabetes mellitus type 2",
+			Code:      &types.CodedConcept{System: string(fhir.SnomedCodingSystem), Code: "44054006", Display: "Diabetes mellitus type 2"},
+			Status:    types.ProblemStatusRemission,
+			OnsetDate: &openapiTypes.Date{Time: onset},
+		},
+		Interventions: []types.Intervention{{
+			Comment:   "Check glucose",
+			Code:      &types.CodedConcept{System: string(fhir.SnomedCodingSystem), Code: "33747003", Display: "Glucose measurement, blood"},
+			Frequency: &types.InterventionFrequency{Frequency: 3, Period: 1, PeriodUnit: types.D},
+		}},
+	}
+
+	advanceNotice := builder.BuildAdvanceNotice(types.CreateTransferRequest{
+		CarePlan: types.EOverdrachtCarePlan{PatientProblems: []types.PatientProblem{patientProblem}},
+	}, &types.Patient{ObjectID: "patient-1"})
+
+	t.Run("coded problems and interventions are read by the receiver", func(t *testing.T) {
+		assert.Equal(t, patientProblem.Problem, ToDomainProblem(advanceNotice.Problems[0]))
+		assert.Equal(t, patientProblem.Interventions[0], ToDomainIntervention(advanceNotice.Interventions[0]))
+	})
+	t.Run("name of the problem is kept as note for older receivers", func(t *testing.T) {
+		assert.Equal(t, "Diabetes mellitus type 2", fhir.FromStringPtr(advanceNotice.Problems[0].Note[0].Text))
+	})
+	t.Run("extension without URL", func(t *testing.T) {
+		procedure := advanceNotice.Interventions[0]
+		procedure.Extension = []datatypes.Extension{{}}
+
+		assert.Nil(t, ToDomainIntervention(procedure).Frequency)
+	})
+	t.Run("narrative doesn't reveal the patient", func(t *testing.T) {
+		narrative := fhir.FromStringPtr(advanceNotice.Composition.Text.Div)
+
+		assert.Contains(t, narrative, "Diabetes mellitus type 2")
+		assert.NotContains(t, narrative, "patient-1")
+	})
+	t.Run("problem of an older transfer", func(t *testing.T) {
+		condition := resources.Condition{Note: []datatypes.Annotation{{Text: fhir.ToStringPtr("Diabetes")}}}
+
+		assert.Equal(t, types.Problem{Name: "Diabetes", Status: types.ProblemStatusActive}, ToDomainProblem(condition))
+	})
+}
+
+func toPtr(value string) *string {
+	return &value
+}
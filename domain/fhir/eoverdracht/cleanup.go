@@ -0,0 +1,103 @@
+package eoverdracht
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/sirupsen/logrus"
+)
+
+// enteredInError is the status of resources which should not have been created, e.g. those of a cancelled transfer.
+const enteredInError = "entered-in-error"
+
+// CleanupTransfer removes the compositions of a cancelled transfer together with the resources they refer to in a
+// single transaction. The anonymous Patient of the advance notice is removed afterwards with a conditional delete, the
+// (real) Patient of the nursing handoff is kept. When the resources can't be removed, e.g. because Tasks still refer to the compositions,
+// they are marked entered-in-error instead.
+func (s transferService) CleanupTransfer(ctx context.Context, advanceNoticeID string, nursingHandoffID *string) error {
+	compositionIDs := []string{advanceNoticeID}
+	if nursingHandoffID != nil {
+		compositionIDs = append(compositionIDs, *nursingHandoffID)
+	}
+	var paths []string
+	var anonymousPatientID string
+	for _, compositionID := range compositionIDs {
+		composition := fhir.Composition{}
+		if err := s.fhirClient.ReadOne(ctx, "Composition/"+compositionID, &composition); err != nil {
+			return fmt.Errorf("could not clean up transfer: %w", err)
+		}
+		// the nursing handoff refers to the same problems and interventions as the advance notice
+		for _, path := range append([]string{"Composition/" + compositionID}, sectionEntries(composition.Section)...) {
+			if !slices.Contains(paths, path) {
+				paths = append(paths, path)
+			}
+		}
+		if compositionID == advanceNoticeID {
+			anonymousPatientID = strings.TrimPrefix(strings.TrimPrefix(fhir.FromStringPtr(composition.Subject.Reference), "/"), "Patient/")
+		}
+	}
+
+	bundle := resources.Bundle{}
+	for _, path := range paths {
+		bundle.Entry = append(bundle.Entry, fhir.DeleteEntry(path))
+	}
+	_, err := s.fhirClient.Transaction(ctx, bundle)
+	if err == nil {
+		if anonymousPatientID == "" {
+			return nil
+		}
+		// the patient is only deleted if it's anonymous, in case the advance notice refers to a real patient
+		if err := s.fhirClient.DeleteWhere(ctx, "Patient", map[string]string{"_id": anonymousPatientID, "name:missing": "true"}); err != nil {
+			return fmt.Errorf("could not clean up transfer: %w", err)
+		}
+		return nil
+	}
+	logrus.Infof("Could not delete resources of cancelled transfer, marking them %s instead (advance-notice=%s): %s", enteredInError, advanceNoticeID, err)
+
+	if anonymousPatientID != "" {
+		paths = append(paths, "Patient/"+anonymousPatientID)
+	}
+	bundle = resources.Bundle{}
+	for _, path := range paths {
+		resource := map[string]interface{}{}
+		if err := s.fhirClient.ReadOne(ctx, path, &resource); err != nil {
+			return fmt.Errorf("could not clean up transfer: %w", err)
+		}
+		markEnteredInError(resource)
+		bundle.Entry = append(bundle.Entry, fhir.PutEntry(path, resource))
+	}
+	if _, err := s.fhirClient.Transaction(ctx, bundle); err != nil {
+		return fmt.Errorf("could not clean up transfer: %w", err)
+	}
+	return nil
+}
+
+// markEnteredInError sets the status of the resource to entered-in-error. Resources without status are set inactive.
+func markEnteredInError(resource map[string]interface{}) {
+	switch resource["resourceType"] {
+	case "Condition", "AllergyIntolerance":
+		// the clinical status must be left out when the verification status is entered-in-error
+		delete(resource, "clinicalStatus")
+		resource["verificationStatus"] = enteredInError
+	case "Patient", "Practitioner", "RelatedPerson":
+		resource["active"] = false
+	default:
+		resource["status"] = enteredInError
+	}
+}
+
+// sectionEntries returns the paths of the resources the sections (and their subsections) refer to.
+func sectionEntries(sections []fhir.CompositionSection) []string {
+	var paths []string
+	for _, section := range sections {
+		for _, entry := range section.Entry {
+			paths = append(paths, strings.TrimPrefix(fhir.FromStringPtr(entry.Reference), "/"))
+		}
+		paths = append(paths, sectionEntries(section.Section)...)
+	}
+	return paths
+}
@@ -12,6 +12,7 @@ var (
 	SnomedNursingHandoffCode  datatypes.Code   = "371535009"
 	NursingHandoffDisplay     datatypes.String = "verslag van zorg"
 	TransferDisplay           datatypes.String = "Overdracht van zorg"
+	AlternativeDateDisplay    datatypes.String = "Alternatieve datum"
 )
 
 const (
@@ -20,6 +21,26 @@ const (
 	NursingDiagnosisCode  = "86644006"
 )
 
+// Codes of the sections of the nursing handoff which are not part of the advance notice
+const (
+	MedicationOverviewCode      = "10160-0"
+	AllergiesCode               = "48765-2"
+	WoundCareCode               = "225358003"
+	FunctionalStatusCode        = "47420-5"
+	ContactPersonsCode          = "133932002"
+	ResponsiblePractitionerCode = "223366009"
+)
+
+// InterventionFrequencyExtension holds the Timing of a nursing intervention, which the Procedure resource doesn't support
+const InterventionFrequencyExtension = "http://nictiz.nl/fhir/StructureDefinition/eOverdracht-InterventionFrequency"
+
+// Codes of the resources in the nursing handoff sections
+const (
+	WoundCode           = "416462003"
+	MobilityCode        = "301438001"
+	DailyActivitiesCode = "129025006"
+)
+
 /* Short-hand types */
 var AdministrativeDocConcept = datatypes.CodeableConcept{
 	Coding: []datatypes.Coding{{
@@ -28,6 +49,69 @@ var AdministrativeDocConcept = datatypes.CodeableConcept{
 		Display: fhir.ToStringPtr("Administrative documentation (record artifact)"),
 	}}}
 
+var MedicationOverviewConcept = datatypes.CodeableConcept{
+	Coding: []datatypes.Coding{{
+		System:  &fhir.LoincCodingSystem,
+		Code:    fhir.ToCodePtr(MedicationOverviewCode),
+		Display: fhir.ToStringPtr("History of Medication use Narrative"),
+	}}}
+
+var AllergiesConcept = datatypes.CodeableConcept{
+	Coding: []datatypes.Coding{{
+		System:  &fhir.LoincCodingSystem,
+		Code:    fhir.ToCodePtr(AllergiesCode),
+		Display: fhir.ToStringPtr("Allergies and adverse reactions Document"),
+	}}}
+
+var WoundCareConcept = datatypes.CodeableConcept{
+	Coding: []datatypes.Coding{{
+		System:  &fhir.SnomedCodingSystem,
+		Code:    fhir.ToCodePtr(WoundCareCode),
+		Display: fhir.ToStringPtr("Wound care (regime/therapy)"),
+	}}}
+
+var FunctionalStatusConcept = datatypes.CodeableConcept{
+	Coding: []datatypes.Coding{{
+		System:  &fhir.LoincCodingSystem,
+		Code:    fhir.ToCodePtr(FunctionalStatusCode),
+		Display: fhir.ToStringPtr("Functional status assessment note"),
+	}}}
+
+var ContactPersonsConcept = datatypes.CodeableConcept{
+	Coding: []datatypes.Coding{{
+		System:  &fhir.SnomedCodingSystem,
+		Code:    fhir.ToCodePtr(ContactPersonsCode),
+		Display: fhir.ToStringPtr("Caregiver (person)"),
+	}}}
+
+var ResponsiblePractitionerConcept = datatypes.CodeableConcept{
+	Coding: []datatypes.Coding{{
+		System:  &fhir.SnomedCodingSystem,
+		Code:    fhir.ToCodePtr(ResponsiblePractitionerCode),
+		Display: fhir.ToStringPtr("Healthcare professional (occupation)"),
+	}}}
+
+var WoundConcept = datatypes.CodeableConcept{
+	Coding: []datatypes.Coding{{
+		System:  &fhir.SnomedCodingSystem,
+		Code:    fhir.ToCodePtr(WoundCode),
+		Display: fhir.ToStringPtr("Wound (disorder)"),
+	}}}
+
+var MobilityConcept = datatypes.CodeableConcept{
+	Coding: []datatypes.Coding{{
+		System:  &fhir.SnomedCodingSystem,
+		Code:    fhir.ToCodePtr(MobilityCode),
+		Display: fhir.ToStringPtr("Ability to mobilize"),
+	}}}
+
+var DailyActivitiesConcept = datatypes.CodeableConcept{
+	Coding: []datatypes.Coding{{
+		System:  &fhir.SnomedCodingSystem,
+		Code:    fhir.ToCodePtr(DailyActivitiesCode),
+		Display: fhir.ToStringPtr("Activity of daily living"),
+	}}}
+
 var LoincAdvanceNoticeType = datatypes.CodeableConcept{
 	Coding: []datatypes.Coding{{
 		System: &fhir.LoincCodingSystem,
@@ -52,6 +136,14 @@ var SnomedNursingHandoffType = datatypes.CodeableConcept{
 	}},
 }
 
+var SnomedAlternativeDateType = datatypes.CodeableConcept{
+	Coding: []datatypes.Coding{{
+		System:  &fhir.SnomedCodingSystem,
+		Code:    &SnomedAlternaticeDateCode,
+		Display: &AlternativeDateDisplay,
+	}},
+}
+
 var SnomedTransferType = datatypes.CodeableConcept{
 	Coding: []datatypes.Coding{{
 		System:  &fhir.SnomedCodingSystem,
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/monarko/fhirgo/STU3/datatypes"
 	"github.com/monarko/fhirgo/STU3/resources"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
@@ -14,19 +15,73 @@ import (
 )
 
 func ToDomainProblem(condition resources.Condition) types.Problem {
-	var notes []string
-	for _, note := range condition.Note {
-		notes = append(notes, fhir.FromStringPtr(note.Text))
+	problem := types.Problem{Status: types.ProblemStatusActive}
+	if condition.ClinicalStatus != nil {
+		problem.Status = types.ProblemStatus(fhir.FromCodePtr(condition.ClinicalStatus))
 	}
-	return types.Problem{
-		// TODO: get the name from the value instead of the notes
-		Name:   strings.Join(notes, ","),
-		Status: "active",
+	if condition.Code != nil {
+		problem.Code = toDomainConcept(*condition.Code)
+		problem.Name = fhir.FromStringPtr(condition.Code.Text)
+		if problem.Name == "" && problem.Code != nil {
+			problem.Name = problem.Code.Display
+		}
+	}
+	if problem.Name == "" {
+		// Conditions of older transfers only contain the name of the problem as note
+		var notes []string
+		for _, note := range condition.Note {
+			notes = append(notes, fhir.FromStringPtr(note.Text))
+		}
+		problem.Name = strings.Join(notes, ",")
 	}
+	if condition.OnsetDateTime != nil {
+		if onset, err := time.Parse(types.DobFormat, string(*condition.OnsetDateTime)[:min(len(types.DobFormat), len(*condition.OnsetDateTime))]); err == nil {
+			problem.OnsetDate = &openapiTypes.Date{Time: onset}
+		}
+	}
+	return problem
 }
 
 func ToDomainIntervention(procedure fhir.Procedure) types.Intervention {
-	return types.Intervention{Comment: fhir.FromStringPtr(procedure.Note[0].Text)}
+	intervention := types.Intervention{}
+	if len(procedure.Note) > 0 {
+		intervention.Comment = fhir.FromStringPtr(procedure.Note[0].Text)
+	}
+	if procedure.Code != nil {
+		intervention.Code = toDomainConcept(*procedure.Code)
+	}
+	for _, extension := range procedure.Extension {
+		if fhir.FromUriPtr(extension.URL) != InterventionFrequencyExtension || extension.ValueTiming == nil || extension.ValueTiming.Repeat == nil {
+			continue
+		}
+		repeat := extension.ValueTiming.Repeat
+		frequency := &types.InterventionFrequency{PeriodUnit: types.InterventionFrequencyPeriodUnit(fhir.FromCodePtr(repeat.PeriodUnit))}
+		if repeat.Frequency != nil {
+			frequency.Frequency = int(*repeat.Frequency)
+		}
+		if repeat.Period != nil {
+			frequency.Period = float32(*repeat.Period)
+		}
+		intervention.Frequency = frequency
+	}
+	return intervention
+}
+
+// toDomainConcept returns the first coding of the CodeableConcept, or nil if it only has a text.
+func toDomainConcept(concept datatypes.CodeableConcept) *types.CodedConcept {
+	if len(concept.Coding) == 0 {
+		return nil
+	}
+	coding := concept.Coding[0]
+	system := ""
+	if coding.System != nil {
+		system = string(*coding.System)
+	}
+	return &types.CodedConcept{
+		System:  system,
+		Code:    fhir.FromCodePtr(coding.Code),
+		Display: fhir.FromStringPtr(coding.Display),
+	}
 }
 
 func ToDomainPatient(fhirPatient resources.Patient) types.Patient {
@@ -116,5 +171,110 @@ func NursingHandoffToDomainTransfer(nursingHandoff NursingHandoff) (types.Transf
 			})
 
 	}
+	domainTransfer.HandoffContent = ToDomainHandoffContent(nursingHandoff)
 	return domainTransfer, nil
 }
+
+// ToDomainHandoffContent converts the resources of the nursing handoff sections which are not part of the advance notice.
+func ToDomainHandoffContent(nursingHandoff NursingHandoff) *types.NursingHandoffContent {
+	content := types.NursingHandoffContent{}
+
+	medications := []types.Medication{}
+	for _, statement := range nursingHandoff.Medications {
+		medication := types.Medication{Name: fhir.FromStringPtr(statement.MedicationCodeableConcept.Text)}
+		if len(statement.Dosage) > 0 {
+			medication.Dosage = fromStringPtr(statement.Dosage[0].Text)
+		}
+		if len(statement.Note) > 0 {
+			medication.Comment = fromStringPtr(statement.Note[0].Text)
+		}
+		medications = append(medications, medication)
+	}
+	content.Medications = &medications
+
+	allergies := []types.Allergy{}
+	for _, allergyIntolerance := range nursingHandoff.Allergies {
+		allergy := types.Allergy{}
+		if allergyIntolerance.Code != nil {
+			allergy.Substance = fhir.FromStringPtr(allergyIntolerance.Code.Text)
+		}
+		if allergyIntolerance.Criticality != nil {
+			criticality := types.AllergyCriticality(fhir.FromCodePtr(allergyIntolerance.Criticality))
+			allergy.Criticality = &criticality
+		}
+		if len(allergyIntolerance.Reaction) > 0 && len(allergyIntolerance.Reaction[0].Manifestation) > 0 {
+			allergy.Reaction = fromStringPtr(allergyIntolerance.Reaction[0].Manifestation[0].Text)
+		}
+		allergies = append(allergies, allergy)
+	}
+	content.Allergies = &allergies
+
+	woundCare := []types.WoundCare{}
+	for _, wound := range nursingHandoff.Wounds {
+		domainWound := types.WoundCare{}
+		if wound.BodySite != nil {
+			domainWound.Location = fhir.FromStringPtr(wound.BodySite.Text)
+		}
+		if len(wound.Note) > 0 {
+			domainWound.Description = fromStringPtr(wound.Note[0].Text)
+		}
+		for _, treatment := range nursingHandoff.WoundTreatments {
+			if len(treatment.ReasonReference) > 0 && len(treatment.Note) > 0 &&
+				fhir.FromStringPtr(treatment.ReasonReference[0].Reference) == "Condition/"+fhir.FromIDPtr(wound.ID) {
+				domainWound.Treatment = fromStringPtr(treatment.Note[0].Text)
+			}
+		}
+		woundCare = append(woundCare, domainWound)
+	}
+	content.WoundCare = &woundCare
+
+	for _, observation := range nursingHandoff.FunctionalStatus {
+		switch {
+		case hasCode(observation.Code, MobilityCode):
+			content.Mobility = fromStringPtr(observation.ValueString)
+		case hasCode(observation.Code, DailyActivitiesCode):
+			content.DailyActivities = fromStringPtr(observation.ValueString)
+		}
+	}
+
+	contactPersons := []types.ContactPerson{}
+	for _, relatedPerson := range nursingHandoff.ContactPersons {
+		contactPerson := types.ContactPerson{}
+		if len(relatedPerson.Name) > 0 {
+			contactPerson.Name = fhir.FromStringPtr(relatedPerson.Name[0].Text)
+		}
+		if relatedPerson.Relationship != nil {
+			contactPerson.Relationship = fromStringPtr(relatedPerson.Relationship.Text)
+		}
+		if len(relatedPerson.Telecom) > 0 {
+			contactPerson.Telephone = fromStringPtr(relatedPerson.Telecom[0].Value)
+		}
+		contactPersons = append(contactPersons, contactPerson)
+	}
+	content.ContactPersons = &contactPersons
+
+	if practitioner := nursingHandoff.ResponsiblePractitioner; practitioner != nil {
+		responsiblePractitioner := types.ResponsiblePractitioner{}
+		if len(practitioner.Name) > 0 {
+			responsiblePractitioner.Name = fhir.FromStringPtr(practitioner.Name[0].Text)
+		}
+		if len(practitioner.Qualification) > 0 && practitioner.Qualification[0].Code != nil {
+			responsiblePractitioner.Role = fromStringPtr(practitioner.Qualification[0].Code.Text)
+		}
+		if len(practitioner.Telecom) > 0 {
+			responsiblePractitioner.Telephone = fromStringPtr(practitioner.Telecom[0].Value)
+		}
+		content.ResponsiblePractitioner = &responsiblePractitioner
+	}
+
+	return &content
+}
+
+// fromStringPtr converts an optional FHIR string to an optional domain string.
+func fromStringPtr(str *datatypes.String) *string {
+	if str == nil {
+		return nil
+	}
+	result := string(*str)
+	return &result
+}
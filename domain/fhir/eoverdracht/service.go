@@ -2,40 +2,84 @@ package eoverdracht
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/monarko/fhirgo/STU3/datatypes"
 	"github.com/monarko/fhirgo/STU3/resources"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
+	"github.com/sirupsen/logrus"
 )
 
 type TransferService interface {
 	GetTask(ctx context.Context, taskID string) (*TransferTask, error)
 	CreateTask(ctx context.Context, domainTask TransferTask) (TransferTask, error)
+	// DeleteTask removes the Task, it is used to undo the creation of a Task.
+	DeleteTask(ctx context.Context, fhirTaskID string) error
 	UpdateTaskStatus(ctx context.Context, fhirTaskID string, newState string) error
 	UpdateTask(ctx context.Context, fhirTaskID string, callbackFn func(domainTask TransferTask) TransferTask) error
+	// ProposeAlternativeDate puts the Task on-hold and adds the alternative transfer date as Task output.
+	ProposeAlternativeDate(ctx context.Context, fhirTaskID string, alternativeDate time.Time) error
 
 	CreateAdvanceNotice(ctx context.Context, advanceNotice AdvanceNotice) error
 	CreateNursingHandoff(ctx context.Context, nursingHandoff NursingHandoff) error
+	// DeleteNursingHandoff removes the resources stored by CreateNursingHandoff, it is used to undo storing a nursing handoff.
+	DeleteNursingHandoff(ctx context.Context, nursingHandoff NursingHandoff) error
+	// ImportCarePlan stores the resources of a care plan import in a single FHIR transaction.
+	ImportCarePlan(ctx context.Context, carePlanImport CarePlanImport) error
+	// CleanupTransfer removes (or marks entered-in-error) the compositions of a cancelled transfer and the resources they refer to.
+	CleanupTransfer(ctx context.Context, advanceNoticeID string, nursingHandoffID *string) error
 
 	GetAdvanceNotice(ctx context.Context, fhirCompositionID string) (AdvanceNotice, error)
 	GetNursingHandoff(ctx context.Context, fhirCompositionID string) (NursingHandoff, error)
 }
 
-func NewFHIRTransferService(client fhir.Client) TransferService {
-	return &transferService{fhirClient: client, resourceBuilder: NewFHIRBuilder()}
+type TransferServiceOpt func(service *transferService)
+
+// WithStrictValidation makes the TransferService refuse to store resources which don't conform to the eOverdracht profiles.
+// When not strict, violations are only logged.
+func WithStrictValidation(strict bool) TransferServiceOpt {
+	return func(service *transferService) {
+		service.strictValidation = strict
+	}
+}
+
+func NewFHIRTransferService(client fhir.Client, opts ...TransferServiceOpt) TransferService {
+	service := &transferService{fhirClient: client, resourceBuilder: NewFHIRBuilder(), validator: bundledValidator}
+	for _, opt := range opts {
+		opt(service)
+	}
+	return service
 }
 
 type transferService struct {
-	fhirClient      fhir.Client
-	resourceBuilder TransferFHIRBuilder
+	fhirClient       fhir.Client
+	resourceBuilder  TransferFHIRBuilder
+	validator        *Validator
+	strictValidation bool
+}
+
+// validate validates the resources against the eOverdracht profiles before they are stored or shared.
+// It only returns a ValidationError in strict mode.
+func (s transferService) validate(resourcesToValidate ...interface{}) error {
+	err := s.validator.Validate(resourcesToValidate...)
+	var validationErr ValidationError
+	if errors.As(err, &validationErr) && !s.strictValidation {
+		logrus.Warn(err)
+		return nil
+	}
+	return err
 }
 
 func (s transferService) CreateTask(ctx context.Context, domainTask TransferTask) (TransferTask, error) {
 	transferTask := s.resourceBuilder.BuildTask(fhir.TaskProperties{
-		Status: domainTask.Status,
+		Status:      domainTask.Status,
+		RequesterID: domainTask.SenderID,
+		OwnerID:     domainTask.ReceiverID,
 	})
 
 	if domainTask.AdvanceNoticeID != nil {
@@ -51,6 +95,9 @@ func (s transferService) CreateTask(ctx context.Context, domainTask TransferTask
 		})
 	}
 
+	if err := s.validate(transferTask); err != nil {
+		return domainTask, fmt.Errorf("could not create FHIR Task: %w", err)
+	}
 	err := s.fhirClient.CreateOrUpdate(ctx, transferTask, nil)
 	if err != nil {
 		return domainTask, fmt.Errorf("could not create FHIR Task: %w", err)
@@ -59,7 +106,22 @@ func (s transferService) CreateTask(ctx context.Context, domainTask TransferTask
 	return domainTask, nil
 }
 
+func (s transferService) DeleteTask(ctx context.Context, fhirTaskID string) error {
+	if err := s.fhirClient.Delete(ctx, "Task/"+fhirTaskID); err != nil {
+		return fmt.Errorf("could not delete FHIR Task: %w", err)
+	}
+	return nil
+}
+
+// UpdateTask applies the callback to the current Task. If the Task is modified concurrently (e.g. by the receiver),
+// the callback is applied again to the fresh Task, so neither update gets lost.
 func (s transferService) UpdateTask(ctx context.Context, fhirTaskID string, callbackFn func(domainTask TransferTask) TransferTask) error {
+	return fhir.RetryOnConflict(func() error {
+		return s.updateTask(ctx, fhirTaskID, callbackFn)
+	})
+}
+
+func (s transferService) updateTask(ctx context.Context, fhirTaskID string, callbackFn func(domainTask TransferTask) TransferTask) error {
 	task, err := s.GetTask(ctx, fhirTaskID)
 	if err != nil {
 		return err
@@ -68,9 +130,14 @@ func (s transferService) UpdateTask(ctx context.Context, fhirTaskID string, call
 	domainTask := callbackFn(*task)
 
 	transferTask := s.resourceBuilder.BuildTask(fhir.TaskProperties{
-		ID:     &domainTask.ID,
-		Status: domainTask.Status,
+		ID:          &domainTask.ID,
+		Status:      domainTask.Status,
+		RequesterID: domainTask.SenderID,
+		OwnerID:     domainTask.ReceiverID,
 	})
+	if task.VersionID != "" {
+		transferTask.Meta = &datatypes.Meta{VersionID: fhir.ToIDPtr(task.VersionID)}
+	}
 
 	if domainTask.AdvanceNoticeID != nil {
 		transferTask.Input = append(transferTask.Input, resources.TaskInputOutput{
@@ -84,7 +151,13 @@ func (s transferService) UpdateTask(ctx context.Context, fhirTaskID string, call
 			ValueReference: &datatypes.Reference{Reference: fhir.ToStringPtr("/Composition/" + *domainTask.NursingHandoffID)},
 		})
 	}
+	if domainTask.AlternativeDate != nil {
+		transferTask.Output = append(transferTask.Output, alternativeDateOutput(*domainTask.AlternativeDate))
+	}
 
+	if err = s.validate(transferTask); err != nil {
+		return fmt.Errorf("could not update FHIR Task: %w", err)
+	}
 	err = s.fhirClient.CreateOrUpdate(ctx, transferTask, nil)
 	if err != nil {
 		return fmt.Errorf("could not update FHIR Task: %w", err)
@@ -92,36 +165,163 @@ func (s transferService) UpdateTask(ctx context.Context, fhirTaskID string, call
 	return nil
 }
 
-func (s transferService) CreateAdvanceNotice(ctx context.Context, advanceNotice AdvanceNotice) error {
-	// Save the Patient
-	err := s.fhirClient.CreateOrUpdate(ctx, advanceNotice.Patient, nil)
-	if err != nil {
+func (s transferService) ProposeAlternativeDate(ctx context.Context, fhirTaskID string, alternativeDate time.Time) error {
+	return fhir.RetryOnConflict(func() error {
+		return s.proposeAlternativeDate(ctx, fhirTaskID, alternativeDate)
+	})
+}
+
+func (s transferService) proposeAlternativeDate(ctx context.Context, fhirTaskID string, alternativeDate time.Time) error {
+	task := &resources.Task{}
+
+	if err := s.fhirClient.ReadOne(ctx, "Task/"+fhirTaskID, &task); err != nil {
 		return err
 	}
-	// Save the all the problems
-	for _, problem := range advanceNotice.Problems {
-		err = s.fhirClient.CreateOrUpdate(ctx, problem, nil)
-		if err != nil {
-			return err
+
+	task.Status = fhir.ToCodePtr(transfer.OnHoldState)
+	// replace a previously proposed date
+	var outputs []resources.TaskInputOutput
+	for _, output := range task.Output {
+		if !hasCode(output.Type, SnomedAlternaticeDateCode) {
+			outputs = append(outputs, output)
 		}
 	}
-	// Save all the interventions
-	for _, intervention := range advanceNotice.Interventions {
-		err = s.fhirClient.CreateOrUpdate(ctx, intervention, nil)
+	task.Output = append(outputs, alternativeDateOutput(alternativeDate))
+
+	if err := s.fhirClient.CreateOrUpdate(ctx, task, nil); err != nil {
+		return fmt.Errorf("could not propose alternative date: %w", err)
+	}
+	return nil
+}
+
+// AlternativeDateFromTask returns the transfer date proposed by the receiver from the Task output, or nil if there is none.
+// The date is a FHIR dateTime, which is either a full date and time or only a date (e.g. 2024-05-01).
+func AlternativeDateFromTask(task resources.Task) (*time.Time, error) {
+	for _, output := range task.Output {
+		if !hasCode(output.Type, SnomedAlternaticeDateCode) || output.ValueDateTime == nil {
+			continue
+		}
+		value := string(*output.ValueDateTime)
+		alternativeDate, err := time.Parse(time.RFC3339, value)
 		if err != nil {
-			return err
+			alternativeDate, err = time.Parse(time.DateOnly, value)
 		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse alternative date: %w", err)
+		}
+		return &alternativeDate, nil
 	}
-	// At least save the composition
-	err = s.fhirClient.CreateOrUpdate(ctx, advanceNotice.Composition, nil)
-	if err != nil {
+	return nil, nil
+}
+
+// alternativeDateOutput builds the Task output which holds the transfer date proposed by the receiver.
+func alternativeDateOutput(alternativeDate time.Time) resources.TaskInputOutput {
+	return resources.TaskInputOutput{
+		Type:          &SnomedAlternativeDateType,
+		ValueDateTime: fhir.ToDateTimePtr(alternativeDate.Format(time.RFC3339)),
+	}
+}
+
+// CreateAdvanceNotice stores the resources of the advance notice in a single FHIR transaction, so the advance notice
+// is never stored partially.
+func (s transferService) CreateAdvanceNotice(ctx context.Context, advanceNotice AdvanceNotice) error {
+	bundle := resources.Bundle{}
+	bundle.Entry = append(bundle.Entry, fhir.PutEntry("Patient/"+fhir.FromIDPtr(advanceNotice.Patient.ID), advanceNotice.Patient))
+	for _, problem := range advanceNotice.Problems {
+		bundle.Entry = append(bundle.Entry, fhir.PutEntry("Condition/"+fhir.FromIDPtr(problem.ID), problem))
+	}
+	for _, intervention := range advanceNotice.Interventions {
+		bundle.Entry = append(bundle.Entry, fhir.PutEntry("Procedure/"+fhir.FromIDPtr(intervention.ID), intervention))
+	}
+	bundle.Entry = append(bundle.Entry, fhir.PutEntry("Composition/"+fhir.FromIDPtr(advanceNotice.Composition.ID), advanceNotice.Composition))
+
+	var resourcesToValidate []interface{}
+	for _, entry := range bundle.Entry {
+		resourcesToValidate = append(resourcesToValidate, entry.Resource)
+	}
+	if err := s.validate(resourcesToValidate...); err != nil {
 		return err
 	}
+	if _, err := s.fhirClient.Transaction(ctx, bundle); err != nil {
+		return fmt.Errorf("could not store advance notice: %w", err)
+	}
 	return nil
 }
 
+// CreateNursingHandoff stores the resources of the nursing handoff in a single FHIR transaction, so the nursing handoff
+// is never stored partially. The Patient, Problems and Interventions are not stored since they already exist.
 func (s transferService) CreateNursingHandoff(ctx context.Context, nursingHandoff NursingHandoff) error {
-	panic("implement me")
+	bundle := resources.Bundle{Entry: nursingHandoffEntries(nursingHandoff)}
+
+	var resourcesToValidate []interface{}
+	for _, entry := range bundle.Entry {
+		resourcesToValidate = append(resourcesToValidate, entry.Resource)
+	}
+	if err := s.validate(resourcesToValidate...); err != nil {
+		return fmt.Errorf("could not store nursing handoff: %w", err)
+	}
+	if _, err := s.fhirClient.Transaction(ctx, bundle); err != nil {
+		return fmt.Errorf("could not store nursing handoff: %w", err)
+	}
+	return nil
+}
+
+// DeleteNursingHandoff removes the resources stored by CreateNursingHandoff in a single FHIR transaction, it is used to
+// undo storing a nursing handoff. The Patient, Problems and Interventions are kept, since they belong to the advance notice.
+func (s transferService) DeleteNursingHandoff(ctx context.Context, nursingHandoff NursingHandoff) error {
+	bundle := resources.Bundle{}
+	// the Composition refers to the other resources, so it's deleted first
+	entries := nursingHandoffEntries(nursingHandoff)
+	for i := len(entries) - 1; i >= 0; i-- {
+		bundle.Entry = append(bundle.Entry, fhir.DeleteEntry(fhir.FromUriPtr(entries[i].Request.URL)))
+	}
+	if _, err := s.fhirClient.Transaction(ctx, bundle); err != nil {
+		return fmt.Errorf("could not delete nursing handoff: %w", err)
+	}
+	return nil
+}
+
+// nursingHandoffEntries returns the Bundle entries which store the resources of the nursing handoff, the Composition is last.
+func nursingHandoffEntries(nursingHandoff NursingHandoff) []resources.BundleEntry {
+	var entries []resources.BundleEntry
+	for _, medication := range nursingHandoff.Medications {
+		entries = append(entries, fhir.PutEntry("MedicationStatement/"+fhir.FromIDPtr(medication.ID), medication))
+	}
+	for _, allergy := range nursingHandoff.Allergies {
+		entries = append(entries, fhir.PutEntry("AllergyIntolerance/"+fhir.FromIDPtr(allergy.ID), allergy))
+	}
+	for _, wound := range nursingHandoff.Wounds {
+		entries = append(entries, fhir.PutEntry("Condition/"+fhir.FromIDPtr(wound.ID), wound))
+	}
+	for _, treatment := range nursingHandoff.WoundTreatments {
+		entries = append(entries, fhir.PutEntry("Procedure/"+fhir.FromIDPtr(treatment.ID), treatment))
+	}
+	for _, observation := range nursingHandoff.FunctionalStatus {
+		entries = append(entries, fhir.PutEntry("Observation/"+fhir.FromIDPtr(observation.ID), observation))
+	}
+	for _, contactPerson := range nursingHandoff.ContactPersons {
+		entries = append(entries, fhir.PutEntry("RelatedPerson/"+fhir.FromIDPtr(contactPerson.ID), contactPerson))
+	}
+	if nursingHandoff.ResponsiblePractitioner != nil {
+		entries = append(entries, fhir.PutEntry("Practitioner/"+fhir.FromIDPtr(nursingHandoff.ResponsiblePractitioner.ID), *nursingHandoff.ResponsiblePractitioner))
+	}
+	return append(entries, fhir.PutEntry("Composition/"+fhir.FromIDPtr(nursingHandoff.Composition.ID), nursingHandoff.Composition))
+}
+
+func (s transferService) ImportCarePlan(ctx context.Context, carePlanImport CarePlanImport) error {
+	bundle := resources.Bundle{}
+	for _, problem := range carePlanImport.Problems {
+		bundle.Entry = append(bundle.Entry, fhir.PutEntry("Condition/"+fhir.FromIDPtr(problem.ID), problem))
+	}
+	for _, procedure := range carePlanImport.Procedures {
+		bundle.Entry = append(bundle.Entry, fhir.PutEntry("Procedure/"+fhir.FromIDPtr(procedure.ID), procedure))
+	}
+	bundle.Entry = append(bundle.Entry, fhir.PutEntry("Provenance/"+fhir.FromIDPtr(carePlanImport.Provenance.ID), carePlanImport.Provenance))
+
+	if _, err := s.fhirClient.Transaction(ctx, bundle); err != nil {
+		return fmt.Errorf("could not import care plan: %w", err)
+	}
+	return nil
 }
 
 func (s transferService) GetTask(ctx context.Context, taskID string) (*TransferTask, error) {
@@ -132,9 +332,17 @@ func (s transferService) GetTask(ctx context.Context, taskID string) (*TransferT
 	}
 
 	task := &TransferTask{
-		ID:         fhir.FromIDPtr(fhirTask.ID),
-		Status:     fhir.FromCodePtr(fhirTask.Status),
-		ReceiverID: fhir.FromStringPtr(fhirTask.Owner.Identifier.Value),
+		ID:     fhir.FromIDPtr(fhirTask.ID),
+		Status: fhir.FromCodePtr(fhirTask.Status),
+	}
+	if fhirTask.Meta != nil {
+		task.VersionID = fhir.FromIDPtr(fhirTask.Meta.VersionID)
+	}
+	if fhirTask.Requester != nil && fhirTask.Requester.Agent != nil && fhirTask.Requester.Agent.Identifier != nil {
+		task.SenderID = fhir.FromStringPtr(fhirTask.Requester.Agent.Identifier.Value)
+	}
+	if fhirTask.Owner != nil && fhirTask.Owner.Identifier != nil {
+		task.ReceiverID = fhir.FromStringPtr(fhirTask.Owner.Identifier.Value)
 	}
 
 	if input := s.findTaskInputOutputByCode(fhirTask.Input, LoincAdvanceNoticeCode); input != nil {
@@ -147,6 +355,9 @@ func (s transferService) GetTask(ctx context.Context, taskID string) (*TransferT
 		ref = strings.Split(ref, "Composition/")[1]
 		task.NursingHandoffID = &ref
 	}
+	if task.AlternativeDate, err = AlternativeDateFromTask(fhirTask); err != nil {
+		return nil, fmt.Errorf("invalid task (task-id=%s): %w", taskID, err)
+	}
 
 	return task, nil
 }
@@ -155,19 +366,21 @@ func (s transferService) UpdateTaskStatus(ctx context.Context, fhirTaskID string
 	// TODO: check for valid state changes
 	const updateErr = "could not update task state: %w"
 
-	task := &resources.Task{}
+	return fhir.RetryOnConflict(func() error {
+		task := &resources.Task{}
 
-	if err := s.fhirClient.ReadOne(ctx, "Task/"+fhirTaskID, &task); err != nil {
-		return err
-	}
+		if err := s.fhirClient.ReadOne(ctx, "Task/"+fhirTaskID, &task); err != nil {
+			return err
+		}
 
-	task.Status = fhir.ToCodePtr(newStatus)
+		task.Status = fhir.ToCodePtr(newStatus)
 
-	if err := s.fhirClient.CreateOrUpdate(ctx, task, nil); err != nil {
-		return fmt.Errorf(updateErr, err)
-	}
+		if err := s.fhirClient.CreateOrUpdate(ctx, task, nil); err != nil {
+			return fmt.Errorf(updateErr, err)
+		}
 
-	return nil
+		return nil
+	})
 }
 
 // GetAdvanceNotice converts a resolved composition into a AdvanceNotice
@@ -237,18 +450,85 @@ func (s transferService) GetNursingHandoff(ctx context.Context, fhirCompositionI
 		}
 	}
 
+	// The sections below are optional, they are only present when they have content
+	if section, err := FilterCompositionSectionByType(composition.Section, MedicationOverviewCode); err == nil {
+		medications, err := s.resolveCompositionEntry(ctx, section, fhir.MedicationStatement{})
+		if err != nil {
+			return NursingHandoff{}, err
+		}
+		for _, medication := range medications {
+			nursingHandoff.Medications = append(nursingHandoff.Medications, *medication.(*fhir.MedicationStatement))
+		}
+	}
+	if section, err := FilterCompositionSectionByType(composition.Section, AllergiesCode); err == nil {
+		allergies, err := s.resolveCompositionEntry(ctx, section, resources.AllergyIntolerance{})
+		if err != nil {
+			return NursingHandoff{}, err
+		}
+		for _, allergy := range allergies {
+			nursingHandoff.Allergies = append(nursingHandoff.Allergies, *allergy.(*resources.AllergyIntolerance))
+		}
+	}
+	if section, err := FilterCompositionSectionByType(composition.Section, WoundCareCode); err == nil {
+		wounds, err := s.resolveCompositionEntry(ctx, section, resources.Condition{})
+		if err != nil {
+			return NursingHandoff{}, err
+		}
+		for _, wound := range wounds {
+			nursingHandoff.Wounds = append(nursingHandoff.Wounds, *wound.(*resources.Condition))
+		}
+		treatments, err := s.resolveCompositionEntry(ctx, section, fhir.Procedure{})
+		if err != nil {
+			return NursingHandoff{}, err
+		}
+		for _, treatment := range treatments {
+			nursingHandoff.WoundTreatments = append(nursingHandoff.WoundTreatments, *treatment.(*fhir.Procedure))
+		}
+	}
+	if section, err := FilterCompositionSectionByType(composition.Section, FunctionalStatusCode); err == nil {
+		observations, err := s.resolveCompositionEntry(ctx, section, resources.Observation{})
+		if err != nil {
+			return NursingHandoff{}, err
+		}
+		for _, observation := range observations {
+			nursingHandoff.FunctionalStatus = append(nursingHandoff.FunctionalStatus, *observation.(*resources.Observation))
+		}
+	}
+	if section, err := FilterCompositionSectionByType(composition.Section, ContactPersonsCode); err == nil {
+		contactPersons, err := s.resolveCompositionEntry(ctx, section, fhir.RelatedPerson{})
+		if err != nil {
+			return NursingHandoff{}, err
+		}
+		for _, contactPerson := range contactPersons {
+			nursingHandoff.ContactPersons = append(nursingHandoff.ContactPersons, *contactPerson.(*fhir.RelatedPerson))
+		}
+	}
+	if section, err := FilterCompositionSectionByType(composition.Section, ResponsiblePractitionerCode); err == nil {
+		practitioners, err := s.resolveCompositionEntry(ctx, section, resources.Practitioner{})
+		if err != nil {
+			return NursingHandoff{}, err
+		}
+		if len(practitioners) > 0 {
+			nursingHandoff.ResponsiblePractitioner = practitioners[0].(*resources.Practitioner)
+		}
+	}
+
 	return nursingHandoff, nil
 }
 
 func (s transferService) findTaskInputOutputByCode(ios []resources.TaskInputOutput, code datatypes.Code) *resources.TaskInputOutput {
 	for _, io := range ios {
-		if fhir.FromCodePtr(io.Type.Coding[0].Code) == string(code) {
+		if hasCode(io.Type, code) {
 			return &io
 		}
 	}
 	return nil
 }
 
+func hasCode(concept *datatypes.CodeableConcept, code datatypes.Code) bool {
+	return concept != nil && len(concept.Coding) > 0 && fhir.FromCodePtr(concept.Coding[0].Code) == string(code)
+}
+
 func (s transferService) resolveCompositionSections(sections []fhir.CompositionSection, code datatypes.CodeableConcept) ([]fhir.CompositionSection, error) {
 	for _, section := range sections {
 		if fhir.FromCodePtr(section.Code.Coding[0].Code) == fhir.FromCodePtr(code.Coding[0].Code) {
@@ -0,0 +1,103 @@
+package eoverdracht
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferService_CreateAdvanceNotice(t *testing.T) {
+	builder := FHIRBuilder{IDGenerator: sequenceGenerator{next: new(int)}}
+	advanceNotice := builder.BuildAdvanceNotice(types.CreateTransferRequest{
+		CarePlan: types.EOverdrachtCarePlan{PatientProblems: []types.PatientProblem{{
+			Problem:       types.Problem{Name: "Diabetes"},
+			Interventions: []types.Intervention{{Comment: "Check glucose"}},
+		}}},
+	}, &types.Patient{ObjectID: "patient-1"})
+
+	t.Run("stored in a single transaction", func(t *testing.T) {
+		client := fhir.NewMockClient(t)
+
+		err := NewFHIRTransferService(client).CreateAdvanceNotice(context.Background(), advanceNotice)
+
+		assert.NoError(t, err)
+		assert.NotNil(t, client.Resource("Composition/"+fhir.FromIDPtr(advanceNotice.Composition.ID)))
+		assert.Len(t, client.Resources("Condition"), 1)
+		assert.Len(t, client.Resources("Procedure"), 1)
+	})
+	t.Run("failed transaction stores nothing", func(t *testing.T) {
+		client := fhir.NewMockClient(t)
+		client.FailOn("Transaction", "Composition")
+
+		err := NewFHIRTransferService(client).CreateAdvanceNotice(context.Background(), advanceNotice)
+
+		assert.ErrorContains(t, err, "could not store advance notice")
+		assert.Empty(t, client.Resources("Patient"))
+		assert.Empty(t, client.Resources("Composition"))
+	})
+}
+
+func TestTransferService_UpdateTask(t *testing.T) {
+	t.Run("concurrent update is retried on the fresh Task", func(t *testing.T) {
+		client := fhir.NewMockClient(t)
+		service := NewFHIRTransferService(client)
+		task, err := service.CreateTask(context.Background(), TransferTask{Status: transfer.RequestedState, ReceiverID: "did:web:receiver"})
+		if !assert.NoError(t, err) {
+			return
+		}
+		calls := 0
+
+		err = service.UpdateTask(context.Background(), task.ID, func(domainTask TransferTask) TransferTask {
+			calls++
+			if calls == 1 {
+				// the receiver accepts the Task after the sender read it
+				assert.NoError(t, service.UpdateTaskStatus(context.Background(), task.ID, transfer.AcceptedState))
+			}
+			compositionID := "composition-1"
+			domainTask.NursingHandoffID = &compositionID
+			return domainTask
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, calls)
+		stored := client.Resource("Task/" + task.ID)
+		assert.Equal(t, transfer.AcceptedState, stored["status"])
+		assert.Len(t, stored["input"], 1)
+	})
+}
+
+func TestAlternativeDateFromTask(t *testing.T) {
+	task := func(value string) resources.Task {
+		return resources.Task{Output: []resources.TaskInputOutput{{Type: &SnomedAlternativeDateType, ValueDateTime: fhir.ToDateTimePtr(value)}}}
+	}
+
+	t.Run("date and time", func(t *testing.T) {
+		date, err := AlternativeDateFromTask(task("2024-05-01T10:00:00+02:00"))
+
+		assert.NoError(t, err)
+		assert.True(t, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC).Equal(*date))
+	})
+	t.Run("date only", func(t *testing.T) {
+		date, err := AlternativeDateFromTask(task("2024-05-01"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), *date)
+	})
+	t.Run("invalid date", func(t *testing.T) {
+		_, err := AlternativeDateFromTask(task("1 May 2024"))
+
+		assert.ErrorContains(t, err, "could not parse alternative date")
+	})
+	t.Run("no alternative date", func(t *testing.T) {
+		date, err := AlternativeDateFromTask(resources.Task{})
+
+		assert.NoError(t, err)
+		assert.Nil(t, date)
+	})
+}
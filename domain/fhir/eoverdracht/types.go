@@ -1,17 +1,25 @@
 package eoverdracht
 
 import (
+	"time"
+
 	"github.com/monarko/fhirgo/STU3/datatypes"
 	"github.com/monarko/fhirgo/STU3/resources"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
 )
 
 type TransferTask struct {
-	ID               string
-	Status           string
+	ID     string
+	Status string
+	// SenderID is the DID of the sending organization, the requester of the Task.
+	SenderID         string
 	ReceiverID       string
 	AdvanceNoticeID  *string
 	NursingHandoffID *string
+	// AlternativeDate contains the transfer date proposed by the receiver when it puts the Task on-hold.
+	AlternativeDate *time.Time
+	// VersionID is the version of the Task that has been read, an update fails if the Task has been modified since.
+	VersionID string
 }
 
 // Practitioner models https://simplifier.net/packages/nictiz.fhir.nl.stu3.zib2017/2.1.1/files/361872
@@ -30,10 +38,30 @@ type AdvanceNotice struct {
 }
 
 // NursingHandoff is a container to hold all FHIR resources associated with a Transfers Nursing Handoff.
-// Note: Currently it contains exactly the same content as a advance notice, but this can be extended.
+// The Problems and Interventions of the care plan are shared with the advance notice, the other resources are only
+// part of the nursing handoff.
 type NursingHandoff struct {
 	Composition   fhir.Composition
 	Patient       resources.Patient
 	Problems      []resources.Condition
 	Interventions []fhir.Procedure
+	Medications   []fhir.MedicationStatement
+	Allergies     []resources.AllergyIntolerance
+	Wounds        []resources.Condition
+	// WoundTreatments refer to the wound they treat as reason, just like the Interventions refer to their Problem.
+	WoundTreatments []fhir.Procedure
+	// FunctionalStatus contains the observations about the mobility and the activities of daily living of the patient.
+	FunctionalStatus        []resources.Observation
+	ContactPersons          []fhir.RelatedPerson
+	ResponsiblePractitioner *resources.Practitioner
+}
+
+// CarePlanImport is a container to hold the FHIR resources which copy the care plan of a received nursing handoff into
+// the local record of the patient. The Provenance targets all copied resources.
+type CarePlanImport struct {
+	// Problems contains the patient problems and the wounds.
+	Problems []resources.Condition
+	// Procedures contains the interventions and the wound treatments.
+	Procedures []fhir.Procedure
+	Provenance fhir.Provenance
 }
@@ -0,0 +1,298 @@
+package eoverdracht
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/monarko/fhirgo/STU3/datatypes"
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+)
+
+// profilesFS contains the StructureDefinitions of the Nictiz profiles the outgoing eOverdracht resources must conform to.
+// They only contain the constraints which can be checked without a terminology server:
+// cardinality, fixed and pattern values and the target types of references.
+//
+//go:embed profiles/*.json
+var profilesFS embed.FS
+
+var bundledValidator = mustLoadValidator()
+
+// Validator validates FHIR resources against the bundled StructureDefinitions.
+type Validator struct {
+	// profiles holds the StructureDefinitions by the resource type they constrain
+	profiles map[string][]structureDefinition
+}
+
+type structureDefinition struct {
+	URL          string `json:"url"`
+	Type         string `json:"type"`
+	Differential struct {
+		Element []elementDefinition `json:"element"`
+	} `json:"differential"`
+}
+
+type elementDefinition struct {
+	Path string                  `json:"path"`
+	Min  int                     `json:"min"`
+	Max  string                  `json:"max"`
+	Type []elementDefinitionType `json:"type"`
+	// Fixed holds the fixed[x] value, the element must equal it.
+	Fixed interface{} `json:"-"`
+	// Pattern holds the pattern[x] value, the element must contain it.
+	Pattern interface{} `json:"-"`
+}
+
+type elementDefinitionType struct {
+	Code          string `json:"code"`
+	TargetProfile string `json:"targetProfile"`
+}
+
+func (e *elementDefinition) UnmarshalJSON(data []byte) error {
+	type plain elementDefinition
+	if err := json.Unmarshal(data, (*plain)(e)); err != nil {
+		return err
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	// the name of fixed[x] and pattern[x] depends on the type of the element, e.g. fixedUri or patternCodeableConcept
+	for key, value := range values {
+		switch {
+		case strings.HasPrefix(key, "fixed"):
+			e.Fixed = value
+		case strings.HasPrefix(key, "pattern"):
+			e.Pattern = value
+		}
+	}
+	return nil
+}
+
+// ValidationError is returned when resources don't conform to their profiles. It holds an OperationOutcome issue per violation.
+type ValidationError struct {
+	Issues []resources.OperationOutcomeIssue
+}
+
+func (e ValidationError) Error() string {
+	var diagnostics []string
+	for _, issue := range e.Issues {
+		diagnostics = append(diagnostics, fhir.FromStringPtr(issue.Diagnostics))
+	}
+	return "resources don't conform to the eOverdracht profiles: " + strings.Join(diagnostics, "; ")
+}
+
+// OperationOutcome returns the issues as FHIR OperationOutcome.
+func (e ValidationError) OperationOutcome() resources.OperationOutcome {
+	return resources.OperationOutcome{
+		Domain: resources.Domain{Base: resources.Base{ResourceType: "OperationOutcome"}},
+		Issue:  e.Issues,
+	}
+}
+
+// NewValidator loads the StructureDefinitions which are bundled with the application.
+func NewValidator() (*Validator, error) {
+	files, err := profilesFS.ReadDir("profiles")
+	if err != nil {
+		return nil, err
+	}
+	validator := &Validator{profiles: map[string][]structureDefinition{}}
+	for _, file := range files {
+		data, err := profilesFS.ReadFile(path.Join("profiles", file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var profile structureDefinition
+		if err := json.Unmarshal(data, &profile); err != nil {
+			return nil, fmt.Errorf("invalid StructureDefinition (file=%s): %w", file.Name(), err)
+		}
+		validator.profiles[profile.Type] = append(validator.profiles[profile.Type], profile)
+	}
+	return validator, nil
+}
+
+func mustLoadValidator() *Validator {
+	validator, err := NewValidator()
+	if err != nil {
+		panic(err)
+	}
+	return validator
+}
+
+// Validate validates the resources against the profiles of their resource type. Resources of a type without profile
+// are not validated. If a resource doesn't conform, a ValidationError with all violations is returned.
+func (v Validator) Validate(resourcesToValidate ...interface{}) error {
+	var issues []resources.OperationOutcomeIssue
+	for _, resource := range resourcesToValidate {
+		data, err := json.Marshal(resource)
+		if err != nil {
+			return err
+		}
+		element := map[string]interface{}{}
+		if err := json.Unmarshal(data, &element); err != nil {
+			return err
+		}
+		resourceType, _ := element["resourceType"].(string)
+		location := resourceType
+		if id, ok := element["id"].(string); ok {
+			location = fmt.Sprintf("%s/%s", resourceType, id)
+		}
+		for _, profile := range v.profiles[resourceType] {
+			for _, definition := range profile.Differential.Element {
+				issues = append(issues, definition.validate(element, location, profile.URL)...)
+			}
+		}
+	}
+	if len(issues) > 0 {
+		return ValidationError{Issues: issues}
+	}
+	return nil
+}
+
+// node is an element of a resource together with its FHIRPath expression, e.g. Task.input[0].type
+type node struct {
+	value      interface{}
+	expression string
+}
+
+func (e elementDefinition) validate(resource map[string]interface{}, location, profileURL string) []resources.OperationOutcomeIssue {
+	segments := strings.Split(e.Path, ".")
+	parents := []node{{value: resource, expression: segments[0]}}
+	for _, segment := range segments[1 : len(segments)-1] {
+		parents = children(parents, segment)
+	}
+
+	var issues []resources.OperationOutcomeIssue
+	newIssue := func(code, expression, diagnostics string) resources.OperationOutcomeIssue {
+		return resources.OperationOutcomeIssue{
+			Severity:    fhir.ToCodePtr("error"),
+			Code:        fhir.ToCodePtr(code),
+			Diagnostics: fhir.ToStringPtr(fmt.Sprintf("%s: %s (resource=%s, profile=%s)", expression, diagnostics, location, profileURL)),
+			Location:    []datatypes.String{datatypes.String(expression)},
+			Expression:  []datatypes.String{datatypes.String(expression)},
+		}
+	}
+	name := segments[len(segments)-1]
+	for _, parent := range parents {
+		values := children([]node{parent}, name)
+		expression := parent.expression + "." + name
+		if len(values) < e.Min {
+			issues = append(issues, newIssue("required", expression, fmt.Sprintf("minimum required = %d, but only found %d", e.Min, len(values))))
+		}
+		if max, err := strconv.Atoi(e.Max); err == nil && len(values) > max {
+			issues = append(issues, newIssue("structure", expression, fmt.Sprintf("maximum allowed = %s, but found %d", e.Max, len(values))))
+		}
+		for _, value := range values {
+			if e.Fixed != nil && !reflect.DeepEqual(value.value, e.Fixed) {
+				issues = append(issues, newIssue("value", value.expression, fmt.Sprintf("value must be %v", e.Fixed)))
+			}
+			if e.Pattern != nil && !containsPattern(value.value, e.Pattern) {
+				patternJSON, _ := json.Marshal(e.Pattern)
+				issues = append(issues, newIssue("value", value.expression, fmt.Sprintf("value must match pattern %s", patternJSON)))
+			}
+			if targetType, ok := e.referenceTargetType(value.value); ok && !e.allowsTarget(targetType) {
+				issues = append(issues, newIssue("invalid", value.expression, fmt.Sprintf("reference to %s is not allowed", targetType)))
+			}
+		}
+	}
+	return issues
+}
+
+// children returns the child elements with the given name, every item of a repeating element is a child.
+// Empty elements (e.g. a Reference without properties) are not present according to FHIR, so they are skipped.
+func children(parents []node, name string) []node {
+	var result []node
+	for _, parent := range parents {
+		object, ok := parent.value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch child := object[name].(type) {
+		case nil:
+		case []interface{}:
+			for i, item := range child {
+				if !isEmpty(item) {
+					result = append(result, node{value: item, expression: fmt.Sprintf("%s.%s[%d]", parent.expression, name, i)})
+				}
+			}
+		default:
+			if !isEmpty(child) {
+				result = append(result, node{value: child, expression: parent.expression + "." + name})
+			}
+		}
+	}
+	return result
+}
+
+func isEmpty(value interface{}) bool {
+	object, ok := value.(map[string]interface{})
+	return ok && len(object) == 0
+}
+
+// referenceTargetType returns the resource type of a literal reference, e.g. Composition for /Composition/123.
+func (e elementDefinition) referenceTargetType(value interface{}) (string, bool) {
+	if len(e.Type) == 0 || e.Type[0].Code != "Reference" {
+		return "", false
+	}
+	reference, _ := value.(map[string]interface{})
+	literal, ok := reference["reference"].(string)
+	if !ok {
+		return "", false
+	}
+	parts := strings.Split(strings.Trim(literal, "/"), "/")
+	if len(parts) < 2 {
+		return "", false
+	}
+	return parts[len(parts)-2], true
+}
+
+func (e elementDefinition) allowsTarget(resourceType string) bool {
+	for _, elementType := range e.Type {
+		if elementType.TargetProfile == "" || path.Base(elementType.TargetProfile) == resourceType {
+			return true
+		}
+	}
+	return false
+}
+
+// containsPattern returns true if the value contains all properties of the pattern. Every item of a repeating pattern
+// must be contained by an item of the value.
+func containsPattern(value, pattern interface{}) bool {
+	switch typedPattern := pattern.(type) {
+	case map[string]interface{}:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, child := range typedPattern {
+			if !containsPattern(object[key], child) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		items, ok := value.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, child := range typedPattern {
+			found := false
+			for _, item := range items {
+				if containsPattern(item, child) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(value, pattern)
+}
@@ -0,0 +1,93 @@
+package eoverdracht
+
+import (
+	"context"
+	"testing"
+
+	"github.com/monarko/fhirgo/STU3/datatypes"
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidator_Validate(t *testing.T) {
+	validator, err := NewValidator()
+	if !assert.NoError(t, err) {
+		return
+	}
+	builder := FHIRBuilder{IDGenerator: sequenceGenerator{next: new(int)}}
+
+	t.Run("built resources conform", func(t *testing.T) {
+		advanceNotice := builder.BuildAdvanceNotice(types.CreateTransferRequest{
+			CarePlan: types.EOverdrachtCarePlan{PatientProblems: []types.PatientProblem{{
+				Problem:       types.Problem{Name: "Diabetes"},
+				Interventions: []types.Intervention{{Comment: "Check glucose"}},
+			}}},
+		}, &types.Patient{ObjectID: "patient-1"})
+		task := builder.BuildTask(fhir.TaskProperties{Status: "requested", RequesterID: "did:web:sender", OwnerID: "did:web:receiver"})
+
+		err := validator.Validate(advanceNotice.Composition, advanceNotice.Problems[0], advanceNotice.Interventions[0], task)
+
+		assert.NoError(t, err)
+	})
+	t.Run("violations", func(t *testing.T) {
+		task := builder.BuildTask(fhir.TaskProperties{Status: "requested", RequesterID: "did:web:sender"})
+		task.Input = []resources.TaskInputOutput{{
+			Type:           &LoincAdvanceNoticeType,
+			ValueReference: &datatypes.Reference{Reference: fhir.ToStringPtr("/Patient/1")},
+		}}
+
+		err := validator.Validate(task)
+
+		var validationErr ValidationError
+		if !assert.ErrorAs(t, err, &validationErr) {
+			return
+		}
+		outcome := validationErr.OperationOutcome()
+		if !assert.Len(t, outcome.Issue, 2) {
+			return
+		}
+		assert.Equal(t, "required", fhir.FromCodePtr(outcome.Issue[0].Code))
+		assert.Equal(t, datatypes.String("Task.owner"), outcome.Issue[0].Expression[0])
+		assert.Equal(t, "invalid", fhir.FromCodePtr(outcome.Issue[1].Code))
+		assert.Equal(t, datatypes.String("Task.input[0].valueReference"), outcome.Issue[1].Expression[0])
+	})
+	t.Run("Task without requester", func(t *testing.T) {
+		task := builder.BuildTask(fhir.TaskProperties{Status: "requested", OwnerID: "did:web:receiver"})
+
+		err := validator.Validate(task)
+
+		var validationErr ValidationError
+		if !assert.ErrorAs(t, err, &validationErr) {
+			return
+		}
+		outcome := validationErr.OperationOutcome()
+		if !assert.Len(t, outcome.Issue, 1) {
+			return
+		}
+		assert.Equal(t, "required", fhir.FromCodePtr(outcome.Issue[0].Code))
+		assert.Equal(t, datatypes.String("Task.requester"), outcome.Issue[0].Expression[0])
+	})
+}
+
+func TestTransferService_CreateTask(t *testing.T) {
+	t.Run("strict validation refuses invalid Task", func(t *testing.T) {
+		client := fhir.NewMockClient(t)
+		service := NewFHIRTransferService(client, WithStrictValidation(true))
+
+		_, err := service.CreateTask(context.Background(), TransferTask{Status: "requested"})
+
+		assert.ErrorAs(t, err, &ValidationError{})
+		assert.Empty(t, client.Resources("Task"))
+	})
+	t.Run("violations are only logged when not strict", func(t *testing.T) {
+		client := fhir.NewMockClient(t)
+		service := NewFHIRTransferService(client)
+
+		_, err := service.CreateTask(context.Background(), TransferTask{Status: "requested"})
+
+		assert.NoError(t, err)
+		assert.Len(t, client.Resources("Task"), 1)
+	})
+}
@@ -0,0 +1,116 @@
+package fhir
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/tidwall/gjson"
+)
+
+// ErrNotFound, ErrGone, ErrConflict and ErrUnauthorized classify the errors of the FHIR server, use them with
+// errors.Is to find out why a request failed, e.g. errors.Is(err, fhir.ErrNotFound).
+var (
+	// ErrNotFound indicates the resource doesn't exist (404), or belongs to another tenant.
+	ErrNotFound = errors.New("FHIR resource not found")
+	// ErrGone indicates the resource has been deleted (410).
+	ErrGone = errors.New("FHIR resource has been deleted")
+	// ErrConflict indicates the request conflicts with the current state of the resource (409 or 412), e.g. because it
+	// has been modified concurrently.
+	ErrConflict = errors.New("FHIR resource conflicts with its current state")
+	// ErrUnauthorized indicates the FHIR server refused the request (401 or 403).
+	ErrUnauthorized = errors.New("FHIR server refused access")
+)
+
+// Issue is an issue of the OperationOutcome the FHIR server returned with an error.
+type Issue struct {
+	// Severity is fatal, error, warning or information.
+	Severity string
+	// Code is the type of the issue, e.g. not-found or invalid.
+	Code        string
+	Diagnostics string
+}
+
+// Error is returned when the FHIR server replies with a non-2xx status.
+type Error struct {
+	// Operation describes the failed request, e.g. "read FHIR resource".
+	Operation string
+	// Path is the request URL or resource path, e.g. Patient/123
+	Path string
+	// Status is the HTTP status code returned by the server.
+	Status int
+	// Issues contains the issues of the OperationOutcome returned by the server. It's empty if the server didn't
+	// return an OperationOutcome.
+	Issues []Issue
+}
+
+func (e Error) Error() string {
+	result := fmt.Sprintf("unable to %s (path=%s,http-status=%d)", e.Operation, e.Path, e.Status)
+	var diagnostics []string
+	for _, issue := range e.Issues {
+		if issue.Diagnostics != "" {
+			diagnostics = append(diagnostics, issue.Diagnostics)
+		}
+	}
+	if len(diagnostics) > 0 {
+		result += ": " + strings.Join(diagnostics, "; ")
+	}
+	return result
+}
+
+// Is reports whether the status of the error matches ErrNotFound, ErrGone, ErrConflict or ErrUnauthorized.
+func (e Error) Is(target error) bool {
+	return statusMatches(e.Status, target)
+}
+
+// Is makes a ConflictError match ErrConflict.
+func (e ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+func statusMatches(status int, target error) bool {
+	switch target {
+	case ErrNotFound:
+		return status == http.StatusNotFound
+	case ErrGone:
+		return status == http.StatusGone
+	case ErrConflict:
+		return status == http.StatusConflict || status == http.StatusPreconditionFailed
+	case ErrUnauthorized:
+		return status == http.StatusUnauthorized || status == http.StatusForbidden
+	}
+	return false
+}
+
+// IsNotFound returns whether the resource doesn't exist (anymore): it has never existed or it has been deleted.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrGone)
+}
+
+// newError returns the Error of a failed request, with the issues of the OperationOutcome in the response.
+func newError(operation string, path string, resp *resty.Response) Error {
+	return Error{
+		Operation: operation,
+		Path:      path,
+		Status:    resp.StatusCode(),
+		Issues:    parseIssues(gjson.ParseBytes(resp.Body())),
+	}
+}
+
+// parseIssues returns the issues of an OperationOutcome, or nil if the value isn't an OperationOutcome.
+func parseIssues(outcome gjson.Result) []Issue {
+	if outcome.Get("resourceType").String() != "OperationOutcome" {
+		return nil
+	}
+	var issues []Issue
+	for _, issue := range outcome.Get("issue").Array() {
+		issues = append(issues, Issue{
+			Severity:    issue.Get("severity").String(),
+			Code:        issue.Get("code").String(),
+			Diagnostics: issue.Get("diagnostics").String(),
+		})
+	}
+	return issues
+}
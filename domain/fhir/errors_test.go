@@ -0,0 +1,75 @@
+package fhir
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClient_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/Patient/missing":
+			writer.WriteHeader(http.StatusNotFound)
+			_, _ = writer.Write([]byte(`{"resourceType":"OperationOutcome","issue":[{"severity":"error","code":"not-found","diagnostics":"Resource Patient/missing is not known"}]}`))
+		case "/Patient/deleted":
+			writer.WriteHeader(http.StatusGone)
+		case "/Patient/secret":
+			writer.WriteHeader(http.StatusForbidden)
+		case "/Patient/invalid":
+			writer.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = writer.Write([]byte(`{"resourceType":"OperationOutcome","issue":[{"severity":"error","code":"invalid","diagnostics":"Patient.gender: unknown code"}]}`))
+		}
+	}))
+	defer server.Close()
+	client := NewFactory(WithURL(server.URL), WithVersion(VersionSTU3))()
+	ctx := context.Background()
+
+	t.Run("not found", func(t *testing.T) {
+		err := client.ReadOne(ctx, "Patient/missing", &resources.Patient{})
+
+		var fhirErr Error
+		assert.ErrorAs(t, err, &fhirErr)
+		assert.Equal(t, http.StatusNotFound, fhirErr.Status)
+		assert.Equal(t, []Issue{{Severity: "error", Code: "not-found", Diagnostics: "Resource Patient/missing is not known"}}, fhirErr.Issues)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NotErrorIs(t, err, ErrGone)
+		assert.True(t, IsNotFound(err))
+		assert.EqualError(t, err, "unable to read FHIR resource (path=Patient/missing,http-status=404): Resource Patient/missing is not known")
+	})
+	t.Run("gone", func(t *testing.T) {
+		err := client.ReadOne(ctx, "Patient/deleted", &resources.Patient{})
+
+		assert.ErrorIs(t, err, ErrGone)
+		assert.True(t, IsNotFound(err))
+	})
+	t.Run("forbidden", func(t *testing.T) {
+		err := client.ReadMultiple(ctx, "Patient/secret", nil, &[]resources.Patient{})
+
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		assert.False(t, IsNotFound(err))
+	})
+	t.Run("invalid resource", func(t *testing.T) {
+		patient := resources.Patient{Domain: resources.Domain{Base: resources.Base{ResourceType: "Patient", ID: ToIDPtr("invalid")}}}
+
+		err := client.CreateOrUpdate(ctx, patient, nil)
+
+		var fhirErr Error
+		assert.ErrorAs(t, err, &fhirErr)
+		assert.Equal(t, http.StatusUnprocessableEntity, fhirErr.Status)
+		assert.Equal(t, "invalid", fhirErr.Issues[0].Code)
+		for _, target := range []error{ErrNotFound, ErrGone, ErrConflict, ErrUnauthorized} {
+			assert.NotErrorIs(t, err, target)
+		}
+	})
+	t.Run("concurrent modification", func(t *testing.T) {
+		err := errors.Join(errors.New("unable to update task"), ConflictError{Path: "Task/1", Status: http.StatusPreconditionFailed, VersionID: "1"})
+
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+}
@@ -0,0 +1,226 @@
+package fhir
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// ReadOpt configures a search of ReadMultiple or Iterate.
+type ReadOpt func(options *readOptions)
+
+type readOptions struct {
+	maxResults int
+	singlePage bool
+	page       string
+}
+
+// WithMaxResults limits the number of resources which are read, further pages of the search Bundle aren't fetched.
+func WithMaxResults(maxResults int) ReadOpt {
+	return func(options *readOptions) {
+		options.maxResults = maxResults
+	}
+}
+
+// WithSinglePage only reads a single page of the search Bundle, use Iterator.NextPage to continue the search later on.
+func WithSinglePage() ReadOpt {
+	return func(options *readOptions) {
+		options.singlePage = true
+	}
+}
+
+// FromPage continues a search at a page returned by Iterator.NextPage, instead of starting it with the path and
+// search parameters. The search parameters are part of the page.
+func FromPage(page string) ReadOpt {
+	return func(options *readOptions) {
+		options.page = page
+	}
+}
+
+// pageFetcher fetches a page of a search Bundle. The path of the first page is relative to the FHIR server,
+// the paths of further pages are the (absolute) URLs of the next links.
+type pageFetcher func(ctx context.Context, path string, params map[string]string) (gjson.Result, error)
+
+// Iterator iterates over the resources of a search, following the next links of the search Bundle.
+// A page is only fetched when all resources of the previous page have been processed, so large results don't have to
+// be loaded into memory. Use it like sql.Rows:
+//
+//	iterator := client.Iterate(ctx, "Observation", params)
+//	for iterator.Next() {
+//		observation := resources.Observation{}
+//		if err := iterator.Scan(&observation); err != nil { ... }
+//	}
+//	if err := iterator.Err(); err != nil { ... }
+type Iterator struct {
+	ctx      context.Context
+	fetch    pageFetcher
+	nextPath string
+	params   map[string]string
+	options  readOptions
+	// accept filters the resources of the pages, if set
+	accept func(resource gjson.Result) bool
+	// base is the URL of the FHIR server the next links are rebased onto, if set
+	base *url.URL
+	// visited contains the paths of the pages which have been fetched, to detect servers which link to the same page
+	visited map[string]bool
+	page    []gjson.Result
+	current gjson.Result
+	count   int
+	// total is the number of resources matching the search, if the server reported it
+	total *int
+	err   error
+}
+
+func newIterator(ctx context.Context, fetch pageFetcher, path string, params map[string]string, opts []ReadOpt) *Iterator {
+	iterator := &Iterator{ctx: ctx, fetch: fetch, nextPath: path, params: params, visited: map[string]bool{}}
+	for _, opt := range opts {
+		opt(&iterator.options)
+	}
+	if iterator.options.page != "" {
+		iterator.nextPath = iterator.options.page
+		iterator.params = nil
+	}
+	return iterator
+}
+
+// Next advances the iterator to the next resource, fetching the next page if needed.
+// It returns false when there are no more resources, the maximum number of results has been reached or an error occurred.
+func (i *Iterator) Next() bool {
+	if i.err != nil || (i.options.maxResults > 0 && i.count >= i.options.maxResults) {
+		return false
+	}
+	for len(i.page) == 0 || (i.accept != nil && !i.accept(i.page[0])) {
+		if len(i.page) > 0 {
+			// skip the resource
+			i.page = i.page[1:]
+			continue
+		}
+		if i.nextPath == "" || (i.options.singlePage && len(i.visited) > 0) {
+			return false
+		}
+		if i.visited[i.nextPath] {
+			i.err = fmt.Errorf("FHIR search Bundle links to a page which has already been read (url=%s)", i.nextPath)
+			return false
+		}
+		i.visited[i.nextPath] = true
+		bundle, err := i.fetch(i.ctx, i.nextPath, i.params)
+		if err != nil {
+			i.err = err
+			return false
+		}
+		// the next link contains the search parameters
+		i.params = nil
+		if total := bundle.Get("total"); total.Exists() && i.total == nil {
+			value := int(total.Int())
+			i.total = &value
+		}
+		i.nextPath = bundle.Get(`link.#(relation=="next").url`).String()
+		if i.nextPath != "" && i.base != nil {
+			if i.nextPath, err = rebase(i.base, i.nextPath); err != nil {
+				i.err = err
+				return false
+			}
+		}
+		i.page = bundle.Get("entry.#.resource").Array()
+	}
+	i.current = i.page[0]
+	i.page = i.page[1:]
+	i.count++
+	return true
+}
+
+// rebase returns the URL of the next link on the configured FHIR server. The next link is never followed verbatim, since
+// the request carries the access token of the FHIR server: links to another host or outside the base path are refused.
+func rebase(base *url.URL, link string) (string, error) {
+	next, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("invalid next link in FHIR search Bundle (url=%s): %w", link, err)
+	}
+	basePath := strings.TrimSuffix(base.Path, "/")
+	if !next.IsAbs() {
+		// relative links are relative to the base
+		next = base.JoinPath("/").ResolveReference(next)
+	}
+	if !strings.EqualFold(next.Host, base.Host) {
+		return "", fmt.Errorf("FHIR search Bundle links to another server (url=%s)", link)
+	}
+	if next.Path != basePath && !strings.HasPrefix(next.Path, basePath+"/") {
+		return "", fmt.Errorf("FHIR search Bundle links outside the FHIR server (url=%s)", link)
+	}
+	rebased := *base
+	rebased.Path = next.Path
+	rebased.RawPath = ""
+	rebased.RawQuery = next.RawQuery
+	return rebased.String(), nil
+}
+
+// relativeTo returns the URL relative to the base, so it can be resolved against the base again by rebase.
+func relativeTo(base *url.URL, link string) string {
+	next, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	path := strings.TrimPrefix(strings.TrimPrefix(next.Path, strings.TrimSuffix(base.Path, "/")), "/")
+	if next.RawQuery != "" {
+		path += "?" + next.RawQuery
+	}
+	return path
+}
+
+// NextPage returns the page following the last page which has been fetched, or an empty string if it was the last page.
+// The page is relative to the FHIR server, pass it to Iterate with FromPage to continue the search later on. It's only
+// available when all resources of the fetched pages have been read, e.g. when reading a single page (WithSinglePage).
+func (i *Iterator) NextPage() (string, error) {
+	if len(i.page) > 0 {
+		return "", errors.New("not all resources of the FHIR search Bundle page have been read")
+	}
+	if i.nextPath == "" || i.base == nil {
+		return i.nextPath, nil
+	}
+	return relativeTo(i.base, i.nextPath), nil
+}
+
+// Total returns the number of resources matching the search, false if the server didn't report it.
+func (i *Iterator) Total() (int, bool) {
+	if i.total == nil {
+		return 0, false
+	}
+	return *i.total, true
+}
+
+// Scan unmarshals the current resource into the target.
+func (i *Iterator) Scan(target interface{}) error {
+	if err := json.Unmarshal([]byte(i.current.Raw), target); err != nil {
+		return fmt.Errorf("unable to unmarshal FHIR result (target-type=%T): %w", target, err)
+	}
+	return nil
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (i *Iterator) Err() error {
+	return i.err
+}
+
+// readAll reads the resources of all pages into the results, which must be a pointer to a slice.
+func readAll(iterator *Iterator, results interface{}) error {
+	var resources []json.RawMessage
+	for iterator.Next() {
+		resources = append(resources, json.RawMessage(iterator.current.Raw))
+	}
+	if err := iterator.Err(); err != nil {
+		return err
+	}
+	if resources == nil {
+		resources = []json.RawMessage{}
+	}
+	resourcesJSON, _ := json.Marshal(resources)
+	if err := json.Unmarshal(resourcesJSON, results); err != nil {
+		return fmt.Errorf("unable to unmarshal FHIR result (target-type=%T): %w", results, err)
+	}
+	return nil
+}
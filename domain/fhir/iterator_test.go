@@ -0,0 +1,207 @@
+package fhir
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/stretchr/testify/assert"
+)
+
+// pagingServer serves a search Bundle of 5 Patients in pages of 2, linking to the next page like HAPI does.
+func pagingServer(t *testing.T, requestedPages *[]string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		offset := 0
+		if request.URL.Query().Get("_getpagesoffset") != "" {
+			_, _ = fmt.Sscan(request.URL.Query().Get("_getpagesoffset"), &offset)
+		} else {
+			assert.Equal(t, "Henk", request.URL.Query().Get("name"))
+		}
+		*requestedPages = append(*requestedPages, request.URL.RawQuery)
+		var entries string
+		for i := offset; i < offset+2 && i < 5; i++ {
+			if entries != "" {
+				entries += ","
+			}
+			entries += fmt.Sprintf(`{"resource":{"resourceType":"Patient","id":"%d"}}`, i)
+		}
+		links := fmt.Sprintf(`{"relation":"self","url":"%s%s"}`, server.URL, request.URL.RequestURI())
+		if offset+2 < 5 {
+			links += fmt.Sprintf(`,{"relation":"next","url":"%s?_getpages=1&_getpagesoffset=%d"}`, server.URL, offset+2)
+		}
+		_, _ = writer.Write([]byte(fmt.Sprintf(`{"resourceType":"Bundle","type":"searchset","link":[%s],"entry":[%s]}`, links, entries)))
+	}))
+	return server
+}
+
+func TestHTTPClient_ReadMultiple(t *testing.T) {
+	t.Run("follows next links", func(t *testing.T) {
+		var requestedPages []string
+		server := pagingServer(t, &requestedPages)
+		defer server.Close()
+		client := NewFactory(WithURL(server.URL), WithVersion(VersionSTU3))()
+		var patients []resources.Patient
+
+		err := client.ReadMultiple(context.Background(), "Patient", map[string]string{"name": "Henk"}, &patients)
+
+		assert.NoError(t, err)
+		assert.Len(t, patients, 5)
+		assert.Len(t, requestedPages, 3)
+	})
+	t.Run("max results", func(t *testing.T) {
+		var requestedPages []string
+		server := pagingServer(t, &requestedPages)
+		defer server.Close()
+		client := NewFactory(WithURL(server.URL), WithVersion(VersionSTU3))()
+		var patients []resources.Patient
+
+		err := client.ReadMultiple(context.Background(), "Patient", map[string]string{"name": "Henk"}, &patients, WithMaxResults(3))
+
+		assert.NoError(t, err)
+		assert.Len(t, patients, 3)
+		assert.Len(t, requestedPages, 2)
+	})
+	t.Run("no results", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			_, _ = writer.Write([]byte(`{"resourceType":"Bundle","type":"searchset","total":0}`))
+		}))
+		defer server.Close()
+		client := NewFactory(WithURL(server.URL), WithVersion(VersionSTU3))()
+		var patients []resources.Patient
+
+		err := client.ReadMultiple(context.Background(), "Patient", nil, &patients)
+
+		assert.NoError(t, err)
+		assert.NotNil(t, patients)
+		assert.Empty(t, patients)
+	})
+}
+
+func TestIterator(t *testing.T) {
+	t.Run("pages are fetched when needed", func(t *testing.T) {
+		var requestedPages []string
+		server := pagingServer(t, &requestedPages)
+		defer server.Close()
+		client := NewFactory(WithURL(server.URL), WithVersion(VersionSTU3))()
+
+		iterator := client.Iterate(context.Background(), "Patient", map[string]string{"name": "Henk"})
+
+		var ids []string
+		for iterator.Next() {
+			patient := resources.Patient{}
+			if !assert.NoError(t, iterator.Scan(&patient)) {
+				return
+			}
+			ids = append(ids, FromIDPtr(patient.ID))
+			assert.Len(t, requestedPages, len(ids)/2+len(ids)%2)
+		}
+		assert.NoError(t, iterator.Err())
+		assert.Equal(t, []string{"0", "1", "2", "3", "4"}, ids)
+	})
+	t.Run("next link to a page which has already been read", func(t *testing.T) {
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			_, _ = writer.Write([]byte(`{"resourceType":"Bundle","link":[{"relation":"next","url":"` + server.URL + `/Patient?_getpages=1"}],"entry":[{"resource":{"resourceType":"Patient"}}]}`))
+		}))
+		defer server.Close()
+		client := NewFactory(WithURL(server.URL), WithVersion(VersionSTU3))()
+
+		iterator := client.Iterate(context.Background(), "Patient", nil)
+		count := 0
+		for iterator.Next() {
+			count++
+		}
+
+		assert.Equal(t, 2, count)
+		assert.ErrorContains(t, iterator.Err(), "already been read")
+	})
+	t.Run("search is continued at the next page", func(t *testing.T) {
+		var requestedPages []string
+		server := pagingServer(t, &requestedPages)
+		defer server.Close()
+		client := NewFactory(WithURL(server.URL), WithVersion(VersionSTU3))()
+		readPage := func(iterator *Iterator) []string {
+			var ids []string
+			for iterator.Next() {
+				patient := resources.Patient{}
+				_ = iterator.Scan(&patient)
+				ids = append(ids, FromIDPtr(patient.ID))
+			}
+			assert.NoError(t, iterator.Err())
+			return ids
+		}
+
+		first := client.Iterate(context.Background(), "Patient", map[string]string{"name": "Henk"}, WithSinglePage())
+		assert.Equal(t, []string{"0", "1"}, readPage(first))
+		nextPage, err := first.NextPage()
+		assert.NoError(t, err)
+		assert.Equal(t, "?_getpages=1&_getpagesoffset=2", nextPage)
+
+		second := client.Iterate(context.Background(), "Patient", nil, WithSinglePage(), FromPage(nextPage))
+		assert.Equal(t, []string{"2", "3"}, readPage(second))
+		assert.Len(t, requestedPages, 2)
+	})
+	t.Run("server error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+		client := NewFactory(WithURL(server.URL), WithVersion(VersionSTU3))()
+
+		iterator := client.Iterate(context.Background(), "Patient", nil)
+
+		assert.False(t, iterator.Next())
+		assert.ErrorContains(t, iterator.Err(), "http-status=500")
+	})
+}
+
+func TestIterator_rebase(t *testing.T) {
+	base, _ := url.Parse("https://fhir.example.com/fhir/partition")
+	testCases := []struct {
+		name     string
+		link     string
+		expected string
+		err      string
+	}{
+		{name: "absolute", link: "https://fhir.example.com/fhir/partition?_getpages=1&_getpagesoffset=2", expected: "https://fhir.example.com/fhir/partition?_getpages=1&_getpagesoffset=2"},
+		{name: "resource type", link: "https://fhir.example.com/fhir/partition/Patient?_offset=2", expected: "https://fhir.example.com/fhir/partition/Patient?_offset=2"},
+		{name: "relative", link: "Patient?_offset=2", expected: "https://fhir.example.com/fhir/partition/Patient?_offset=2"},
+		{name: "scheme of the base", link: "http://fhir.example.com/fhir/partition?_getpages=1", expected: "https://fhir.example.com/fhir/partition?_getpages=1"},
+		{name: "other host", link: "https://attacker.example.com/fhir/partition?_getpages=1", err: "FHIR search Bundle links to another server (url=https://attacker.example.com/fhir/partition?_getpages=1)"},
+		{name: "other partition", link: "https://fhir.example.com/fhir/other?_getpages=1", err: "FHIR search Bundle links outside the FHIR server (url=https://fhir.example.com/fhir/other?_getpages=1)"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rebased, err := rebase(base, testCase.link)
+
+			if testCase.err != "" {
+				assert.EqualError(t, err, testCase.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, rebased)
+		})
+	}
+	t.Run("next link to another server isn't followed", func(t *testing.T) {
+		followed := false
+		other := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			followed = true
+		}))
+		defer other.Close()
+		server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			_, _ = writer.Write([]byte(`{"resourceType":"Bundle","link":[{"relation":"next","url":"` + other.URL + `/Patient?_getpages=1"}],"entry":[{"resource":{"resourceType":"Patient"}}]}`))
+		}))
+		defer server.Close()
+		client := NewFactory(WithURL(server.URL), WithVersion(VersionSTU3))()
+
+		err := client.ReadMultiple(context.Background(), "Patient", nil, &[]resources.Patient{})
+
+		assert.ErrorContains(t, err, "links to another server")
+		assert.False(t, followed)
+	})
+}
@@ -3,39 +3,322 @@ package fhir
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/monarko/fhirgo/STU3/resources"
 	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
 )
 
+var _ Client = mockClient{}
+
+// mockClient is an in-memory FHIR server for tests. Resources that are written can be read back, their meta.versionId
+// is incremented on every write.
 type mockClient struct {
 	t                      assert.TestingT
 	ExpectedCreateOrUpdate map[string]interface{}
 	readMock               map[string]map[string]interface{}
+	resources              map[string]json.RawMessage
+	failures               map[string]error
+}
+
+func NewMockClient(t assert.TestingT) mockClient {
+	return mockClient{t: t, resources: map[string]json.RawMessage{}, failures: map[string]error{}}
 }
 
 func NewMockClientWithExpectedCreateOrUpdate(t assert.TestingT, expected map[string]interface{}) mockClient {
-	return mockClient{t: t, ExpectedCreateOrUpdate: expected}
+	client := NewMockClient(t)
+	client.ExpectedCreateOrUpdate = expected
+	return client
 }
 
 func NewMockClientWithReadMock(t assert.TestingT, expected map[string]map[string]interface{}) mockClient {
-	return mockClient{t: t, readMock: expected}
+	client := NewMockClient(t)
+	client.readMock = expected
+	return client
 }
 
-func (m mockClient) CreateOrUpdate(ctx context.Context, resource interface{}) error {
-	resourceJSON, _ := json.Marshal(resource)
-	_ = json.Unmarshal(resourceJSON, &resource)
-	return nil
+// FailOn makes every call of the operation (e.g. CreateOrUpdate) on the resource type (e.g. Task) return an error.
+// Transaction calls use the resource type Bundle, Batch calls fail per entry (e.g. FailOn("Batch", "Patient")).
+func (m mockClient) FailOn(operation, resourceType string) {
+	m.failures[operation+" "+resourceType] = fmt.Errorf("%s of %s failed", operation, resourceType)
 }
 
-func (mockClient) ReadMultiple(ctx context.Context, path string, params map[string]string, results interface{}) error {
-	panic("implement me")
+// Resource returns the stored resource at the given path (e.g. Task/123), or nil if it doesn't exist.
+func (m mockClient) Resource(path string) map[string]interface{} {
+	data, ok := m.resources[strings.TrimPrefix(path, "/")]
+	if !ok {
+		return nil
+	}
+	result := map[string]interface{}{}
+	_ = json.Unmarshal(data, &result)
+	return result
+}
+
+// Resources returns the paths of all stored resources of the given type.
+func (m mockClient) Resources(resourceType string) []string {
+	var paths []string
+	for path := range m.resources {
+		if strings.HasPrefix(path, resourceType+"/") {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func (m mockClient) Create(ctx context.Context, resource interface{}, result interface{}) error {
+	return m.store("Create", resource, result)
+}
+
+func (m mockClient) CreateOrUpdate(ctx context.Context, resource interface{}, result interface{}) error {
+	return m.store("CreateOrUpdate", resource, result)
+}
+
+func (m mockClient) Transaction(ctx context.Context, bundle resources.Bundle) ([]BundleEntryResult, error) {
+	if err := m.failures["Transaction Bundle"]; err != nil {
+		return nil, err
+	}
+	// a transaction is processed completely or not at all, so the resources are restored when an entry fails
+	snapshot := map[string]json.RawMessage{}
+	for path, data := range m.resources {
+		snapshot[path] = data
+	}
+	restore := func() {
+		for path := range m.resources {
+			delete(m.resources, path)
+		}
+		for path, data := range snapshot {
+			m.resources[path] = data
+		}
+	}
+	var results []BundleEntryResult
+	for _, entry := range bundle.Entry {
+		result, err := m.storeEntry("Transaction", entry)
+		if err != nil {
+			restore()
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	// resources may be deleted together with the resources referring to them, so references are checked afterwards
+	for path := range snapshot {
+		if _, exists := m.resources[path]; !exists {
+			if err := m.checkReferences(path); err != nil {
+				restore()
+				return nil, err
+			}
+		}
+	}
+	return results, nil
+}
+
+// Batch stores the entries of the Bundle, entries of which the operation fails (see FailOn) are returned as BatchError.
+func (m mockClient) Batch(ctx context.Context, bundle resources.Bundle) ([]BundleEntryResult, error) {
+	var results []BundleEntryResult
+	var entryErrors []EntryError
+	for i, entry := range bundle.Entry {
+		result, err := m.storeEntry("Batch", entry)
+		if err != nil {
+			entryError := EntryError{Index: i, URL: string(*entry.Request.URL), Status: 500, Diagnostics: err.Error()}
+			result = BundleEntryResult{Status: entryError.Status, Err: entryError}
+			entryErrors = append(entryErrors, entryError)
+		}
+		results = append(results, result)
+	}
+	if len(entryErrors) > 0 {
+		return results, BatchError{Entries: entryErrors}
+	}
+	return results, nil
+}
+
+// storeEntry stores the resource of a Bundle entry, the mock assigns an ID to resources which are created by POST.
+// DELETE entries remove the resources at their URL, without checking the references (see Transaction).
+func (m mockClient) storeEntry(operation string, entry resources.BundleEntry) (BundleEntryResult, error) {
+	if entry.Request != nil && FromCodePtr(entry.Request.Method) == "DELETE" {
+		if _, err := m.deleteMatching(FromUriPtr(entry.Request.URL)); err != nil {
+			return BundleEntryResult{}, err
+		}
+		return BundleEntryResult{Status: http.StatusNoContent}, nil
+	}
+	resource := entry.Resource
+	if entry.Request != nil && FromCodePtr(entry.Request.Method) == "POST" {
+		resourceJSON, err := json.Marshal(resource)
+		if err != nil {
+			return BundleEntryResult{}, err
+		}
+		withID := map[string]interface{}{}
+		_ = json.Unmarshal(resourceJSON, &withID)
+		withID["id"] = fmt.Sprintf("%d", len(m.resources)+1)
+		resource = withID
+	}
+	if err := m.store(operation, resource, nil); err != nil {
+		return BundleEntryResult{}, err
+	}
+	path, _ := resolveResourcePath(resource)
+	result := BundleEntryResult{Status: 200, Location: path + "/_history/" + gjson.GetBytes(m.resources[path], "meta.versionId").String()}
+	result.ResourceType, result.ID, result.VersionID = parseLocation(result.Location)
+	return result, nil
+}
+
+// ReadMultiple returns the stored resources of the type of the path, only the _id search parameter is evaluated.
+func (m mockClient) ReadMultiple(ctx context.Context, path string, params map[string]string, results interface{}, opts ...ReadOpt) error {
+	return readAll(m.Iterate(ctx, path, params, opts...), results)
+}
+
+// Iterate iterates over the stored resources of the type of the path, only the _id search parameter is evaluated.
+func (m mockClient) Iterate(ctx context.Context, path string, params map[string]string, opts ...ReadOpt) *Iterator {
+	return newIterator(ctx, func(ctx context.Context, path string, params map[string]string) (gjson.Result, error) {
+		resourceType := strings.Trim(path, "/")
+		if err := m.failures["ReadMultiple "+resourceType]; err != nil {
+			return gjson.Result{}, err
+		}
+		paths := m.Resources(resourceType)
+		sort.Strings(paths)
+		var entries []map[string]json.RawMessage
+		for _, resourcePath := range paths {
+			if ids, ok := params["_id"]; ok && !slices.Contains(strings.Split(ids, ","), strings.TrimPrefix(resourcePath, resourceType+"/")) {
+				continue
+			}
+			entries = append(entries, map[string]json.RawMessage{"resource": m.resources[resourcePath]})
+		}
+		bundle, _ := json.Marshal(map[string]interface{}{"resourceType": "Bundle", "type": "searchset", "entry": entries})
+		return gjson.ParseBytes(bundle), nil
+	}, path, params, opts)
 }
 
 func (m mockClient) ReadOne(ctx context.Context, path string, result interface{}) error {
+	path = strings.TrimPrefix(path, "/")
+	if err := m.failures["ReadOne "+strings.Split(path, "/")[0]]; err != nil {
+		return err
+	}
+	if data, ok := m.resources[path]; ok {
+		return json.Unmarshal(data, &result)
+	}
 	if mockData, ok := m.readMock[path]; ok {
 		resourceJSON, _ := json.Marshal(mockData)
 		return json.Unmarshal(resourceJSON, &result)
 	}
+	if m.readMock == nil {
+		// like a FHIR server, resources which don't exist (anymore) aren't found
+		return Error{Operation: "read FHIR resource", Path: path, Status: http.StatusNotFound}
+	}
 	m.t.Errorf("unexpected call to ReadOne with path %s", path)
 	return nil
 }
+
+// Delete removes the resource at the path. Like HAPI, it refuses to delete resources which are referred to by other resources.
+func (m mockClient) Delete(ctx context.Context, path string) error {
+	path = strings.TrimPrefix(path, "/")
+	if err := m.checkReferences(path); err != nil {
+		return err
+	}
+	_, err := m.deleteMatching(path)
+	return err
+}
+
+// DeleteWhere removes the resources of the type which match the search parameters, only _id is evaluated.
+func (m mockClient) DeleteWhere(ctx context.Context, resourceType string, params map[string]string) error {
+	query := url.Values{}
+	for name, value := range params {
+		query.Set(name, value)
+	}
+	snapshot := map[string]json.RawMessage{}
+	for path, data := range m.resources {
+		snapshot[path] = data
+	}
+	deleted, err := m.deleteMatching(resourceType + "?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	for _, path := range deleted {
+		if err := m.checkReferences(path); err != nil {
+			for path, data := range snapshot {
+				m.resources[path] = data
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteMatching removes the resource at the path, or the resources matching the _id of a conditional URL
+// (e.g. Patient?_id=1). It returns the paths of the removed resources.
+func (m mockClient) deleteMatching(resourceURL string) ([]string, error) {
+	resourceURL = strings.TrimPrefix(resourceURL, "/")
+	resourcePath, rawQuery, conditional := strings.Cut(resourceURL, "?")
+	resourceType := strings.Split(resourcePath, "/")[0]
+	if err := m.failures["Delete "+resourceType]; err != nil {
+		return nil, err
+	}
+	if !conditional {
+		delete(m.resources, resourcePath)
+		return []string{resourcePath}, nil
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	var deleted []string
+	for _, path := range m.Resources(resourceType) {
+		if query.Has("_id") && !slices.Contains(strings.Split(query.Get("_id"), ","), strings.TrimPrefix(path, resourceType+"/")) {
+			continue
+		}
+		delete(m.resources, path)
+		deleted = append(deleted, path)
+	}
+	return deleted, nil
+}
+
+// checkReferences returns an error if a stored resource refers to the resource at the path.
+func (m mockClient) checkReferences(path string) error {
+	for referrer, data := range m.resources {
+		for _, reference := range []string{`"` + path + `"`, `"/` + path + `"`} {
+			if referrer != path && strings.Contains(string(data), `"reference":`+reference) {
+				return Error{Operation: "delete FHIR resource", Path: path, Status: http.StatusConflict, Issues: []Issue{{
+					Severity:    "error",
+					Code:        "processing",
+					Diagnostics: fmt.Sprintf("it is referred to by %s", referrer),
+				}}}
+			}
+		}
+	}
+	return nil
+}
+
+func (m mockClient) BuildRequestURI(fhirResourcePath string) *url.URL {
+	return buildRequestURI("http://localhost", "", fhirResourcePath)
+}
+
+func (m mockClient) store(operation string, resource interface{}, result interface{}) error {
+	path, err := resolveResourcePath(resource)
+	if err != nil {
+		return err
+	}
+	if err := m.failures[operation+" "+strings.Split(path, "/")[0]]; err != nil {
+		return err
+	}
+	resourceJSON, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+	// resources are versioned like on a FHIR server, an update of a resource that has been read requires the current version
+	currentVersion := gjson.GetBytes(m.resources[path], "meta.versionId").String()
+	if versionID := resolveVersionID(resource); operation == "CreateOrUpdate" && versionID != "" && versionID != currentVersion {
+		return ConflictError{Path: path, Status: http.StatusPreconditionFailed, VersionID: versionID}
+	}
+	version, _ := strconv.Atoi(currentVersion)
+	if resourceJSON, err = setVersionID(resourceJSON, strconv.Itoa(version+1)); err != nil {
+		return err
+	}
+	m.resources[path] = resourceJSON
+	if result != nil {
+		return json.Unmarshal(resourceJSON, result)
+	}
+	return nil
+}
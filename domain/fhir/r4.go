@@ -0,0 +1,260 @@
+package fhir
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The resources in this application are modelled in FHIR STU3. When a FHIR server speaks R4, the client converts
+// the resources at its boundary: resources are converted to R4 before they're written and back to STU3 after they're read.
+// Only the elements of the resources used by the eOverdracht and zorginzage flows that differ between the versions are converted.
+
+const (
+	conditionClinicalSystem         = "http://terminology.hl7.org/CodeSystem/condition-clinical"
+	conditionVerificationSystem     = "http://terminology.hl7.org/CodeSystem/condition-ver-status"
+	allergyClinicalSystem           = "http://terminology.hl7.org/CodeSystem/allergyintolerance-clinical"
+	allergyVerificationSystem       = "http://terminology.hl7.org/CodeSystem/allergyintolerance-verification"
+	stu3ExtensionURLPrefix          = "http://hl7.org/fhir/3.0/StructureDefinition/extension-"
+	medicationStatementTakenUnknown = "unk"
+)
+
+type resourceConverter func(resource map[string]interface{})
+
+var toR4Converters = map[string]resourceConverter{
+	"AllergyIntolerance": func(resource map[string]interface{}) {
+		codeToConcept(resource, "clinicalStatus", allergyClinicalSystem)
+		codeToConcept(resource, "verificationStatus", allergyVerificationSystem)
+		rename(resource, "assertedDate", "recordedDate")
+	},
+	"Condition": func(resource map[string]interface{}) {
+		codeToConcept(resource, "clinicalStatus", conditionClinicalSystem)
+		codeToConcept(resource, "verificationStatus", conditionVerificationSystem)
+		rename(resource, "assertedDate", "recordedDate")
+		contextToEncounter(resource, "Condition")
+	},
+	"MedicationStatement": func(resource map[string]interface{}) {
+		delete(resource, "taken")
+	},
+	"Observation": func(resource map[string]interface{}) {
+		contextToEncounter(resource, "Observation")
+	},
+	"Procedure": func(resource map[string]interface{}) {
+		contextToEncounter(resource, "Procedure")
+	},
+	"Provenance": func(resource map[string]interface{}) {
+		forEach(resource, "agent", func(agent map[string]interface{}) {
+			rename(agent, "whoReference", "who")
+		})
+		forEach(resource, "entity", func(entity map[string]interface{}) {
+			rename(entity, "whatReference", "what")
+		})
+	},
+	"RelatedPerson": func(resource map[string]interface{}) {
+		if relationship, ok := resource["relationship"]; ok {
+			resource["relationship"] = []interface{}{relationship}
+		}
+	},
+	"Task": func(resource map[string]interface{}) {
+		if requester, ok := resource["requester"].(map[string]interface{}); ok {
+			if agent, ok := requester["agent"]; ok {
+				resource["requester"] = agent
+			} else {
+				delete(resource, "requester")
+			}
+		}
+		if reason, ok := resource["reason"]; ok {
+			delete(resource, "reason")
+			resource["reasonCode"] = reason
+		}
+		contextToEncounter(resource, "Task")
+	},
+}
+
+var fromR4Converters = map[string]resourceConverter{
+	"AllergyIntolerance": func(resource map[string]interface{}) {
+		conceptToCode(resource, "clinicalStatus")
+		conceptToCode(resource, "verificationStatus")
+		rename(resource, "recordedDate", "assertedDate")
+	},
+	"Condition": func(resource map[string]interface{}) {
+		conceptToCode(resource, "clinicalStatus")
+		conceptToCode(resource, "verificationStatus")
+		rename(resource, "recordedDate", "assertedDate")
+		encounterToContext(resource, "Condition")
+	},
+	"MedicationStatement": func(resource map[string]interface{}) {
+		if _, ok := resource["taken"]; !ok {
+			resource["taken"] = medicationStatementTakenUnknown
+		}
+	},
+	"Observation": func(resource map[string]interface{}) {
+		encounterToContext(resource, "Observation")
+	},
+	"Procedure": func(resource map[string]interface{}) {
+		encounterToContext(resource, "Procedure")
+	},
+	"Provenance": func(resource map[string]interface{}) {
+		forEach(resource, "agent", func(agent map[string]interface{}) {
+			rename(agent, "who", "whoReference")
+		})
+		forEach(resource, "entity", func(entity map[string]interface{}) {
+			rename(entity, "what", "whatReference")
+		})
+	},
+	"RelatedPerson": func(resource map[string]interface{}) {
+		if relationships, ok := resource["relationship"].([]interface{}); ok {
+			if len(relationships) > 0 {
+				resource["relationship"] = relationships[0]
+			} else {
+				delete(resource, "relationship")
+			}
+		}
+	},
+	"Task": func(resource map[string]interface{}) {
+		if requester, ok := resource["requester"]; ok {
+			resource["requester"] = map[string]interface{}{"agent": requester}
+		}
+		if reason, ok := resource["reasonCode"]; ok {
+			delete(resource, "reasonCode")
+			resource["reason"] = reason
+		}
+		encounterToContext(resource, "Task")
+	},
+}
+
+// ToR4 converts a resource modelled in FHIR STU3 to its FHIR R4 JSON representation.
+// The entries of a Bundle are converted as well.
+func ToR4(resource interface{}) ([]byte, error) {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	return convertJSON(data, toR4Converters)
+}
+
+// FromR4 converts the JSON of a FHIR R4 resource, or an array of them, to its FHIR STU3 representation.
+// The entries of a Bundle are converted as well.
+func FromR4(data []byte) ([]byte, error) {
+	return convertJSON(data, fromR4Converters)
+}
+
+func convertJSON(data []byte, converters map[string]resourceConverter) ([]byte, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("unable to convert FHIR resource: %w", err)
+	}
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		convertResource(typed, converters)
+	case []interface{}:
+		for _, item := range typed {
+			if resource, ok := item.(map[string]interface{}); ok {
+				convertResource(resource, converters)
+			}
+		}
+	}
+	return json.Marshal(value)
+}
+
+func convertResource(resource map[string]interface{}, converters map[string]resourceConverter) {
+	resourceType, _ := resource["resourceType"].(string)
+	if resourceType == "Bundle" {
+		forEach(resource, "entry", func(entry map[string]interface{}) {
+			if entryResource, ok := entry["resource"].(map[string]interface{}); ok {
+				convertResource(entryResource, converters)
+			}
+		})
+		return
+	}
+	if converter, ok := converters[resourceType]; ok {
+		converter(resource)
+	}
+}
+
+// codeToConcept turns the code at the given key into a CodeableConcept of the given code system.
+func codeToConcept(resource map[string]interface{}, key string, system string) {
+	code, ok := resource[key].(string)
+	if !ok {
+		return
+	}
+	resource[key] = map[string]interface{}{
+		"coding": []interface{}{map[string]interface{}{"system": system, "code": code}},
+	}
+}
+
+// conceptToCode turns the CodeableConcept at the given key into the code of its first coding.
+func conceptToCode(resource map[string]interface{}, key string) {
+	concept, ok := resource[key].(map[string]interface{})
+	if !ok {
+		return
+	}
+	delete(resource, key)
+	if codings, ok := concept["coding"].([]interface{}); ok && len(codings) > 0 {
+		if coding, ok := codings[0].(map[string]interface{}); ok && coding["code"] != nil {
+			resource[key] = coding["code"]
+		}
+	}
+}
+
+// contextToEncounter moves the STU3 context to the R4 encounter. R4 only allows an Encounter there,
+// so other references (e.g. an EpisodeOfCare) are kept in the STU3 context extension.
+func contextToEncounter(resource map[string]interface{}, resourceType string) {
+	context, ok := resource["context"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	delete(resource, "context")
+	if reference, _ := context["reference"].(string); strings.HasPrefix(reference, "Encounter/") {
+		resource["encounter"] = context
+		return
+	}
+	extensions, _ := resource["extension"].([]interface{})
+	resource["extension"] = append(extensions, map[string]interface{}{
+		"url":            stu3ExtensionURLPrefix + resourceType + ".context",
+		"valueReference": context,
+	})
+}
+
+// encounterToContext reverts contextToEncounter.
+func encounterToContext(resource map[string]interface{}, resourceType string) {
+	if encounter, ok := resource["encounter"]; ok {
+		delete(resource, "encounter")
+		resource["context"] = encounter
+		return
+	}
+	extensions, ok := resource["extension"].([]interface{})
+	if !ok {
+		return
+	}
+	var remaining []interface{}
+	for _, item := range extensions {
+		extension, _ := item.(map[string]interface{})
+		if extension != nil && extension["url"] == stu3ExtensionURLPrefix+resourceType+".context" {
+			resource["context"] = extension["valueReference"]
+			continue
+		}
+		remaining = append(remaining, item)
+	}
+	if len(remaining) == 0 {
+		delete(resource, "extension")
+	} else {
+		resource["extension"] = remaining
+	}
+}
+
+func rename(element map[string]interface{}, from, to string) {
+	if value, ok := element[from]; ok {
+		delete(element, from)
+		element[to] = value
+	}
+}
+
+func forEach(element map[string]interface{}, key string, fn func(map[string]interface{})) {
+	items, _ := element[key].([]interface{})
+	for _, item := range items {
+		if child, ok := item.(map[string]interface{}); ok {
+			fn(child)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package fhir
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/monarko/fhirgo/STU3/datatypes"
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToR4(t *testing.T) {
+	t.Run("Task requester", func(t *testing.T) {
+		task := resources.Task{
+			Domain:    resources.Domain{Base: resources.Base{ResourceType: "Task", ID: ToIDPtr("1")}},
+			Requester: &resources.TaskRequester{Agent: &datatypes.Reference{Display: ToStringPtr("sender")}},
+		}
+
+		data, err := ToR4(task)
+
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.JSONEq(t, `{"resourceType":"Task","id":"1","requester":{"display":"sender"}}`, string(data))
+	})
+	t.Run("Condition statuses", func(t *testing.T) {
+		condition := map[string]interface{}{"resourceType": "Condition", "clinicalStatus": "active", "assertedDate": "2021-01-01"}
+
+		data, err := ToR4(condition)
+
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.JSONEq(t, `{"resourceType":"Condition","recordedDate":"2021-01-01","clinicalStatus":{"coding":[{"system":"`+conditionClinicalSystem+`","code":"active"}]}}`, string(data))
+	})
+	t.Run("Observation context of an EpisodeOfCare", func(t *testing.T) {
+		observation := map[string]interface{}{"resourceType": "Observation", "context": map[string]interface{}{"reference": "EpisodeOfCare/1"}}
+
+		data, err := ToR4(observation)
+
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.JSONEq(t, `{"resourceType":"Observation","extension":[{"url":"`+stu3ExtensionURLPrefix+`Observation.context","valueReference":{"reference":"EpisodeOfCare/1"}}]}`, string(data))
+	})
+	t.Run("Bundle entries", func(t *testing.T) {
+		bundle := map[string]interface{}{"resourceType": "Bundle", "entry": []interface{}{
+			map[string]interface{}{"resource": map[string]interface{}{"resourceType": "RelatedPerson", "relationship": map[string]interface{}{"text": "partner"}}},
+		}}
+
+		data, err := ToR4(bundle)
+
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.JSONEq(t, `{"resourceType":"Bundle","entry":[{"resource":{"resourceType":"RelatedPerson","relationship":[{"text":"partner"}]}}]}`, string(data))
+	})
+}
+
+func TestFromR4(t *testing.T) {
+	t.Run("reverts ToR4", func(t *testing.T) {
+		stu3 := []map[string]interface{}{
+			{"resourceType": "Task", "requester": map[string]interface{}{"agent": map[string]interface{}{"display": "sender"}}},
+			{"resourceType": "AllergyIntolerance", "clinicalStatus": "active", "verificationStatus": "confirmed"},
+			{"resourceType": "Observation", "context": map[string]interface{}{"reference": "EpisodeOfCare/1"}},
+			{"resourceType": "Procedure", "context": map[string]interface{}{"reference": "Encounter/1"}},
+			{"resourceType": "Provenance", "agent": []interface{}{map[string]interface{}{"whoReference": map[string]interface{}{"display": "sender"}}}},
+		}
+		for _, resource := range stu3 {
+			r4, err := ToR4(resource)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			data, err := FromR4(r4)
+
+			if !assert.NoError(t, err) {
+				return
+			}
+			expected, _ := json.Marshal(resource)
+			assert.JSONEq(t, string(expected), string(data))
+		}
+	})
+	t.Run("MedicationStatement without taken", func(t *testing.T) {
+		data, err := FromR4([]byte(`[{"resourceType":"MedicationStatement","status":"active"}]`))
+
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.JSONEq(t, `[{"resourceType":"MedicationStatement","status":"active","taken":"unk"}]`, string(data))
+	})
+}
+
+func TestHTTPClient_resolveVersion(t *testing.T) {
+	metadataRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/r4/metadata":
+			metadataRequests++
+			_, _ = writer.Write([]byte(`{"resourceType":"CapabilityStatement","fhirVersion":"4.0.1"}`))
+		case "/r4/Task/1":
+			_, _ = writer.Write([]byte(`{"resourceType":"Task","id":"1","requester":{"display":"sender"}}`))
+		case "/stu3/metadata":
+			_, _ = writer.Write([]byte(`{"resourceType":"CapabilityStatement","fhirVersion":"3.0.2"}`))
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	factory := NewFactory()
+
+	t.Run("R4", func(t *testing.T) {
+		client := factory(WithURL(server.URL + "/r4")).(*httpClient)
+		var task resources.Task
+
+		err := client.ReadOne(context.Background(), "Task/1", &task)
+
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "sender", FromStringPtr(task.Requester.Agent.Display))
+		assert.Equal(t, 1, metadataRequests)
+	})
+	t.Run("STU3", func(t *testing.T) {
+		client := factory(WithURL(server.URL + "/stu3")).(*httpClient)
+
+		assert.Equal(t, VersionSTU3, client.resolveVersion(context.Background()))
+	})
+	t.Run("configured version isn't negotiated", func(t *testing.T) {
+		client := factory(WithURL(server.URL+"/other"), WithVersion(VersionR4)).(*httpClient)
+
+		assert.Equal(t, VersionR4, client.resolveVersion(context.Background()))
+	})
+	t.Run("unsupported server assumes STU3", func(t *testing.T) {
+		client := factory(WithURL(server.URL + "/other")).(*httpClient)
+
+		assert.Equal(t, VersionSTU3, client.resolveVersion(context.Background()))
+	})
+}
+
+func TestHTTPClient_resolveVersion_PEP(t *testing.T) {
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		authorizations = append(authorizations, request.Header.Get("Authorization"))
+		if request.Header.Get("Authorization") != "Bearer token" {
+			writer.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = writer.Write([]byte(`{"resourceType":"CapabilityStatement","fhirVersion":"4.0.1"}`))
+	}))
+	defer server.Close()
+
+	t.Run("negotiated with the access token", func(t *testing.T) {
+		authorizations = nil
+		factory := NewFactory(WithURL(server.URL+"/authorized"), WithAuthToken("token"))
+
+		assert.Equal(t, VersionR4, factory().(*httpClient).resolveVersion(context.Background()))
+		assert.Equal(t, VersionR4, factory().(*httpClient).resolveVersion(context.Background()))
+		assert.Equal(t, []string{"Bearer token"}, authorizations)
+	})
+	t.Run("failure is cached", func(t *testing.T) {
+		authorizations = nil
+		factory := NewFactory(WithURL(server.URL + "/unauthorized"))
+
+		assert.Equal(t, VersionSTU3, factory().(*httpClient).resolveVersion(context.Background()))
+		assert.Equal(t, VersionSTU3, factory().(*httpClient).resolveVersion(context.Background()))
+		assert.Len(t, authorizations, 1)
+	})
+}
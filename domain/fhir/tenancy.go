@@ -0,0 +1,240 @@
+package fhir
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/tidwall/gjson"
+)
+
+// TenantTagSystem is the system of the meta.tag with which TagTenancy marks the resources of a tenant.
+const TenantTagSystem = "http://nuts.nl/fhir/CodeSystem/demo-ehr-tenant"
+
+// Tenancy isolates the resources of the tenants (customers) which share a FHIR server. The client applies it to every
+// request of a tenant, so callers only have to specify the tenant with WithTenant.
+type Tenancy interface {
+	// RequestURI returns the URL of a resource path (e.g. Patient/123, Patient or an empty path for the server base)
+	// for the tenant.
+	RequestURI(serverURL string, tenant string, resourcePath string) *url.URL
+	// Stamp marks a resource (as JSON) as the tenant's before it is written.
+	Stamp(tenant string, resource []byte) ([]byte, error)
+	// SearchParams returns the search parameters which restrict a search or conditional operation to the resources
+	// of the tenant, or nil if the server does that itself.
+	SearchParams(tenant string) map[string]string
+	// Owns returns whether a resource which has been read belongs to the tenant.
+	Owns(tenant string, resource gjson.Result) bool
+}
+
+// SharedTenancy doesn't isolate tenants, all of them share the resources on the FHIR server.
+// It's the default, and is meant for FHIR servers which are accessed on behalf of a single tenant (e.g. the FHIR
+// servers of other care organizations).
+type SharedTenancy struct{}
+
+func (SharedTenancy) RequestURI(serverURL string, _ string, resourcePath string) *url.URL {
+	return buildRequestURI(serverURL, "", resourcePath)
+}
+
+func (SharedTenancy) Stamp(_ string, resource []byte) ([]byte, error) {
+	return resource, nil
+}
+
+func (SharedTenancy) SearchParams(_ string) map[string]string {
+	return nil
+}
+
+func (SharedTenancy) Owns(_ string, _ gjson.Result) bool {
+	return true
+}
+
+// Partitions resolves the partitions of tenants.
+type Partitions interface {
+	// PartitionName returns the name of the partition of the tenant, false if the tenant doesn't have one.
+	PartitionName(tenant string) (string, bool)
+}
+
+// PartitionTenancy stores the resources of every tenant in a partition of the FHIR server, which is selected by the
+// first path segment after the server address (e.g. http://localhost:8080/fhir/1/Patient for partition 1).
+// HAPI requires the partitions to be created first, see InitializeTenant.
+type PartitionTenancy struct {
+	// Partitions resolves the partition names of the tenants. If it's nil or doesn't know a tenant, the tenant itself
+	// is used as partition name.
+	Partitions Partitions
+}
+
+func (p PartitionTenancy) RequestURI(serverURL string, tenant string, resourcePath string) *url.URL {
+	if p.Partitions != nil && tenant != "" {
+		if name, ok := p.Partitions.PartitionName(tenant); ok {
+			tenant = name
+		}
+	}
+	return buildRequestURI(serverURL, tenant, resourcePath)
+}
+
+func (PartitionTenancy) Stamp(_ string, resource []byte) ([]byte, error) {
+	return resource, nil
+}
+
+func (PartitionTenancy) SearchParams(_ string) map[string]string {
+	return nil
+}
+
+func (PartitionTenancy) Owns(_ string, _ gjson.Result) bool {
+	return true
+}
+
+// TagTenancy isolates tenants on FHIR servers without partitions. Every resource a tenant writes is tagged with
+// TenantTagSystem|<tenant>, every search is restricted to resources with that tag (_tag), resources of other
+// tenants are treated as if they don't exist when they're read and they can't be overwritten.
+// Resources which have been written without the tag (e.g. before TagTenancy has been configured) aren't visible to
+// any tenant. A client without a tenant isn't restricted.
+type TagTenancy struct{}
+
+func (TagTenancy) RequestURI(serverURL string, _ string, resourcePath string) *url.URL {
+	return buildRequestURI(serverURL, "", resourcePath)
+}
+
+func (TagTenancy) Stamp(tenant string, resource []byte) ([]byte, error) {
+	if tenant == "" {
+		return resource, nil
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(resource, &fields); err != nil {
+		return nil, err
+	}
+	meta := map[string]json.RawMessage{}
+	if data, ok := fields["meta"]; ok {
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, err
+		}
+	}
+	var tags []json.RawMessage
+	if data, ok := meta["tag"]; ok {
+		if err := json.Unmarshal(data, &tags); err != nil {
+			return nil, err
+		}
+	}
+	// a resource which is copied from another tenant (e.g. a received Task) gets the tag of this tenant instead
+	stampedTags := []json.RawMessage{}
+	for _, tag := range tags {
+		if gjson.GetBytes(tag, "system").String() != TenantTagSystem {
+			stampedTags = append(stampedTags, tag)
+		}
+	}
+	tenantTag, _ := json.Marshal(map[string]string{"system": TenantTagSystem, "code": tenant})
+	meta["tag"], _ = json.Marshal(append(stampedTags, tenantTag))
+	fields["meta"], _ = json.Marshal(meta)
+	return json.Marshal(fields)
+}
+
+func (TagTenancy) SearchParams(tenant string) map[string]string {
+	if tenant == "" {
+		return nil
+	}
+	return map[string]string{"_tag": TenantTagSystem + "|" + tenant}
+}
+
+func (TagTenancy) Owns(tenant string, resource gjson.Result) bool {
+	if tenant == "" {
+		return true
+	}
+	for _, tag := range resource.Get("meta.tag").Array() {
+		if tag.Get("system").String() == TenantTagSystem && tag.Get("code").String() == tenant {
+			return true
+		}
+	}
+	return false
+}
+
+// stamp marks the resource as the tenant's, returning it as JSON.
+func stamp(tenancy Tenancy, tenant string, resource interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	return tenancy.Stamp(tenant, data)
+}
+
+// restrictQuery adds the search parameters of the tenancy to a query, e.g. the If-None-Exist of a conditional create.
+func restrictQuery(tenancy Tenancy, tenant string, query string) string {
+	params := tenancy.SearchParams(tenant)
+	if len(params) == 0 {
+		return query
+	}
+	values := url.Values{}
+	for name, value := range params {
+		values.Set(name, value)
+	}
+	if query == "" {
+		return values.Encode()
+	}
+	return strings.TrimSuffix(query, "&") + "&" + values.Encode()
+}
+
+// withSearchParams returns the search parameters combined with those of the tenancy.
+func withSearchParams(tenancy Tenancy, tenant string, params map[string]string) map[string]string {
+	tenancyParams := tenancy.SearchParams(tenant)
+	if len(tenancyParams) == 0 {
+		return params
+	}
+	result := map[string]string{}
+	for name, value := range params {
+		result[name] = value
+	}
+	for name, value := range tenancyParams {
+		result[name] = value
+	}
+	return result
+}
+
+// putPaths returns the resource paths of the PUT entries of the Bundle, e.g. Patient/123.
+func putPaths(bundle resources.Bundle) []string {
+	var paths []string
+	for _, entry := range bundle.Entry {
+		request := entry.Request
+		if request == nil || request.Method == nil || *request.Method != "PUT" || request.URL == nil {
+			continue
+		}
+		if path := string(*request.URL); !strings.Contains(path, "?") {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// restrictBundle returns a copy of the Bundle in which the resources are stamped and the conditional and DELETE entries
+// are restricted to the resources of the tenant.
+func restrictBundle(tenancy Tenancy, tenant string, bundle resources.Bundle) (resources.Bundle, error) {
+	restricted := len(tenancy.SearchParams(tenant)) > 0
+	entries := make([]resources.BundleEntry, len(bundle.Entry))
+	for i, entry := range bundle.Entry {
+		if entry.Resource != nil {
+			resource, err := stamp(tenancy, tenant, entry.Resource)
+			if err != nil {
+				return bundle, fmt.Errorf("unable to stamp resource of Bundle entry %d: %w", i, err)
+			}
+			entry.Resource = resource
+		}
+		if entry.Request != nil && restricted {
+			request := *entry.Request
+			if request.IfNoneExist != nil {
+				request.IfNoneExist = ToStringPtr(restrictQuery(tenancy, tenant, FromStringPtr(request.IfNoneExist)))
+			}
+			if request.Method != nil && *request.Method == "DELETE" && request.URL != nil {
+				// a resource is deleted by a conditional delete on its ID, so it's only deleted if it's the tenant's
+				entryPath, query, isConditional := strings.Cut(string(*request.URL), "?")
+				if !isConditional {
+					resourceType, id, _ := strings.Cut(entryPath, "/")
+					entryPath, query = resourceType, url.Values{"_id": []string{id}}.Encode()
+				}
+				request.URL = ToUriPtr(entryPath + "?" + restrictQuery(tenancy, tenant, query))
+			}
+			entry.Request = &request
+		}
+		entries[i] = entry
+	}
+	bundle.Entry = entries
+	return bundle, nil
+}
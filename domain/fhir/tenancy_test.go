@@ -0,0 +1,21 @@
+package fhir
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestTagTenancy_Stamp(t *testing.T) {
+	resource := []byte(`{"resourceType":"Task","meta":{"versionId":"2","tag":[{"system":"http://example.com","code":"a"},{"system":"` + TenantTagSystem + `","code":"1"}]}}`)
+
+	stamped, err := TagTenancy{}.Stamp("2", resource)
+
+	require.NoError(t, err)
+	assert.Equal(t, "2", gjson.GetBytes(stamped, "meta.versionId").String())
+	assert.JSONEq(t, `[{"system":"http://example.com","code":"a"},{"system":"`+TenantTagSystem+`","code":"2"}]`, gjson.GetBytes(stamped, "meta.tag").Raw)
+	assert.True(t, TagTenancy{}.Owns("2", gjson.ParseBytes(stamped)))
+	assert.False(t, TagTenancy{}.Owns("1", gjson.ParseBytes(stamped)))
+}
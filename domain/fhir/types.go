@@ -11,6 +11,7 @@ var (
 	LoincCodingSystem  datatypes.URI = "http://loinc.org"
 	NutsCodingSystem   datatypes.URI = "http://nuts.nl"
 	UZICodingSystem    datatypes.URI = "http://fhir.nl/fhir/NamingSystem/uzi-nr-pers"
+	NandaCodingSystem  datatypes.URI = "urn:oid:2.16.840.1.113883.6.20"
 )
 
 // Codes for the status of an EpisodeOfCare
@@ -39,11 +40,35 @@ type TaskProperties struct {
 // Procedure defines a basic FHIR STU3 Procedure resource which is currently not included in the FHIR library.
 type Procedure struct {
 	resources.Domain
-	Identifier      []datatypes.Identifier `json:"identifier,omitempty"`
-	Code            datatypes.Code         `json:"code,omitempty"`
-	Subject         datatypes.Reference    `json:"subject,omitempty"`
-	ReasonReference []datatypes.Reference  `json:"reasonReference,omitempty"`
-	Note            []datatypes.Annotation `json:"note,omitempty"`
+	Extension       []datatypes.Extension      `json:"extension,omitempty"`
+	Identifier      []datatypes.Identifier     `json:"identifier,omitempty"`
+	Status          datatypes.Code             `json:"status,omitempty"`
+	Code            *datatypes.CodeableConcept `json:"code,omitempty"`
+	Subject         datatypes.Reference        `json:"subject,omitempty"`
+	ReasonReference []datatypes.Reference      `json:"reasonReference,omitempty"`
+	Note            []datatypes.Annotation     `json:"note,omitempty"`
+}
+
+// MedicationStatement defines a basic FHIR STU3 MedicationStatement resource which is currently not included in the FHIR library.
+type MedicationStatement struct {
+	resources.Domain
+	Identifier                []datatypes.Identifier    `json:"identifier,omitempty"`
+	Status                    datatypes.Code            `json:"status"`
+	MedicationCodeableConcept datatypes.CodeableConcept `json:"medicationCodeableConcept"`
+	Subject                   datatypes.Reference       `json:"subject"`
+	Taken                     datatypes.Code            `json:"taken"`
+	Note                      []datatypes.Annotation    `json:"note,omitempty"`
+	Dosage                    []datatypes.Dosage        `json:"dosage,omitempty"`
+}
+
+// RelatedPerson defines a basic FHIR STU3 RelatedPerson resource which is currently not included in the FHIR library.
+type RelatedPerson struct {
+	resources.Domain
+	Identifier   []datatypes.Identifier     `json:"identifier,omitempty"`
+	Patient      datatypes.Reference        `json:"patient"`
+	Relationship *datatypes.CodeableConcept `json:"relationship,omitempty"`
+	Name         []datatypes.HumanName      `json:"name,omitempty"`
+	Telecom      []datatypes.ContactPoint   `json:"telecom,omitempty"`
 }
 
 type CompositionSection struct {
@@ -57,6 +82,7 @@ type CompositionSection struct {
 // Composition defines a basic FHIR STU3 Composition resource which is currently not included in the FHIR library.
 type Composition struct {
 	resources.Base
+	Text       *datatypes.Narrative      `json:"text,omitempty"`
 	Identifier []datatypes.Identifier    `json:"identifier,omitempty"`
 	Type       datatypes.CodeableConcept `json:"type"`
 	Status     datatypes.Code            `json:"status,omitempty"`
@@ -81,3 +107,24 @@ type EpisodeOfCare struct {
 	Team                 []datatypes.Reference       `json:"team,omitempty"`
 	Account              []datatypes.Reference       `json:"account,omitempty"`
 }
+
+// Provenance defines a basic FHIR STU3 Provenance resource which is currently not included in the FHIR library.
+type Provenance struct {
+	resources.Base
+	Target   []datatypes.Reference `json:"target"`
+	Recorded datatypes.Instant     `json:"recorded"`
+	Agent    []ProvenanceAgent     `json:"agent"`
+	Entity   []ProvenanceEntity    `json:"entity,omitempty"`
+}
+
+type ProvenanceAgent struct {
+	datatypes.BackboneElement
+	Role         []datatypes.CodeableConcept `json:"role,omitempty"`
+	WhoReference datatypes.Reference         `json:"whoReference"`
+}
+
+type ProvenanceEntity struct {
+	datatypes.BackboneElement
+	Role          datatypes.Code      `json:"role"`
+	WhatReference datatypes.Reference `json:"whatReference"`
+}
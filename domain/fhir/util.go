@@ -33,6 +33,13 @@ func ToUriPtr(str string) *datatypes.URI {
 	return &result
 }
 
+func FromUriPtr(str *datatypes.URI) string {
+	if str == nil {
+		return ""
+	}
+	return string(*str)
+}
+
 func ToCodePtr(str string) *datatypes.Code {
 	result := datatypes.Code(str)
 	return &result
@@ -0,0 +1,57 @@
+package fhir
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the FHIR version a FHIR server speaks.
+type Version string
+
+const (
+	// VersionSTU3 is FHIR 3.0, which is the version the resources in this application are modelled in.
+	VersionSTU3 Version = "STU3"
+	// VersionR4 is FHIR 4.0. Resources are converted from and to STU3 when talking to an R4 server.
+	VersionR4 Version = "R4"
+)
+
+// ParseVersion parses a configured FHIR version (STU3 or R4, case-insensitive).
+// An empty string returns an empty Version, which means the version is negotiated with the server.
+func ParseVersion(version string) (Version, error) {
+	switch strings.ToUpper(version) {
+	case "":
+		return "", nil
+	case string(VersionSTU3):
+		return VersionSTU3, nil
+	case string(VersionR4):
+		return VersionR4, nil
+	}
+	return "", fmt.Errorf("unsupported FHIR version: %s (supported: STU3, R4)", version)
+}
+
+// versionOf maps the fhirVersion of a CapabilityStatement (e.g. 3.0.2 or 4.0.1) to a Version.
+func versionOf(fhirVersion string) (Version, error) {
+	switch {
+	case strings.HasPrefix(fhirVersion, "3.0"):
+		return VersionSTU3, nil
+	case strings.HasPrefix(fhirVersion, "4.0"):
+		return VersionR4, nil
+	}
+	return "", fmt.Errorf("unsupported FHIR version: %s", fhirVersion)
+}
+
+// negotiationRetryInterval is how long the fallback to STU3 is used after negotiating the version of a server failed.
+const negotiationRetryInterval = 5 * time.Minute
+
+// negotiatedVersions caches the negotiatedVersion of the FHIR servers by the URL of their CapabilityStatement,
+// so it's only requested once per server. Failed negotiations are cached as well, so a server which refuses to
+// return its CapabilityStatement isn't asked on every request.
+var negotiatedVersions = &sync.Map{}
+
+type negotiatedVersion struct {
+	version Version
+	// retryAfter is set if the negotiation failed, it's the time after which it's negotiated again
+	retryAfter time.Time
+}
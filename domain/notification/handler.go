@@ -2,16 +2,21 @@ package notification
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	nutsClient "github.com/nuts-foundation/nuts-demo-ehr/nuts/client"
+	"slices"
 
 	"github.com/monarko/fhirgo/STU3/resources"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/receiver"
+	nutsClient "github.com/nuts-foundation/nuts-demo-ehr/nuts/client"
 	"github.com/nuts-foundation/nuts-demo-ehr/nuts/registry"
 )
 
+// ErrNotTaskOwner is returned when the Task of a notification isn't owned by the customer the notification is addressed to.
+var ErrNotTaskOwner = errors.New("the Task is not owned by the customer the notification is addressed to")
+
 type Notification struct {
 	TaskID     string
 	SenderID   string
@@ -64,11 +69,27 @@ func (service *handler) Handle(ctx context.Context, notification Notification) e
 	task := &resources.Task{}
 	client := fhir.NewFactory(fhir.WithURL(fhirServer), fhir.WithAuthToken(accessToken))
 
-	// FIXME: add query params to filter on the owner so to only process the customer addressed in the notification
 	err = client().ReadOne(ctx, taskPath, &task)
 	if err != nil {
 		return err
 	}
 
+	// Only process the Task for the customer addressed in the notification
+	customerDIDs, err := service.nutsClient.ListSubjectDIDs(ctx, notification.CustomerID)
+	if err != nil {
+		return err
+	}
+	if !isOwnedBy(*task, customerDIDs) {
+		return ErrNotTaskOwner
+	}
+
 	return service.transferService.CreateOrUpdate(ctx, fhir.FromCodePtr(task.Status), notification.CustomerID, notification.SenderID, fhir.FromIDPtr(task.ID))
 }
+
+// isOwnedBy returns true when the owner of the Task is identified by one of the DIDs.
+func isOwnedBy(task resources.Task, dids []string) bool {
+	if task.Owner == nil || task.Owner.Identifier == nil {
+		return false
+	}
+	return slices.Contains(dids, fhir.FromStringPtr(task.Owner.Identifier.Value))
+}
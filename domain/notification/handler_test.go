@@ -0,0 +1,25 @@
+package notification
+
+import (
+	"testing"
+
+	"github.com/monarko/fhirgo/STU3/datatypes"
+	"github.com/monarko/fhirgo/STU3/resources"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_isOwnedBy(t *testing.T) {
+	dids := []string{"did:web:example.com:iam:1", "did:nuts:1"}
+	task := func(owner *datatypes.Reference) resources.Task {
+		return resources.Task{Owner: owner}
+	}
+	ownerReference := func(did string) *datatypes.Reference {
+		return &datatypes.Reference{Identifier: &datatypes.Identifier{System: &fhir.NutsCodingSystem, Value: fhir.ToStringPtr(did)}}
+	}
+
+	assert.True(t, isOwnedBy(task(ownerReference("did:nuts:1")), dids))
+	assert.False(t, isOwnedBy(task(ownerReference("did:nuts:2")), dids))
+	assert.False(t, isOwnedBy(task(&datatypes.Reference{}), dids))
+	assert.False(t, isOwnedBy(task(nil), dids))
+}
@@ -2,7 +2,9 @@ package patients
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"strconv"
 
 	"github.com/monarko/fhirgo/STU3/datatypes"
 	"github.com/monarko/fhirgo/STU3/resources"
@@ -71,18 +73,44 @@ func (r FHIRPatientRepository) FindByID(ctx context.Context, customerID, id stri
 	return &result, nil
 }
 
-func (r FHIRPatientRepository) Update(ctx context.Context, customerID, id string, updateFn func(c types.Patient) (*types.Patient, error)) (*types.Patient, error) {
-	domainPatient, err := r.FindByID(ctx, customerID, id)
+func (r FHIRPatientRepository) FindBySSN(ctx context.Context, customerID, ssn string) (*types.Patient, error) {
+	fhirPatients := []resources.Patient{}
+	params := map[string]string{"identifier": fmt.Sprintf("%s|%s", types.BsnSystem, ssn)}
+	err := r.fhirClientFactory(fhir.WithTenant(customerID)).ReadMultiple(ctx, "Patient", params, &fhirPatients, fhir.WithMaxResults(1))
 	if err != nil {
-		return nil, fmt.Errorf("could not update patient: could not read current patient from FHIR store: %w", err)
+		return nil, err
 	}
-	updatedDomainPatient, err := updateFn(*domainPatient)
+	if len(fhirPatients) == 0 {
+		return nil, nil
+	}
+	result := ToDomainPatient(fhirPatients[0])
+	return &result, nil
+}
+
+// Update applies the updateFn to the current patient. If the patient is modified concurrently, the updateFn is applied
+// again to the fresh patient.
+func (r FHIRPatientRepository) Update(ctx context.Context, customerID, id string, updateFn func(c types.Patient) (*types.Patient, error)) (*types.Patient, error) {
+	fhirClient := r.fhirClientFactory(fhir.WithTenant(customerID))
+	var updatedDomainPatient *types.Patient
+	err := fhir.RetryOnConflict(func() error {
+		currentFHIRPatient := resources.Patient{}
+		if err := fhirClient.ReadOne(ctx, "Patient/"+id, &currentFHIRPatient); err != nil {
+			return fmt.Errorf("could not update patient: could not read current patient from FHIR store: %w", err)
+		}
+		var err error
+		updatedDomainPatient, err = updateFn(ToDomainPatient(currentFHIRPatient))
+		if err != nil {
+			return err
+		}
+		updatedFHIRPatient := ToFHIRPatient(*updatedDomainPatient)
+		// the version of the patient that has been read, so a concurrent update isn't overwritten
+		updatedFHIRPatient.Meta = currentFHIRPatient.Meta
+		return fhirClient.CreateOrUpdate(ctx, updatedFHIRPatient, nil)
+	})
 	if err != nil {
 		return nil, err
 	}
-	fhirClient := r.fhirClientFactory(fhir.WithTenant(customerID))
-	updatedFHIRPatient := ToFHIRPatient(*updatedDomainPatient)
-	return updatedDomainPatient, fhirClient.CreateOrUpdate(ctx, updatedFHIRPatient, nil)
+	return updatedDomainPatient, nil
 }
 
 func (r FHIRPatientRepository) NewPatient(ctx context.Context, customerID string, patientProperties types.PatientProperties) (*types.Patient, error) {
@@ -97,24 +125,123 @@ func (r FHIRPatientRepository) NewPatient(ctx context.Context, customerID string
 	return patient, nil
 }
 
-func (r FHIRPatientRepository) All(ctx context.Context, customerID string, name *string) ([]types.Patient, error) {
-	var params map[string]string
-	if name != nil {
-		params = map[string]string{"name": *name}
-	} else {
-		// Filter patients by having a name. This filters out the anonymous patients created just for the eOverdracht advance notice.
-		params = map[string]string{"name:above": "_"}
+func (r FHIRPatientRepository) NewPatients(ctx context.Context, customerID string, patientProperties []types.PatientProperties) ([]types.Patient, error) {
+	var patients []types.Patient
+	bundle := resources.Bundle{}
+	for _, properties := range patientProperties {
+		patient, err := r.factory.NewPatient(properties)
+		if err != nil {
+			return nil, err
+		}
+		patients = append(patients, *patient)
+		fhirPatient := ToFHIRPatient(*patient)
+		// the FHIR server assigns the ID, so an existing patient keeps its ID
+		fhirPatient.ID = nil
+		var ifNoneExist string
+		if patient.Ssn != nil {
+			ifNoneExist = fmt.Sprintf("identifier=%s|%s", types.BsnSystem, *patient.Ssn)
+		}
+		bundle.Entry = append(bundle.Entry, fhir.PostEntry("Patient", fhirPatient, ifNoneExist))
 	}
-	fhirPatients := []resources.Patient{}
-	err := r.fhirClientFactory(fhir.WithTenant(customerID)).ReadMultiple(ctx, "Patient", params, &fhirPatients)
+	results, err := r.fhirClientFactory(fhir.WithTenant(customerID)).Batch(ctx, bundle)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("could not create patients: %w", err)
 	}
+	for i, result := range results {
+		patients[i].ObjectID = result.ID
+	}
+	return patients, nil
+}
 
-	patients := make([]types.Patient, 0)
-	for _, patient := range fhirPatients {
-		patients = append(patients, ToDomainPatient(patient))
+// sortParams contains the FHIR _sort of the orders in which patients can be searched.
+var sortParams = map[Sort]string{
+	SortBySurname:       "family,given",
+	SortBySurnameDesc:   "-family,-given",
+	SortByBirthDate:     "birthdate,family",
+	SortByBirthDateDesc: "-birthdate,family",
+}
+
+func (r FHIRPatientRepository) Search(ctx context.Context, customerID string, query Query) (*Page, error) {
+	params, err := searchParams(query)
+	if err != nil {
+		return nil, err
+	}
+	var opts []fhir.ReadOpt
+	if query.Limit > 0 || query.Cursor != "" {
+		// a page of patients is a page of the FHIR search Bundle, so the next page starts where the FHIR server's does
+		opts = append(opts, fhir.WithSinglePage())
 	}
+	if query.Cursor != "" {
+		// the cursor is the next link of the FHIR search Bundle, which contains the search parameters
+		page, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		opts = append(opts, fhir.FromPage(string(page)))
+	}
+	// the patients are converted page by page, so the FHIR resources of all patients are never in memory at once
+	fhirPatients := r.fhirClientFactory(fhir.WithTenant(customerID)).Iterate(ctx, "Patient", params, opts...)
+	result := &Page{Patients: make([]types.Patient, 0)}
+	for fhirPatients.Next() {
+		patient := resources.Patient{}
+		if err := fhirPatients.Scan(&patient); err != nil {
+			return nil, err
+		}
+		if patient.ResourceType != "Patient" {
+			return nil, fmt.Errorf("%w: it doesn't continue a search of patients", ErrInvalidCursor)
+		}
+		result.Patients = append(result.Patients, ToDomainPatient(patient))
+	}
+	if err := fhirPatients.Err(); err != nil {
+		return nil, err
+	}
+	nextPage, err := fhirPatients.NextPage()
+	if err != nil {
+		return nil, err
+	}
+	if nextPage != "" {
+		result.Next = base64.RawURLEncoding.EncodeToString([]byte(nextPage))
+	}
+	if total, ok := fhirPatients.Total(); ok {
+		result.Total = &total
+	}
+	return result, nil
+}
 
-	return patients, nil
+// searchParams returns the FHIR search parameters of the query. The FHIR server sorts and pages the result, so a page
+// of patients only requires a single request. Further pages are read by following the next link of the search Bundle,
+// since FHIR servers page in their own way (e.g. HAPI's _getpages).
+func searchParams(query Query) (map[string]string, error) {
+	params := map[string]string{}
+	if query.Name != "" {
+		params["name"] = query.Name
+	} else {
+		// Filter patients by having a name. This filters out the anonymous patients created just for the eOverdracht advance notice.
+		params["name:above"] = "_"
+	}
+	if query.SSN != "" {
+		params["identifier"] = fmt.Sprintf("%s|%s", types.BsnSystem, query.SSN)
+	}
+	if query.BirthDate != nil {
+		params["birthdate"] = query.BirthDate.Format(types.DobFormat)
+	}
+	if query.PostalCode != "" {
+		params["address-postalcode"] = query.PostalCode
+	}
+	if query.Gender != "" {
+		params["gender"] = string(query.Gender)
+	}
+	sortOrder := query.Sort
+	if sortOrder == "" {
+		sortOrder = SortBySurname
+	}
+	sortParam, ok := sortParams[sortOrder]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort order of patients: %s", query.Sort)
+	}
+	params["_sort"] = sortParam
+	if query.Limit > 0 {
+		params["_count"] = strconv.Itoa(query.Limit)
+	}
+	return params, nil
 }
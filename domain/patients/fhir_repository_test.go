@@ -0,0 +1,98 @@
+package patients
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir/embedded"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFHIRPatientRepository_Search(t *testing.T) {
+	httpServer := httptest.NewServer(embedded.NewServer())
+	t.Cleanup(httpServer.Close)
+	repository := NewFHIRPatientRepository(Factory{}, fhir.NewFactory(fhir.WithURL(httpServer.URL)))
+	ctx := context.Background()
+	newPatient := func(ssn, firstName, surname, dob, zipcode string, gender types.Gender) types.PatientProperties {
+		date, _ := time.Parse(types.DobFormat, dob)
+		return types.PatientProperties{Ssn: &ssn, FirstName: firstName, Surname: surname, Dob: &openapi_types.Date{Time: date}, Zipcode: zipcode, Gender: gender}
+	}
+	_, err := repository.NewPatients(ctx, "c1", []types.PatientProperties{
+		newPatient("123", "Henk", "de Vries", "1980-05-02", "1234AB", types.Male),
+		newPatient("456", "Anna", "Bouwman", "1975-01-01", "5678CD", types.Female),
+		newPatient("789", "Kees", "Jansen", "1990-12-31", "1234XY", types.Male),
+	})
+	require.NoError(t, err)
+	birthDate := time.Date(1975, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		query    Query
+		surnames []string
+	}{
+		{name: "all, by surname", query: Query{}, surnames: []string{"Bouwman", "de Vries", "Jansen"}},
+		{name: "by name", query: Query{Name: "kees"}, surnames: []string{"Jansen"}},
+		{name: "by BSN", query: Query{SSN: "123"}, surnames: []string{"de Vries"}},
+		{name: "by birth date", query: Query{BirthDate: &birthDate}, surnames: []string{"Bouwman"}},
+		{name: "by postal code", query: Query{PostalCode: "1234"}, surnames: []string{"de Vries", "Jansen"}},
+		{name: "by gender", query: Query{Gender: types.Female}, surnames: []string{"Bouwman"}},
+		{name: "youngest first", query: Query{Sort: SortByBirthDateDesc}, surnames: []string{"Jansen", "de Vries", "Bouwman"}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			page, err := repository.Search(ctx, "c1", testCase.query)
+
+			require.NoError(t, err)
+			assert.Equal(t, testCase.surnames, surnames(page))
+			assert.Empty(t, page.Next)
+		})
+	}
+	t.Run("pages", func(t *testing.T) {
+		first, err := repository.Search(ctx, "c1", Query{Sort: SortBySurnameDesc, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Jansen", "de Vries"}, surnames(first))
+		require.NotEmpty(t, first.Next)
+		assert.Equal(t, 3, *first.Total)
+
+		// the cursor contains the search, so the other fields are ignored
+		second, err := repository.Search(ctx, "c1", Query{Name: "kees", Cursor: first.Next})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Bouwman"}, surnames(second))
+		assert.Empty(t, second.Next)
+	})
+	t.Run("invalid cursor", func(t *testing.T) {
+		_, err := repository.Search(ctx, "c1", Query{Cursor: "not base64!"})
+
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+	t.Run("cursor of another search", func(t *testing.T) {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte("Observation?_count=1"))
+		observation := map[string]interface{}{"resourceType": "Observation", "id": "o1", "status": "final"}
+		require.NoError(t, fhir.NewFactory(fhir.WithURL(httpServer.URL))(fhir.WithTenant("c1")).CreateOrUpdate(ctx, observation, nil))
+
+		_, err := repository.Search(ctx, "c1", Query{Cursor: cursor})
+
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+	t.Run("unsupported sort", func(t *testing.T) {
+		_, err := repository.Search(ctx, "c1", Query{Sort: "zipcode"})
+
+		assert.EqualError(t, err, "unsupported sort order of patients: zipcode")
+	})
+}
+
+func surnames(page *Page) []string {
+	var result []string
+	for _, patient := range page.Patients {
+		result = append(result, patient.Surname)
+	}
+	return result
+}
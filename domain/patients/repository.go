@@ -2,15 +2,64 @@ package patients
 
 import (
 	"context"
+	"errors"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
 )
 
 type Repository interface {
 	FindByID(ctx context.Context, customerID, id string) (*types.Patient, error)
+	// FindBySSN returns the patient with the given social security number (BSN), or nil if there is none.
+	FindBySSN(ctx context.Context, customerID, ssn string) (*types.Patient, error)
 	Update(ctx context.Context, customerID, id string, updateFn func(c types.Patient) (*types.Patient, error)) (*types.Patient, error)
 	NewPatient(ctx context.Context, customerID string, patient types.PatientProperties) (*types.Patient, error)
-	All(ctx context.Context, customerID string, name *string) ([]types.Patient, error)
+	// NewPatients creates the patients in a single request. A patient with a BSN is only created if there is no patient
+	// with that BSN yet, otherwise the existing patient is returned.
+	NewPatients(ctx context.Context, customerID string, patients []types.PatientProperties) ([]types.Patient, error)
+	// Search returns a page of the patients matching the query, in the order of the query.
+	Search(ctx context.Context, customerID string, query Query) (*Page, error)
+}
+
+// ErrInvalidCursor is returned by Search when the cursor of the query wasn't returned by an earlier search.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Sort is the order in which Search returns the patients.
+type Sort string
+
+const (
+	SortBySurname       Sort = "surname"
+	SortBySurnameDesc   Sort = "-surname"
+	SortByBirthDate     Sort = "dob"
+	SortByBirthDateDesc Sort = "-dob"
+)
+
+// Query selects the patients Search returns. Empty fields don't restrict the result.
+type Query struct {
+	// Name matches the patients of which a part of the name starts with it.
+	Name string
+	// SSN is the social security number (BSN) of the patient.
+	SSN        string
+	BirthDate  *time.Time
+	PostalCode string
+	Gender     types.Gender
+	// Sort defaults to SortBySurname.
+	Sort Sort
+	// Limit is the number of patients on a page, all of them are returned if it's 0.
+	Limit int
+	// Cursor continues an earlier search at its next page (Page.Next). The cursor contains the search including the
+	// page size, so the other fields are ignored.
+	Cursor string
+}
+
+// Page is a page of the patients returned by Search.
+type Page struct {
+	Patients []types.Patient
+	// Next is the cursor of the next page, it's empty if there are no more patients.
+	Next string
+	// Total is the number of patients matching the query, nil if the FHIR server didn't report it.
+	Total *int
 }
 
 type Factory struct{}
@@ -132,9 +132,9 @@ func ConvertToDomain(observation *resources.Observation, patientID string) types
 	return report
 }
 
+// AllByPatient returns the reports of the patient. The observation history can be long,
+// so the observations are converted page by page instead of being read at once.
 func (repo *fhirRepository) AllByPatient(ctx context.Context, customerID, patientID string, episodeID *string) ([]types.Report, error) {
-	observations := []resources.Observation{}
-
 	queryMap := map[string]string{
 		"subject": fmt.Sprintf("Patient/%s", patientID),
 	}
@@ -143,14 +143,16 @@ func (repo *fhirRepository) AllByPatient(ctx context.Context, customerID, patien
 	}
 
 	fhirClient := repo.factory(fhir.WithTenant(customerID))
-	if err := fhirClient.ReadMultiple(ctx, "Observation", queryMap, &observations); err != nil {
-		return nil, err
-	}
+	observations := fhirClient.Iterate(ctx, "Observation", queryMap)
 
 	reports := []types.Report{}
 
 	episodeCache := map[string]types.Episode{}
-	for _, observation := range observations {
+	for observations.Next() {
+		observation := resources.Observation{}
+		if err := observations.Scan(&observation); err != nil {
+			return nil, err
+		}
 		ref := fhir.FromStringPtr(observation.Subject.Reference)
 
 		if !strings.HasPrefix(ref, "Patient/") {
@@ -177,6 +179,9 @@ func (repo *fhirRepository) AllByPatient(ctx context.Context, customerID, patien
 		}
 		reports = append(reports, report)
 	}
+	if err := observations.Err(); err != nil {
+		return nil, err
+	}
 
 	return reports, nil
 }
@@ -0,0 +1,247 @@
+package tenants
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	sqlUtil "github.com/nuts-foundation/nuts-demo-ehr/sql"
+)
+
+const schema = `
+	CREATE TABLE IF NOT EXISTS tenant_partition (
+		customer_id VARCHAR(255) NOT NULL,
+		partition_id INTEGER NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (customer_id),
+		UNIQUE (partition_id),
+		UNIQUE (name)
+	);
+`
+
+// maxNameLength is the maximum length of a partition name, without the suffix which makes it unique.
+const maxNameLength = 64
+
+// firstAllocatedID is the first partition ID allocated to customers whose ID isn't an integer. The IDs below it are
+// reserved for customers whose ID is an integer, so they always get their own ID, even if they're registered later.
+const firstAllocatedID = 1 << 30
+
+// reservedNames can't be used as partition name, since they have a special meaning in the URLs of the FHIR server.
+var reservedNames = map[string]bool{"default": true, "metadata": true}
+
+// Partition is the partition of a customer on the FHIR server.
+type Partition struct {
+	CustomerID string `db:"customer_id"`
+	// ID identifies the partition on the FHIR server, HAPI requires it to be an integer.
+	ID int `db:"partition_id"`
+	// Name is the path segment of the partition in the URLs of the FHIR server, e.g. /fhir/<name>/Patient
+	Name      string    `db:"name"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// Registry allocates the FHIR server partitions of the customers. Customer IDs can't be used as partition directly,
+// since they don't have to be integers or valid path segments.
+type Registry struct {
+	mux sync.RWMutex
+	// names contains the partition names by customer ID, so they can be resolved for every FHIR request without a
+	// database transaction.
+	names map[string]string
+}
+
+func NewRegistry(db *sqlx.DB) (*Registry, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	tx.MustExec(schema)
+	var partitions []Partition
+	if err := tx.Select(&partitions, "SELECT * FROM tenant_partition"); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	registry := &Registry{names: map[string]string{}}
+	for _, partition := range partitions {
+		registry.names[partition.CustomerID] = partition.Name
+	}
+	return registry, nil
+}
+
+// PartitionName returns the name of the partition of the customer, false if the customer hasn't been registered.
+func (r *Registry) PartitionName(customerID string) (string, bool) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	name, ok := r.names[customerID]
+	return name, ok
+}
+
+// Register returns the partition of the customer. If the customer doesn't have one yet, it's allocated:
+//   - the ID is the customer ID if that's an integer below firstAllocatedID (like partitions created before the
+//     registry existed), otherwise the next unused ID from firstAllocatedID,
+//   - the name is derived from the customer ID, with a suffix (e.g. acme-2) if another customer already has that name.
+func (r *Registry) Register(ctx context.Context, customerID string) (*Partition, error) {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	partition, err := r.find(tx, customerID)
+	if err != nil || partition != nil {
+		if partition != nil {
+			r.cache(ctx, customerID, partition.Name)
+		}
+		return partition, err
+	}
+
+	partition = &Partition{CustomerID: customerID, CreatedAt: time.Now()}
+	if partition.ID, err = allocateID(tx, customerID); err != nil {
+		return nil, err
+	}
+	if partition.Name, err = allocateName(tx, customerID); err != nil {
+		return nil, err
+	}
+	const query = `INSERT INTO tenant_partition (customer_id, partition_id, name, created_at)
+		VALUES (:customer_id, :partition_id, :name, :created_at)`
+	if _, err = tx.NamedExec(query, partition); err != nil {
+		return nil, fmt.Errorf("unable to register partition of customer (customer=%s): %w", customerID, err)
+	}
+	r.cache(ctx, customerID, partition.Name)
+	return partition, nil
+}
+
+// Find returns the partition of the customer, or nil if the customer hasn't been registered.
+func (r *Registry) Find(ctx context.Context, customerID string) (*Partition, error) {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.find(tx, customerID)
+}
+
+// All returns the partitions of all registered customers, ordered by ID.
+func (r *Registry) All(ctx context.Context) ([]Partition, error) {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	partitions := []Partition{}
+	if err := tx.SelectContext(ctx, &partitions, "SELECT * FROM tenant_partition ORDER BY partition_id"); err != nil {
+		return nil, err
+	}
+	return partitions, nil
+}
+
+// Remove removes the partition of the customer from the registry, it doesn't remove the partition from the FHIR server.
+func (r *Registry) Remove(ctx context.Context, customerID string) error {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tenant_partition WHERE customer_id = ?", customerID); err != nil {
+		return err
+	}
+	r.mux.Lock()
+	name, existed := r.names[customerID]
+	delete(r.names, customerID)
+	r.mux.Unlock()
+	if existed {
+		r.onRollback(ctx, func() {
+			r.mux.Lock()
+			r.names[customerID] = name
+			r.mux.Unlock()
+		})
+	}
+	return nil
+}
+
+func (r *Registry) find(tx *sqlx.Tx, customerID string) (*Partition, error) {
+	partition := Partition{}
+	err := tx.Get(&partition, "SELECT * FROM tenant_partition WHERE customer_id = ?", customerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &partition, nil
+}
+
+// cache makes the partition name resolvable, it's forgotten again when the transaction is rolled back.
+func (r *Registry) cache(ctx context.Context, customerID string, name string) {
+	r.mux.Lock()
+	_, existed := r.names[customerID]
+	r.names[customerID] = name
+	r.mux.Unlock()
+	if !existed {
+		r.onRollback(ctx, func() {
+			r.mux.Lock()
+			delete(r.names, customerID)
+			r.mux.Unlock()
+		})
+	}
+}
+
+func (r *Registry) onRollback(ctx context.Context, handler func()) {
+	if tm, err := sqlUtil.GetTransactionManager(ctx); err == nil {
+		tm.OnRollback(handler)
+	}
+}
+
+func allocateID(tx *sqlx.Tx, customerID string) (int, error) {
+	if id, err := strconv.Atoi(customerID); err == nil && id > 0 && id < firstAllocatedID {
+		return id, nil
+	}
+	var id int
+	const query = "SELECT COALESCE(MAX(partition_id) + 1, ?) FROM tenant_partition WHERE partition_id >= ?"
+	if err := tx.Get(&id, query, firstAllocatedID, firstAllocatedID); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func allocateName(tx *sqlx.Tx, customerID string) (string, error) {
+	base := partitionName(customerID)
+	name := base
+	for i := 2; ; i++ {
+		var count int
+		if err := tx.Get(&count, "SELECT COUNT(*) FROM tenant_partition WHERE name = ?", name); err != nil {
+			return "", err
+		}
+		if count == 0 && !reservedNames[name] {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// partitionName derives a partition name from the customer ID: lower case letters, digits and dashes only.
+// Lower case names can't be mistaken for resource types (e.g. Patient) in the URLs of the FHIR server.
+func partitionName(customerID string) string {
+	var name strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(customerID) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			name.WriteRune(c)
+			dash = false
+		} else if !dash && name.Len() > 0 {
+			name.WriteRune('-')
+			dash = true
+		}
+		if name.Len() >= maxNameLength {
+			break
+		}
+	}
+	result := strings.Trim(name.String(), "-")
+	if result == "" {
+		return "tenant"
+	}
+	return result
+}
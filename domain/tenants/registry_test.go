@@ -0,0 +1,118 @@
+package tenants
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nuts-foundation/nuts-demo-ehr/sql"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRegistry(t *testing.T) (*sqlx.DB, *Registry) {
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	registry, err := NewRegistry(db)
+	require.NoError(t, err)
+	return db, registry
+}
+
+func TestRegistry_Register(t *testing.T) {
+	db, registry := newTestRegistry(t)
+	var partitions []*Partition
+	err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+		for _, customerID := range []string{"2", "Zorg & Co", "zorg-co", "2b1cbc5a-0d25-4c5e-9bd5-1e0ec7d5d5b6", "Default", "2"} {
+			partition, err := registry.Register(ctx, customerID)
+			if err != nil {
+				return err
+			}
+			partitions = append(partitions, partition)
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	// integer customer IDs keep their ID, like the partitions created before the registry existed
+	assert.Equal(t, 2, partitions[0].ID)
+	assert.Equal(t, "2", partitions[0].Name)
+	assert.Equal(t, firstAllocatedID, partitions[1].ID)
+	assert.Equal(t, "zorg-co", partitions[1].Name)
+	assert.Equal(t, firstAllocatedID+1, partitions[2].ID)
+	assert.Equal(t, "zorg-co-2", partitions[2].Name)
+	assert.Equal(t, "2b1cbc5a-0d25-4c5e-9bd5-1e0ec7d5d5b6", partitions[3].Name)
+	assert.Equal(t, "default-2", partitions[4].Name)
+	// registering again returns the same partition
+	assert.Equal(t, partitions[0].ID, partitions[5].ID)
+
+	t.Run("resolved after restart", func(t *testing.T) {
+		registry, err := NewRegistry(db)
+		require.NoError(t, err)
+
+		name, ok := registry.PartitionName("Zorg & Co")
+
+		assert.True(t, ok)
+		assert.Equal(t, "zorg-co", name)
+	})
+}
+
+func TestRegistry_Register_reservedIDs(t *testing.T) {
+	db, registry := newTestRegistry(t)
+	var partitions []*Partition
+	err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+		// a customer with an integer ID registered after other customers must still get its own partition
+		for _, customerID := range []string{"acme", "1", "1073741824"} {
+			partition, err := registry.Register(ctx, customerID)
+			if err != nil {
+				return err
+			}
+			partitions = append(partitions, partition)
+		}
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, firstAllocatedID, partitions[0].ID)
+	assert.Equal(t, 1, partitions[1].ID)
+	assert.Equal(t, firstAllocatedID+1, partitions[2].ID)
+}
+
+func TestRegistry_Rollback(t *testing.T) {
+	db, registry := newTestRegistry(t)
+
+	err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+		if _, err := registry.Register(ctx, "1"); err != nil {
+			return err
+		}
+		return errors.New("failed")
+	})
+
+	assert.Error(t, err)
+	_, ok := registry.PartitionName("1")
+	assert.False(t, ok)
+}
+
+func TestRegistry_Remove(t *testing.T) {
+	db, registry := newTestRegistry(t)
+	var partitions []Partition
+	err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+		_, _ = registry.Register(ctx, "1")
+		_, _ = registry.Register(ctx, "2")
+		if err := registry.Remove(ctx, "1"); err != nil {
+			return err
+		}
+		var err error
+		partitions, err = registry.All(ctx)
+		return err
+	})
+
+	require.NoError(t, err)
+	require.Len(t, partitions, 1)
+	assert.Equal(t, "2", partitions[0].CustomerID)
+	_, ok := registry.PartitionName("1")
+	assert.False(t, ok)
+}
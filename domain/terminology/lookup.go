@@ -0,0 +1,97 @@
+package terminology
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+)
+
+// Value sets which are bundled with the application
+const (
+	ProblemsValueSet      = "problems"
+	InterventionsValueSet = "interventions"
+)
+
+// ErrUnknownValueSet is returned when the requested value set isn't bundled with the application.
+var ErrUnknownValueSet = errors.New("unknown value set")
+
+// valueSetsFS contains the bundled FHIR ValueSets, the file name (without extension) is the name of the value set.
+//
+//go:embed valuesets/*.json
+var valueSetsFS embed.FS
+
+// Lookup searches the concepts of the value sets which are bundled with the application,
+// so the care plan can be coded without a terminology server.
+type Lookup interface {
+	// Search returns at most limit concepts of the value set of which the display or code contains the query (case-insensitive).
+	Search(valueSet, query string, limit int) ([]types.CodedConcept, error)
+}
+
+type valueSet struct {
+	Compose struct {
+		Include []struct {
+			System  string `json:"system"`
+			Concept []struct {
+				Code    string `json:"code"`
+				Display string `json:"display"`
+			} `json:"concept"`
+		} `json:"include"`
+	} `json:"compose"`
+}
+
+// NewLookup loads the bundled value sets.
+func NewLookup() (Lookup, error) {
+	files, err := valueSetsFS.ReadDir("valuesets")
+	if err != nil {
+		return nil, err
+	}
+	lookup := bundledLookup{valueSets: map[string][]types.CodedConcept{}}
+	for _, file := range files {
+		data, err := valueSetsFS.ReadFile(path.Join("valuesets", file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var parsed valueSet
+		if err := json.Unmarshal(data, &parsed); err != nil {
+			return nil, fmt.Errorf("invalid ValueSet (file=%s): %w", file.Name(), err)
+		}
+		name := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
+		for _, include := range parsed.Compose.Include {
+			for _, concept := range include.Concept {
+				lookup.valueSets[name] = append(lookup.valueSets[name], types.CodedConcept{
+					System:  include.System,
+					Code:    concept.Code,
+					Display: concept.Display,
+				})
+			}
+		}
+	}
+	return lookup, nil
+}
+
+type bundledLookup struct {
+	valueSets map[string][]types.CodedConcept
+}
+
+func (l bundledLookup) Search(valueSet, query string, limit int) ([]types.CodedConcept, error) {
+	concepts, ok := l.valueSets[valueSet]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownValueSet, valueSet)
+	}
+	query = strings.ToLower(strings.TrimSpace(query))
+	results := make([]types.CodedConcept, 0)
+	for _, concept := range concepts {
+		if len(results) == limit {
+			break
+		}
+		if strings.Contains(strings.ToLower(concept.Display), query) || strings.Contains(concept.Code, query) {
+			results = append(results, concept)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,47 @@
+package terminology
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundledLookup_Search(t *testing.T) {
+	lookup, err := NewLookup()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("by display", func(t *testing.T) {
+		concepts, err := lookup.Search(ProblemsValueSet, "DIABETES", 20)
+
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NotEmpty(t, concepts)
+		for _, concept := range concepts {
+			assert.Contains(t, concept.Display, "iabetes")
+		}
+	})
+	t.Run("by code", func(t *testing.T) {
+		concepts, err := lookup.Search(InterventionsValueSet, "33747003", 20)
+
+		if !assert.NoError(t, err) {
+			return
+		}
+		if assert.Len(t, concepts, 1) {
+			assert.Equal(t, "http://snomed.info/sct", concepts[0].System)
+		}
+	})
+	t.Run("limit", func(t *testing.T) {
+		concepts, err := lookup.Search(ProblemsValueSet, "", 3)
+
+		assert.NoError(t, err)
+		assert.Len(t, concepts, 3)
+	})
+	t.Run("unknown value set", func(t *testing.T) {
+		_, err := lookup.Search("medications", "", 3)
+
+		assert.ErrorIs(t, err, ErrUnknownValueSet)
+	})
+}
@@ -0,0 +1,210 @@
+package document
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	openapiTypes "github.com/oapi-codegen/runtime/types"
+)
+
+// Titles of the documents of a transfer
+const (
+	AdvanceNoticeTitle  = "Advance notice"
+	NursingHandoffTitle = "Nursing handoff"
+)
+
+// Document is the human-readable representation of a transfer, for care organizations which don't run a FHIR-aware EHR.
+type Document struct {
+	types.TransferProperties
+	// Title is the type of document, e.g. "Advance notice" or "Nursing handoff"
+	Title string
+	// Sender is the care organization which requests the transfer, it is only known by the receiving care organization.
+	Sender *types.Organization
+	// Status is the status of the transfer or transfer request, it is empty when the document is used as narrative.
+	Status string
+}
+
+// FromTransfer returns the document of a transfer of the sending care organization.
+// It is the nursing handoff if it has been shared, otherwise the advance notice.
+func FromTransfer(transfer types.Transfer) Document {
+	title := AdvanceNoticeTitle
+	if transfer.FhirNursingHandoffComposition != nil {
+		title = NursingHandoffTitle
+	}
+	return Document{
+		TransferProperties: types.TransferProperties{
+			CarePlan:       transfer.CarePlan,
+			HandoffContent: transfer.HandoffContent,
+			Patient:        transfer.Patient,
+			TransferDate:   transfer.TransferDate,
+		},
+		Title:  title,
+		Status: string(transfer.Status),
+	}
+}
+
+// FromTransferRequest returns the document of a transfer request received from another care organization.
+// It is the nursing handoff if it has been received, otherwise the advance notice.
+func FromTransferRequest(request types.TransferRequest) Document {
+	document := Document{
+		TransferProperties: request.AdvanceNotice,
+		Title:              AdvanceNoticeTitle,
+		Sender:             &request.Sender,
+		Status:             request.Status,
+	}
+	if request.NursingHandoff != nil {
+		document.TransferProperties = *request.NursingHandoff
+		document.Title = NursingHandoffTitle
+	}
+	return document
+}
+
+func patientName(patient types.Patient) string {
+	return strings.TrimSpace(patient.FirstName + " " + patient.Surname)
+}
+
+// formatDate formats a (pointer to a) date, it returns an empty string if the date isn't set.
+func formatDate(value interface{}) string {
+	var date openapiTypes.Date
+	switch typed := value.(type) {
+	case openapiTypes.Date:
+		date = typed
+	case *openapiTypes.Date:
+		if typed == nil {
+			return ""
+		}
+		date = *typed
+	default:
+		return ""
+	}
+	if date.IsZero() {
+		return ""
+	}
+	return date.Format("2 January 2006")
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return strings.TrimSpace(*value)
+}
+
+// codeLabel returns the code system and code of a concept, e.g. SNOMED CT 44054006
+func codeLabel(concept *types.CodedConcept) string {
+	if concept == nil {
+		return ""
+	}
+	system := concept.System
+	switch system {
+	case string(fhir.SnomedCodingSystem):
+		system = "SNOMED CT"
+	case string(fhir.NandaCodingSystem):
+		system = "NANDA-I"
+	}
+	return system + " " + concept.Code
+}
+
+// problemDetails returns the status, onset date and code of a problem, e.g. active, since 1 March 2021, SNOMED CT 44054006
+func problemDetails(problem types.Problem) string {
+	details := []string{string(problem.Status)}
+	if onset := formatDate(problem.OnsetDate); onset != "" {
+		details = append(details, "since "+onset)
+	}
+	if problem.Code != nil {
+		details = append(details, codeLabel(problem.Code))
+	}
+	return strings.Join(details, ", ")
+}
+
+var periodUnits = map[types.InterventionFrequencyPeriodUnit]string{
+	types.H:  "hour",
+	types.D:  "day",
+	types.Wk: "week",
+	types.Mo: "month",
+}
+
+// formatFrequency returns how often an intervention is performed, e.g. 3 times per day
+func formatFrequency(frequency *types.InterventionFrequency) string {
+	if frequency == nil {
+		return ""
+	}
+	unit := periodUnits[frequency.PeriodUnit]
+	if unit == "" {
+		unit = string(frequency.PeriodUnit)
+	}
+	period := unit
+	if frequency.Period != 1 {
+		period = fmt.Sprintf("%s %ss", strconv.FormatFloat(float64(frequency.Period), 'f', -1, 32), unit)
+	}
+	times := "times"
+	if frequency.Frequency == 1 {
+		times = "time"
+	}
+	return fmt.Sprintf("%d %s per %s", frequency.Frequency, times, period)
+}
+
+// interventions returns the interventions which have been filled in, the form always contains an empty one.
+func interventions(patientProblem types.PatientProblem) []types.Intervention {
+	var result []types.Intervention
+	for _, intervention := range patientProblem.Interventions {
+		if strings.TrimSpace(intervention.Comment) != "" {
+			result = append(result, intervention)
+		}
+	}
+	return result
+}
+
+// handoffContent returns the content of the nursing handoff without the entries of which the required field is left
+// empty in the form. Lists without entries are nil, so they're left out of the document.
+func handoffContent(content *types.NursingHandoffContent) *types.NursingHandoffContent {
+	if content == nil {
+		return nil
+	}
+	result := types.NursingHandoffContent{
+		Mobility:        nonEmpty(content.Mobility),
+		DailyActivities: nonEmpty(content.DailyActivities),
+	}
+	if content.Medications != nil {
+		result.Medications = filter(*content.Medications, func(medication types.Medication) bool { return strings.TrimSpace(medication.Name) != "" })
+	}
+	if content.Allergies != nil {
+		result.Allergies = filter(*content.Allergies, func(allergy types.Allergy) bool { return strings.TrimSpace(allergy.Substance) != "" })
+	}
+	if content.WoundCare != nil {
+		result.WoundCare = filter(*content.WoundCare, func(woundCare types.WoundCare) bool { return strings.TrimSpace(woundCare.Location) != "" })
+	}
+	if content.ContactPersons != nil {
+		result.ContactPersons = filter(*content.ContactPersons, func(contactPerson types.ContactPerson) bool { return strings.TrimSpace(contactPerson.Name) != "" })
+	}
+	if content.ResponsiblePractitioner != nil && strings.TrimSpace(content.ResponsiblePractitioner.Name) != "" {
+		result.ResponsiblePractitioner = content.ResponsiblePractitioner
+	}
+	if result == (types.NursingHandoffContent{}) {
+		return nil
+	}
+	return &result
+}
+
+func nonEmpty(value *string) *string {
+	if stringValue(value) == "" {
+		return nil
+	}
+	return value
+}
+
+func filter[T any](items []T, keep func(T) bool) *[]T {
+	var result []T
+	for _, item := range items {
+		if keep(item) {
+			result = append(result, item)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return &result
+}
@@ -0,0 +1,103 @@
+package document
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	openapiTypes "github.com/oapi-codegen/runtime/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDocument() Document {
+	transferDate, _ := time.Parse(types.DobFormat, "2024-05-01")
+	mobility := "Walks with a walker"
+	empty := " "
+	return FromTransferRequest(types.TransferRequest{
+		AdvanceNotice: types.TransferProperties{Patient: types.Patient{Zipcode: "1234AB"}},
+		NursingHandoff: &types.TransferProperties{
+			Patient:      types.Patient{FirstName: "Henk", Surname: "de Vries", Zipcode: "1234AB"},
+			TransferDate: openapiTypes.Date{Time: transferDate},
+			CarePlan: types.EOverdrachtCarePlan{PatientProblems: []types.PatientProblem{{
+				Problem: types.Problem{
+					Name:   "Diabetes & <complications>",
+					Status: types.ProblemStatusActive,
+					Code:   &types.CodedConcept{System: "http://snomed.info/sct", Code: "73211009", Display: "Diabetes mellitus"},
+				},
+				Interventions: []types.Intervention{
+					{Comment: "Check glucose", Frequency: &types.InterventionFrequency{Frequency: 3, Period: 1, PeriodUnit: types.D}},
+					{Comment: ""},
+				},
+			}}},
+			HandoffContent: &types.NursingHandoffContent{
+				Mobility:        &mobility,
+				DailyActivities: &empty,
+				Medications:     &[]types.Medication{{Name: ""}},
+			},
+		},
+		Sender: types.Organization{Name: "Verpleeghuis De Regenboog", City: "Utrecht"},
+		Status: "in-progress",
+	})
+}
+
+func TestRenderHTML(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	err := RenderHTML(buf, testDocument())
+
+	if !assert.NoError(t, err) {
+		return
+	}
+	html := buf.String()
+	assert.Contains(t, html, "<title>Nursing handoff - Henk de Vries</title>")
+	assert.Contains(t, html, "Verpleeghuis De Regenboog, Utrecht")
+	assert.Contains(t, html, "1 May 2024")
+	assert.Contains(t, html, "Diabetes &amp; &lt;complications&gt;")
+	assert.Contains(t, html, "active, SNOMED CT 73211009")
+	assert.Contains(t, html, "Check glucose (3 times per day)")
+	assert.Contains(t, html, "Walks with a walker")
+	// empty entries of the form are left out
+	assert.Equal(t, 1, strings.Count(html, "<li>"))
+	assert.NotContains(t, html, "Medication")
+	assert.NotContains(t, html, "Activities of daily living")
+}
+
+func TestRenderNarrative(t *testing.T) {
+	narrative, err := RenderNarrative(testDocument())
+
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, strings.HasPrefix(narrative, `<div xmlns="http://www.w3.org/1999/xhtml">`))
+	assert.NotContains(t, narrative, "<style>")
+	// the narrative of a FHIR resource must be well-formed XHTML
+	decoder := xml.NewDecoder(strings.NewReader(narrative))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+	}
+}
+
+func TestRenderPDF(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	err := RenderPDF(buf, testDocument())
+
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+}
+
+func TestFormatFrequency(t *testing.T) {
+	assert.Equal(t, "1 time per 2 weeks", formatFrequency(&types.InterventionFrequency{Frequency: 1, Period: 2, PeriodUnit: types.Wk}))
+	assert.Equal(t, "2 times per 1.5 hours", formatFrequency(&types.InterventionFrequency{Frequency: 2, Period: 1.5, PeriodUnit: types.H}))
+	assert.Empty(t, formatFrequency(nil))
+}
@@ -0,0 +1,38 @@
+package document
+
+import (
+	"embed"
+	"html/template"
+	"io"
+	"strings"
+)
+
+//go:embed templates/document.html
+var templatesFS embed.FS
+
+var templates = template.Must(template.New("document").Funcs(template.FuncMap{
+	"patientName":     patientName,
+	"formatDate":      formatDate,
+	"stringValue":     stringValue,
+	"codeLabel":       codeLabel,
+	"problemDetails":  problemDetails,
+	"formatFrequency": formatFrequency,
+	"interventions":   interventions,
+	"handoffContent":  handoffContent,
+}).ParseFS(templatesFS, "templates/document.html"))
+
+// RenderHTML writes the document as styled HTML page.
+func RenderHTML(writer io.Writer, document Document) error {
+	return templates.ExecuteTemplate(writer, "page", document)
+}
+
+// RenderNarrative returns the document as XHTML fragment, to be used as narrative (text) of a FHIR resource.
+func RenderNarrative(document Document) (string, error) {
+	builder := strings.Builder{}
+	builder.WriteString(`<div xmlns="http://www.w3.org/1999/xhtml">`)
+	if err := templates.ExecuteTemplate(&builder, "body", document); err != nil {
+		return "", err
+	}
+	builder.WriteString(`</div>`)
+	return builder.String(), nil
+}
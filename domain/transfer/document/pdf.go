@@ -0,0 +1,183 @@
+package document
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// pdfWriter renders the parts of a document, it uses the same layout as the HTML page.
+type pdfWriter struct {
+	pdf *fpdf.Fpdf
+	// translate converts UTF-8 to the encoding of the core fonts
+	translate func(string) string
+}
+
+const (
+	pdfLabelWidth = 45
+	pdfLineHeight = 6
+)
+
+// RenderPDF writes the document as PDF.
+func RenderPDF(writer io.Writer, document Document) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(document.Title, true)
+	pdf.SetMargins(20, 20, 20)
+	pdf.AddPage()
+	w := pdfWriter{pdf: pdf, translate: pdf.UnicodeTranslatorFromDescriptor("")}
+
+	w.title(document.Title)
+
+	w.heading("Patient")
+	w.field("Name", patientName(document.Patient))
+	w.field("Date of birth", formatDate(document.Patient.Dob))
+	w.field("Gender", string(document.Patient.Gender))
+	w.field("BSN", stringValue(document.Patient.Ssn))
+	w.field("Zipcode", document.Patient.Zipcode)
+
+	w.heading("Administrative data")
+	w.field("Transfer date", formatDate(document.TransferDate))
+	if document.Sender != nil {
+		sender := document.Sender.Name
+		if document.Sender.City != "" {
+			sender += ", " + document.Sender.City
+		}
+		w.field("Sender", sender)
+	}
+	w.field("Status", document.Status)
+
+	w.heading("Problems")
+	if len(document.CarePlan.PatientProblems) == 0 {
+		w.paragraph("No problems.")
+	}
+	for _, patientProblem := range document.CarePlan.PatientProblems {
+		w.subheading(patientProblem.Problem.Name)
+		w.details(problemDetails(patientProblem.Problem))
+		for _, intervention := range interventions(patientProblem) {
+			item := intervention.Comment
+			if frequency := formatFrequency(intervention.Frequency); frequency != "" {
+				item += fmt.Sprintf(" (%s)", frequency)
+			}
+			if code := codeLabel(intervention.Code); code != "" {
+				item += " - " + code
+			}
+			w.item(item)
+		}
+	}
+
+	if content := handoffContent(document.HandoffContent); content != nil {
+		if content.Medications != nil {
+			w.heading("Medication")
+			for _, medication := range *content.Medications {
+				w.item(join(medication.Name, ": ", stringValue(medication.Dosage), " - ", stringValue(medication.Comment)))
+			}
+		}
+		if content.Allergies != nil {
+			w.heading("Allergies")
+			for _, allergy := range *content.Allergies {
+				criticality := ""
+				if allergy.Criticality != nil {
+					criticality = "criticality " + string(*allergy.Criticality)
+				}
+				w.item(join(allergy.Substance, ": ", stringValue(allergy.Reaction), " - ", criticality))
+			}
+		}
+		if content.WoundCare != nil {
+			w.heading("Wound care")
+			for _, woundCare := range *content.WoundCare {
+				treatment := ""
+				if stringValue(woundCare.Treatment) != "" {
+					treatment = "treatment: " + stringValue(woundCare.Treatment)
+				}
+				w.item(join(woundCare.Location, ": ", stringValue(woundCare.Description), " - ", treatment))
+			}
+		}
+		if content.Mobility != nil {
+			w.heading("Mobility")
+			w.paragraph(*content.Mobility)
+		}
+		if content.DailyActivities != nil {
+			w.heading("Activities of daily living")
+			w.paragraph(*content.DailyActivities)
+		}
+		if content.ContactPersons != nil {
+			w.heading("Contact persons")
+			for _, contactPerson := range *content.ContactPersons {
+				w.item(join(contactPerson.Name, " - ", stringValue(contactPerson.Relationship), ", ", stringValue(contactPerson.Telephone)))
+			}
+		}
+		if practitioner := content.ResponsiblePractitioner; practitioner != nil {
+			w.heading("Responsible practitioner")
+			w.paragraph(join(practitioner.Name, " - ", stringValue(practitioner.Role), ", ", stringValue(practitioner.Telephone)))
+		}
+	}
+
+	if err := pdf.Error(); err != nil {
+		return err
+	}
+	return pdf.Output(writer)
+}
+
+func (w pdfWriter) title(text string) {
+	w.pdf.SetFont("Helvetica", "B", 18)
+	w.pdf.SetTextColor(15, 76, 129)
+	w.pdf.CellFormat(0, 10, w.translate(text), "B", 1, "L", false, 0, "")
+	w.pdf.Ln(2)
+}
+
+func (w pdfWriter) heading(text string) {
+	w.pdf.Ln(4)
+	w.pdf.SetFont("Helvetica", "B", 13)
+	w.pdf.SetTextColor(15, 76, 129)
+	w.pdf.CellFormat(0, 8, w.translate(text), "", 1, "L", false, 0, "")
+}
+
+func (w pdfWriter) subheading(text string) {
+	w.pdf.SetFont("Helvetica", "B", 11)
+	w.pdf.SetTextColor(31, 41, 55)
+	w.pdf.MultiCell(0, pdfLineHeight, w.translate(text), "", "L", false)
+}
+
+// field writes a label and its value, it is left out if the value is empty.
+func (w pdfWriter) field(label, value string) {
+	if value == "" {
+		return
+	}
+	w.pdf.SetFont("Helvetica", "B", 10)
+	w.pdf.SetTextColor(31, 41, 55)
+	w.pdf.CellFormat(pdfLabelWidth, pdfLineHeight, w.translate(label), "", 0, "L", false, 0, "")
+	w.pdf.SetFont("Helvetica", "", 10)
+	w.pdf.MultiCell(0, pdfLineHeight, w.translate(value), "", "L", false)
+}
+
+func (w pdfWriter) details(text string) {
+	w.pdf.SetFont("Helvetica", "", 9)
+	w.pdf.SetTextColor(107, 114, 128)
+	w.pdf.MultiCell(0, pdfLineHeight, w.translate(text), "", "L", false)
+}
+
+func (w pdfWriter) item(text string) {
+	w.pdf.SetFont("Helvetica", "", 10)
+	w.pdf.SetTextColor(31, 41, 55)
+	w.pdf.CellFormat(5, pdfLineHeight, "-", "", 0, "L", false, 0, "")
+	w.pdf.MultiCell(0, pdfLineHeight, w.translate(text), "", "L", false)
+}
+
+func (w pdfWriter) paragraph(text string) {
+	w.pdf.SetFont("Helvetica", "", 10)
+	w.pdf.SetTextColor(31, 41, 55)
+	w.pdf.MultiCell(0, pdfLineHeight, w.translate(text), "", "L", false)
+}
+
+// join joins the first value with the optional values, every optional value is preceded by its separator.
+// Empty optional values are left out together with their separator, e.g. join("Metformin", ": ", "", " - ", "with food")
+// returns "Metformin - with food".
+func join(value string, separatorsAndValues ...string) string {
+	for i := 0; i+1 < len(separatorsAndValues); i += 2 {
+		if separatorsAndValues[i+1] != "" {
+			value += separatorsAndValues[i] + separatorsAndValues[i+1]
+		}
+	}
+	return value
+}
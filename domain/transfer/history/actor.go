@@ -0,0 +1,17 @@
+package history
+
+import "context"
+
+type actorContextKey struct{}
+
+// WithActor returns a context that carries the user that performs the action, so it can be recorded in the events.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the user that performs the action. It returns an empty string when the action
+// is not performed by a user, e.g. when it is caused by the other care organization.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorContextKey{}).(string)
+	return actor
+}
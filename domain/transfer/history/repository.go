@@ -0,0 +1,201 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	sqlUtil "github.com/nuts-foundation/nuts-demo-ehr/sql"
+)
+
+// The triggers make the table append-only, events can't be altered or removed once they have been recorded.
+const schema = `
+	CREATE TABLE IF NOT EXISTS transfer_event (
+		id char(36) NOT NULL,
+		customer_id VARCHAR(255) NOT NULL,
+		role VARCHAR(20) CHECK (role IN ('sender', 'receiver')) NOT NULL,
+		transfer_id char(36) NULL,
+		negotiation_id char(36) NULL,
+		task_id VARCHAR(100) NULL,
+		type VARCHAR(50) NOT NULL,
+		status VARCHAR(100) NULL,
+		organization_id varchar(200) NULL,
+		actor VARCHAR(255) NULL,
+		details TEXT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_transfer_event_transfer ON transfer_event (customer_id, transfer_id);
+	CREATE INDEX IF NOT EXISTS idx_transfer_event_task ON transfer_event (customer_id, task_id);
+	CREATE TRIGGER IF NOT EXISTS transfer_event_no_update BEFORE UPDATE ON transfer_event
+	BEGIN
+		SELECT RAISE(ABORT, 'transfer events are append-only');
+	END;
+	CREATE TRIGGER IF NOT EXISTS transfer_event_no_delete BEFORE DELETE ON transfer_event
+	BEGIN
+		SELECT RAISE(ABORT, 'transfer events are append-only');
+	END;
+`
+
+// Role indicates whether the event was recorded by the sending or receiving side of the transfer.
+type Role string
+
+const (
+	SenderRole   Role = "sender"
+	ReceiverRole Role = "receiver"
+)
+
+// Event is an entry in the audit trail of a transfer.
+type Event struct {
+	CustomerID string
+	Role       Role
+	// TransferID is only known by the sending organization.
+	TransferID     string
+	NegotiationID  string
+	TaskID         string
+	Type           types.TransferEventType
+	Status         string
+	OrganizationID string
+	Actor          string
+	Details        string
+}
+
+type Repository interface {
+	// Add records the event. It uses the transaction from the context, so the event is only recorded when the action itself is committed.
+	Add(ctx context.Context, event Event) error
+	// FindByTransfer returns the events of a transfer of the sending organization, including the events of the given FHIR tasks, oldest first.
+	FindByTransfer(ctx context.Context, customerID, transferID string, taskIDs []string) ([]types.TransferEvent, error)
+	// FindByTask returns the events of a FHIR Task recorded in the given role, oldest first.
+	FindByTask(ctx context.Context, customerID string, role Role, taskID string) ([]types.TransferEvent, error)
+}
+
+type sqlEvent struct {
+	ID             string         `db:"id"`
+	CustomerID     string         `db:"customer_id"`
+	Role           string         `db:"role"`
+	TransferID     sql.NullString `db:"transfer_id"`
+	NegotiationID  sql.NullString `db:"negotiation_id"`
+	TaskID         sql.NullString `db:"task_id"`
+	Type           string         `db:"type"`
+	Status         sql.NullString `db:"status"`
+	OrganizationID sql.NullString `db:"organization_id"`
+	Actor          sql.NullString `db:"actor"`
+	Details        sql.NullString `db:"details"`
+	CreatedAt      time.Time      `db:"created_at"`
+}
+
+func (dbEvent sqlEvent) MarshalToDomainEvent() types.TransferEvent {
+	return types.TransferEvent{
+		Id:             dbEvent.ID,
+		Type:           types.TransferEventType(dbEvent.Type),
+		NegotiationID:  fromNullString(dbEvent.NegotiationID),
+		TaskID:         fromNullString(dbEvent.TaskID),
+		Status:         fromNullString(dbEvent.Status),
+		OrganizationID: fromNullString(dbEvent.OrganizationID),
+		Actor:          fromNullString(dbEvent.Actor),
+		Details:        fromNullString(dbEvent.Details),
+		CreatedAt:      dbEvent.CreatedAt,
+	}
+}
+
+func (dbEvent *sqlEvent) UnmarshalFromDomainEvent(event Event) {
+	*dbEvent = sqlEvent{
+		CustomerID:     event.CustomerID,
+		Role:           string(event.Role),
+		TransferID:     toNullString(event.TransferID),
+		NegotiationID:  toNullString(event.NegotiationID),
+		TaskID:         toNullString(event.TaskID),
+		Type:           string(event.Type),
+		Status:         toNullString(event.Status),
+		OrganizationID: toNullString(event.OrganizationID),
+		Actor:          toNullString(event.Actor),
+		Details:        toNullString(event.Details),
+	}
+}
+
+type SQLiteRepository struct {
+}
+
+func NewRepository(db *sqlx.DB) *SQLiteRepository {
+	if db == nil {
+		panic("missing db")
+	}
+
+	tx, _ := db.Beginx()
+	tx.MustExec(schema)
+	if err := tx.Commit(); err != nil {
+		panic(err)
+	}
+
+	return &SQLiteRepository{}
+}
+
+func (r SQLiteRepository) Add(ctx context.Context, event Event) error {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	dbEvent := sqlEvent{}
+	dbEvent.UnmarshalFromDomainEvent(event)
+	dbEvent.ID = uuid.NewString()
+	dbEvent.CreatedAt = time.Now()
+
+	const query = `INSERT INTO transfer_event
+		(id, customer_id, role, transfer_id, negotiation_id, task_id, type, status, organization_id, actor, details, created_at)
+		values(:id, :customer_id, :role, :transfer_id, :negotiation_id, :task_id, :type, :status, :organization_id, :actor, :details, :created_at)
+`
+	if _, err := tx.NamedExecContext(ctx, query, dbEvent); err != nil {
+		return fmt.Errorf("could not record transfer event: %w", err)
+	}
+	return nil
+}
+
+func (r SQLiteRepository) FindByTransfer(ctx context.Context, customerID, transferID string, taskIDs []string) ([]types.TransferEvent, error) {
+	if len(taskIDs) == 0 {
+		const query = `SELECT * FROM transfer_event WHERE customer_id = ? AND role = ? AND transfer_id = ? ORDER BY created_at ASC, rowid ASC`
+		return r.list(ctx, query, customerID, SenderRole, transferID)
+	}
+	query, args, err := sqlx.In(`SELECT * FROM transfer_event WHERE customer_id = ? AND role = ? AND (transfer_id = ? OR task_id IN (?)) ORDER BY created_at ASC, rowid ASC`,
+		customerID, SenderRole, transferID, taskIDs)
+	if err != nil {
+		return nil, err
+	}
+	return r.list(ctx, query, args...)
+}
+
+func (r SQLiteRepository) FindByTask(ctx context.Context, customerID string, role Role, taskID string) ([]types.TransferEvent, error) {
+	const query = `SELECT * FROM transfer_event WHERE customer_id = ? AND role = ? AND task_id = ? ORDER BY created_at ASC, rowid ASC`
+	return r.list(ctx, query, customerID, role, taskID)
+}
+
+func (r SQLiteRepository) list(ctx context.Context, query string, args ...interface{}) ([]types.TransferEvent, error) {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var dbEvents []sqlEvent
+	if err := tx.SelectContext(ctx, &dbEvents, query, args...); err != nil {
+		return nil, fmt.Errorf("unable to list transfer events: %w", err)
+	}
+	result := make([]types.TransferEvent, len(dbEvents))
+	for i, dbEvent := range dbEvents {
+		result[i] = dbEvent.MarshalToDomainEvent()
+	}
+	return result, nil
+}
+
+func toNullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func fromNullString(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+	return &value.String
+}
@@ -0,0 +1,61 @@
+package history
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	"github.com/nuts-foundation/nuts-demo-ehr/sql"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteRepository_FindByTransfer(t *testing.T) {
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	repo := NewRepository(db)
+
+	var events []types.TransferEvent
+	err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+		ctx = WithActor(ctx, "t.tester@example.com")
+		_ = repo.Add(ctx, Event{CustomerID: "c1", Role: SenderRole, TransferID: "t1", Type: types.TransferCreated})
+		_ = repo.Add(ctx, Event{CustomerID: "c1", Role: SenderRole, TransferID: "t1", TaskID: "task1", Type: types.StateChanged, Actor: ActorFromContext(ctx)})
+		// recorded by the notification dispatcher, which only knows the task
+		_ = repo.Add(ctx, Event{CustomerID: "c1", Role: SenderRole, TaskID: "task1", Type: types.NotificationSent})
+		// other transfer, customer and role
+		_ = repo.Add(ctx, Event{CustomerID: "c1", Role: SenderRole, TransferID: "t2", TaskID: "task2", Type: types.StateChanged})
+		_ = repo.Add(ctx, Event{CustomerID: "c2", Role: SenderRole, TransferID: "t1", Type: types.TransferCreated})
+		_ = repo.Add(ctx, Event{CustomerID: "c1", Role: ReceiverRole, TaskID: "task1", Type: types.NotificationReceived})
+
+		var err error
+		events, err = repo.FindByTransfer(ctx, "c1", "t1", []string{"task1"})
+		return err
+	})
+
+	if !assert.NoError(t, err) || !assert.Len(t, events, 3) {
+		return
+	}
+	assert.Equal(t, types.TransferCreated, events[0].Type)
+	assert.Nil(t, events[0].Actor)
+	assert.Equal(t, types.StateChanged, events[1].Type)
+	assert.Equal(t, "t.tester@example.com", *events[1].Actor)
+	assert.Equal(t, types.NotificationSent, events[2].Type)
+}
+
+func TestSQLiteRepository_AppendOnly(t *testing.T) {
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	repo := NewRepository(db)
+
+	err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+		return repo.Add(ctx, Event{CustomerID: "c1", Role: ReceiverRole, TaskID: "task1", Type: types.NotificationReceived})
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = db.Exec("UPDATE transfer_event SET type = 'state-changed'")
+	assert.ErrorContains(t, err, "append-only")
+	_, err = db.Exec("DELETE FROM transfer_event")
+	assert.ErrorContains(t, err, "append-only")
+}
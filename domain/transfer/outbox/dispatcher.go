@@ -0,0 +1,221 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/history"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	nutsClient "github.com/nuts-foundation/nuts-demo-ehr/nuts/client"
+	"github.com/nuts-foundation/nuts-demo-ehr/nuts/registry"
+	sqlUtil "github.com/nuts-foundation/nuts-demo-ehr/sql"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrNotFailed is returned when a notification is resent that has not failed.
+var ErrNotFailed = errors.New("only failed notifications can be resent")
+
+// batchSize is the maximum number of notifications that is delivered per dispatch round.
+const batchSize = 50
+
+type Config struct {
+	// Interval at which the dispatcher looks for pending notifications.
+	Interval time.Duration
+	// MaxAttempts is the number of delivery attempts after which a notification is marked as failed.
+	MaxAttempts int
+	// InitialBackoff is the delay after the first failed attempt. It doubles after every failed attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff time.Duration
+}
+
+// Dispatcher delivers the notifications in the outbox in the background.
+type Dispatcher struct {
+	db         *sqlx.DB
+	repository Repository
+	nutsClient *nutsClient.HTTPClient
+	registry   registry.OrganizationRegistry
+	notifier   transfer.Notifier
+	history    history.Repository
+	config     Config
+}
+
+func NewDispatcher(db *sqlx.DB, repository Repository, nutsClient *nutsClient.HTTPClient, organizationRegistry registry.OrganizationRegistry, notifier transfer.Notifier, transferHistory history.Repository, config Config) *Dispatcher {
+	return &Dispatcher{
+		db:         db,
+		repository: repository,
+		nutsClient: nutsClient,
+		registry:   organizationRegistry,
+		notifier:   notifier,
+		history:    transferHistory,
+		config:     config,
+	}
+}
+
+// Start starts delivering pending notifications until the context is cancelled.
+func (d *Dispatcher) Start(ctx context.Context) {
+	if d.config.Interval <= 0 {
+		logrus.Warn("Delivery of eOverdracht notifications is disabled, since its interval isn't positive")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(d.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.dispatch(ctx)
+			}
+		}
+	}()
+}
+
+// ListFailed returns the notifications of the customer that could not be delivered.
+func (d *Dispatcher) ListFailed(ctx context.Context, customerID string) ([]types.TransferNotification, error) {
+	notifications, err := d.repository.ListFailed(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]types.TransferNotification, len(notifications))
+	for i, notification := range notifications {
+		result[i] = notification.TransferNotification
+	}
+	return result, nil
+}
+
+// Resend schedules a failed notification for immediate delivery. It returns nil if the notification does not exist.
+func (d *Dispatcher) Resend(ctx context.Context, customerID, id string) (*types.TransferNotification, error) {
+	notification, err := d.repository.FindByID(ctx, customerID, id)
+	if err != nil || notification == nil {
+		return nil, err
+	}
+	if notification.Status != types.TransferNotificationStatusFailed {
+		return nil, fmt.Errorf("%w (status=%s)", ErrNotFailed, notification.Status)
+	}
+	now := time.Now()
+	notification.Status = types.TransferNotificationStatusPending
+	notification.Attempts = 0
+	notification.NextAttemptAt = &now
+	if err := d.repository.Update(ctx, *notification); err != nil {
+		return nil, err
+	}
+	return &notification.TransferNotification, nil
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	var due []Notification
+	err := sqlUtil.ExecuteTransactional(d.db, func(txCtx context.Context) error {
+		var err error
+		due, err = d.repository.FindDue(txCtx, time.Now(), batchSize)
+		return err
+	})
+	if err != nil {
+		logrus.Errorf("Unable to find pending eOverdracht notifications: %s", err)
+		return
+	}
+
+	// Notifications are delivered outside a transaction, since the receiver might be this server.
+	for _, notification := range due {
+		deliveryErr := d.deliver(ctx, notification)
+		err = sqlUtil.ExecuteTransactional(d.db, func(txCtx context.Context) error {
+			notification = d.recordAttempt(notification, deliveryErr, time.Now())
+			if err := d.repository.Update(txCtx, notification); err != nil {
+				return err
+			}
+			return d.recordEvent(txCtx, notification)
+		})
+		if err != nil {
+			logrus.Errorf("Unable to update eOverdracht notification (id=%s): %s", notification.Id, err)
+		}
+	}
+}
+
+// recordAttempt updates the notification with the result of a delivery attempt and schedules the next attempt.
+func (d *Dispatcher) recordAttempt(notification Notification, deliveryErr error, now time.Time) Notification {
+	notification.Attempts++
+	if deliveryErr == nil {
+		notification.Status = types.TransferNotificationStatusDelivered
+		notification.DeliveredAt = &now
+		notification.NextAttemptAt = nil
+		return notification
+	}
+
+	errStr := deliveryErr.Error()
+	notification.LastError = &errStr
+	if notification.Attempts >= d.config.MaxAttempts {
+		logrus.Errorf("Giving up delivering eOverdracht notification (id=%s, task=%s, receiver=%s) after %d attempts: %s", notification.Id, notification.TaskID, notification.OrganizationID, notification.Attempts, deliveryErr)
+		notification.Status = types.TransferNotificationStatusFailed
+		notification.NextAttemptAt = nil
+		return notification
+	}
+	logrus.Warnf("Unable to deliver eOverdracht notification (id=%s, task=%s, receiver=%s, attempt=%d): %s", notification.Id, notification.TaskID, notification.OrganizationID, notification.Attempts, deliveryErr)
+	nextAttempt := now.Add(d.backoff(notification.Attempts))
+	notification.NextAttemptAt = &nextAttempt
+	return notification
+}
+
+// recordEvent adds the delivery of the notification, or giving up on it, to the history of the transfer.
+func (d *Dispatcher) recordEvent(ctx context.Context, notification Notification) error {
+	event := history.Event{
+		CustomerID:     notification.CustomerID,
+		Role:           history.SenderRole,
+		TaskID:         notification.TaskID,
+		OrganizationID: notification.OrganizationID,
+	}
+	switch notification.Status {
+	case types.TransferNotificationStatusDelivered:
+		event.Type = types.NotificationSent
+	case types.TransferNotificationStatusFailed:
+		event.Type = types.NotificationFailed
+		event.Details = fmt.Sprintf("gave up after %d attempts: %s", notification.Attempts, *notification.LastError)
+	default:
+		// will be retried
+		return nil
+	}
+	return d.history.Add(ctx, event)
+}
+
+// backoff returns the delay before the next attempt, given the number of failed attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.InitialBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= d.config.MaxBackoff {
+			return d.config.MaxBackoff
+		}
+	}
+	return delay
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, notification Notification) error {
+	notificationEndpoint, err := d.registry.GetCompoundServiceEndpoint(ctx, notification.OrganizationID, transfer.ServiceName, "notification")
+	if err != nil {
+		return err
+	}
+	authServerEndpoint, err := d.registry.GetCompoundServiceEndpoint(ctx, notification.OrganizationID, transfer.ServiceName, "authServerURL")
+	if err != nil {
+		return err
+	}
+
+	tokenResponse, err := d.nutsClient.RequestServiceAccessToken(ctx, notification.CustomerID, authServerEndpoint, transfer.ReceiverServiceScope)
+	if err != nil {
+		return err
+	}
+
+	endpoint := notificationEndpoint
+
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+
+	endpoint += notification.TaskID
+
+	return d.notifier.Notify(tokenResponse, endpoint)
+}
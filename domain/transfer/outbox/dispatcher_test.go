@@ -0,0 +1,121 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	"github.com/nuts-foundation/nuts-demo-ehr/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = Config{Interval: time.Second, MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: 3 * time.Minute}
+
+func TestDispatcher_Start(t *testing.T) {
+	t.Run("non-positive interval", func(t *testing.T) {
+		for _, interval := range []time.Duration{0, -time.Second} {
+			dispatcher := NewDispatcher(nil, nil, nil, nil, nil, nil, Config{Interval: interval})
+
+			// a ticker with a non-positive interval panics
+			assert.NotPanics(t, func() { dispatcher.Start(context.Background()) })
+		}
+	})
+}
+
+func TestDispatcher_backoff(t *testing.T) {
+	dispatcher := NewDispatcher(nil, nil, nil, nil, nil, nil, testConfig)
+
+	assert.Equal(t, time.Minute, dispatcher.backoff(1))
+	assert.Equal(t, 2*time.Minute, dispatcher.backoff(2))
+	assert.Equal(t, 3*time.Minute, dispatcher.backoff(3))
+	assert.Equal(t, 3*time.Minute, dispatcher.backoff(10))
+}
+
+func TestDispatcher_recordAttempt(t *testing.T) {
+	dispatcher := NewDispatcher(nil, nil, nil, nil, nil, nil, testConfig)
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	pending := func(attempts int) Notification {
+		return Notification{TransferNotification: types.TransferNotification{Status: types.TransferNotificationStatusPending, Attempts: attempts}}
+	}
+
+	t.Run("delivered", func(t *testing.T) {
+		notification := dispatcher.recordAttempt(pending(1), nil, now)
+
+		assert.Equal(t, types.TransferNotificationStatusDelivered, notification.Status)
+		assert.Equal(t, 2, notification.Attempts)
+		assert.Equal(t, &now, notification.DeliveredAt)
+		assert.Nil(t, notification.NextAttemptAt)
+	})
+	t.Run("failed, retried after the backoff", func(t *testing.T) {
+		notification := dispatcher.recordAttempt(pending(1), errors.New("connection refused"), now)
+
+		assert.Equal(t, types.TransferNotificationStatusPending, notification.Status)
+		assert.Equal(t, 2, notification.Attempts)
+		assert.Equal(t, "connection refused", *notification.LastError)
+		assert.Equal(t, now.Add(2*time.Minute), *notification.NextAttemptAt)
+	})
+	t.Run("failed for the last time", func(t *testing.T) {
+		notification := dispatcher.recordAttempt(pending(2), errors.New("connection refused"), now)
+
+		assert.Equal(t, types.TransferNotificationStatusFailed, notification.Status)
+		assert.Equal(t, 3, notification.Attempts)
+		assert.Nil(t, notification.NextAttemptAt)
+	})
+}
+
+func TestDispatcher_Resend(t *testing.T) {
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	repository := NewRepository(db)
+	dispatcher := NewDispatcher(db, repository, nil, nil, nil, nil, testConfig)
+	var failed, pending *Notification
+	err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+		var err error
+		if failed, err = repository.Add(ctx, "c1", "did:web:receiver", "task-1"); err != nil {
+			return err
+		}
+		failed.Status, failed.Attempts, failed.NextAttemptAt = types.TransferNotificationStatusFailed, 3, nil
+		if err = repository.Update(ctx, *failed); err != nil {
+			return err
+		}
+		pending, err = repository.Add(ctx, "c1", "did:web:receiver", "task-2")
+		return err
+	})
+	require.NoError(t, err)
+
+	t.Run("failed notification is delivered again", func(t *testing.T) {
+		_ = sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			notification, err := dispatcher.Resend(ctx, "c1", failed.Id)
+
+			require.NoError(t, err)
+			assert.Equal(t, types.TransferNotificationStatusPending, notification.Status)
+			assert.Equal(t, 0, notification.Attempts)
+			due, err := repository.FindDue(ctx, time.Now(), batchSize)
+			require.NoError(t, err)
+			assert.Len(t, due, 2)
+			return nil
+		})
+	})
+	t.Run("notification which hasn't failed", func(t *testing.T) {
+		_ = sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			_, err := dispatcher.Resend(ctx, "c1", pending.Id)
+
+			assert.ErrorIs(t, err, ErrNotFailed)
+			return nil
+		})
+	})
+	t.Run("notification of another customer", func(t *testing.T) {
+		_ = sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			notification, err := dispatcher.Resend(ctx, "c2", failed.Id)
+
+			assert.NoError(t, err)
+			assert.Nil(t, notification)
+			return nil
+		})
+	})
+}
@@ -0,0 +1,226 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	sqlUtil "github.com/nuts-foundation/nuts-demo-ehr/sql"
+)
+
+const schema = `
+	CREATE TABLE IF NOT EXISTS transfer_notification (
+		id char(36) NOT NULL,
+		customer_id VARCHAR(255) NOT NULL,
+		organization_id varchar(200) NOT NULL,
+		task_id char(36) NOT NULL,
+		status VARCHAR(20) CHECK (status IN (
+			'pending',
+			'delivered',
+			'failed'
+		)) NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NULL,
+		created_at DATETIME NOT NULL,
+		next_attempt_at DATETIME NULL,
+		delivered_at DATETIME NULL,
+		PRIMARY KEY (id)
+	);
+`
+
+// Notification is a notification that is queued for delivery to a receiving care organization.
+type Notification struct {
+	types.TransferNotification
+	CustomerID string
+}
+
+type Repository interface {
+	// Add queues a new notification. It uses the transaction from the context,
+	// so the notification only becomes available for delivery when that transaction is committed.
+	Add(ctx context.Context, customerID, organizationID, taskID string) (*Notification, error)
+	FindByID(ctx context.Context, customerID, id string) (*Notification, error)
+	// FindDue returns the pending notifications of which the next attempt is due at the given time, oldest first.
+	FindDue(ctx context.Context, now time.Time, limit int) ([]Notification, error)
+	ListFailed(ctx context.Context, customerID string) ([]Notification, error)
+	// Update stores the delivery state of the notification.
+	Update(ctx context.Context, notification Notification) error
+}
+
+type sqlNotification struct {
+	ID             string         `db:"id"`
+	CustomerID     string         `db:"customer_id"`
+	OrganizationID string         `db:"organization_id"`
+	TaskID         string         `db:"task_id"`
+	Status         string         `db:"status"`
+	Attempts       int            `db:"attempts"`
+	LastError      sql.NullString `db:"last_error"`
+	CreatedAt      time.Time      `db:"created_at"`
+	NextAttemptAt  sql.NullTime   `db:"next_attempt_at"`
+	DeliveredAt    sql.NullTime   `db:"delivered_at"`
+}
+
+func (dbNotification sqlNotification) MarshalToDomainNotification() Notification {
+	result := Notification{
+		TransferNotification: types.TransferNotification{
+			Id:             dbNotification.ID,
+			OrganizationID: dbNotification.OrganizationID,
+			TaskID:         dbNotification.TaskID,
+			Status:         types.TransferNotificationStatus(dbNotification.Status),
+			Attempts:       dbNotification.Attempts,
+			CreatedAt:      dbNotification.CreatedAt,
+		},
+		CustomerID: dbNotification.CustomerID,
+	}
+	if dbNotification.LastError.Valid {
+		result.LastError = &dbNotification.LastError.String
+	}
+	if dbNotification.NextAttemptAt.Valid {
+		result.NextAttemptAt = &dbNotification.NextAttemptAt.Time
+	}
+	if dbNotification.DeliveredAt.Valid {
+		result.DeliveredAt = &dbNotification.DeliveredAt.Time
+	}
+	return result
+}
+
+// UnmarshalFromDomainNotification converts the notification to its database representation. The times are stored in
+// UTC, so they're in the same time zone as the times they're compared with.
+func (dbNotification *sqlNotification) UnmarshalFromDomainNotification(notification Notification) {
+	*dbNotification = sqlNotification{
+		ID:             notification.Id,
+		CustomerID:     notification.CustomerID,
+		OrganizationID: notification.OrganizationID,
+		TaskID:         notification.TaskID,
+		Status:         string(notification.Status),
+		Attempts:       notification.Attempts,
+		CreatedAt:      notification.CreatedAt.UTC(),
+	}
+	if notification.LastError != nil {
+		dbNotification.LastError = sql.NullString{String: *notification.LastError, Valid: true}
+	}
+	if notification.NextAttemptAt != nil {
+		dbNotification.NextAttemptAt = sql.NullTime{Time: notification.NextAttemptAt.UTC(), Valid: true}
+	}
+	if notification.DeliveredAt != nil {
+		dbNotification.DeliveredAt = sql.NullTime{Time: notification.DeliveredAt.UTC(), Valid: true}
+	}
+}
+
+type SQLiteRepository struct {
+}
+
+func NewRepository(db *sqlx.DB) *SQLiteRepository {
+	if db == nil {
+		panic("missing db")
+	}
+
+	tx, _ := db.Beginx()
+	tx.MustExec(schema)
+	if err := tx.Commit(); err != nil {
+		panic(err)
+	}
+
+	return &SQLiteRepository{}
+}
+
+func (r SQLiteRepository) Add(ctx context.Context, customerID, organizationID, taskID string) (*Notification, error) {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notification := Notification{
+		TransferNotification: types.TransferNotification{
+			Id:             uuid.NewString(),
+			OrganizationID: organizationID,
+			TaskID:         taskID,
+			Status:         types.TransferNotificationStatusPending,
+			CreatedAt:      now,
+			NextAttemptAt:  &now,
+		},
+		CustomerID: customerID,
+	}
+	dbNotification := sqlNotification{}
+	dbNotification.UnmarshalFromDomainNotification(notification)
+
+	const query = `INSERT INTO transfer_notification
+		(id, customer_id, organization_id, task_id, status, attempts, created_at, next_attempt_at)
+		values(:id, :customer_id, :organization_id, :task_id, :status, :attempts, :created_at, :next_attempt_at)
+`
+	if _, err := tx.NamedExecContext(ctx, query, dbNotification); err != nil {
+		return nil, fmt.Errorf("could not queue notification: %w", err)
+	}
+	return &notification, nil
+}
+
+func (r SQLiteRepository) FindByID(ctx context.Context, customerID, id string) (*Notification, error) {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	const query = `SELECT * FROM transfer_notification WHERE customer_id = ? AND id = ?`
+
+	dbNotification := sqlNotification{}
+	err = tx.GetContext(ctx, &dbNotification, query, customerID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to find notification by id: %w", err)
+	}
+	result := dbNotification.MarshalToDomainNotification()
+	return &result, nil
+}
+
+func (r SQLiteRepository) FindDue(ctx context.Context, now time.Time, limit int) ([]Notification, error) {
+	const query = `SELECT * FROM transfer_notification WHERE status = ? AND julianday(next_attempt_at) <= julianday(?) ORDER BY created_at ASC LIMIT ?`
+	return r.list(ctx, query, types.TransferNotificationStatusPending, now.UTC(), limit)
+}
+
+func (r SQLiteRepository) ListFailed(ctx context.Context, customerID string) ([]Notification, error) {
+	const query = `SELECT * FROM transfer_notification WHERE customer_id = ? AND status = ? ORDER BY created_at DESC`
+	return r.list(ctx, query, customerID, types.TransferNotificationStatusFailed)
+}
+
+func (r SQLiteRepository) list(ctx context.Context, query string, args ...interface{}) ([]Notification, error) {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var dbNotifications []sqlNotification
+	if err := tx.SelectContext(ctx, &dbNotifications, query, args...); err != nil {
+		return nil, fmt.Errorf("unable to list notifications: %w", err)
+	}
+	result := make([]Notification, len(dbNotifications))
+	for i, dbNotification := range dbNotifications {
+		result[i] = dbNotification.MarshalToDomainNotification()
+	}
+	return result, nil
+}
+
+func (r SQLiteRepository) Update(ctx context.Context, notification Notification) error {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	const query = `
+	UPDATE transfer_notification SET
+		status = :status,
+		attempts = :attempts,
+		last_error = :last_error,
+		next_attempt_at = :next_attempt_at,
+		delivered_at = :delivered_at
+	WHERE customer_id = :customer_id AND id = :id
+`
+	dbNotification := sqlNotification{}
+	dbNotification.UnmarshalFromDomainNotification(notification)
+	if _, err = tx.NamedExecContext(ctx, query, dbNotification); err != nil {
+		return fmt.Errorf("unable to update the notification: %w", err)
+	}
+	return nil
+}
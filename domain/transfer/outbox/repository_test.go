@@ -0,0 +1,52 @@
+package outbox
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nuts-foundation/nuts-demo-ehr/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteRepository_FindDue(t *testing.T) {
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	repository := NewRepository(db)
+	nextAttempt := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	utcMinus5 := time.FixedZone("UTC-5", -5*60*60)
+	utcPlus2 := time.FixedZone("UTC+2", 2*60*60)
+	err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+		notification, err := repository.Add(ctx, "c1", "did:web:receiver", "task-1")
+		if err != nil {
+			return err
+		}
+		// the next attempt is scheduled in another time zone than it's looked up in
+		next := nextAttempt.In(utcMinus5)
+		notification.NextAttemptAt = &next
+		return repository.Update(ctx, *notification)
+	})
+	require.NoError(t, err)
+	findDue := func(now time.Time) []Notification {
+		var result []Notification
+		err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			var err error
+			result, err = repository.FindDue(ctx, now, 10)
+			return err
+		})
+		require.NoError(t, err)
+		return result
+	}
+
+	t.Run("due", func(t *testing.T) {
+		// after the next attempt in UTC, but before it when compared as text
+		assert.Len(t, findDue(nextAttempt.Add(30*time.Minute).In(utcMinus5)), 1)
+	})
+	t.Run("not due", func(t *testing.T) {
+		// before the next attempt in UTC, but after it when compared as text
+		assert.Empty(t, findDue(nextAttempt.Add(-30*time.Minute).In(utcPlus2)))
+	})
+}
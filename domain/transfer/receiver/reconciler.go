@@ -0,0 +1,142 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	sqlUtil "github.com/nuts-foundation/nuts-demo-ehr/sql"
+	"github.com/sirupsen/logrus"
+)
+
+type ReconcilerConfig struct {
+	// Interval at which the incoming transfers are compared with the sender's Task. The reconciler is disabled when it is 0.
+	Interval time.Duration
+	// InitialBackoff is the period a sender is skipped after its Tasks could not be read. It doubles after every next failure.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the period a sender is skipped.
+	MaxBackoff time.Duration
+}
+
+// Reconciler periodically reads the sender's Task of every incoming transfer that is not final, so a lost notification
+// doesn't leave the incoming transfer with a stale status.
+type Reconciler struct {
+	db         *sqlx.DB
+	repository TransferRepository
+	service    TransferService
+	config     ReconcilerConfig
+	// backoffs holds the senders which can't be reached, by DID
+	backoffs    map[string]backoff
+	backoffsMux *sync.Mutex
+}
+
+type backoff struct {
+	failures    int
+	nextAttempt time.Time
+}
+
+func NewReconciler(db *sqlx.DB, transferRepository TransferRepository, transferService TransferService, config ReconcilerConfig) *Reconciler {
+	return &Reconciler{
+		db:          db,
+		repository:  transferRepository,
+		service:     transferService,
+		config:      config,
+		backoffs:    map[string]backoff{},
+		backoffsMux: &sync.Mutex{},
+	}
+}
+
+// Start runs the reconciler until the context is cancelled.
+func (r *Reconciler) Start(ctx context.Context) {
+	if r.config.Interval == 0 {
+		logrus.Info("Reconciler for incoming eOverdracht transfers is disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.run(ctx, time.Now())
+			}
+		}
+	}()
+}
+
+func (r *Reconciler) run(ctx context.Context, now time.Time) {
+	var transfers map[string][]types.IncomingTransfer
+	err := sqlUtil.ExecuteTransactional(r.db, func(txCtx context.Context) error {
+		var err error
+		transfers, err = r.repository.ListNotFinal(txCtx)
+		return err
+	})
+	if err != nil {
+		logrus.Errorf("Unable to find incoming eOverdracht transfers: %s", err)
+		return
+	}
+
+	for customerID, customerTransfers := range transfers {
+		for _, transfer := range customerTransfers {
+			senderDID := transfer.Sender.Did
+			if !r.shouldAttempt(senderDID, now) {
+				continue
+			}
+			// The transaction only starts when the status is updated, so it isn't held while reading the remote Task.
+			err := sqlUtil.ExecuteTransactional(r.db, func(txCtx context.Context) error {
+				return r.service.ReconcileTransferRequest(txCtx, customerID, senderDID, transfer.FhirTaskID, string(transfer.Status.Status))
+			})
+			if err != nil {
+				logrus.Warnf("Unable to reconcile incoming eOverdracht transfer (task=%s, sender=%s): %s", transfer.FhirTaskID, senderDID, err)
+			}
+			r.recordAttempt(senderDID, err, now)
+		}
+	}
+}
+
+// shouldAttempt returns false when the sender is in backoff.
+func (r *Reconciler) shouldAttempt(senderDID string, now time.Time) bool {
+	r.backoffsMux.Lock()
+	defer r.backoffsMux.Unlock()
+	current, exists := r.backoffs[senderDID]
+	return !exists || !now.Before(current.nextAttempt)
+}
+
+// recordAttempt puts the sender in backoff after it failed, a success ends the backoff. Errors of a single Task
+// (e.g. a Task that doesn't exist) show the sender can be reached, so they end the backoff as well.
+func (r *Reconciler) recordAttempt(senderDID string, err error, now time.Time) {
+	r.backoffsMux.Lock()
+	defer r.backoffsMux.Unlock()
+	if err == nil || !isSenderFailure(err) {
+		delete(r.backoffs, senderDID)
+		return
+	}
+	current := r.backoffs[senderDID]
+	current.failures++
+	delay := r.config.InitialBackoff
+	for i := 1; i < current.failures && delay < r.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if r.config.MaxBackoff > 0 && delay > r.config.MaxBackoff {
+		delay = r.config.MaxBackoff
+	}
+	current.nextAttempt = now.Add(delay)
+	r.backoffs[senderDID] = current
+}
+
+// isSenderFailure returns whether the error means the sender can't process requests at the moment: it can't be reached,
+// it has a server error (5xx) or it receives too many requests. Other errors of its FHIR server concern a single Task.
+func isSenderFailure(err error) bool {
+	var fhirErr fhir.Error
+	if errors.As(err, &fhirErr) {
+		return fhirErr.Status >= http.StatusInternalServerError || fhirErr.Status == http.StatusTooManyRequests
+	}
+	return true
+}
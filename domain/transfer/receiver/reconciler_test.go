@@ -0,0 +1,127 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
+	"github.com/nuts-foundation/nuts-demo-ehr/sql"
+	"github.com/stretchr/testify/assert"
+)
+
+// reconcilingService records the Tasks it reconciled, reading the Tasks of unreachable senders fails.
+type reconcilingService struct {
+	TransferService
+	unreachable map[string]bool
+	// taskErrors contains the errors of reading a Task, by Task ID
+	taskErrors map[string]error
+	reconciled []string
+}
+
+func (r *reconcilingService) ReconcileTransferRequest(_ context.Context, _, senderDID, fhirTaskID, _ string) error {
+	if r.unreachable[senderDID] {
+		return errors.New("connection refused")
+	}
+	if err := r.taskErrors[fhirTaskID]; err != nil {
+		return err
+	}
+	r.reconciled = append(r.reconciled, fhirTaskID)
+	return nil
+}
+
+func TestReconciler_run(t *testing.T) {
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	repo := NewTransferRepository(db)
+	service := &reconcilingService{unreachable: map[string]bool{"did:web:down": true}}
+	reconciler := NewReconciler(db, repo, service, ReconcilerConfig{InitialBackoff: time.Minute, MaxBackoff: 3 * time.Minute})
+	err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+		_, _ = repo.CreateOrUpdate(ctx, transfer.RequestedState, "task-1", "c1", "did:web:up")
+		_, _ = repo.CreateOrUpdate(ctx, transfer.CompletedState, "task-2", "c1", "did:web:up")
+		_, _ = repo.CreateOrUpdate(ctx, transfer.InProgressState, "task-3", "c2", "did:web:down")
+		return nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	now := time.Now()
+
+	t.Run("final transfers are skipped", func(t *testing.T) {
+		reconciler.run(context.Background(), now)
+
+		assert.Equal(t, []string{"task-1"}, service.reconciled)
+		assert.Equal(t, 1, reconciler.backoffs["did:web:down"].failures)
+	})
+	t.Run("unreachable sender is skipped during backoff", func(t *testing.T) {
+		reconciler.run(context.Background(), now.Add(30*time.Second))
+
+		assert.Equal(t, 1, reconciler.backoffs["did:web:down"].failures)
+	})
+	t.Run("backoff doubles until the maximum", func(t *testing.T) {
+		reconciler.run(context.Background(), now.Add(time.Minute))
+		assert.Equal(t, now.Add(3*time.Minute), reconciler.backoffs["did:web:down"].nextAttempt)
+
+		reconciler.run(context.Background(), now.Add(3*time.Minute))
+		assert.Equal(t, now.Add(6*time.Minute), reconciler.backoffs["did:web:down"].nextAttempt)
+	})
+	t.Run("backoff ends when the sender is reachable again", func(t *testing.T) {
+		service.unreachable = nil
+		reconciler.run(context.Background(), now.Add(6*time.Minute))
+
+		assert.Contains(t, service.reconciled, "task-3")
+		assert.Empty(t, reconciler.backoffs)
+	})
+}
+
+func TestReconciler_recordAttempt(t *testing.T) {
+	reconciler := NewReconciler(nil, nil, nil, ReconcilerConfig{InitialBackoff: time.Minute, MaxBackoff: 3 * time.Minute})
+	now := time.Now()
+	testCases := []struct {
+		name    string
+		err     error
+		backoff bool
+	}{
+		{name: "connection error", err: errors.New("connection refused"), backoff: true},
+		{name: "server error", err: fhir.Error{Status: http.StatusBadGateway}, backoff: true},
+		{name: "too many requests", err: fhir.Error{Status: http.StatusTooManyRequests}, backoff: true},
+		{name: "access to the Task revoked", err: fmt.Errorf("error while fetching task: %w", fhir.Error{Status: http.StatusForbidden})},
+		{name: "Task not found", err: fhir.Error{Status: http.StatusNotFound}},
+		{name: "invalid request", err: fhir.Error{Status: http.StatusBadRequest}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			reconciler.backoffs = map[string]backoff{"did:web:a": {failures: 1, nextAttempt: now}}
+
+			reconciler.recordAttempt("did:web:a", testCase.err, now)
+
+			_, inBackoff := reconciler.backoffs["did:web:a"]
+			assert.Equal(t, testCase.backoff, inBackoff)
+			if testCase.backoff {
+				assert.Equal(t, now.Add(2*time.Minute), reconciler.backoffs["did:web:a"].nextAttempt)
+			}
+		})
+	}
+	t.Run("a Task which can't be read doesn't block the other Tasks of the sender", func(t *testing.T) {
+		db := sqlx.MustConnect("sqlite3", ":memory:")
+		repo := NewTransferRepository(db)
+		service := &reconcilingService{taskErrors: map[string]error{"task-1": fhir.Error{Status: http.StatusForbidden}}}
+		reconciler := NewReconciler(db, repo, service, ReconcilerConfig{InitialBackoff: time.Minute, MaxBackoff: 3 * time.Minute})
+		_ = sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			_, _ = repo.CreateOrUpdate(ctx, transfer.RequestedState, "task-1", "c1", "did:web:a")
+			_, _ = repo.CreateOrUpdate(ctx, transfer.RequestedState, "task-2", "c1", "did:web:a")
+			return nil
+		})
+
+		reconciler.run(context.Background(), now)
+		reconciler.run(context.Background(), now.Add(time.Second))
+
+		assert.Equal(t, []string{"task-2", "task-2"}, service.reconciled)
+		assert.Empty(t, reconciler.backoffs)
+	})
+}
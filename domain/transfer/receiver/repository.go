@@ -4,10 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
 	sqlUtil "github.com/nuts-foundation/nuts-demo-ehr/sql"
 )
@@ -21,6 +24,7 @@ const transferSchema = `
 		    'completed',
 		    'in-progress',
 		    'on-hold',
+		    'rejected',
 		    'requested',
 			'received',
 		    'ready',
@@ -37,15 +41,83 @@ const transferSchema = `
 	);
 `
 
+// inboxFlagsSchema holds the flags of the inbox entries per user. An entry is read when it is read after its last update.
+const inboxFlagsSchema = `
+	CREATE TABLE IF NOT EXISTS incoming_transfer_flags (
+		transfer_id char(36) NOT NULL,
+		user_id VARCHAR(100) NOT NULL,
+		read_at DATETIME NULL,
+		archived BOOLEAN NOT NULL DEFAULT 0,
+		PRIMARY KEY (transfer_id, user_id),
+		FOREIGN KEY (transfer_id) REFERENCES incoming_transfers (id) ON DELETE CASCADE
+	);
+`
+
+// staleSchema holds the transfers of which the sender's Task can't be read anymore, e.g. because the sender revoked
+// access to it after the transfer ended. The reconciler doesn't read their Task until a notification is received again.
+const staleSchema = `
+	CREATE TABLE IF NOT EXISTS incoming_transfer_stale (
+		transfer_id char(36) NOT NULL,
+		reason VARCHAR(500) NOT NULL,
+		marked_at DATETIME NOT NULL,
+		PRIMARY KEY (transfer_id),
+		FOREIGN KEY (transfer_id) REFERENCES incoming_transfers (id) ON DELETE CASCADE
+	);
+`
+
+// InboxQuery filters and pages the incoming transfers of a customer, as seen by a user.
+type InboxQuery struct {
+	UserID string
+	// Statuses limits the transfers to the given states, all states are returned when empty.
+	Statuses  []string
+	SenderDID string
+	// From and To limit the date on which the transfers are received, both are inclusive.
+	From *time.Time
+	To   *time.Time
+	// Archived returns the archived transfers instead of the ones that are not archived.
+	Archived bool
+	Offset   int
+	Limit    int
+}
+
+// InboxTransfer is an incoming transfer with the flags of the user viewing the inbox.
+type InboxTransfer struct {
+	types.IncomingTransfer
+	Read     bool
+	Archived bool
+}
+
+// RequiresAttention returns true when the transfer is unread or awaits an action of the receiver.
+func (t InboxTransfer) RequiresAttention() bool {
+	status := string(t.Status.Status)
+	return !t.Read || status == transfer.RequestedState || status == transfer.InProgressState
+}
+
+// ErrTransferNotFound is returned when the customer hasn't received a transfer for the Task.
+var ErrTransferNotFound = errors.New("incoming transfer not found")
+
 type TransferRepository interface {
-	GetNotCompletedCount(ctx context.Context, customerID string) (int, error)
-	GetAll(ctx context.Context, customerID string) ([]types.IncomingTransfer, error)
+	// CountUnread returns the number of transfers the user hasn't read since they were last updated, archived transfers are not counted.
+	CountUnread(ctx context.Context, customerID, userID string) (int, error)
+	// FindInbox returns a page of the transfers matching the query, most recently updated first, and the total number of matching transfers.
+	FindInbox(ctx context.Context, customerID string, query InboxQuery) ([]InboxTransfer, int, error)
+	// UpdateFlags marks the transfer as read or unread and archives or restores it for the user. Flags which are nil are left unchanged.
+	// It returns ErrTransferNotFound if the customer hasn't received a transfer for the Task.
+	UpdateFlags(ctx context.Context, customerID, userID, taskID string, read, archived *bool) error
 	CreateOrUpdate(ctx context.Context, status, taskID string, customerID string, senderDID string) (*types.IncomingTransfer, error)
+	// ListNotFinal returns the transfers of all customers of which the Task can still change, grouped by customer ID.
+	// Stale transfers are left out.
+	ListNotFinal(ctx context.Context) (map[string][]types.IncomingTransfer, error)
+	// MarkStale marks the transfer as stale, its Task can't be read anymore. It isn't stale anymore when it's updated
+	// with CreateOrUpdate, e.g. because a notification was received. Like UpdateFlags, it returns ErrTransferNotFound for an unknown Task.
+	MarkStale(ctx context.Context, customerID, taskID, reason string) error
 }
 
 func NewTransferRepository(db *sqlx.DB) TransferRepository {
 	tx, _ := db.Beginx()
 	tx.MustExec(transferSchema)
+	tx.MustExec(inboxFlagsSchema)
+	tx.MustExec(staleSchema)
 
 	if err := tx.Commit(); err != nil {
 		panic(err)
@@ -81,48 +153,165 @@ type repository struct {
 	db *sqlx.DB
 }
 
-func (f repository) GetAll(ctx context.Context, customerID string) ([]types.IncomingTransfer, error) {
-	const query = `SELECT * FROM incoming_transfers WHERE customer_id = ? ORDER BY updated_at DESC`
+type sqlInboxTransfer struct {
+	sqlTransfer
+	Read     bool `db:"is_read"`
+	Archived bool `db:"is_archived"`
+}
+
+func (f repository) CountUnread(ctx context.Context, customerID, userID string) (int, error) {
+	const query = `SELECT COUNT(*) FROM incoming_transfers t
+		LEFT JOIN incoming_transfer_flags f ON f.transfer_id = t.id AND f.user_id = ?
+		WHERE t.customer_id = ? AND COALESCE(f.archived, 0) = 0 AND (f.read_at IS NULL OR julianday(f.read_at) < julianday(t.updated_at))`
 
 	tx, err := sqlUtil.GetTransaction(ctx)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	var transfers []sqlTransfer
+	var count int
 
-	if err := tx.SelectContext(ctx, &transfers, query, customerID); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return []types.IncomingTransfer{}, nil
+	if err := tx.GetContext(ctx, &count, query, userID, customerID); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (f repository) FindInbox(ctx context.Context, customerID string, query InboxQuery) ([]InboxTransfer, int, error) {
+	const from = ` FROM incoming_transfers t
+		LEFT JOIN incoming_transfer_flags f ON f.transfer_id = t.id AND f.user_id = ?`
+
+	conditions := []string{"t.customer_id = ?", "COALESCE(f.archived, 0) = ?"}
+	args := []interface{}{query.UserID, customerID, query.Archived}
+	if len(query.Statuses) > 0 {
+		conditions = append(conditions, "t.status IN (?"+strings.Repeat(", ?", len(query.Statuses)-1)+")")
+		for _, status := range query.Statuses {
+			args = append(args, status)
 		}
+	}
+	if query.SenderDID != "" {
+		conditions = append(conditions, "t.sender_did = ?")
+		args = append(args, query.SenderDID)
+	}
+	if query.From != nil {
+		conditions = append(conditions, "julianday(t.created_at) >= julianday(?)")
+		args = append(args, query.From.UTC())
+	}
+	if query.To != nil {
+		conditions = append(conditions, "julianday(t.created_at) < julianday(?)")
+		args = append(args, query.To.AddDate(0, 0, 1).UTC())
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
 
-		return nil, err
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := tx.GetContext(ctx, &total, "SELECT COUNT(*)"+from+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	const columns = `SELECT t.*,
+		f.read_at IS NOT NULL AND julianday(f.read_at) >= julianday(t.updated_at) AS is_read,
+		COALESCE(f.archived, 0) AS is_archived`
+	var transfers []sqlInboxTransfer
+	err = tx.SelectContext(ctx, &transfers, columns+from+where+" ORDER BY t.updated_at DESC LIMIT ? OFFSET ?", append(args, query.Limit, query.Offset)...)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	var results []types.IncomingTransfer
+	results := make([]InboxTransfer, 0, len(transfers))
 
 	for _, transfer := range transfers {
-		results = append(results, transfer.marshalToDomain())
+		results = append(results, InboxTransfer{
+			IncomingTransfer: transfer.marshalToDomain(),
+			Read:             transfer.Read,
+			Archived:         transfer.Archived,
+		})
 	}
 
-	return results, nil
+	return results, total, nil
 }
 
-func (f repository) GetNotCompletedCount(ctx context.Context, customerID string) (int, error) {
-	const query = `SELECT COUNT(*) FROM incoming_transfers WHERE customer_id = ? and status != 'completed'`
+func (f repository) UpdateFlags(ctx context.Context, customerID, userID, taskID string, read, archived *bool) error {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return err
+	}
+
+	var transferID string
+	err = tx.GetContext(ctx, &transferID, `SELECT id FROM incoming_transfers WHERE customer_id = ? AND task_id = ?`, customerID, taskID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w (task=%s)", ErrTransferNotFound, taskID)
+	} else if err != nil {
+		return err
+	}
+
+	const insertQuery = `INSERT INTO incoming_transfer_flags (transfer_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING`
+	if _, err = tx.ExecContext(ctx, insertQuery, transferID, userID); err != nil {
+		return err
+	}
+	if read != nil {
+		readAt := sql.NullTime{Time: time.Now().UTC(), Valid: *read}
+		const query = `UPDATE incoming_transfer_flags SET read_at = ? WHERE transfer_id = ? AND user_id = ?`
+		if _, err = tx.ExecContext(ctx, query, readAt, transferID, userID); err != nil {
+			return err
+		}
+	}
+	if archived != nil {
+		const query = `UPDATE incoming_transfer_flags SET archived = ? WHERE transfer_id = ? AND user_id = ?`
+		if _, err = tx.ExecContext(ctx, query, *archived, transferID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f repository) ListNotFinal(ctx context.Context) (map[string][]types.IncomingTransfer, error) {
+	const query = `SELECT * FROM incoming_transfers
+		WHERE status NOT IN ('completed', 'rejected', 'cancelled', 'failed')
+		AND id NOT IN (SELECT transfer_id FROM incoming_transfer_stale)
+		ORDER BY updated_at ASC`
 
 	tx, err := sqlUtil.GetTransaction(ctx)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	var count int
+	var transfers []sqlTransfer
 
-	if err := tx.GetContext(ctx, &count, query, customerID); err != nil {
-		return 0, err
+	if err := tx.SelectContext(ctx, &transfers, query); err != nil {
+		return nil, err
 	}
 
-	return count, nil
+	results := map[string][]types.IncomingTransfer{}
+
+	for _, transfer := range transfers {
+		results[transfer.CustomerID] = append(results[transfer.CustomerID], transfer.marshalToDomain())
+	}
+
+	return results, nil
+}
+
+func (f repository) MarkStale(ctx context.Context, customerID, taskID, reason string) error {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	const query = `INSERT INTO incoming_transfer_stale (transfer_id, reason, marked_at)
+		SELECT id, ?, ? FROM incoming_transfers WHERE customer_id = ? AND task_id = ?
+		ON CONFLICT(transfer_id) DO UPDATE SET reason = excluded.reason, marked_at = excluded.marked_at`
+	result, err := tx.ExecContext(ctx, query, reason, time.Now().UTC(), customerID, taskID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("%w (task=%s)", ErrTransferNotFound, taskID)
+	}
+	return nil
 }
 
 func (f repository) CreateOrUpdate(ctx context.Context, status, taskID string, customerID string, senderDID string) (*types.IncomingTransfer, error) {
@@ -136,20 +325,27 @@ func (f repository) CreateOrUpdate(ctx context.Context, status, taskID string, c
 		ON CONFLICT(task_id) DO
 		UPDATE SET updated_at = :updated_at, status = :status`
 
+	// times are stored in UTC, so they're in the same time zone as the times they're compared with
+	now := time.Now().UTC()
 	transfer := &sqlTransfer{
 		ID:         uuid.New().String(),
 		Status:     status,
 		TaskID:     taskID,
 		CustomerID: customerID,
 		SenderDID:  senderDID,
-		UpdatedAt:  time.Now(),
-		CreatedAt:  time.Now(),
+		UpdatedAt:  now,
+		CreatedAt:  now,
 	}
 
 	_, err = tx.NamedExecContext(ctx, query, transfer)
 	if err != nil {
 		return nil, err
 	}
+	// the Task could be read again, or the sender sent a notification about it
+	const clearStale = `DELETE FROM incoming_transfer_stale WHERE transfer_id IN (SELECT id FROM incoming_transfers WHERE task_id = ?)`
+	if _, err = tx.ExecContext(ctx, clearStale, taskID); err != nil {
+		return nil, err
+	}
 
 	incomingTransfer := transfer.marshalToDomain()
 
@@ -0,0 +1,152 @@
+package receiver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
+	"github.com/nuts-foundation/nuts-demo-ehr/sql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository_FindInbox(t *testing.T) {
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	repo := NewTransferRepository(db)
+	read := true
+	archived := true
+
+	err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+		_, _ = repo.CreateOrUpdate(ctx, transfer.RequestedState, "task-1", "c1", "did:web:a")
+		_, _ = repo.CreateOrUpdate(ctx, transfer.AcceptedState, "task-2", "c1", "did:web:b")
+		_, _ = repo.CreateOrUpdate(ctx, transfer.CompletedState, "task-3", "c1", "did:web:a")
+		_, _ = repo.CreateOrUpdate(ctx, transfer.RequestedState, "task-4", "c2", "did:web:a")
+		_ = repo.UpdateFlags(ctx, "c1", "alice", "task-2", &read, nil)
+		return repo.UpdateFlags(ctx, "c1", "alice", "task-3", nil, &archived)
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	find := func(query InboxQuery) ([]InboxTransfer, int) {
+		var transfers []InboxTransfer
+		var total int
+		err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			var err error
+			transfers, total, err = repo.FindInbox(ctx, "c1", query)
+			return err
+		})
+		assert.NoError(t, err)
+		return transfers, total
+	}
+	countUnread := func(userID string) int {
+		var count int
+		err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			var err error
+			count, err = repo.CountUnread(ctx, "c1", userID)
+			return err
+		})
+		assert.NoError(t, err)
+		return count
+	}
+
+	t.Run("archived transfers are excluded", func(t *testing.T) {
+		transfers, total := find(InboxQuery{UserID: "alice", Limit: 10})
+
+		assert.Equal(t, 2, total)
+		assert.Len(t, transfers, 2)
+	})
+	t.Run("flags are per user", func(t *testing.T) {
+		transfers, _ := find(InboxQuery{UserID: "alice", Statuses: []string{transfer.AcceptedState}, Limit: 10})
+		assert.True(t, transfers[0].Read)
+		assert.False(t, transfers[0].RequiresAttention())
+
+		transfers, total := find(InboxQuery{UserID: "bob", Limit: 10})
+		assert.Equal(t, 3, total)
+		assert.False(t, transfers[0].Read)
+
+		assert.Equal(t, 1, countUnread("alice"))
+		assert.Equal(t, 3, countUnread("bob"))
+	})
+	t.Run("filter and page", func(t *testing.T) {
+		transfers, total := find(InboxQuery{UserID: "bob", SenderDID: "did:web:a", Limit: 1, Offset: 1})
+
+		assert.Equal(t, 2, total)
+		assert.Len(t, transfers, 1)
+	})
+	t.Run("filter by date in another time zone", func(t *testing.T) {
+		// an hour before the transfers were received, but after it when compared as text
+		from := time.Now().Add(-time.Hour).In(time.FixedZone("UTC+5", 5*60*60))
+		_, total := find(InboxQuery{UserID: "bob", From: &from, Limit: 10})
+		assert.Equal(t, 3, total)
+
+		// an hour after the transfers were received, but before it when compared as text
+		from = time.Now().Add(time.Hour).In(time.FixedZone("UTC-5", -5*60*60))
+		_, total = find(InboxQuery{UserID: "bob", From: &from, Limit: 10})
+		assert.Equal(t, 0, total)
+	})
+	t.Run("an update makes the transfer unread", func(t *testing.T) {
+		_ = sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			_, err := repo.CreateOrUpdate(ctx, transfer.InProgressState, "task-2", "c1", "did:web:b")
+			return err
+		})
+
+		assert.Equal(t, 2, countUnread("alice"))
+	})
+	t.Run("unknown task", func(t *testing.T) {
+		err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			return repo.UpdateFlags(ctx, "c2", "alice", "task-1", &read, nil)
+		})
+
+		assert.ErrorIs(t, err, ErrTransferNotFound)
+		assert.EqualError(t, err, "incoming transfer not found (task=task-1)")
+	})
+}
+
+func TestRepository_MarkStale(t *testing.T) {
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	repo := NewTransferRepository(db)
+	listNotFinal := func() []string {
+		var taskIDs []string
+		_ = sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			transfers, err := repo.ListNotFinal(ctx)
+			assert.NoError(t, err)
+			for _, incomingTransfer := range transfers["c1"] {
+				taskIDs = append(taskIDs, incomingTransfer.FhirTaskID)
+			}
+			return nil
+		})
+		return taskIDs
+	}
+	err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+		_, _ = repo.CreateOrUpdate(ctx, transfer.RequestedState, "task-1", "c1", "did:web:a")
+		_, _ = repo.CreateOrUpdate(ctx, transfer.RequestedState, "task-2", "c1", "did:web:a")
+		return repo.MarkStale(ctx, "c1", "task-1", "http-status=403")
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	t.Run("stale transfers aren't listed", func(t *testing.T) {
+		assert.Equal(t, []string{"task-2"}, listNotFinal())
+	})
+	t.Run("unknown transfer", func(t *testing.T) {
+		err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			return repo.MarkStale(ctx, "c2", "task-1", "http-status=404")
+		})
+
+		assert.ErrorIs(t, err, ErrTransferNotFound)
+		assert.EqualError(t, err, "incoming transfer not found (task=task-1)")
+	})
+	t.Run("update ends staleness", func(t *testing.T) {
+		err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			_, err := repo.CreateOrUpdate(ctx, transfer.InProgressState, "task-1", "c1", "did:web:a")
+			return err
+		})
+
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"task-1", "task-2"}, listNotFinal())
+	})
+}
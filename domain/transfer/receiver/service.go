@@ -2,21 +2,38 @@ package receiver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/customers"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/dossier"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir/eoverdracht"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/patients"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/history"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
 	"github.com/nuts-foundation/nuts-demo-ehr/nuts/client"
 	"github.com/nuts-foundation/nuts-demo-ehr/nuts/registry"
+	openapiTypes "github.com/oapi-codegen/runtime/types"
+	"github.com/sirupsen/logrus"
+	"time"
 )
 
 type TransferService interface {
 	// CreateOrUpdate creates or updates an incoming transfer record in the local storage
 	CreateOrUpdate(ctx context.Context, status, customerID, senderDID, fhirTaskID string) error
-	UpdateTransferRequestState(ctx context.Context, customerID, requesterDID, fhirTaskID, newState string) error
+	// UpdateTransferRequestState updates the state of the sender's Task. When the newState is on-hold,
+	// the alternativeDate is proposed as new transfer date.
+	UpdateTransferRequestState(ctx context.Context, customerID, requesterDID, fhirTaskID, newState string, alternativeDate *time.Time) error
 	GetTransferRequest(ctx context.Context, customerID, requesterDID, fhirTaskID, token string) (*types.TransferRequest, error)
+	// GetTransferRequestHistory returns the events of the incoming transfer request, oldest first.
+	GetTransferRequestHistory(ctx context.Context, customerID, requesterDID, fhirTaskID string) ([]types.TransferEvent, error)
+	// ReconcileTransferRequest reads the sender's Task and updates the local status of the incoming transfer when it differs.
+	// It is used to recover from notifications that never arrived.
+	ReconcileTransferRequest(ctx context.Context, customerID, senderDID, fhirTaskID, localStatus string) error
+	// ImportTransferRequest imports the nursing handoff into the local record: the patient is matched by BSN or created,
+	// a dossier is created and the problems and interventions are copied into the local FHIR store.
+	ImportTransferRequest(ctx context.Context, customerID, requesterDID, fhirTaskID, accessToken string) (*types.Dossier, error)
 }
 
 type service struct {
@@ -25,26 +42,35 @@ type service struct {
 	nutsClient             *client.HTTPClient
 	localFHIRClientFactory fhir.Factory // client for interacting with the local FHIR server
 	customerRepo           customers.Repository
+	patientRepo            patients.Repository
+	dossierRepo            dossier.Repository
 	registry               registry.OrganizationRegistry
+	history                history.Repository
 }
 
-func NewTransferService(nutsClient *client.HTTPClient, localFHIRClientFactory fhir.Factory, transferRepository TransferRepository, customerRepository customers.Repository, organizationRegistry registry.OrganizationRegistry, notifier transfer.Notifier) TransferService {
+func NewTransferService(nutsClient *client.HTTPClient, localFHIRClientFactory fhir.Factory, transferRepository TransferRepository, customerRepository customers.Repository, patientRepository patients.Repository, dossierRepository dossier.Repository, organizationRegistry registry.OrganizationRegistry, notifier transfer.Notifier, transferHistory history.Repository) TransferService {
 	return &service{
 		nutsClient:             nutsClient,
 		localFHIRClientFactory: localFHIRClientFactory,
 		transferRepo:           transferRepository,
 		customerRepo:           customerRepository,
+		patientRepo:            patientRepository,
+		dossierRepo:            dossierRepository,
 		registry:               organizationRegistry,
 		notifier:               notifier,
+		history:                transferHistory,
 	}
 }
 
 func (s service) CreateOrUpdate(ctx context.Context, status, customerID, senderDID, fhirTaskID string) error {
-	_, err := s.transferRepo.CreateOrUpdate(ctx, status, fhirTaskID, customerID, senderDID)
-	return err
+	if _, err := s.transferRepo.CreateOrUpdate(ctx, status, fhirTaskID, customerID, senderDID); err != nil {
+		return err
+	}
+	// CreateOrUpdate is called when the sender notifies about an updated Task
+	return s.recordEvent(ctx, customerID, senderDID, fhirTaskID, types.NotificationReceived, status, "")
 }
 
-func (s service) UpdateTransferRequestState(ctx context.Context, customerID, requesterDID, fhirTaskID string, newState string) error {
+func (s service) UpdateTransferRequestState(ctx context.Context, customerID, requesterDID, fhirTaskID string, newState string, alternativeDate *time.Time) error {
 	customer, err := s.customerRepo.FindByID(customerID)
 	if err != nil {
 		return err
@@ -63,8 +89,17 @@ func (s service) UpdateTransferRequestState(ctx context.Context, customerID, req
 
 	// state machine
 	if (task.Status == transfer.InProgressState && newState == transfer.CompletedState) ||
-		(task.Status == transfer.RequestedState && newState == transfer.AcceptedState) {
-		err = fhirService.UpdateTaskStatus(ctx, fhirTaskID, newState)
+		(task.Status == transfer.RequestedState && newState == transfer.AcceptedState) ||
+		(task.Status == transfer.RequestedState && newState == transfer.RejectedState) ||
+		(task.Status == transfer.RequestedState && newState == transfer.OnHoldState) {
+		if newState == transfer.OnHoldState {
+			if alternativeDate == nil {
+				return errors.New("an alternative date is required when putting the transfer request on-hold")
+			}
+			err = fhirService.ProposeAlternativeDate(ctx, fhirTaskID, *alternativeDate)
+		} else {
+			err = fhirService.UpdateTaskStatus(ctx, fhirTaskID, newState)
+		}
 		if err != nil {
 			return err
 		}
@@ -77,7 +112,11 @@ func (s service) UpdateTransferRequestState(ctx context.Context, customerID, req
 		if err != nil {
 			return fmt.Errorf("could update incomming transfers with new state")
 		}
-		return nil
+		details := ""
+		if newState == transfer.OnHoldState {
+			details = fmt.Sprintf("alternative date %s proposed", alternativeDate.Format(openapiTypes.DateFormat))
+		}
+		return s.recordEvent(ctx, customerID, requesterDID, fhirTaskID, types.StateChanged, task.Status, details)
 	}
 
 	return fmt.Errorf("invalid state change from %s to %s", task.Status, newState)
@@ -111,8 +150,11 @@ func (s service) GetTransferRequest(ctx context.Context, customerID, requesterDI
 		Sender: types.FromNutsOrganization(*organization),
 		Status: task.Status,
 	}
+	if task.AlternativeDate != nil {
+		transferRequest.AlternativeDate = &openapiTypes.Date{Time: *task.AlternativeDate}
+	}
 
-	if task.Status == transfer.CompletedState || task.Status == transfer.CancelledState {
+	if task.Status == transfer.CompletedState || task.Status == transfer.CancelledState || task.Status == transfer.RejectedState {
 		return &transferRequest, nil
 	}
 
@@ -155,6 +197,139 @@ func (s service) GetTransferRequest(ctx context.Context, customerID, requesterDI
 	return &transferRequest, nil
 }
 
+func (s service) GetTransferRequestHistory(ctx context.Context, customerID, requesterDID, fhirTaskID string) ([]types.TransferEvent, error) {
+	events, err := s.history.FindByTask(ctx, customerID, history.ReceiverRole, fhirTaskID)
+	if err != nil {
+		return nil, err
+	}
+	// Task IDs are chosen by the sender, only return the events of the requester
+	result := make([]types.TransferEvent, 0, len(events))
+	for _, event := range events {
+		if event.OrganizationID != nil && *event.OrganizationID == requesterDID {
+			result = append(result, event)
+		}
+	}
+	return result, nil
+}
+
+func (s service) ReconcileTransferRequest(ctx context.Context, customerID, senderDID, fhirTaskID, localStatus string) error {
+	customer, err := s.customerRepo.FindByID(customerID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		return fmt.Errorf("customer not found (id=%s)", customerID)
+	}
+
+	fhirClient, err := s.getServiceFHIRClient(ctx, senderDID, customer.Id)
+	if err != nil {
+		return err
+	}
+	task, err := eoverdracht.NewFHIRTransferService(fhirClient).GetTask(ctx, fhirTaskID)
+	if fhir.IsNotFound(err) || errors.Is(err, fhir.ErrUnauthorized) {
+		// The sender revokes access to the Task when it ends the transfer (or deletes it), reading it again won't succeed.
+		logrus.Infof("Task of incoming eOverdracht transfer can't be read anymore, it won't be reconciled (task=%s, sender=%s): %s", fhirTaskID, senderDID, err)
+		return s.transferRepo.MarkStale(ctx, customerID, fhirTaskID, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	if task.Status == localStatus {
+		return nil
+	}
+
+	if _, err = s.transferRepo.CreateOrUpdate(ctx, task.Status, fhirTaskID, customerID, senderDID); err != nil {
+		return err
+	}
+	return s.recordEvent(ctx, customerID, senderDID, fhirTaskID, types.StateChanged, task.Status, "status synchronized with the sender's Task, a notification was missed")
+}
+
+func (s service) ImportTransferRequest(ctx context.Context, customerID, requesterDID, fhirTaskID, accessToken string) (*types.Dossier, error) {
+	events, err := s.GetTransferRequestHistory(ctx, customerID, requesterDID, fhirTaskID)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		if event.Type == types.HandoffImported {
+			return nil, errors.New("the nursing handoff has already been imported")
+		}
+	}
+
+	transferRequest, err := s.GetTransferRequest(ctx, customerID, requesterDID, fhirTaskID, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if transferRequest.NursingHandoff == nil {
+		return nil, errors.New("the nursing handoff can only be imported while the transfer is in progress")
+	}
+	nursingHandoff := *transferRequest.NursingHandoff
+
+	patient, err := s.findOrCreatePatient(ctx, customerID, nursingHandoff.Patient)
+	if err != nil {
+		return nil, fmt.Errorf("unable to import patient: %w", err)
+	}
+	patientDossier, err := s.dossierRepo.Create(ctx, customerID, "Transfer from "+transferRequest.Sender.Name, patient.ObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The copied resources refer to the Task at the sender's FHIR server, through which the nursing handoff was received
+	fhirServer, err := s.registry.GetCompoundServiceEndpoint(ctx, requesterDID, transfer.ServiceName, "fhir")
+	if err != nil {
+		return nil, fmt.Errorf("error while looking up sender's FHIR server (did=%s): %w", requesterDID, err)
+	}
+	sourceURL := fhir.NewFactory(fhir.WithURL(fhirServer))().BuildRequestURI("Task/" + fhirTaskID).String()
+
+	carePlanImport := eoverdracht.NewFHIRBuilder().BuildCarePlanImport(patient.ObjectID, nursingHandoff, transferRequest.Sender, sourceURL)
+	fhirService := eoverdracht.NewFHIRTransferService(s.localFHIRClientFactory(fhir.WithTenant(customerID)))
+	if err = fhirService.ImportCarePlan(ctx, carePlanImport); err != nil {
+		return nil, err
+	}
+
+	details := fmt.Sprintf("imported into dossier %s of patient %s", patientDossier.Id, patient.ObjectID)
+	if err = s.recordEvent(ctx, customerID, requesterDID, fhirTaskID, types.HandoffImported, transferRequest.Status, details); err != nil {
+		return nil, err
+	}
+	return patientDossier, nil
+}
+
+// findOrCreatePatient returns the local patient with the BSN of the transferred patient. When there is none, the
+// patient is created from the transferred patient.
+func (s service) findOrCreatePatient(ctx context.Context, customerID string, transferredPatient types.Patient) (*types.Patient, error) {
+	if transferredPatient.Ssn != nil && *transferredPatient.Ssn != "" {
+		patient, err := s.patientRepo.FindBySSN(ctx, customerID, *transferredPatient.Ssn)
+		if err != nil {
+			return nil, err
+		}
+		if patient != nil {
+			return patient, nil
+		}
+	}
+	return s.patientRepo.NewPatient(ctx, customerID, types.PatientProperties{
+		FirstName: transferredPatient.FirstName,
+		Surname:   transferredPatient.Surname,
+		Ssn:       transferredPatient.Ssn,
+		Dob:       transferredPatient.Dob,
+		Zipcode:   transferredPatient.Zipcode,
+		Gender:    transferredPatient.Gender,
+		Email:     transferredPatient.Email,
+	})
+}
+
+// recordEvent adds an event to the history of the incoming transfer request.
+func (s service) recordEvent(ctx context.Context, customerID, senderDID, fhirTaskID string, eventType types.TransferEventType, status, details string) error {
+	return s.history.Add(ctx, history.Event{
+		CustomerID:     customerID,
+		Role:           history.ReceiverRole,
+		TaskID:         fhirTaskID,
+		Type:           eventType,
+		Status:         status,
+		OrganizationID: senderDID,
+		Actor:          history.ActorFromContext(ctx),
+		Details:        details,
+	})
+}
+
 func (s service) getServiceFHIRClient(ctx context.Context, authorizerID string, localRequesterSubjectID string) (fhir.Client, error) {
 	fhirServer, err := s.registry.GetCompoundServiceEndpoint(ctx, authorizerID, transfer.ServiceName, "fhir")
 	if err != nil {
@@ -0,0 +1,135 @@
+package receiver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/dossier"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir/embedded"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir/eoverdracht"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/patients"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/history"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	"github.com/nuts-foundation/nuts-demo-ehr/nuts"
+	"github.com/nuts-foundation/nuts-demo-ehr/nuts/client"
+	"github.com/nuts-foundation/nuts-demo-ehr/sql"
+	openapiTypes "github.com/oapi-codegen/runtime/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCustomers struct{}
+
+func (fakeCustomers) FindByID(id string) (*types.Customer, error) {
+	return &types.Customer{Id: id}, nil
+}
+
+func (fakeCustomers) All() ([]types.Customer, error) {
+	return nil, nil
+}
+
+// fakeRegistry registers the sender's FHIR server.
+type fakeRegistry struct {
+	fhirServer string
+}
+
+func (f fakeRegistry) Get(_ context.Context, organizationID string) (*nuts.NutsOrganization, error) {
+	return &nuts.NutsOrganization{ID: organizationID, Details: nuts.OrganizationDetails{Name: "Sender"}}, nil
+}
+
+func (f fakeRegistry) GetCompoundServiceEndpoint(_ context.Context, _, _ string, field string) (string, error) {
+	if field == "fhir" {
+		return f.fhirServer, nil
+	}
+	return "https://sender.example.com/oauth2", nil
+}
+
+func TestService_ImportTransferRequest(t *testing.T) {
+	const senderDID = "did:web:sender"
+	senderServer := httptest.NewServer(embedded.NewServer())
+	t.Cleanup(senderServer.Close)
+	localServer := httptest.NewServer(embedded.NewServer())
+	t.Cleanup(localServer.Close)
+	nutsNode := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(`{"access_token":"token","token_type":"Bearer"}`))
+	}))
+	t.Cleanup(nutsNode.Close)
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	db.SetMaxOpenConns(1)
+	localFHIR := fhir.NewFactory(fhir.WithURL(localServer.URL))
+	patientRepository := patients.NewFHIRPatientRepository(patients.Factory{}, localFHIR)
+	service := NewTransferService(&client.HTTPClient{NutsNodeAddress: nutsNode.URL}, localFHIR, NewTransferRepository(db), fakeCustomers{},
+		patientRepository, dossier.NewSQLiteDossierRepository(dossier.Factory{}, db), fakeRegistry{fhirServer: senderServer.URL}, nil, history.NewRepository(db))
+
+	// the sender shares the nursing handoff of its patient through the Task
+	ctx := context.Background()
+	senderFHIR := fhir.NewFactory(fhir.WithURL(senderServer.URL))
+	ssn := "999911120"
+	dob := openapiTypes.Date{Time: time.Date(1975, 1, 1, 0, 0, 0, 0, time.UTC)}
+	patient, err := patients.NewFHIRPatientRepository(patients.Factory{}, senderFHIR).NewPatient(ctx, "sender", types.PatientProperties{Ssn: &ssn, Dob: &dob, FirstName: "Anna", Surname: "Bouwman", Gender: types.Female})
+	require.NoError(t, err)
+	builder := eoverdracht.NewFHIRBuilder()
+	advanceNotice := builder.BuildAdvanceNotice(types.CreateTransferRequest{
+		CarePlan: types.EOverdrachtCarePlan{PatientProblems: []types.PatientProblem{{
+			Problem:       types.Problem{Name: "Diabetes"},
+			Interventions: []types.Intervention{{Comment: "Check glucose"}},
+		}}},
+	}, patient)
+	treatment := "Daily dressing"
+	nursingHandoff, err := builder.BuildNursingHandoff(patient, advanceNotice, types.NursingHandoffContent{
+		WoundCare: &[]types.WoundCare{{Location: "Left heel", Treatment: &treatment}},
+	})
+	require.NoError(t, err)
+	senderService := eoverdracht.NewFHIRTransferService(senderFHIR())
+	require.NoError(t, senderService.CreateAdvanceNotice(ctx, advanceNotice))
+	require.NoError(t, senderService.CreateNursingHandoff(ctx, nursingHandoff))
+	advanceNoticeID, nursingHandoffID := fhir.FromIDPtr(advanceNotice.Composition.ID), fhir.FromIDPtr(nursingHandoff.Composition.ID)
+	task, err := senderService.CreateTask(ctx, eoverdracht.TransferTask{
+		Status:           transfer.InProgressState,
+		SenderID:         senderDID,
+		ReceiverID:       "did:web:receiver",
+		AdvanceNoticeID:  &advanceNoticeID,
+		NursingHandoffID: &nursingHandoffID,
+	})
+	require.NoError(t, err)
+	importTransferRequest := func() (*types.Dossier, error) {
+		var result *types.Dossier
+		err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+			var err error
+			result, err = service.ImportTransferRequest(ctx, "c1", senderDID, task.ID, "token")
+			return err
+		})
+		return result, err
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		imported, err := importTransferRequest()
+
+		require.NoError(t, err)
+		assert.Equal(t, "Transfer from Sender", imported.Name)
+		localPatient, err := patientRepository.FindBySSN(ctx, "c1", ssn)
+		require.NoError(t, err)
+		require.NotNil(t, localPatient)
+		assert.Equal(t, localPatient.ObjectID, string(imported.PatientID))
+		localClient := localFHIR(fhir.WithTenant("c1"))
+		var provenances []fhir.Provenance
+		require.NoError(t, localClient.ReadMultiple(ctx, "Provenance", nil, &provenances))
+		require.Len(t, provenances, 1)
+		// the problem, the intervention, the wound and its treatment
+		assert.Len(t, provenances[0].Target, 4)
+		assert.Equal(t, senderServer.URL+"/Task/"+task.ID, fhir.FromStringPtr(provenances[0].Entity[0].WhatReference.Reference))
+	})
+	t.Run("already imported", func(t *testing.T) {
+		_, err := importTransferRequest()
+
+		assert.EqualError(t, err, "the nursing handoff has already been imported")
+	})
+}
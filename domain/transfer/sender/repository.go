@@ -31,7 +31,7 @@ type TransferRepository interface {
 
 	// ProposeAlternateDate updates the date on the domain.TransferNegotiation indicated by the negotiationID.
 	// It updates the status to ON_HOLD_STATE
-	ProposeAlternateDate(ctx context.Context, customerID, negotiationID string) (*types.TransferNegotiation, error)
+	ProposeAlternateDate(ctx context.Context, customerID, negotiationID string, date time.Time) (*types.TransferNegotiation, error)
 
 	// ConfirmNegotiation confirms the negotiation indicated by the negotiationID.
 	// The updates the status to ACCEPTED_STATE.
@@ -46,4 +46,14 @@ type TransferRepository interface {
 
 	// ListNegotiations returns a list of negotiations for the indicated transfer
 	ListNegotiations(ctx context.Context, customerID, transferID string) ([]types.TransferNegotiation, error)
+
+	// ListNegotiationsByState returns the negotiations of all customers in the given state with a transfer date before the given time.
+	// The negotiations are grouped by customer ID.
+	ListNegotiationsByState(ctx context.Context, state types.FHIRTaskStatus, before time.Time) (map[string][]types.TransferNegotiation, error)
+
+	// SaveHandoffContent stores the clinical content of the nursing handoff of the indicated transfer, replacing earlier content.
+	SaveHandoffContent(ctx context.Context, customerID, transferID string, content types.NursingHandoffContent) error
+
+	// FindHandoffContent returns the clinical content of the nursing handoff of the indicated transfer, or nil if there is none.
+	FindHandoffContent(ctx context.Context, customerID, transferID string) (*types.NursingHandoffContent, error)
 }
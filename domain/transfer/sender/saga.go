@@ -0,0 +1,63 @@
+package sender
+
+import (
+	"context"
+	"time"
+
+	sqlUtil "github.com/nuts-foundation/nuts-demo-ehr/sql"
+	"github.com/sirupsen/logrus"
+)
+
+const compensationTimeout = 10 * time.Second
+
+// saga keeps track of the steps of an operation on the local FHIR server and the PIP, which are not rolled back
+// together with the database transaction. Every step that succeeded registers a compensating action, which runs when
+// a later step fails, or when the transaction the operation is part of is rolled back or fails to commit.
+// Revoking PIP data is compensated by granting the same access again, since the negotiation it belongs to continues.
+type saga struct {
+	compensations []compensation
+}
+
+type compensation struct {
+	description string
+	undo        func(ctx context.Context) error
+}
+
+// compensate registers the action which undoes a step that succeeded.
+func (s *saga) compensate(description string, undo func(ctx context.Context) error) {
+	s.compensations = append(s.compensations, compensation{description: description, undo: undo})
+}
+
+// end finishes the operation with its result. When the operation failed, all compensating actions are executed
+// directly. Otherwise, they are executed when the transaction in the context doesn't get committed.
+func (s *saga) end(ctx context.Context, err error) error {
+	if err != nil {
+		s.rollback()
+		return err
+	}
+	if len(s.compensations) == 0 {
+		return nil
+	}
+	tm, err := sqlUtil.GetTransactionManager(ctx)
+	if err != nil {
+		s.rollback()
+		return err
+	}
+	tm.OnRollback(s.rollback)
+	return nil
+}
+
+// rollback executes the compensating actions in the reverse order of the steps. A failing action is logged, since the
+// other actions must still be executed.
+func (s *saga) rollback() {
+	// the context of the operation might already be cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), compensationTimeout)
+	defer cancel()
+	for i := len(s.compensations) - 1; i >= 0; i-- {
+		action := s.compensations[i]
+		if err := action.undo(ctx); err != nil {
+			logrus.Errorf("Unable to compensate eOverdracht step (%s): %s", action.description, err)
+		}
+	}
+	s.compensations = nil
+}
@@ -0,0 +1,106 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	sqlUtil "github.com/nuts-foundation/nuts-demo-ehr/sql"
+	"github.com/sirupsen/logrus"
+)
+
+type SchedulerConfig struct {
+	// Interval at which the scheduler looks for negotiations to complete or cancel. The scheduler is disabled when it is 0.
+	Interval time.Duration
+	// CompleteAfter is the period after the transfer date after which in-progress negotiations are completed.
+	// Automatic completion is disabled when it is 0.
+	CompleteAfter time.Duration
+	// AnswerBefore is the period before the transfer date in which the receiver must answer a requested negotiation,
+	// otherwise the negotiation is cancelled. When it is 0, the negotiation is cancelled when the transfer date has passed.
+	// The same applies to the sender accepting the alternative date of an on-hold negotiation.
+	AnswerBefore time.Duration
+}
+
+// Scheduler completes and cancels negotiations in the background based on their transfer date.
+type Scheduler struct {
+	db         *sqlx.DB
+	repository TransferRepository
+	service    TransferService
+	config     SchedulerConfig
+}
+
+func NewScheduler(db *sqlx.DB, transferRepository TransferRepository, transferService TransferService, config SchedulerConfig) *Scheduler {
+	return &Scheduler{
+		db:         db,
+		repository: transferRepository,
+		service:    transferService,
+		config:     config,
+	}
+}
+
+// Start runs the scheduler until the context is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	if s.config.Interval == 0 {
+		logrus.Info("Scheduler for eOverdracht negotiations is disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.run(ctx, time.Now())
+			}
+		}
+	}()
+}
+
+func (s *Scheduler) run(ctx context.Context, now time.Time) {
+	if s.config.CompleteAfter > 0 {
+		reason := fmt.Sprintf("transfer completed automatically %s after the transfer date", s.config.CompleteAfter)
+		s.process(ctx, transfer.InProgressState, now.Add(-s.config.CompleteAfter), func(txCtx context.Context, customerID, negotiationID string) error {
+			return s.service.AutoCompleteNegotiation(txCtx, customerID, negotiationID, reason)
+		})
+	}
+	reason := "negotiation cancelled since it was not answered in time"
+	s.process(ctx, transfer.RequestedState, now.Add(s.config.AnswerBefore), func(txCtx context.Context, customerID, negotiationID string) error {
+		return s.service.ExpireNegotiation(txCtx, customerID, negotiationID, reason)
+	})
+	// an on-hold negotiation waits for the sender to accept the alternative date, which can't be met anymore either
+	reason = "negotiation cancelled since the alternative date was not accepted in time"
+	s.process(ctx, transfer.OnHoldState, now.Add(s.config.AnswerBefore), func(txCtx context.Context, customerID, negotiationID string) error {
+		return s.service.ExpireNegotiation(txCtx, customerID, negotiationID, reason)
+	})
+}
+
+// process applies the action to every negotiation in the given state with a transfer date before the deadline.
+// Every action is executed in its own transaction, so a failing negotiation doesn't block the others.
+func (s *Scheduler) process(ctx context.Context, state types.FHIRTaskStatus, deadline time.Time, action func(txCtx context.Context, customerID, negotiationID string) error) {
+	var negotiations map[string][]types.TransferNegotiation
+	err := sqlUtil.ExecuteTransactional(s.db, func(txCtx context.Context) error {
+		var err error
+		negotiations, err = s.repository.ListNegotiationsByState(txCtx, state, deadline)
+		return err
+	})
+	if err != nil {
+		logrus.Errorf("Unable to find %s eOverdracht negotiations: %s", state, err)
+		return
+	}
+
+	for customerID, customerNegotiations := range negotiations {
+		for _, negotiation := range customerNegotiations {
+			err := sqlUtil.ExecuteTransactional(s.db, func(txCtx context.Context) error {
+				return action(txCtx, customerID, string(negotiation.Id))
+			})
+			if err != nil {
+				logrus.Errorf("Unable to process %s eOverdracht negotiation (id=%s, customer=%s): %s", state, negotiation.Id, customerID, err)
+			}
+		}
+	}
+}
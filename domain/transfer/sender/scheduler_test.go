@@ -0,0 +1,73 @@
+package sender
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	"github.com/nuts-foundation/nuts-demo-ehr/sql"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingService records the negotiations the scheduler acts upon.
+type recordingService struct {
+	TransferService
+	completed []string
+	expired   []string
+}
+
+func (r *recordingService) AutoCompleteNegotiation(_ context.Context, customerID, negotiationID, _ string) error {
+	r.completed = append(r.completed, customerID+"/"+negotiationID)
+	return nil
+}
+
+func (r *recordingService) ExpireNegotiation(_ context.Context, customerID, negotiationID, _ string) error {
+	r.expired = append(r.expired, customerID+"/"+negotiationID)
+	return nil
+}
+
+func TestScheduler_run(t *testing.T) {
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	repo := NewTransferRepository(db)
+	service := &recordingService{}
+	scheduler := NewScheduler(db, repo, service, SchedulerConfig{CompleteAfter: 7 * 24 * time.Hour, AnswerBefore: 24 * time.Hour})
+
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	var longAgo, overdue, notYetDue, tomorrow, nextWeek, onHold, otherTimeZone string
+	err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
+		dbTransfer, err := repo.Create(ctx, "c1", "dossier", now, "composition")
+		if err != nil {
+			return err
+		}
+		create := func(date time.Time, state types.FHIRTaskStatus) string {
+			negotiation, _ := repo.CreateNegotiation(ctx, "c1", dbTransfer.Id, "did:web:receiver", date, "task")
+			_, _ = repo.UpdateNegotiationState(ctx, "c1", negotiation.Id, state)
+			return negotiation.Id
+		}
+		longAgo = create(now.AddDate(0, 0, -8), transfer.InProgressState)
+		overdue = create(now.AddDate(0, 0, -8), transfer.AcceptedState)
+		notYetDue = create(now.AddDate(0, 0, -6), transfer.InProgressState)
+		tomorrow = create(now.AddDate(0, 0, 1).Add(-time.Hour), transfer.RequestedState)
+		nextWeek = create(now.AddDate(0, 0, 7), transfer.RequestedState)
+		onHold = create(now.AddDate(0, 0, 1).Add(-time.Hour), transfer.OnHoldState)
+		// 2 hours after the deadline in UTC, but before it when compared as text
+		otherTimeZone = create(now.AddDate(0, 0, 1).Add(2*time.Hour).In(time.FixedZone("UTC-5", -5*60*60)), transfer.RequestedState)
+		return nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	scheduler.run(context.Background(), now)
+
+	assert.Equal(t, []string{"c1/" + longAgo}, service.completed)
+	assert.Equal(t, []string{"c1/" + tomorrow, "c1/" + onHold}, service.expired)
+	assert.NotContains(t, service.expired, "c1/"+otherTimeZone)
+	assert.NotContains(t, service.completed, "c1/"+overdue)
+	assert.NotContains(t, service.completed, "c1/"+notYetDue)
+	assert.NotContains(t, service.expired, "c1/"+nextWeek)
+}
@@ -2,26 +2,32 @@ package sender
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
 
-	"github.com/avast/retry-go/v4"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/customers"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/dossier"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir/eoverdracht"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/patients"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/history"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/outbox"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
 	nutsClient "github.com/nuts-foundation/nuts-demo-ehr/nuts/client"
 	"github.com/nuts-foundation/nuts-demo-ehr/nuts/registry"
 	"github.com/nuts-foundation/nuts-demo-ehr/nutspxp/client"
 	sqlUtil "github.com/nuts-foundation/nuts-demo-ehr/sql"
+	openapiTypes "github.com/oapi-codegen/runtime/types"
 	"github.com/sirupsen/logrus"
 )
 
+// ErrNegotiationNotFound is returned when the transfer has no negotiation with the given ID.
+var ErrNegotiationNotFound = errors.New("negotiation not found")
+
 type TransferService interface {
 	// AssignTransfer assigns a transfer directly to a single organization
 	AssignTransfer(ctx context.Context, customer types.Customer, transferID, organizationID string) (*types.TransferNegotiation, error)
@@ -33,6 +39,19 @@ type TransferService interface {
 
 	GetTransferByID(ctx context.Context, customerID, transferID string) (types.Transfer, error)
 
+	// UpdateTransferDate changes the date of the transfer.
+	UpdateTransferDate(ctx context.Context, customerID, transferID string, transferDate time.Time) error
+
+	// UpdateHandoffContent changes the clinical content of the nursing handoff. This is only possible as long as the
+	// nursing handoff has not been shared with the receiving organization.
+	UpdateHandoffContent(ctx context.Context, customerID, transferID string, content types.NursingHandoffContent) error
+
+	// CancelTransfer cancels the transfer and all its negotiations.
+	CancelTransfer(ctx context.Context, customerID, transferID string) (*types.Transfer, error)
+
+	// GetTransferHistory returns the events of the transfer and its negotiations, oldest first.
+	GetTransferHistory(ctx context.Context, customerID, transferID string) ([]types.TransferEvent, error)
+
 	// ConfirmNegotiation confirms the negotiation indicated by the negotiationID.
 	// The updates the status to in progress
 	// It automatically cancels other negotiations of the domain.Transfer indicated by the transferID
@@ -43,23 +62,39 @@ type TransferService interface {
 	// It updates the status to CANCELLED_STATE, updates the FHIR Task and sends out a notification
 	CancelNegotiation(ctx context.Context, customerID, transferID, negotiationID string) (*types.TransferNegotiation, error)
 
+	// AcceptAlternateDate accepts the transfer date proposed by the receiving organization.
+	// It updates the status back to requested, updates the FHIR Task and sends out a notification.
+	AcceptAlternateDate(ctx context.Context, customerID, transferID, negotiationID string) (*types.TransferNegotiation, error)
+
+	// AutoCompleteNegotiation completes an in-progress negotiation and its transfer on behalf of the receiving organization.
+	// It does nothing when the negotiation is no longer in-progress.
+	AutoCompleteNegotiation(ctx context.Context, customerID, negotiationID, reason string) error
+
+	// ExpireNegotiation cancels a requested negotiation the receiving organization did not answer in time, or an on-hold
+	// negotiation of which the alternative date wasn't accepted in time. It does nothing in other states.
+	ExpireNegotiation(ctx context.Context, customerID, negotiationID, reason string) error
+
 	// UpdateTaskState updates the Task resource. It updates the local DB, checks the statemachine, updates the FHIR record and sends a notification.
-	UpdateTaskState(ctx context.Context, customer types.Customer, taskID string, newState string) error
+	// The alternativeDate is only used when the receiver puts the Task on-hold.
+	UpdateTaskState(ctx context.Context, customer types.Customer, taskID string, newState string, alternativeDate *time.Time) error
 }
 
 type service struct {
 	transferRepo           TransferRepository
-	nutsClient             *nutsClient.HTTPClient
+	nutsClient             nutsClient.VDR
 	pipClient              nutspxp.Client
 	localFHIRClientFactory fhir.Factory // client for interacting with the local FHIR server
 	customerRepo           customers.Repository
 	dossierRepo            dossier.Repository
 	patientRepo            patients.Repository
 	registry               registry.OrganizationRegistry
-	notifier               transfer.Notifier
+	notificationOutbox     outbox.Repository
+	history                history.Repository
+	// strictValidation refuses outgoing FHIR resources which don't conform to the eOverdracht profiles
+	strictValidation bool
 }
 
-func NewTransferService(nutsClient *nutsClient.HTTPClient, pipClient nutspxp.Client, localFHIRClientFactory fhir.Factory, transferRepository TransferRepository, customerRepository customers.Repository, dossierRepo dossier.Repository, patientRepo patients.Repository, organizationRegistry registry.OrganizationRegistry, notifier transfer.Notifier) TransferService {
+func NewTransferService(nutsClient nutsClient.VDR, pipClient nutspxp.Client, localFHIRClientFactory fhir.Factory, transferRepository TransferRepository, customerRepository customers.Repository, dossierRepo dossier.Repository, patientRepo patients.Repository, organizationRegistry registry.OrganizationRegistry, notificationOutbox outbox.Repository, transferHistory history.Repository, strictValidation bool) TransferService {
 	return &service{
 		nutsClient:             nutsClient,
 		pipClient:              pipClient,
@@ -69,10 +104,16 @@ func NewTransferService(nutsClient *nutsClient.HTTPClient, pipClient nutspxp.Cli
 		dossierRepo:            dossierRepo,
 		patientRepo:            patientRepo,
 		registry:               organizationRegistry,
-		notifier:               notifier,
+		notificationOutbox:     notificationOutbox,
+		history:                transferHistory,
+		strictValidation:       strictValidation,
 	}
 }
 
+func (s service) newFHIRTransferService(fhirClient fhir.Client) eoverdracht.TransferService {
+	return eoverdracht.NewFHIRTransferService(fhirClient, eoverdracht.WithStrictValidation(s.strictValidation))
+}
+
 func (s service) CreateTransfer(ctx context.Context, customerID string, request types.CreateTransferRequest) (*types.Transfer, error) {
 	const createTransferErr = "could not create new transfer: %w"
 	// Fetch the patient
@@ -84,16 +125,120 @@ func (s service) CreateTransfer(ctx context.Context, customerID string, request
 	// Build the advance notice resources
 	advanceNotice := eoverdracht.NewFHIRBuilder().BuildAdvanceNotice(request, patient)
 	fhirClient := s.localFHIRClientFactory(fhir.WithTenant(customerID))
-	fhirService := eoverdracht.NewFHIRTransferService(fhirClient)
+	fhirService := s.newFHIRTransferService(fhirClient)
 
-	// Save the resources to the fhir storage
+	// Save the resources to the fhir storage, in strict mode they must conform to the eOverdracht profiles
 	err = fhirService.CreateAdvanceNotice(ctx, advanceNotice)
 	if err != nil {
 		return nil, fmt.Errorf(createTransferErr, fmt.Errorf("unable to store advance notification fhir resources: %w", err))
 	}
 
 	// Create the database transfer
-	return s.transferRepo.Create(ctx, customerID, string(request.DossierID), request.TransferDate.Time, fhir.FromIDPtr(advanceNotice.Composition.ID))
+	dbTransfer, err := s.transferRepo.Create(ctx, customerID, string(request.DossierID), request.TransferDate.Time, fhir.FromIDPtr(advanceNotice.Composition.ID))
+	if err != nil {
+		return nil, err
+	}
+	// The content of the nursing handoff is only shared when the transfer is assigned
+	if request.HandoffContent != nil {
+		if err = s.transferRepo.SaveHandoffContent(ctx, customerID, string(dbTransfer.Id), *request.HandoffContent); err != nil {
+			return nil, err
+		}
+		dbTransfer.HandoffContent = request.HandoffContent
+	}
+	return dbTransfer, s.recordTransferEvent(ctx, customerID, *dbTransfer, types.TransferCreated, "")
+}
+
+func (s service) UpdateTransferDate(ctx context.Context, customerID, transferID string, transferDate time.Time) error {
+	dbTransfer, err := s.transferRepo.Update(ctx, customerID, transferID, func(dbTransfer *types.Transfer) (*types.Transfer, error) {
+		dbTransfer.TransferDate = openapiTypes.Date{Time: transferDate}
+		return dbTransfer, nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.recordTransferEvent(ctx, customerID, *dbTransfer, types.TransferUpdated, fmt.Sprintf("transfer date changed to %s", transferDate.Format(openapiTypes.DateFormat)))
+}
+
+func (s service) UpdateHandoffContent(ctx context.Context, customerID, transferID string, content types.NursingHandoffContent) error {
+	dbTransfer, err := s.transferRepo.FindByID(ctx, customerID, transferID)
+	if err != nil {
+		return err
+	}
+	if dbTransfer == nil {
+		return fmt.Errorf("transfer not found (id=%s)", transferID)
+	}
+	if dbTransfer.FhirNursingHandoffComposition != nil {
+		return errors.New("can't change the nursing handoff content after it has been shared")
+	}
+	if err = s.transferRepo.SaveHandoffContent(ctx, customerID, transferID, content); err != nil {
+		return err
+	}
+	return s.recordTransferEvent(ctx, customerID, *dbTransfer, types.TransferUpdated, "nursing handoff content changed")
+}
+
+// CancelTransfer cancels the transfer and its negotiations. The FHIR resources of the transfer are cleaned up after the
+// transaction has been committed, since removing them can't be undone.
+func (s service) CancelTransfer(ctx context.Context, customerID, transferID string) (*types.Transfer, error) {
+	tm, err := sqlUtil.GetTransactionManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+	negotiations, err := s.transferRepo.ListNegotiations(ctx, customerID, transferID)
+	if err != nil {
+		return nil, err
+	}
+	dbTransfer, err := s.transferRepo.Cancel(ctx, customerID, transferID)
+	if err != nil || dbTransfer == nil {
+		return nil, err
+	}
+
+	// update the Tasks, revoke the credentials and notify the receivers
+	compensations := &saga{}
+	for _, negotiation := range negotiations {
+		if closed(negotiation) {
+			continue
+		}
+		if _, err = s.cancelNegotiation(ctx, compensations, customerID, string(negotiation.Id), dbTransfer.FhirAdvanceNoticeComposition, "transfer cancelled"); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = s.recordTransferEvent(ctx, customerID, *dbTransfer, types.TransferCancelled, "")
+	}
+	if err = compensations.end(ctx, err); err != nil {
+		return nil, err
+	}
+
+	// the resources of the advance notice (e.g. its anonymous patient) and nursing handoff aren't needed anymore
+	fhirService := s.newFHIRTransferService(s.localFHIRClientFactory(fhir.WithTenant(customerID)))
+	tm.OnCommit(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), compensationTimeout)
+		defer cancel()
+		if err := fhirService.CleanupTransfer(ctx, dbTransfer.FhirAdvanceNoticeComposition, dbTransfer.FhirNursingHandoffComposition); err != nil {
+			logrus.Errorf("Unable to clean up FHIR resources of cancelled transfer (id=%s): %s", dbTransfer.Id, err)
+		}
+	})
+	return dbTransfer, nil
+}
+
+// closed returns whether the negotiation has already ended, so there's nothing left to cancel.
+func closed(negotiation types.TransferNegotiation) bool {
+	return negotiation.Status == transfer.RejectedState ||
+		negotiation.Status == transfer.CancelledState ||
+		negotiation.Status == transfer.CompletedState
+}
+
+func (s service) GetTransferHistory(ctx context.Context, customerID, transferID string) ([]types.TransferEvent, error) {
+	negotiations, err := s.transferRepo.ListNegotiations(ctx, customerID, transferID)
+	if err != nil {
+		return nil, err
+	}
+	// events of the notifications are only related to the Task
+	taskIDs := make([]string, len(negotiations))
+	for i, negotiation := range negotiations {
+		taskIDs[i] = negotiation.TaskID
+	}
+	return s.history.FindByTransfer(ctx, customerID, transferID, taskIDs)
 }
 
 func (s service) GetTransferByID(ctx context.Context, customerID, transferID string) (types.Transfer, error) {
@@ -107,8 +252,24 @@ func (s service) GetTransferByID(ctx context.Context, customerID, transferID str
 		return types.Transfer{}, err
 	}
 	fhirClient := s.localFHIRClientFactory(fhir.WithTenant(customerID))
-	fhirService := eoverdracht.NewFHIRTransferService(fhirClient)
+	fhirService := s.newFHIRTransferService(fhirClient)
 
+	if dbTransfer.Status == types.Cancelled {
+		exists, err := s.advanceNoticeExists(ctx, fhirClient, dbTransfer.FhirAdvanceNoticeComposition)
+		if err != nil {
+			return types.Transfer{}, err
+		}
+		if !exists {
+			// the resources of the transfer have been removed when it was cancelled
+			return types.Transfer{
+				DossierID:                    dbTransfer.DossierID,
+				FhirAdvanceNoticeComposition: dbTransfer.FhirAdvanceNoticeComposition,
+				Id:                           dbTransfer.Id,
+				Status:                       dbTransfer.Status,
+				TransferDate:                 dbTransfer.TransferDate,
+			}, nil
+		}
+	}
 	advanceNotice, err := fhirService.GetAdvanceNotice(ctx, dbTransfer.FhirAdvanceNoticeComposition)
 	if err != nil {
 		return types.Transfer{}, err
@@ -119,7 +280,13 @@ func (s service) GetTransferByID(ctx context.Context, customerID, transferID str
 		return types.Transfer{}, err
 	}
 
+	handoffContent, err := s.transferRepo.FindHandoffContent(ctx, customerID, transferID)
+	if err != nil {
+		return types.Transfer{}, err
+	}
+
 	return types.Transfer{
+		HandoffContent:                handoffContent,
 		CarePlan:                      domainTransfer.CarePlan,
 		TransferDate:                  domainTransfer.TransferDate,
 		Patient:                       domainTransfer.Patient,
@@ -131,6 +298,15 @@ func (s service) GetTransferByID(ctx context.Context, customerID, transferID str
 	}, nil
 }
 
+// advanceNoticeExists returns whether the advance notice composition still exists, it's removed when a transfer is cancelled.
+func (s service) advanceNoticeExists(ctx context.Context, fhirClient fhir.Client, compositionID string) (bool, error) {
+	err := fhirClient.ReadOne(ctx, "Composition/"+compositionID, &fhir.Composition{})
+	if fhir.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
 // CreateNegotiation creates a new negotiation(FHIR Task) for a specific transfer and sends the other party a notification.
 func (s service) CreateNegotiation(ctx context.Context, customerID, transferID, organizationID string) (*types.TransferNegotiation, error) {
 	customer, err := s.customerRepo.FindByID(customerID)
@@ -139,9 +315,10 @@ func (s service) CreateNegotiation(ctx context.Context, customerID, transferID,
 	}
 
 	var negotiation *types.TransferNegotiation
+	compensations := &saga{}
 
 	fhirClient := s.localFHIRClientFactory(fhir.WithTenant(customerID))
-	fhirTransferService := eoverdracht.NewFHIRTransferService(fhirClient)
+	fhirTransferService := s.newFHIRTransferService(fhirClient)
 
 	// Update the transfer
 	_, err = s.transferRepo.Update(ctx, customerID, transferID, func(dbTransfer *types.Transfer) (*types.Transfer, error) {
@@ -159,37 +336,39 @@ func (s service) CreateNegotiation(ctx context.Context, customerID, transferID,
 			return nil, fmt.Errorf("could not create transfer negotiation: could not read fhir compositition: %w", err)
 		}
 
+		senderID, err := s.senderDID(ctx, customerID)
+		if err != nil {
+			return nil, err
+		}
 		transferTask := eoverdracht.TransferTask{
 			Status:          transfer.RequestedState,
+			SenderID:        senderID,
 			ReceiverID:      organizationID,
 			AdvanceNoticeID: &dbTransfer.FhirAdvanceNoticeComposition,
 		}
 
-		transferTask, err = fhirTransferService.CreateTask(ctx, transferTask)
+		transferTask, err = s.createTask(ctx, compensations, fhirTransferService, transferTask)
 		if err != nil {
-			return nil, fmt.Errorf("could not create FHIR task: %w", err)
+			return nil, err
 		}
 
-		// Build the list of resources for the authorization credential:
-		authorizedResources := map[string]interface{}{
-			fmt.Sprintf("/Task/%s", transferTask.ID): []string{"GET"},
-			compositionPath:                          []string{"GET"},
+		authorizedResources := advanceNoticeResources(transferTask.ID, compositionPath, composition)
+		if err := s.addPIPData(compensations, transferTask.ID, organizationID, *customer, authorizedResources); err != nil {
+			return nil, err
 		}
 
-		// A list to store all the paths to FHIR resources associated with this advance notice
-		// These paths must be included in the authorization credential
-		resourcePaths := resourcePathsFromSection(composition.Section, []string{})
-		// Include subject reference (patient)
-		resourcePaths = append(resourcePaths, fhir.FromStringPtr(composition.Subject.Reference))
-		for _, path := range resourcePaths {
-			authorizedResources[path] = []string{"GET"}
+		negotiation, err = s.transferRepo.CreateNegotiation(ctx, customerID, transferID, organizationID, dbTransfer.TransferDate.Time, transferTask.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.recordEvent(ctx, customerID, *negotiation, types.StateChanged, "negotiation started"); err != nil {
+			return nil, err
 		}
-		if err := s.pipClient.AddPIPData(transferTask.ID, organizationID, transfer.SenderServiceScope, *customer, authorizedResources); err != nil {
-			return nil, fmt.Errorf("could not create PIP data: %w", err)
+		if err = s.recordEvent(ctx, customerID, *negotiation, types.AuthorizationGranted, "access to the advance notice"); err != nil {
+			return nil, err
 		}
 
-		negotiation, err = s.transferRepo.CreateNegotiation(ctx, customerID, transferID, organizationID, dbTransfer.TransferDate.Time, transferTask.ID)
-		if err != nil {
+		if err = s.queueNotification(ctx, customer.Id, organizationID, negotiation.TaskID); err != nil {
 			return nil, err
 		}
 
@@ -197,20 +376,86 @@ func (s service) CreateNegotiation(ctx context.Context, customerID, transferID,
 		//transfer.Status = domain.TransferStatusRequested
 		return dbTransfer, nil
 	})
-	if err == nil {
-		// Commit here, otherwise notifications to this server will deadlock on the uncommitted tx.
-		tm, _ := sqlUtil.GetTransactionManager(ctx)
-		if commitErr := tm.Commit(); commitErr != nil {
-			return negotiation, commitErr
-		}
 
-		if err = s.sendNotification(ctx, customer, organizationID, negotiation.TaskID); err != nil {
-			// TODO: What to do here? Should we maybe rollback?
-			logrus.Errorf("Unable to notify receiving care organization of updated FHIR task (id=%s): %s", organizationID, err)
-		}
+	return negotiation, compensations.end(ctx, err)
+}
+
+// metadataPath is the path of the CapabilityStatement, the receiver reads it to negotiate the FHIR version of the server.
+const metadataPath = "/metadata"
+
+// advanceNoticeResources returns the resources the receiver is granted access to while the transfer is negotiated:
+// the Task, the advance notice and the resources it refers to.
+func advanceNoticeResources(taskID, compositionPath string, composition fhir.Composition) map[string]interface{} {
+	// Build the list of resources for the authorization credential:
+	// the receiver updates the Task to accept, reject or put the transfer on hold
+	authorizedResources := map[string]interface{}{
+		fmt.Sprintf("/Task/%s", taskID): []string{"GET", "PUT"},
+		compositionPath:                 []string{"GET"},
+		metadataPath:                    []string{"GET"},
 	}
 
-	return negotiation, err
+	// A list to store all the paths to FHIR resources associated with this advance notice
+	// These paths must be included in the authorization credential
+	resourcePaths := resourcePathsFromSection(composition.Section, []string{})
+	// Include subject reference (patient)
+	resourcePaths = append(resourcePaths, fhir.FromStringPtr(composition.Subject.Reference))
+	for _, path := range resourcePaths {
+		authorizedResources[path] = []string{"GET"}
+	}
+	return authorizedResources
+}
+
+// confirmedNegotiationResources returns the resources the receiver is granted access to when the negotiation is
+// confirmed: the Task, the advance notice, the nursing handoff and the resources they refer to.
+func confirmedNegotiationResources(taskID, advanceNoticePath string, advanceNotice, nursingHandoff fhir.Composition) map[string]interface{} {
+	// the receiver updates the Task to complete the transfer
+	authorizedResources := map[string]interface{}{
+		fmt.Sprintf("/Task/%s", taskID): []string{"GET", "PUT"},
+		metadataPath:                    []string{"GET"},
+	}
+	compositionPath := fmt.Sprintf("/Composition/%s", fhir.FromIDPtr(nursingHandoff.ID))
+	// Add paths of resources of both the advance notice and the nursing handoff
+	resourcePaths := resourcePathsFromSection(nursingHandoff.Section, []string{advanceNoticePath, compositionPath})
+	resourcePaths = resourcePathsFromSection(advanceNotice.Section, resourcePaths)
+	// Add path to the complete, non-anonymous, patient
+	resourcePaths = append(resourcePaths, "/"+fhir.FromStringPtr(nursingHandoff.Subject.Reference))
+	resourcePaths = append(resourcePaths, "/"+fhir.FromStringPtr(advanceNotice.Subject.Reference))
+	for _, path := range resourcePaths {
+		authorizedResources[path] = []string{"GET"}
+	}
+	return authorizedResources
+}
+
+// advanceNoticeAccess reads the advance notice and returns the resources the receiver of the Task has access to while
+// the transfer is negotiated.
+func advanceNoticeAccess(ctx context.Context, fhirClient fhir.Client, taskID, advanceNoticeID string) (map[string]interface{}, error) {
+	advanceNoticePath := fmt.Sprintf("/Composition/%s", advanceNoticeID)
+	advanceNotice := fhir.Composition{}
+	if err := fhirClient.ReadOne(ctx, advanceNoticePath, &advanceNotice); err != nil {
+		return nil, fmt.Errorf("could not read advance notice: %w", err)
+	}
+	return advanceNoticeResources(taskID, advanceNoticePath, advanceNotice), nil
+}
+
+// nursingHandoffAccess reads the compositions of the Task and returns the resources its receiver has access to while
+// the transfer is in progress. A Task without advance notice belongs to a transfer which was assigned directly.
+func (s service) nursingHandoffAccess(ctx context.Context, fhirClient fhir.Client, customerID string, task eoverdracht.TransferTask) (map[string]interface{}, error) {
+	if task.NursingHandoffID == nil {
+		return nil, fmt.Errorf("Task has no nursing handoff (id=%s)", task.ID)
+	}
+	nursingHandoff := fhir.Composition{}
+	if err := fhirClient.ReadOne(ctx, "/Composition/"+*task.NursingHandoffID, &nursingHandoff); err != nil {
+		return nil, fmt.Errorf("could not read nursing handoff: %w", err)
+	}
+	if task.AdvanceNoticeID == nil {
+		return s.assignedTransferResources(customerID, task.ID, &nursingHandoff), nil
+	}
+	advanceNoticePath := fmt.Sprintf("/Composition/%s", *task.AdvanceNoticeID)
+	advanceNotice := fhir.Composition{}
+	if err := fhirClient.ReadOne(ctx, advanceNoticePath, &advanceNotice); err != nil {
+		return nil, fmt.Errorf("could not read advance notice: %w", err)
+	}
+	return confirmedNegotiationResources(task.ID, advanceNoticePath, advanceNotice, nursingHandoff), nil
 }
 
 func resourcePathsFromSection(sections []fhir.CompositionSection, paths []string) []string {
@@ -233,7 +478,7 @@ func (s service) ConfirmNegotiation(ctx context.Context, customerID, transferID,
 		negotiation   *types.TransferNegotiation
 		patient       *types.Patient
 		customer      *types.Customer
-		notifications []*notification
+		compensations = &saga{}
 	)
 
 	// Update database transfer
@@ -245,15 +490,14 @@ func (s service) ConfirmNegotiation(ctx context.Context, customerID, transferID,
 
 		advanceNoticePath := fmt.Sprintf("/Composition/%s", dbTransfer.FhirAdvanceNoticeComposition)
 
-		// cancel other negotiations + tasks + batch notifications
+		// cancel other negotiations + tasks + notifications
 		for _, n := range allNegotiations {
-			if negotiationID != string(n.Id) {
-				// this also handles the FHIR and notification stuff
-				_, notification, err := s.cancelNegotiation(ctx, customerID, string(n.Id), advanceNoticePath)
-				if err != nil {
-					return nil, err
-				}
-				notifications = append(notifications, notification)
+			if negotiationID == string(n.Id) || closed(n) {
+				continue
+			}
+			// this also handles the FHIR and notification stuff
+			if _, err := s.cancelNegotiation(ctx, compensations, customerID, string(n.Id), dbTransfer.FhirAdvanceNoticeComposition, "negotiation cancelled"); err != nil {
+				return nil, err
 			}
 		}
 
@@ -261,6 +505,9 @@ func (s service) ConfirmNegotiation(ctx context.Context, customerID, transferID,
 		if negotiation, err = s.transferRepo.ConfirmNegotiation(ctx, customerID, negotiationID); err != nil {
 			return nil, err
 		}
+		if err = s.recordEvent(ctx, customerID, *negotiation, types.StateChanged, "negotiation confirmed"); err != nil {
+			return nil, err
+		}
 
 		patient, err = s.findPatientByDossierID(ctx, customerID, string(dbTransfer.DossierID))
 		if err != nil {
@@ -273,7 +520,7 @@ func (s service) ConfirmNegotiation(ctx context.Context, customerID, transferID,
 		}
 
 		fhirClient := s.localFHIRClientFactory(fhir.WithTenant(customerID))
-		fhirService := eoverdracht.NewFHIRTransferService(fhirClient)
+		fhirService := s.newFHIRTransferService(fhirClient)
 
 		// The advance notice contains a lot of the same resources which should also be used in the Nursing Handoff
 		// Fetch the advanceNotice FHIR resources
@@ -282,87 +529,68 @@ func (s service) ConfirmNegotiation(ctx context.Context, customerID, transferID,
 			return nil, err
 		}
 
-		// Create nursing handoff composition based on the advanceNotice and patient
-		nursingHandoffComposition, err := eoverdracht.NewFHIRBuilder().BuildNursingHandoffComposition(patient, advanceNotice)
+		handoffContent, err := s.findHandoffContent(ctx, customerID, string(dbTransfer.Id))
+		if err != nil {
+			return nil, err
+		}
+
+		// Create nursing handoff based on the advanceNotice, patient and the content entered for the handoff
+		nursingHandoff, err := eoverdracht.NewFHIRBuilder().BuildNursingHandoff(patient, advanceNotice, handoffContent)
 		if err != nil {
 			return nil, err
 		}
 
-		// Save nursing handoff composition in the FHIR store
-		if err = s.localFHIRClientFactory(fhir.WithTenant(customerID)).CreateOrUpdate(ctx, nursingHandoffComposition, nil); err != nil {
+		// Save nursing handoff resources in the FHIR store
+		if err = s.createNursingHandoff(ctx, compensations, fhirService, nursingHandoff); err != nil {
 			return nil, err
 		}
+		nursingHandoffComposition := nursingHandoff.Composition
 
 		compositionID := nursingHandoffComposition.ID
 		dbTransfer.FhirNursingHandoffComposition = (*string)(compositionID)
 		dbTransfer.Status = types.Assigned
 
 		// Update the task with the new state and nursing handoff composition ID
+		var previousTask eoverdracht.TransferTask
 		if err := fhirService.UpdateTask(ctx, negotiation.TaskID, func(domainTask eoverdracht.TransferTask) eoverdracht.TransferTask {
+			previousTask = domainTask
 			domainTask.Status = transfer.InProgressState
 			domainTask.NursingHandoffID = dbTransfer.FhirNursingHandoffComposition
 			return domainTask
 		}); err != nil {
 			return nil, fmt.Errorf("could not confirm negotiation: %w", fmt.Errorf("could not update task with in-progress state: %w", err))
 		}
+		compensations.compensate("restore Task/"+negotiation.TaskID, func(ctx context.Context) error {
+			return fhirService.UpdateTask(ctx, previousTask.ID, func(eoverdracht.TransferTask) eoverdracht.TransferTask {
+				return previousTask
+			})
+		})
 
 		// Revoke the old AuthorizationCredential for the Task and AdvanceNotice
-		if err = s.pipClient.DeletePIPData(negotiation.TaskID); err != nil {
+		advanceNoticeAccess := advanceNoticeResources(negotiation.TaskID, advanceNoticePath, advanceNotice.Composition)
+		if err = s.revokePIPData(compensations, *negotiation, *customer, advanceNoticeAccess); err != nil {
 			return nil, fmt.Errorf("unable to confirm negotiation: could not revoke advance notice authorization credential: %w", err)
 		}
-
-		authorizedResources := map[string]interface{}{
-			fmt.Sprintf("/Task/%s", negotiation.TaskID): []string{"GET"},
+		if err = s.recordEvent(ctx, customerID, *negotiation, types.AuthorizationRevoked, "access to the advance notice"); err != nil {
+			return nil, err
 		}
-		compositionPath := fmt.Sprintf("/Composition/%s", fhir.FromIDPtr(compositionID))
-		// Add paths of resources of both the advance notice and the nursing handoff
-		resourcePaths := resourcePathsFromSection(nursingHandoffComposition.Section, []string{advanceNoticePath, compositionPath})
-		resourcePaths = resourcePathsFromSection(advanceNotice.Composition.Section, resourcePaths)
-		// Add path to the complete, non-anonymous, patient
-		resourcePaths = append(resourcePaths, "/"+fhir.FromStringPtr(nursingHandoffComposition.Subject.Reference))
-		resourcePaths = append(resourcePaths, "/"+fhir.FromStringPtr(advanceNotice.Composition.Subject.Reference))
 
-		// The resourcePaths may contain duplicates, hold a list of processedPaths
-		processedPaths := map[string]struct{}{}
-		for _, path := range resourcePaths {
-			if _, exists := processedPaths[path]; exists {
-				continue
-			}
-			authorizedResources[path] = []string{"GET"}
-			processedPaths[path] = struct{}{}
+		authorizedResources := confirmedNegotiationResources(negotiation.TaskID, advanceNoticePath, advanceNotice.Composition, nursingHandoffComposition)
+		if err := s.addPIPData(compensations, negotiation.TaskID, negotiation.OrganizationID, *customer, authorizedResources); err != nil {
+			return nil, err
 		}
-
-		if err := s.pipClient.AddPIPData(negotiation.TaskID, negotiation.OrganizationID, transfer.SenderServiceScope, *customer, authorizedResources); err != nil {
-			return nil, fmt.Errorf("could not create PIP data: %w", err)
+		if err = s.recordEvent(ctx, customerID, *negotiation, types.AuthorizationGranted, "access to the advance notice and nursing handoff"); err != nil {
+			return nil, err
 		}
 
-		notifications = append(notifications, &notification{
-			customer:       customer,
-			organizationID: negotiation.OrganizationID,
-		})
+		if err = s.queueNotification(ctx, customer.Id, negotiation.OrganizationID, negotiation.TaskID); err != nil {
+			return nil, err
+		}
 
 		return dbTransfer, nil
 	})
-	if err == nil {
-		// Commit db transaction here, otherwise notifications to this server will deadlock.
-		tm, _ := sqlUtil.GetTransactionManager(ctx)
-		if commitErr := tm.Commit(); commitErr != nil {
-			return negotiation, commitErr
-		}
-
-		var errs []string
-		for _, n := range notifications {
-			err = s.sendNotification(ctx, n.customer, n.organizationID, negotiation.TaskID)
-			if err != nil {
-				errs = append(errs, fmt.Errorf("sending to %s: %w", n.organizationID, err).Error())
-			}
-		}
-		if len(errs) > 0 {
-			return nil, fmt.Errorf("one or more eOverdracht notifications failed: %s", strings.Join(errs, ", "))
-		}
-	}
 
-	return negotiation, err
+	return negotiation, compensations.end(ctx, err)
 }
 
 func (s service) CancelNegotiation(ctx context.Context, customerID, transferID, negotiationID string) (*types.TransferNegotiation, error) {
@@ -371,39 +599,128 @@ func (s service) CancelNegotiation(ctx context.Context, customerID, transferID,
 	if err != nil {
 		return nil, err
 	}
+	if negotiation == nil || string(negotiation.TransferID) != transferID {
+		return nil, fmt.Errorf("%w (id=%s)", ErrNegotiationNotFound, negotiationID)
+	}
+	dbTransfer, err := s.transferRepo.FindByID(ctx, customerID, transferID)
+	if err != nil {
+		return nil, err
+	}
+	if dbTransfer == nil {
+		return nil, fmt.Errorf("transfer not found (id=%s)", transferID)
+	}
+
+	// update DB, Task, credential state and notify the receiver
+	compensations := &saga{}
+	negotiation, err = s.cancelNegotiation(ctx, compensations, customerID, negotiationID, dbTransfer.FhirAdvanceNoticeComposition, "negotiation cancelled")
+	return negotiation, compensations.end(ctx, err)
+}
+
+func (s service) AutoCompleteNegotiation(ctx context.Context, customerID, negotiationID, reason string) error {
+	negotiation, err := s.transferRepo.FindNegotiationByID(ctx, customerID, negotiationID)
+	if err != nil {
+		return err
+	}
+	// the receiver might have completed the transfer in the meantime
+	if negotiation == nil || negotiation.Status != transfer.InProgressState {
+		return nil
+	}
+	customer, err := s.customerRepo.FindByID(customerID)
+	if err != nil {
+		return err
+	}
+	return s.completeTask(ctx, *customer, negotiation, reason)
+}
+
+func (s service) ExpireNegotiation(ctx context.Context, customerID, negotiationID, reason string) error {
+	negotiation, err := s.transferRepo.FindNegotiationByID(ctx, customerID, negotiationID)
+	if err != nil {
+		return err
+	}
+	// the receiver might have answered, or the sender accepted the alternative date, in the meantime
+	if negotiation == nil || (negotiation.Status != transfer.RequestedState && negotiation.Status != transfer.OnHoldState) {
+		return nil
+	}
 	dbTransfer, err := s.transferRepo.FindByID(ctx, customerID, string(negotiation.TransferID))
+	if err != nil {
+		return err
+	}
+	if dbTransfer == nil {
+		return fmt.Errorf("transfer not found (id=%s)", negotiation.TransferID)
+	}
+	compensations := &saga{}
+	_, err = s.cancelNegotiation(ctx, compensations, customerID, negotiationID, dbTransfer.FhirAdvanceNoticeComposition, reason)
+	return compensations.end(ctx, err)
+}
+
+// AcceptAlternateDate is executed by the sending organization. It accepts the date proposed by the receiving organization.
+// Rejecting the proposed date is done by cancelling the negotiation.
+func (s service) AcceptAlternateDate(ctx context.Context, customerID, transferID, negotiationID string) (*types.TransferNegotiation, error) {
+	negotiation, err := s.transferRepo.FindNegotiationByID(ctx, customerID, negotiationID)
 	if err != nil {
 		return nil, err
 	}
+	if negotiation == nil || string(negotiation.TransferID) != transferID {
+		return nil, fmt.Errorf("%w (id=%s)", ErrNegotiationNotFound, negotiationID)
+	}
+	if negotiation.Status != transfer.OnHoldState {
+		return nil, fmt.Errorf("can't accept alternate date: invalid task state change: from %s to %s", negotiation.Status, transfer.RequestedState)
+	}
 
-	// update DB, Task and credential state
-	negotiation, notification, err := s.cancelNegotiation(ctx, customerID, negotiationID, dbTransfer.FhirAdvanceNoticeComposition)
+	// the negotiation already holds the proposed date, only the state changes
+	if negotiation, err = s.transferRepo.UpdateNegotiationState(ctx, customerID, negotiationID, transfer.RequestedState); err != nil {
+		return nil, err
+	}
+
+	fhirClient := s.localFHIRClientFactory(fhir.WithTenant(customerID))
+	fhirService := s.newFHIRTransferService(fhirClient)
+	// the proposed date is the agreed transfer date now, so it's removed from the Task output
+	err = fhirService.UpdateTask(ctx, negotiation.TaskID, func(task eoverdracht.TransferTask) eoverdracht.TransferTask {
+		task.Status = transfer.RequestedState
+		task.AlternativeDate = nil
+		return task
+	})
 	if err != nil {
 		return nil, err
 	}
+	if err := s.recordEvent(ctx, customerID, *negotiation, types.StateChanged, "alternative date accepted"); err != nil {
+		return nil, err
+	}
 
-	return negotiation, s.sendNotification(ctx, notification.customer, notification.organizationID, negotiation.TaskID)
+	return negotiation, s.queueNotification(ctx, customerID, negotiation.OrganizationID, negotiation.TaskID)
 }
 
-func (s service) UpdateTaskState(ctx context.Context, customer types.Customer, taskID string, newState string) error {
+func (s service) UpdateTaskState(ctx context.Context, customer types.Customer, taskID string, newState string, alternativeDate *time.Time) error {
 	// find negotiation
 	negotiation, err := s.transferRepo.FindNegotiationByTaskID(ctx, customer.Id, taskID)
 	if err != nil {
 		return err
 	}
+	if negotiation == nil {
+		return fmt.Errorf("task not found (id=%s): %w", taskID, sql.ErrNoRows)
+	}
 
 	// check state transition
 	if !(negotiation.Status == transfer.RequestedState && newState == transfer.AcceptedState ||
+		negotiation.Status == transfer.RequestedState && newState == transfer.RejectedState ||
+		negotiation.Status == transfer.RequestedState && newState == transfer.OnHoldState ||
 		negotiation.Status == transfer.InProgressState && newState == transfer.CompletedState) {
 		// invalid state change
 		return fmt.Errorf("invalid task state change: from %s to %s", negotiation.Status, newState)
 	}
 
-	if newState == transfer.AcceptedState {
+	switch newState {
+	case transfer.AcceptedState:
 		return s.acceptTask(ctx, customer, negotiation)
-	}
-	if newState == transfer.CompletedState {
-		return s.completeTask(ctx, customer, negotiation)
+	case transfer.RejectedState:
+		return s.rejectTask(ctx, customer, negotiation)
+	case transfer.OnHoldState:
+		if alternativeDate == nil {
+			return errors.New("invalid task state change: on-hold requires an alternative date")
+		}
+		return s.proposeAlternateDate(ctx, customer, negotiation, *alternativeDate)
+	case transfer.CompletedState:
+		return s.completeTask(ctx, customer, negotiation, "transfer completed by the receiver")
 	}
 	return nil
 }
@@ -412,38 +729,91 @@ func (s service) UpdateTaskState(ctx context.Context, customer types.Customer, t
 func (s service) acceptTask(ctx context.Context, customer types.Customer, negotiation *types.TransferNegotiation) error {
 
 	// alter state to completed in DB for Task
-	if _, err := s.transferRepo.UpdateNegotiationState(ctx, customer.Id, string(negotiation.Id), transfer.AcceptedState); err != nil {
+	negotiation, err := s.transferRepo.UpdateNegotiationState(ctx, customer.Id, string(negotiation.Id), transfer.AcceptedState)
+	if err != nil {
 		return err
 	}
 
 	fhirClient := s.localFHIRClientFactory(fhir.WithTenant(customer.Id))
-	fhirService := eoverdracht.NewFHIRTransferService(fhirClient)
+	fhirService := s.newFHIRTransferService(fhirClient)
 	if err := fhirService.UpdateTaskStatus(ctx, negotiation.TaskID, transfer.AcceptedState); err != nil {
 		return err
 	}
+	if err := s.recordEvent(ctx, customer.Id, *negotiation, types.StateChanged, "transfer request accepted by the receiver"); err != nil {
+		return err
+	}
+
+	return s.queueNotification(ctx, customer.Id, negotiation.OrganizationID, negotiation.TaskID)
+}
+
+// rejectTask sets the negotiation and corresponding task on rejected, revokes the credential and sends a notification.
+func (s service) rejectTask(ctx context.Context, customer types.Customer, negotiation *types.TransferNegotiation) error {
+	compensations := &saga{}
+	err := s.rejectNegotiation(ctx, compensations, customer, negotiation)
+	return compensations.end(ctx, err)
+}
+
+func (s service) rejectNegotiation(ctx context.Context, compensations *saga, customer types.Customer, negotiation *types.TransferNegotiation) error {
+	dbTransfer, err := s.transferRepo.FindByID(ctx, customer.Id, string(negotiation.TransferID))
+	if err != nil {
+		return err
+	}
+	if dbTransfer == nil {
+		return fmt.Errorf("transfer not found (id=%s)", negotiation.TransferID)
+	}
+	negotiation, err = s.transferRepo.UpdateNegotiationState(ctx, customer.Id, string(negotiation.Id), transfer.RejectedState)
+	if err != nil {
+		return err
+	}
+
+	fhirClient := s.localFHIRClientFactory(fhir.WithTenant(customer.Id))
+	fhirService := s.newFHIRTransferService(fhirClient)
+	if err := s.updateTaskStatus(ctx, compensations, fhirService, negotiation.TaskID, transfer.RejectedState); err != nil {
+		return err
+	}
+	if err := s.recordEvent(ctx, customer.Id, *negotiation, types.StateChanged, "transfer request rejected by the receiver"); err != nil {
+		return err
+	}
 
-	// create notification
-	not := notification{
-		customer:       &customer,
-		organizationID: negotiation.OrganizationID,
+	// the receiver no longer needs access to the advance notice, it is granted again when the rejection is undone
+	access, err := advanceNoticeAccess(ctx, fhirClient, negotiation.TaskID, dbTransfer.FhirAdvanceNoticeComposition)
+	if err != nil {
+		return err
+	}
+	if err := s.revokePIPData(compensations, *negotiation, customer, access); err != nil {
+		return err
+	}
+	if err := s.recordEvent(ctx, customer.Id, *negotiation, types.AuthorizationRevoked, "access to the advance notice"); err != nil {
+		return err
 	}
 
-	// Commit here, otherwise notifications to this server will deadlock on the uncommitted tx.
-	tm, _ := sqlUtil.GetTransactionManager(ctx)
-	if commitErr := tm.Commit(); commitErr != nil {
-		return commitErr
+	return s.queueNotification(ctx, customer.Id, negotiation.OrganizationID, negotiation.TaskID)
+}
+
+// proposeAlternateDate stores the date proposed by the receiver, puts the negotiation and task on-hold and sends a notification.
+func (s service) proposeAlternateDate(ctx context.Context, customer types.Customer, negotiation *types.TransferNegotiation, alternativeDate time.Time) error {
+	negotiation, err := s.transferRepo.ProposeAlternateDate(ctx, customer.Id, string(negotiation.Id), alternativeDate)
+	if err != nil {
+		return err
 	}
 
-	_ = s.sendNotification(ctx, not.customer, not.organizationID, negotiation.TaskID)
+	fhirClient := s.localFHIRClientFactory(fhir.WithTenant(customer.Id))
+	fhirService := s.newFHIRTransferService(fhirClient)
+	if err := fhirService.ProposeAlternativeDate(ctx, negotiation.TaskID, alternativeDate); err != nil {
+		return err
+	}
+	details := fmt.Sprintf("alternative date %s proposed by the receiver", alternativeDate.Format(openapiTypes.DateFormat))
+	if err := s.recordEvent(ctx, customer.Id, *negotiation, types.StateChanged, details); err != nil {
+		return err
+	}
 
-	return nil
+	return s.queueNotification(ctx, customer.Id, negotiation.OrganizationID, negotiation.TaskID)
 }
 
 // completeTask will also complete the transfer, revoke credential and send a notification
-func (s service) completeTask(ctx context.Context, customer types.Customer, negotiation *types.TransferNegotiation) error {
+func (s service) completeTask(ctx context.Context, customer types.Customer, negotiation *types.TransferNegotiation, details string) error {
 	transferID := string(negotiation.TransferID)
-
-	var not notification
+	compensations := &saga{}
 
 	_, err := s.transferRepo.Update(ctx, customer.Id, transferID, func(transferRecord *types.Transfer) (*types.Transfer, error) {
 		var err error
@@ -456,102 +826,115 @@ func (s service) completeTask(ctx context.Context, customer types.Customer, nego
 
 		// update FHIR task
 		fhirClient := s.localFHIRClientFactory(fhir.WithTenant(customer.Id))
-		fhirService := eoverdracht.NewFHIRTransferService(fhirClient)
-		if err := fhirService.UpdateTaskStatus(ctx, negotiation.TaskID, transfer.CompletedState); err != nil {
+		fhirService := s.newFHIRTransferService(fhirClient)
+		task, err := fhirService.GetTask(ctx, negotiation.TaskID)
+		if err != nil {
+			return nil, err
+		}
+		// the access is granted again when completing the transfer is undone
+		access, err := s.nursingHandoffAccess(ctx, fhirClient, customer.Id, *task)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.updateTaskStatus(ctx, compensations, fhirService, negotiation.TaskID, transfer.CompletedState); err != nil {
+			return nil, err
+		}
+		if err = s.recordEvent(ctx, customer.Id, *negotiation, types.StateChanged, details); err != nil {
 			return nil, err
 		}
 
 		// revoke authorization credential
-		if err = s.pipClient.DeletePIPData(negotiation.TaskID); err != nil {
+		if err = s.revokePIPData(compensations, *negotiation, customer, access); err != nil {
+			return nil, err
+		}
+		if err = s.recordEvent(ctx, customer.Id, *negotiation, types.AuthorizationRevoked, "access to the advance notice and nursing handoff"); err != nil {
 			return nil, err
 		}
 
-		// create notification
-		not = notification{
-			customer:       &customer,
-			organizationID: negotiation.OrganizationID,
+		if err = s.queueNotification(ctx, customer.Id, negotiation.OrganizationID, negotiation.TaskID); err != nil {
+			return nil, err
 		}
 
 		return transferRecord, nil
 	})
-	if err == nil {
-		// Commit here, otherwise notifications to this server will deadlock on the uncommitted tx.
-		tm, _ := sqlUtil.GetTransactionManager(ctx)
-		if commitErr := tm.Commit(); commitErr != nil {
-			return commitErr
-		}
-
-		_ = s.sendNotification(ctx, not.customer, not.organizationID, negotiation.TaskID)
-	}
 
-	return err
+	return compensations.end(ctx, err)
 }
 
-type notification struct {
-	customer       *types.Customer
-	organizationID string
-}
+// cancelNegotiation cancels the negotiation, updates the Task, revokes the credential and queues a notification for the receiver.
+func (s service) cancelNegotiation(ctx context.Context, compensations *saga, customerID, negotiationID, advanceNoticeID, details string) (*types.TransferNegotiation, error) {
+	customer, err := s.customerRepo.FindByID(customerID)
+	if err != nil {
+		return nil, err
+	}
 
-// cancelNegotiation is like CancelNegotiation but it doesn't send any notification.
-// the notification is returned so they can be send as batch.
-func (s service) cancelNegotiation(ctx context.Context, customerID, negotiationID, advanceNoticePath string) (*types.TransferNegotiation, *notification, error) {
 	// update DB state
 	negotiation, err := s.transferRepo.CancelNegotiation(ctx, customerID, negotiationID)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// update local Task
 	fhirClient := s.localFHIRClientFactory(fhir.WithTenant(customerID))
-	fhirService := eoverdracht.NewFHIRTransferService(fhirClient)
-	if err := fhirService.UpdateTaskStatus(ctx, negotiation.TaskID, transfer.CancelledState); err != nil {
-		return nil, nil, err
-	}
-
-	if err = s.pipClient.DeletePIPData(negotiation.TaskID); err != nil {
-		return nil, nil, err
+	fhirService := s.newFHIRTransferService(fhirClient)
+	if err := s.updateTaskStatus(ctx, compensations, fhirService, negotiation.TaskID, transfer.CancelledState); err != nil {
+		return nil, err
 	}
-
-	// create notification
-	customer, err := s.customerRepo.FindByID(customerID)
-	if err != nil {
-		return nil, nil, err
+	if err = s.recordEvent(ctx, customerID, *negotiation, types.StateChanged, details); err != nil {
+		return nil, err
 	}
-	return negotiation, &notification{customer: customer, organizationID: negotiation.OrganizationID}, nil
-}
 
-func (s service) sendNotification(ctx context.Context, customer *types.Customer, organizationID string, fhirTaskID string) error {
-	notificationEndpoint, err := s.registry.GetCompoundServiceEndpoint(ctx, organizationID, transfer.ServiceName, "notification")
+	// the access to the advance notice is granted again when the cancellation is undone
+	access, err := advanceNoticeAccess(ctx, fhirClient, negotiation.TaskID, advanceNoticeID)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	authServerEndpoint, err := s.registry.GetCompoundServiceEndpoint(ctx, organizationID, transfer.ServiceName, "authServerURL")
-	if err != nil {
-		return err
+	if err = s.revokePIPData(compensations, *negotiation, *customer, access); err != nil {
+		return nil, err
 	}
-
-	tokenResponse, err := s.nutsClient.RequestServiceAccessToken(ctx, customer.Id, authServerEndpoint, transfer.ReceiverServiceScope)
-	if err != nil {
-		return err
+	if err = s.recordEvent(ctx, customerID, *negotiation, types.AuthorizationRevoked, "access to the advance notice"); err != nil {
+		return nil, err
 	}
 
-	endpoint := notificationEndpoint
+	return negotiation, s.queueNotification(ctx, customerID, negotiation.OrganizationID, negotiation.TaskID)
+}
 
-	if !strings.HasSuffix(endpoint, "/") {
-		endpoint += "/"
+// queueNotification adds a notification for the receiving care organization to the outbox.
+// It is delivered in the background, after the transaction in the context has been committed.
+func (s service) queueNotification(ctx context.Context, customerID, organizationID string, fhirTaskID string) error {
+	if _, err := s.notificationOutbox.Add(ctx, customerID, organizationID, fhirTaskID); err != nil {
+		return fmt.Errorf("could not queue notification for %s: %w", organizationID, err)
 	}
+	return nil
+}
 
-	endpoint += fhirTaskID
+// recordEvent adds an event about the negotiation to the history of its transfer.
+func (s service) recordEvent(ctx context.Context, customerID string, negotiation types.TransferNegotiation, eventType types.TransferEventType, details string) error {
+	return s.history.Add(ctx, history.Event{
+		CustomerID:     customerID,
+		Role:           history.SenderRole,
+		TransferID:     negotiation.TransferID,
+		NegotiationID:  negotiation.Id,
+		TaskID:         negotiation.TaskID,
+		Type:           eventType,
+		Status:         string(negotiation.Status),
+		OrganizationID: negotiation.OrganizationID,
+		Actor:          history.ActorFromContext(ctx),
+		Details:        details,
+	})
+}
 
-	return retry.Do(
-		func() error {
-			return s.notifier.Notify(tokenResponse, endpoint)
-		},
-		retry.LastErrorOnly(true),
-		retry.Attempts(60),
-		retry.Delay(1*time.Second),
-		retry.DelayType(retry.FixedDelay),
-	)
+// recordTransferEvent adds an event about the transfer itself to its history.
+func (s service) recordTransferEvent(ctx context.Context, customerID string, dbTransfer types.Transfer, eventType types.TransferEventType, details string) error {
+	return s.history.Add(ctx, history.Event{
+		CustomerID: customerID,
+		Role:       history.SenderRole,
+		TransferID: dbTransfer.Id,
+		Type:       eventType,
+		Status:     string(dbTransfer.Status),
+		Actor:      history.ActorFromContext(ctx),
+		Details:    details,
+	})
 }
 
 func (s service) findPatientByDossierID(ctx context.Context, customerID, dossierID string) (*types.Patient, error) {
@@ -574,9 +957,10 @@ func (s service) findPatientByDossierID(ctx context.Context, customerID, dossier
 
 func (s service) AssignTransfer(ctx context.Context, customer types.Customer, transferID, organizationID string) (*types.TransferNegotiation, error) {
 	var negotiation *types.TransferNegotiation
+	compensations := &saga{}
 
 	fhirClient := s.localFHIRClientFactory(fhir.WithTenant(customer.Id))
-	fhirTransferService := eoverdracht.NewFHIRTransferService(fhirClient)
+	fhirTransferService := s.newFHIRTransferService(fhirClient)
 
 	// Update the transfer
 	_, err := s.transferRepo.Update(ctx, customer.Id, transferID, func(dbTransfer *types.Transfer) (*types.Transfer, error) {
@@ -596,30 +980,36 @@ func (s service) AssignTransfer(ctx context.Context, customer types.Customer, tr
 		if err != nil {
 			return nil, fmt.Errorf("could not assign transfer negotiation: could not read fhir compositition: %w", err)
 		}
-		nursingHandoffComposition, err := s.advanceNoticeToNursingHandoff(ctx, customer.Id, dbTransfer)
+		nursingHandoff, err := s.advanceNoticeToNursingHandoff(ctx, customer.Id, dbTransfer)
 		if err != nil {
 			return nil, fmt.Errorf("could not assign transfer negotiation: failed to upgrade AdvanceNotice to NursingHandoff: %w", err)
 		}
-		// Save nursing handoff composition in the FHIR store
-		if err = s.localFHIRClientFactory(fhir.WithTenant(customer.Id)).CreateOrUpdate(ctx, nursingHandoffComposition, nil); err != nil {
+		// Save nursing handoff resources in the FHIR store
+		if err = s.createNursingHandoff(ctx, compensations, fhirTransferService, *nursingHandoff); err != nil {
 			return nil, err
 		}
+		nursingHandoffComposition := &nursingHandoff.Composition
 		dbTransfer.FhirNursingHandoffComposition = (*string)(nursingHandoffComposition.ID)
 
 		// create the FHIR task with the Nurse Handoff
+		senderID, err := s.senderDID(ctx, customer.Id)
+		if err != nil {
+			return nil, err
+		}
 		transferTask := eoverdracht.TransferTask{
 			Status:           transfer.InProgressState,
+			SenderID:         senderID,
 			ReceiverID:       organizationID,
 			NursingHandoffID: dbTransfer.FhirNursingHandoffComposition,
 		}
 
-		transferTask, err = fhirTransferService.CreateTask(ctx, transferTask)
+		transferTask, err = s.createTask(ctx, compensations, fhirTransferService, transferTask)
 		if err != nil {
-			return nil, fmt.Errorf("could not create FHIR task: %w", err)
+			return nil, err
 		}
 
 		// store auth in pip
-		if err := s.createAuthorizations(ctx, &transferTask, nursingHandoffComposition, organizationID, customer); err != nil {
+		if err := s.createAuthorizations(compensations, &transferTask, nursingHandoffComposition, organizationID, customer); err != nil {
 			return nil, err
 		}
 
@@ -627,35 +1017,41 @@ func (s service) AssignTransfer(ctx context.Context, customer types.Customer, tr
 		if err != nil {
 			return nil, err
 		}
-		_, err = s.transferRepo.UpdateNegotiationState(ctx, customer.Id, negotiation.Id, transfer.InProgressState)
+		negotiation, err = s.transferRepo.UpdateNegotiationState(ctx, customer.Id, negotiation.Id, transfer.InProgressState)
 		if err != nil {
 			return nil, err
 		}
-
-		return dbTransfer, nil
-	})
-	if err == nil {
-		// Commit here, otherwise notifications to this server will deadlock on the uncommitted tx.
-		tm, _ := sqlUtil.GetTransactionManager(ctx)
-		if commitErr := tm.Commit(); commitErr != nil {
-			return negotiation, commitErr
+		if err = s.recordEvent(ctx, customer.Id, *negotiation, types.StateChanged, "transfer assigned"); err != nil {
+			return nil, err
+		}
+		if err = s.recordEvent(ctx, customer.Id, *negotiation, types.AuthorizationGranted, "access to the nursing handoff"); err != nil {
+			return nil, err
 		}
 
-		if err = s.sendNotification(ctx, &customer, organizationID, negotiation.TaskID); err != nil {
-			// TODO: What to do here? Should we maybe rollback?
-			logrus.Errorf("Unable to notify receiving care organization of updated FHIR task (did=%s): %s", organizationID, err)
+		if err = s.queueNotification(ctx, customer.Id, organizationID, negotiation.TaskID); err != nil {
+			return nil, err
 		}
-	}
 
-	return negotiation, err
+		return dbTransfer, nil
+	})
+
+	return negotiation, compensations.end(ctx, err)
 }
 
 // createAuthorizations creates 2 authorization credentials, one for the Task, and one for the nursingHandoffComposition.
-func (s service) createAuthorizations(ctx context.Context, transferTask *eoverdracht.TransferTask, nursingHandoffComposition *fhir.Composition, organizationID string, customer types.Customer) error {
-	prefix := fmt.Sprintf("/fhir/%d", customer.Id)
+func (s service) createAuthorizations(compensations *saga, transferTask *eoverdracht.TransferTask, nursingHandoffComposition *fhir.Composition, organizationID string, customer types.Customer) error {
+	authorizedResources := s.assignedTransferResources(customer.Id, transferTask.ID, nursingHandoffComposition)
+	return s.addPIPData(compensations, transferTask.ID, organizationID, customer, authorizedResources)
+}
+
+// assignedTransferResources returns the resources the receiver is granted access to when the transfer is assigned
+// directly: the Task, the nursing handoff and the resources it refers to.
+func (s service) assignedTransferResources(customerID, taskID string, nursingHandoffComposition *fhir.Composition) map[string]interface{} {
+	// the resources are authorized by their path on the FHIR server, which contains the partition of the customer
+	prefix := strings.TrimSuffix(s.localFHIRClientFactory(fhir.WithTenant(customerID)).BuildRequestURI("").Path, "/")
 	// Build the list of resources for the authorization credential:
 	authorizedResources := s.resourcesForNursingHandoff(nursingHandoffComposition)
-	authorizedResources[fmt.Sprintf("/Task/%s", transferTask.ID)] = []string{"GET", "PUT"}
+	authorizedResources[fmt.Sprintf("/Task/%s", taskID)] = []string{"GET", "PUT"}
 	// Add prefix to all paths
 	for path, methods := range authorizedResources {
 		// if not already prefixed
@@ -664,35 +1060,121 @@ func (s service) createAuthorizations(ctx context.Context, transferTask *eoverdr
 			delete(authorizedResources, path)
 		}
 	}
-	if err := s.pipClient.AddPIPData(transferTask.ID, organizationID, transfer.SenderServiceScope, customer, authorizedResources); err != nil {
+	return authorizedResources
+}
+
+// createTask creates the FHIR Task and registers its deletion as compensation.
+func (s service) createTask(ctx context.Context, compensations *saga, fhirService eoverdracht.TransferService, transferTask eoverdracht.TransferTask) (eoverdracht.TransferTask, error) {
+	transferTask, err := fhirService.CreateTask(ctx, transferTask)
+	if err != nil {
+		return transferTask, fmt.Errorf("could not create FHIR task: %w", err)
+	}
+	taskID := transferTask.ID
+	compensations.compensate("delete Task/"+taskID, func(ctx context.Context) error {
+		return fhirService.DeleteTask(ctx, taskID)
+	})
+	return transferTask, nil
+}
+
+// senderDID returns the DID which identifies the customer as requester of its Tasks: the first DID of its subject.
+func (s service) senderDID(ctx context.Context, customerID string) (string, error) {
+	dids, err := s.nutsClient.ListSubjectDIDs(ctx, customerID)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve DID of the sender: %w", err)
+	}
+	if len(dids) == 0 {
+		return "", fmt.Errorf("could not resolve DID of the sender: customer has no DIDs (id=%s)", customerID)
+	}
+	return dids[0], nil
+}
+
+// createNursingHandoff stores the resources of the nursing handoff and registers their deletion as compensation.
+func (s service) createNursingHandoff(ctx context.Context, compensations *saga, fhirService eoverdracht.TransferService, nursingHandoff eoverdracht.NursingHandoff) error {
+	if err := fhirService.CreateNursingHandoff(ctx, nursingHandoff); err != nil {
+		return err
+	}
+	compensations.compensate("delete nursing handoff Composition/"+fhir.FromIDPtr(nursingHandoff.Composition.ID), func(ctx context.Context) error {
+		return fhirService.DeleteNursingHandoff(ctx, nursingHandoff)
+	})
+	return nil
+}
+
+// updateTaskStatus changes the status of the FHIR Task and registers restoring its previous status as compensation.
+func (s service) updateTaskStatus(ctx context.Context, compensations *saga, fhirService eoverdracht.TransferService, taskID, newStatus string) error {
+	task, err := fhirService.GetTask(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if err = fhirService.UpdateTaskStatus(ctx, taskID, newStatus); err != nil {
+		return err
+	}
+	compensations.compensate("restore status of Task/"+taskID, func(ctx context.Context) error {
+		return fhirService.UpdateTaskStatus(ctx, taskID, task.Status)
+	})
+	return nil
+}
+
+// addPIPData grants the organization access to the resources and registers revoking it as compensation.
+func (s service) addPIPData(compensations *saga, id, organizationID string, customer types.Customer, authorizedResources map[string]interface{}) error {
+	if err := s.pipClient.AddPIPData(id, organizationID, transfer.SenderServiceScope, customer, authorizedResources); err != nil {
 		return fmt.Errorf("could not create PIP data: %w", err)
 	}
+	compensations.compensate("revoke PIP data "+id, func(context.Context) error {
+		return s.pipClient.DeletePIPData(id)
+	})
+	return nil
+}
+
+// revokePIPData revokes the access of the organization of the negotiation and registers granting the access to the
+// resources again as compensation, since the negotiation continues when the revocation is undone.
+func (s service) revokePIPData(compensations *saga, negotiation types.TransferNegotiation, customer types.Customer, authorizedResources map[string]interface{}) error {
+	if err := s.pipClient.DeletePIPData(negotiation.TaskID); err != nil {
+		return fmt.Errorf("could not revoke PIP data: %w", err)
+	}
+	compensations.compensate("restore PIP data "+negotiation.TaskID, func(context.Context) error {
+		return s.pipClient.AddPIPData(negotiation.TaskID, negotiation.OrganizationID, transfer.SenderServiceScope, customer, authorizedResources)
+	})
 	return nil
 }
 
-func (s service) advanceNoticeToNursingHandoff(ctx context.Context, customerID string, dbTransfer *types.Transfer) (*fhir.Composition, error) {
+func (s service) advanceNoticeToNursingHandoff(ctx context.Context, customerID string, dbTransfer *types.Transfer) (*eoverdracht.NursingHandoff, error) {
 	patient, err := s.findPatientByDossierID(ctx, customerID, string(dbTransfer.DossierID))
 	if err != nil {
 		return nil, fmt.Errorf("could not fetch patient by dossierID: %w", err)
 	}
 
 	fhirClient := s.localFHIRClientFactory(fhir.WithTenant(customerID))
-	fhirService := eoverdracht.NewFHIRTransferService(fhirClient)
+	fhirService := s.newFHIRTransferService(fhirClient)
 
 	advanceNotice, err := fhirService.GetAdvanceNotice(ctx, dbTransfer.FhirAdvanceNoticeComposition)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create nursing handoff composition based on the advanceNotice and patient
-	nursingHandoffComposition, err := eoverdracht.NewFHIRBuilder().BuildNursingHandoffComposition(patient, advanceNotice)
-	return &nursingHandoffComposition, err
+	handoffContent, err := s.findHandoffContent(ctx, customerID, string(dbTransfer.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	// Create nursing handoff based on the advanceNotice, patient and the content entered for the handoff
+	nursingHandoff, err := eoverdracht.NewFHIRBuilder().BuildNursingHandoff(patient, advanceNotice, handoffContent)
+	return &nursingHandoff, err
+}
+
+// findHandoffContent returns the content entered for the nursing handoff, which is empty when nothing was entered.
+func (s service) findHandoffContent(ctx context.Context, customerID, transferID string) (types.NursingHandoffContent, error) {
+	content, err := s.transferRepo.FindHandoffContent(ctx, customerID, transferID)
+	if err != nil || content == nil {
+		return types.NursingHandoffContent{}, err
+	}
+	return *content, nil
 }
 
 func (s service) resourcesForNursingHandoff(nursingHandoffComposition *fhir.Composition) map[string]interface{} {
 	authorizedResources := map[string]interface{}{
 		fmt.Sprintf("/Composition/%s", fhir.FromIDPtr(nursingHandoffComposition.ID)):        []string{"GET"},
 		fmt.Sprintf("/%s", fhir.FromStringPtr(nursingHandoffComposition.Subject.Reference)): []string{"GET"},
+		metadataPath: []string{"GET"},
 	}
 	// Add paths of resources of both the advance notice and the nursing handoff
 	resourcePaths := resourcePathsFromSection(nursingHandoffComposition.Section, []string{})
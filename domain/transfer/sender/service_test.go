@@ -0,0 +1,892 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/dossier"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/patients"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/history"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/outbox"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
+	"github.com/nuts-foundation/nuts-demo-ehr/sql"
+	openapiTypes "github.com/oapi-codegen/runtime/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+const customerID = "c1"
+
+type mockFHIRClient interface {
+	fhir.Client
+	FailOn(operation, resourceType string)
+	Resource(path string) map[string]interface{}
+	Resources(resourceType string) []string
+}
+
+// fakePIP stores the authorized resources of the PIP data in memory.
+type fakePIP struct {
+	data map[string]map[string]interface{}
+	// failAdd fails the next call of AddPIPData
+	failAdd bool
+	// failDelete is the ID of the PIP data which can't be deleted
+	failDelete string
+}
+
+func (f *fakePIP) AddPIPData(id string, _ string, _ string, _ types.Customer, authInput map[string]interface{}) error {
+	if f.failAdd {
+		f.failAdd = false
+		return errors.New("add failed")
+	}
+	f.data[id] = authInput
+	return nil
+}
+
+func (f *fakePIP) DeletePIPData(id string) error {
+	if f.failDelete == id {
+		return errors.New("delete failed")
+	}
+	delete(f.data, id)
+	return nil
+}
+
+// failingHistory fails recording events of the given type, to simulate a failing database.
+type failingHistory struct {
+	history.Repository
+	failOn types.TransferEventType
+	// failFor limits the failures to the events of the Task with this ID
+	failFor string
+}
+
+func (f *failingHistory) Add(ctx context.Context, event history.Event) error {
+	if f.failOn != "" && event.Type == f.failOn && (f.failFor == "" || event.TaskID == f.failFor) {
+		return errors.New("database failure")
+	}
+	return f.Repository.Add(ctx, event)
+}
+
+// taskFailingClient fails storing the Task with the given ID, while other resources can still be stored.
+type taskFailingClient struct {
+	mockFHIRClient
+	failTask *string
+}
+
+func (c taskFailingClient) CreateOrUpdate(ctx context.Context, resource interface{}, result interface{}) error {
+	data, _ := json.Marshal(resource)
+	if gjson.GetBytes(data, "resourceType").String() == "Task" && gjson.GetBytes(data, "id").String() == *c.failTask {
+		return errors.New("storing Task failed")
+	}
+	return c.mockFHIRClient.CreateOrUpdate(ctx, resource, result)
+}
+
+type fakeVDR struct{}
+
+func (fakeVDR) ListSubjectDIDs(_ context.Context, _ string) ([]string, error) {
+	return []string{"did:web:sender"}, nil
+}
+
+type fakeCustomers struct{}
+
+func (fakeCustomers) FindByID(id string) (*types.Customer, error) {
+	return &types.Customer{Id: id, Name: "Verpleeghuis De Regenboog"}, nil
+}
+
+func (fakeCustomers) All() ([]types.Customer, error) {
+	return nil, nil
+}
+
+type fakeDossiers struct {
+	dossier.Repository
+}
+
+func (fakeDossiers) FindByID(_ context.Context, _ string, id string) (*types.Dossier, error) {
+	return &types.Dossier{Id: types.ObjectID(id), PatientID: "patient-1"}, nil
+}
+
+type fakePatients struct {
+	patients.Repository
+}
+
+func (fakePatients) FindByID(_ context.Context, _ string, id string) (*types.Patient, error) {
+	return &types.Patient{ObjectID: id, FirstName: "Henk", Surname: "de Vries", Zipcode: "1234AB"}, nil
+}
+
+type testContext struct {
+	db         *sqlx.DB
+	fhirClient mockFHIRClient
+	// failTask is the ID of the Task which can't be stored
+	failTask   string
+	pip        *fakePIP
+	history    *failingHistory
+	repo       TransferRepository
+	service    TransferService
+	transferID string
+}
+
+func newTestContext(t *testing.T) *testContext {
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	fhirClient := fhir.NewMockClient(t)
+	ctx := &testContext{
+		db:         db,
+		fhirClient: fhirClient,
+		pip:        &fakePIP{data: map[string]map[string]interface{}{}},
+		history:    &failingHistory{Repository: history.NewRepository(db)},
+		repo:       NewTransferRepository(db),
+	}
+	factory := func(...fhir.ClientOpt) fhir.Client {
+		return taskFailingClient{mockFHIRClient: fhirClient, failTask: &ctx.failTask}
+	}
+	ctx.service = NewTransferService(fakeVDR{}, ctx.pip, factory, ctx.repo, fakeCustomers{}, fakeDossiers{}, fakePatients{}, nil, outbox.NewRepository(db), ctx.history, false)
+
+	ctx.transact(t, func(txCtx context.Context) error {
+		dbTransfer, err := ctx.service.CreateTransfer(txCtx, customerID, types.CreateTransferRequest{
+			DossierID:    "dossier-1",
+			TransferDate: openapiTypes.Date{Time: time.Now().AddDate(0, 0, 7)},
+			CarePlan: types.EOverdrachtCarePlan{PatientProblems: []types.PatientProblem{{
+				Problem:       types.Problem{Name: "Diabetes"},
+				Interventions: []types.Intervention{{Comment: "Check glucose"}},
+			}}},
+		})
+		if err == nil {
+			ctx.transferID = string(dbTransfer.Id)
+		}
+		return err
+	})
+	return ctx
+}
+
+// transact executes the function in its own transaction, the test fails when it returns an error.
+func (c *testContext) transact(t *testing.T, fn func(ctx context.Context) error) {
+	if err := sql.ExecuteTransactional(c.db, fn); !assert.NoError(t, err) {
+		t.FailNow()
+	}
+}
+
+func (c *testContext) negotiations(t *testing.T) []types.TransferNegotiation {
+	var negotiations []types.TransferNegotiation
+	c.transact(t, func(ctx context.Context) error {
+		var err error
+		negotiations, err = c.repo.ListNegotiations(ctx, customerID, c.transferID)
+		return err
+	})
+	return negotiations
+}
+
+func (c *testContext) taskStatus(taskID string) interface{} {
+	task := c.fhirClient.Resource("Task/" + taskID)
+	if task == nil {
+		return nil
+	}
+	return task["status"]
+}
+
+var errRollback = errors.New("rollback")
+
+func TestService_CreateNegotiation_Compensation(t *testing.T) {
+	testCases := []struct {
+		name   string
+		inject func(c *testContext)
+		// rollback fails the transaction after the negotiation has been created
+		rollback bool
+	}{
+		{
+			name:   "creating the Task fails",
+			inject: func(c *testContext) { c.fhirClient.FailOn("CreateOrUpdate", "Task") },
+		},
+		{
+			name:   "creating the PIP data fails",
+			inject: func(c *testContext) { c.pip.failAdd = true },
+		},
+		{
+			name:   "recording the negotiation fails",
+			inject: func(c *testContext) { c.history.failOn = types.AuthorizationGranted },
+		},
+		{
+			name:     "transaction is rolled back",
+			inject:   func(c *testContext) {},
+			rollback: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := newTestContext(t)
+			testCase.inject(c)
+
+			err := sql.ExecuteTransactional(c.db, func(ctx context.Context) error {
+				_, err := c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:receiver")
+				if err == nil && testCase.rollback {
+					return errRollback
+				}
+				return err
+			})
+
+			assert.Error(t, err)
+			assert.Empty(t, c.fhirClient.Resources("Task"))
+			assert.Empty(t, c.pip.data)
+			assert.Empty(t, c.negotiations(t))
+		})
+	}
+	t.Run("ok", func(t *testing.T) {
+		c := newTestContext(t)
+
+		c.transact(t, func(ctx context.Context) error {
+			_, err := c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:receiver")
+			return err
+		})
+
+		negotiations := c.negotiations(t)
+		if !assert.Len(t, negotiations, 1) {
+			return
+		}
+		assert.Equal(t, transfer.RequestedState, c.taskStatus(negotiations[0].TaskID))
+		task, _ := json.Marshal(c.fhirClient.Resource("Task/" + negotiations[0].TaskID))
+		assert.Equal(t, "did:web:sender", gjson.GetBytes(task, "requester.agent.identifier.value").String())
+		assert.Contains(t, c.pip.data, negotiations[0].TaskID)
+	})
+}
+
+func TestService_AssignTransfer_Compensation(t *testing.T) {
+	testCases := []struct {
+		name     string
+		inject   func(c *testContext)
+		rollback bool
+	}{
+		{
+			name:   "storing the nursing handoff fails",
+			inject: func(c *testContext) { c.fhirClient.FailOn("Transaction", "Bundle") },
+		},
+		{
+			name:   "creating the Task fails",
+			inject: func(c *testContext) { c.fhirClient.FailOn("CreateOrUpdate", "Task") },
+		},
+		{
+			name:   "creating the PIP data fails",
+			inject: func(c *testContext) { c.pip.failAdd = true },
+		},
+		{
+			name:   "recording the negotiation fails",
+			inject: func(c *testContext) { c.history.failOn = types.StateChanged },
+		},
+		{
+			name:   "recording the granted access fails",
+			inject: func(c *testContext) { c.history.failOn = types.AuthorizationGranted },
+		},
+		{
+			name:     "transaction is rolled back",
+			inject:   func(c *testContext) {},
+			rollback: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := newTestContext(t)
+			testCase.inject(c)
+
+			err := sql.ExecuteTransactional(c.db, func(ctx context.Context) error {
+				_, err := c.service.AssignTransfer(ctx, types.Customer{Id: customerID}, c.transferID, "did:web:receiver")
+				if err == nil && testCase.rollback {
+					return errRollback
+				}
+				return err
+			})
+
+			assert.Error(t, err)
+			assert.Empty(t, c.fhirClient.Resources("Task"))
+			assert.Empty(t, c.pip.data)
+			assert.Empty(t, c.negotiations(t))
+			// only the advance notice is left
+			assert.Len(t, c.fhirClient.Resources("Composition"), 1)
+		})
+	}
+	t.Run("ok", func(t *testing.T) {
+		c := newTestContext(t)
+
+		c.transact(t, func(ctx context.Context) error {
+			_, err := c.service.AssignTransfer(ctx, types.Customer{Id: customerID}, c.transferID, "did:web:receiver")
+			return err
+		})
+
+		negotiations := c.negotiations(t)
+		if !assert.Len(t, negotiations, 1) {
+			return
+		}
+		assert.Equal(t, transfer.InProgressState, c.taskStatus(negotiations[0].TaskID))
+		assert.Contains(t, c.pip.data, negotiations[0].TaskID)
+	})
+}
+
+func TestService_ConfirmNegotiation_Compensation(t *testing.T) {
+	// setup starts negotiations with 2 organizations, of which the first accepted the transfer
+	setup := func(t *testing.T) (*testContext, types.TransferNegotiation, types.TransferNegotiation) {
+		c := newTestContext(t)
+		var accepted, other *types.TransferNegotiation
+		c.transact(t, func(ctx context.Context) error {
+			var err error
+			if accepted, err = c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:accepted"); err != nil {
+				return err
+			}
+			if other, err = c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:other"); err != nil {
+				return err
+			}
+			return c.service.UpdateTaskState(ctx, types.Customer{Id: customerID}, accepted.TaskID, transfer.AcceptedState, nil)
+		})
+		return c, *accepted, *other
+	}
+
+	// every case fails a step of confirming the negotiation, in the order the steps are executed
+	testCases := []struct {
+		name     string
+		inject   func(c *testContext, accepted, other types.TransferNegotiation)
+		rollback bool
+	}{
+		{
+			name:   "cancelling the other Task fails",
+			inject: func(c *testContext, _, other types.TransferNegotiation) { c.failTask = other.TaskID },
+		},
+		{
+			name: "revoking the access of the other organization fails",
+			inject: func(c *testContext, _, other types.TransferNegotiation) {
+				c.pip.failDelete = other.TaskID
+			},
+		},
+		{
+			name: "recording the cancellation fails",
+			inject: func(c *testContext, _, other types.TransferNegotiation) {
+				c.history.failOn, c.history.failFor = types.AuthorizationRevoked, other.TaskID
+			},
+		},
+		{
+			name: "storing the nursing handoff fails",
+			inject: func(c *testContext, _, _ types.TransferNegotiation) {
+				c.fhirClient.FailOn("Transaction", "Bundle")
+			},
+		},
+		{
+			name:   "updating the Task fails",
+			inject: func(c *testContext, accepted, _ types.TransferNegotiation) { c.failTask = accepted.TaskID },
+		},
+		{
+			name: "revoking the access to the advance notice fails",
+			inject: func(c *testContext, accepted, _ types.TransferNegotiation) {
+				c.pip.failDelete = accepted.TaskID
+			},
+		},
+		{
+			name: "recording the revoked access fails",
+			inject: func(c *testContext, accepted, _ types.TransferNegotiation) {
+				c.history.failOn, c.history.failFor = types.AuthorizationRevoked, accepted.TaskID
+			},
+		},
+		{
+			name:   "creating the PIP data fails",
+			inject: func(c *testContext, _, _ types.TransferNegotiation) { c.pip.failAdd = true },
+		},
+		{
+			name: "recording the granted access fails",
+			inject: func(c *testContext, _, _ types.TransferNegotiation) {
+				c.history.failOn = types.AuthorizationGranted
+			},
+		},
+		{
+			name:     "transaction is rolled back",
+			inject:   func(c *testContext, _, _ types.TransferNegotiation) {},
+			rollback: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			c, accepted, other := setup(t)
+			access := map[string]map[string]interface{}{}
+			for id, authorizedResources := range c.pip.data {
+				access[id] = authorizedResources
+			}
+			testCase.inject(c, accepted, other)
+
+			err := sql.ExecuteTransactional(c.db, func(ctx context.Context) error {
+				_, err := c.service.ConfirmNegotiation(ctx, customerID, c.transferID, string(accepted.Id))
+				if err == nil && testCase.rollback {
+					return errRollback
+				}
+				return err
+			})
+
+			assert.Error(t, err)
+			assert.Equal(t, transfer.AcceptedState, c.taskStatus(accepted.TaskID))
+			// the nursing handoff is removed and no longer referenced
+			assert.Len(t, c.fhirClient.Resource("Task/" + accepted.TaskID)["input"], 1)
+			assert.Len(t, c.fhirClient.Resources("Composition"), 1)
+			assert.Equal(t, transfer.RequestedState, c.taskStatus(other.TaskID))
+			// both organizations have access to the advance notice again
+			assert.Equal(t, access, c.pip.data)
+			statuses := map[string]string{}
+			for _, negotiation := range c.negotiations(t) {
+				statuses[negotiation.TaskID] = string(negotiation.Status)
+			}
+			assert.Equal(t, map[string]string{accepted.TaskID: transfer.AcceptedState, other.TaskID: transfer.RequestedState}, statuses)
+		})
+	}
+	t.Run("ok", func(t *testing.T) {
+		c, accepted, other := setup(t)
+
+		c.transact(t, func(ctx context.Context) error {
+			_, err := c.service.ConfirmNegotiation(ctx, customerID, c.transferID, string(accepted.Id))
+			return err
+		})
+
+		assert.Equal(t, transfer.InProgressState, c.taskStatus(accepted.TaskID))
+		assert.Len(t, c.fhirClient.Resource("Task/" + accepted.TaskID)["input"], 2)
+		assert.Equal(t, transfer.CancelledState, c.taskStatus(other.TaskID))
+		assert.Contains(t, c.pip.data, accepted.TaskID)
+		assert.NotContains(t, c.pip.data, other.TaskID)
+	})
+}
+
+// negotiationState returns the state of the negotiation in the database and its Task.
+func (c *testContext) negotiationState(t *testing.T, negotiation types.TransferNegotiation) (types.FHIRTaskStatus, interface{}) {
+	for _, current := range c.negotiations(t) {
+		if current.Id == negotiation.Id {
+			return current.Status, c.taskStatus(negotiation.TaskID)
+		}
+	}
+	return "", c.taskStatus(negotiation.TaskID)
+}
+
+// eventDetails returns the details of the events in the history of the negotiation.
+func (c *testContext) eventDetails(t *testing.T, negotiation types.TransferNegotiation) []string {
+	var details []string
+	c.transact(t, func(ctx context.Context) error {
+		events, err := c.history.FindByTask(ctx, customerID, history.SenderRole, negotiation.TaskID)
+		for _, event := range events {
+			if event.Details != nil {
+				details = append(details, *event.Details)
+			}
+		}
+		return err
+	})
+	return details
+}
+
+func TestService_UpdateTaskState_Compensation(t *testing.T) {
+	// every case fails a step after the Task and the access of the receiver have been changed
+	testCases := []struct {
+		name     string
+		inject   func(c *testContext, taskID string)
+		rollback bool
+	}{
+		{
+			name: "recording the state change fails",
+			inject: func(c *testContext, taskID string) {
+				c.history.failOn, c.history.failFor = types.StateChanged, taskID
+			},
+		},
+		{
+			name: "recording the revoked access fails",
+			inject: func(c *testContext, taskID string) {
+				c.history.failOn, c.history.failFor = types.AuthorizationRevoked, taskID
+			},
+		},
+		{
+			name:     "transaction is rolled back",
+			inject:   func(*testContext, string) {},
+			rollback: true,
+		},
+	}
+	// assertUnchanged checks the state of the negotiation, its Task and the access of the receiver are left unchanged
+	assertUnchanged := func(t *testing.T, c *testContext, negotiation types.TransferNegotiation, access map[string]map[string]interface{}, err error) {
+		assert.Error(t, err)
+		status, taskStatus := c.negotiationState(t, negotiation)
+		assert.Equal(t, negotiation.Status, status)
+		assert.Equal(t, string(negotiation.Status), taskStatus)
+		assert.Equal(t, access, c.pip.data)
+	}
+	updateTaskState := func(c *testContext, negotiation types.TransferNegotiation, newState string, rollback bool) error {
+		return sql.ExecuteTransactional(c.db, func(ctx context.Context) error {
+			err := c.service.UpdateTaskState(ctx, types.Customer{Id: customerID}, negotiation.TaskID, newState, nil)
+			if err == nil && rollback {
+				return errRollback
+			}
+			return err
+		})
+	}
+	copyAccess := func(c *testContext) map[string]map[string]interface{} {
+		access := map[string]map[string]interface{}{}
+		for id, authorizedResources := range c.pip.data {
+			access[id] = authorizedResources
+		}
+		return access
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				c := newTestContext(t)
+				var negotiation *types.TransferNegotiation
+				c.transact(t, func(ctx context.Context) error {
+					var err error
+					negotiation, err = c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:receiver")
+					return err
+				})
+				access := copyAccess(c)
+				testCase.inject(c, negotiation.TaskID)
+
+				err := updateTaskState(c, *negotiation, transfer.RejectedState, testCase.rollback)
+
+				assertUnchanged(t, c, *negotiation, access, err)
+			})
+		}
+	})
+	t.Run("complete", func(t *testing.T) {
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				c := newTestContext(t)
+				var negotiation *types.TransferNegotiation
+				c.transact(t, func(ctx context.Context) error {
+					var err error
+					if negotiation, err = c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:receiver"); err != nil {
+						return err
+					}
+					if err = c.service.UpdateTaskState(ctx, types.Customer{Id: customerID}, negotiation.TaskID, transfer.AcceptedState, nil); err != nil {
+						return err
+					}
+					negotiation, err = c.service.ConfirmNegotiation(ctx, customerID, c.transferID, string(negotiation.Id))
+					return err
+				})
+				access := copyAccess(c)
+				testCase.inject(c, negotiation.TaskID)
+
+				err := updateTaskState(c, *negotiation, transfer.CompletedState, testCase.rollback)
+
+				assertUnchanged(t, c, *negotiation, access, err)
+			})
+		}
+	})
+	t.Run("complete an assigned transfer", func(t *testing.T) {
+		c := newTestContext(t)
+		var negotiation *types.TransferNegotiation
+		c.transact(t, func(ctx context.Context) error {
+			var err error
+			negotiation, err = c.service.AssignTransfer(ctx, types.Customer{Id: customerID}, c.transferID, "did:web:receiver")
+			return err
+		})
+		access := copyAccess(c)
+
+		err := updateTaskState(c, *negotiation, transfer.CompletedState, true)
+
+		assertUnchanged(t, c, *negotiation, access, err)
+	})
+}
+
+func TestService_AutoCompleteNegotiation(t *testing.T) {
+	const reason = "transfer completed automatically"
+	t.Run("in-progress negotiation is completed", func(t *testing.T) {
+		c := newTestContext(t)
+		var negotiation *types.TransferNegotiation
+		c.transact(t, func(ctx context.Context) error {
+			var err error
+			if negotiation, err = c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:receiver"); err != nil {
+				return err
+			}
+			if err = c.service.UpdateTaskState(ctx, types.Customer{Id: customerID}, negotiation.TaskID, transfer.AcceptedState, nil); err != nil {
+				return err
+			}
+			_, err = c.service.ConfirmNegotiation(ctx, customerID, c.transferID, string(negotiation.Id))
+			return err
+		})
+
+		c.transact(t, func(ctx context.Context) error {
+			return c.service.AutoCompleteNegotiation(ctx, customerID, string(negotiation.Id), reason)
+		})
+
+		status, taskStatus := c.negotiationState(t, *negotiation)
+		assert.Equal(t, types.FHIRTaskStatus(transfer.CompletedState), status)
+		assert.Equal(t, transfer.CompletedState, taskStatus)
+		assert.NotContains(t, c.pip.data, negotiation.TaskID)
+		c.transact(t, func(ctx context.Context) error {
+			dbTransfer, err := c.repo.FindByID(ctx, customerID, c.transferID)
+			assert.Equal(t, types.Completed, dbTransfer.Status)
+			return err
+		})
+		assert.Contains(t, c.eventDetails(t, *negotiation), reason)
+	})
+	t.Run("negotiation which isn't in-progress is left alone", func(t *testing.T) {
+		c := newTestContext(t)
+		var negotiation *types.TransferNegotiation
+		c.transact(t, func(ctx context.Context) error {
+			var err error
+			negotiation, err = c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:receiver")
+			return err
+		})
+
+		c.transact(t, func(ctx context.Context) error {
+			return c.service.AutoCompleteNegotiation(ctx, customerID, string(negotiation.Id), reason)
+		})
+
+		status, taskStatus := c.negotiationState(t, *negotiation)
+		assert.Equal(t, types.FHIRTaskStatus(transfer.RequestedState), status)
+		assert.Equal(t, transfer.RequestedState, taskStatus)
+		assert.Contains(t, c.pip.data, negotiation.TaskID)
+	})
+}
+
+func TestService_ExpireNegotiation(t *testing.T) {
+	const reason = "negotiation cancelled since it was not answered in time"
+	testCases := []struct {
+		name string
+		// state the negotiation is in when it expires
+		state     types.FHIRTaskStatus
+		cancelled bool
+	}{
+		{name: "requested negotiation is cancelled", state: transfer.RequestedState, cancelled: true},
+		{name: "on-hold negotiation is cancelled", state: transfer.OnHoldState, cancelled: true},
+		{name: "accepted negotiation is left alone", state: transfer.AcceptedState},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := newTestContext(t)
+			var negotiation *types.TransferNegotiation
+			c.transact(t, func(ctx context.Context) error {
+				var err error
+				if negotiation, err = c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:receiver"); err != nil {
+					return err
+				}
+				if testCase.state != transfer.RequestedState {
+					negotiation, err = c.repo.UpdateNegotiationState(ctx, customerID, string(negotiation.Id), testCase.state)
+				}
+				return err
+			})
+
+			c.transact(t, func(ctx context.Context) error {
+				return c.service.ExpireNegotiation(ctx, customerID, string(negotiation.Id), reason)
+			})
+
+			status, _ := c.negotiationState(t, *negotiation)
+			if !testCase.cancelled {
+				assert.Equal(t, testCase.state, status)
+				assert.Contains(t, c.pip.data, negotiation.TaskID)
+				assert.NotContains(t, c.eventDetails(t, *negotiation), reason)
+				return
+			}
+			assert.Equal(t, types.FHIRTaskStatus(transfer.CancelledState), status)
+			assert.Equal(t, transfer.CancelledState, c.taskStatus(negotiation.TaskID))
+			assert.NotContains(t, c.pip.data, negotiation.TaskID)
+			assert.Contains(t, c.eventDetails(t, *negotiation), reason)
+		})
+	}
+}
+
+func TestService_AcceptAlternateDate(t *testing.T) {
+	c := newTestContext(t)
+	alternativeDate := time.Now().AddDate(0, 0, 7)
+	var negotiation *types.TransferNegotiation
+	c.transact(t, func(ctx context.Context) error {
+		var err error
+		if negotiation, err = c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:receiver"); err != nil {
+			return err
+		}
+		return c.service.UpdateTaskState(ctx, types.Customer{Id: customerID}, negotiation.TaskID, transfer.OnHoldState, &alternativeDate)
+	})
+	assert.NotEmpty(t, c.fhirClient.Resource("Task/" + negotiation.TaskID)["output"])
+
+	c.transact(t, func(ctx context.Context) error {
+		_, err := c.service.AcceptAlternateDate(ctx, customerID, c.transferID, string(negotiation.Id))
+		return err
+	})
+
+	status, taskStatus := c.negotiationState(t, *negotiation)
+	assert.Equal(t, types.FHIRTaskStatus(transfer.RequestedState), status)
+	assert.Equal(t, transfer.RequestedState, taskStatus)
+	// the accepted date isn't proposed anymore
+	assert.Empty(t, c.fhirClient.Resource("Task/" + negotiation.TaskID)["output"])
+	assert.Len(t, c.fhirClient.Resource("Task/" + negotiation.TaskID)["input"], 1)
+}
+
+func TestService_CancelNegotiation(t *testing.T) {
+	c := newTestContext(t)
+	var negotiation *types.TransferNegotiation
+	c.transact(t, func(ctx context.Context) error {
+		var err error
+		negotiation, err = c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:receiver")
+		return err
+	})
+	cancel := func(transferID, negotiationID string) error {
+		return sql.ExecuteTransactional(c.db, func(ctx context.Context) error {
+			_, err := c.service.CancelNegotiation(ctx, customerID, transferID, negotiationID)
+			return err
+		})
+	}
+
+	t.Run("unknown negotiation", func(t *testing.T) {
+		err := cancel(c.transferID, "unknown")
+
+		assert.ErrorIs(t, err, ErrNegotiationNotFound)
+	})
+	t.Run("negotiation of another transfer", func(t *testing.T) {
+		err := cancel("other-transfer", string(negotiation.Id))
+
+		assert.ErrorIs(t, err, ErrNegotiationNotFound)
+		status, taskStatus := c.negotiationState(t, *negotiation)
+		assert.Equal(t, types.FHIRTaskStatus(transfer.RequestedState), status)
+		assert.Equal(t, transfer.RequestedState, taskStatus)
+		assert.Contains(t, c.pip.data, negotiation.TaskID)
+	})
+	t.Run("ok", func(t *testing.T) {
+		err := cancel(c.transferID, string(negotiation.Id))
+
+		assert.NoError(t, err)
+		status, taskStatus := c.negotiationState(t, *negotiation)
+		assert.Equal(t, types.FHIRTaskStatus(transfer.CancelledState), status)
+		assert.Equal(t, transfer.CancelledState, taskStatus)
+	})
+}
+
+// TestService_TaskAccess verifies the receiver is allowed to update the Task through the resources of the PIP,
+// since it changes the state of the Task to answer the negotiation and to complete the transfer.
+func TestService_TaskAccess(t *testing.T) {
+	c := newTestContext(t)
+	var negotiation *types.TransferNegotiation
+	c.transact(t, func(ctx context.Context) error {
+		var err error
+		negotiation, err = c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:receiver")
+		return err
+	})
+	taskPath := "/Task/" + negotiation.TaskID
+
+	t.Run("negotiation", func(t *testing.T) {
+		assert.Equal(t, []string{"GET", "PUT"}, c.pip.data[negotiation.TaskID][taskPath])
+	})
+	t.Run("on hold", func(t *testing.T) {
+		alternativeDate := time.Now().AddDate(0, 0, 8)
+		c.transact(t, func(ctx context.Context) error {
+			return c.service.UpdateTaskState(ctx, types.Customer{Id: customerID}, negotiation.TaskID, transfer.OnHoldState, &alternativeDate)
+		})
+		c.transact(t, func(ctx context.Context) error {
+			_, err := c.service.AcceptAlternateDate(ctx, customerID, c.transferID, string(negotiation.Id))
+			return err
+		})
+
+		assert.Equal(t, []string{"GET", "PUT"}, c.pip.data[negotiation.TaskID][taskPath])
+	})
+	t.Run("confirmed", func(t *testing.T) {
+		c.transact(t, func(ctx context.Context) error {
+			return c.service.UpdateTaskState(ctx, types.Customer{Id: customerID}, negotiation.TaskID, transfer.AcceptedState, nil)
+		})
+		c.transact(t, func(ctx context.Context) error {
+			_, err := c.service.ConfirmNegotiation(ctx, customerID, c.transferID, string(negotiation.Id))
+			return err
+		})
+
+		assert.Equal(t, []string{"GET", "PUT"}, c.pip.data[negotiation.TaskID][taskPath])
+	})
+}
+
+func TestService_CancelTransfer(t *testing.T) {
+	t.Run("resources of the transfer are deleted", func(t *testing.T) {
+		c := newTestContext(t)
+
+		c.transact(t, func(ctx context.Context) error {
+			_, err := c.service.CancelTransfer(ctx, customerID, c.transferID)
+			return err
+		})
+
+		assert.Empty(t, c.fhirClient.Resources("Composition"))
+		assert.Empty(t, c.fhirClient.Resources("Condition"))
+		assert.Empty(t, c.fhirClient.Resources("Procedure"))
+		assert.Empty(t, c.fhirClient.Resources("Patient"))
+		c.transact(t, func(ctx context.Context) error {
+			cancelled, err := c.service.GetTransferByID(ctx, customerID, c.transferID)
+			assert.Equal(t, types.Cancelled, cancelled.Status)
+			return err
+		})
+		// other errors than a missing advance notice are returned
+		c.fhirClient.FailOn("ReadOne", "Composition")
+		_ = sql.ExecuteTransactional(c.db, func(ctx context.Context) error {
+			_, err := c.service.GetTransferByID(ctx, customerID, c.transferID)
+			assert.EqualError(t, err, "ReadOne of Composition failed")
+			return err
+		})
+	})
+	t.Run("resources referred to by a Task are marked entered-in-error", func(t *testing.T) {
+		c := newTestContext(t)
+		c.transact(t, func(ctx context.Context) error {
+			_, err := c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:receiver")
+			return err
+		})
+
+		c.transact(t, func(ctx context.Context) error {
+			_, err := c.service.CancelTransfer(ctx, customerID, c.transferID)
+			return err
+		})
+
+		compositions := c.fhirClient.Resources("Composition")
+		if !assert.Len(t, compositions, 1) {
+			return
+		}
+		assert.Equal(t, "entered-in-error", c.fhirClient.Resource(compositions[0])["status"])
+		for _, condition := range c.fhirClient.Resources("Condition") {
+			assert.Equal(t, "entered-in-error", c.fhirClient.Resource(condition)["verificationStatus"])
+			assert.NotContains(t, c.fhirClient.Resource(condition), "clinicalStatus")
+		}
+		for _, procedure := range c.fhirClient.Resources("Procedure") {
+			assert.Equal(t, "entered-in-error", c.fhirClient.Resource(procedure)["status"])
+		}
+		assert.Equal(t, false, c.fhirClient.Resource(c.fhirClient.Resources("Patient")[0])["active"])
+	})
+	t.Run("negotiations are cancelled", func(t *testing.T) {
+		c := newTestContext(t)
+		c.transact(t, func(ctx context.Context) error {
+			_, err := c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:receiver")
+			return err
+		})
+		taskID := c.negotiations(t)[0].TaskID
+
+		c.transact(t, func(ctx context.Context) error {
+			_, err := c.service.CancelTransfer(ctx, customerID, c.transferID)
+			return err
+		})
+
+		assert.Equal(t, transfer.CancelledState, c.taskStatus(taskID))
+		assert.Equal(t, transfer.CancelledState, string(c.negotiations(t)[0].Status))
+		assert.Empty(t, c.pip.data)
+	})
+	t.Run("nothing changes when cancelling a negotiation fails", func(t *testing.T) {
+		c := newTestContext(t)
+		c.transact(t, func(ctx context.Context) error {
+			_, err := c.service.CreateNegotiation(ctx, customerID, c.transferID, "did:web:receiver")
+			return err
+		})
+		negotiation := c.negotiations(t)[0]
+		c.pip.failDelete = negotiation.TaskID
+
+		err := sql.ExecuteTransactional(c.db, func(ctx context.Context) error {
+			_, err := c.service.CancelTransfer(ctx, customerID, c.transferID)
+			return err
+		})
+
+		assert.Error(t, err)
+		assert.Equal(t, transfer.RequestedState, c.taskStatus(negotiation.TaskID))
+		assert.Equal(t, transfer.RequestedState, string(c.negotiations(t)[0].Status))
+		assert.Contains(t, c.pip.data, negotiation.TaskID)
+		assert.Len(t, c.fhirClient.Resources("Composition"), 1)
+	})
+	t.Run("resources are kept when the transaction is rolled back", func(t *testing.T) {
+		c := newTestContext(t)
+
+		err := sql.ExecuteTransactional(c.db, func(ctx context.Context) error {
+			if _, err := c.service.CancelTransfer(ctx, customerID, c.transferID); err != nil {
+				return err
+			}
+			return errRollback
+		})
+
+		assert.ErrorIs(t, err, errRollback)
+		assert.Len(t, c.fhirClient.Resources("Composition"), 1)
+		assert.NotEmpty(t, c.fhirClient.Resources("Patient"))
+	})
+}
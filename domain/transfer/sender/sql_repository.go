@@ -3,6 +3,7 @@ package sender
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	openapiTypes "github.com/oapi-codegen/runtime/types"
@@ -151,6 +152,17 @@ const negotiationSchema = `
 	);
 `
 
+// The content is only needed to build the nursing handoff, so it is stored as JSON
+const handoffContentSchema = `
+	CREATE TABLE IF NOT EXISTS transfer_handoff_content (
+		transfer_id char(36) NOT NULL,
+		customer_id VARCHAR(255) NOT NULL,
+		content TEXT NOT NULL,
+		PRIMARY KEY (transfer_id),
+		FOREIGN KEY (transfer_id) REFERENCES transfer(id)
+	);
+`
+
 type SQLiteTransferRepository struct {
 }
 
@@ -162,6 +174,7 @@ func NewTransferRepository(db *sqlx.DB) *SQLiteTransferRepository {
 	tx, _ := db.Beginx()
 	tx.MustExec(transferSchema)
 	tx.MustExec(negotiationSchema)
+	tx.MustExec(handoffContentSchema)
 	if err := tx.Commit(); err != nil {
 		panic(err)
 	}
@@ -394,8 +407,24 @@ func (r SQLiteTransferRepository) CancelNegotiation(ctx context.Context, custome
 	return negotiation, nil
 }
 
-func (r SQLiteTransferRepository) ProposeAlternateDate(ctx context.Context, customerID string, negotiationID string) (*types.TransferNegotiation, error) {
-	panic("implement me")
+func (r SQLiteTransferRepository) ProposeAlternateDate(ctx context.Context, customerID string, negotiationID string, date time.Time) (*types.TransferNegotiation, error) {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	negotiation, err := r.findNegotiationByID(ctx, tx, customerID, negotiationID)
+	if err != nil {
+		return nil, err
+	}
+	if negotiation == nil {
+		return nil, fmt.Errorf("could not propose alternate date: negotiation not found (id=%s)", negotiationID)
+	}
+	negotiation.TransferDate = openapiTypes.Date{Time: date}
+	negotiation.Status = transfer.OnHoldState
+	if err := r.updateNegotiation(ctx, tx, customerID, *negotiation); err != nil {
+		return nil, err
+	}
+	return negotiation, nil
 }
 
 func (r SQLiteTransferRepository) ConfirmNegotiation(ctx context.Context, customerID string, negotiationID string) (*types.TransferNegotiation, error) {
@@ -488,3 +517,65 @@ func (r SQLiteTransferRepository) ListNegotiations(ctx context.Context, customer
 
 	return result, nil
 }
+
+func (r SQLiteTransferRepository) ListNegotiationsByState(ctx context.Context, state types.FHIRTaskStatus, before time.Time) (map[string][]types.TransferNegotiation, error) {
+	// dates are compared as Julian day numbers, since they might have been stored with different time zone offsets
+	const query = `SELECT * FROM transfer_negotiation WHERE status = ? AND julianday(date) < julianday(?) ORDER BY customer_id ASC, date ASC`
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dbNegotiations := []sqlNegotiation{}
+	if err = tx.SelectContext(ctx, &dbNegotiations, query, string(state), before.UTC()); err != nil {
+		return nil, fmt.Errorf("unable to list negotiations by state: %w", err)
+	}
+
+	result := map[string][]types.TransferNegotiation{}
+	for _, dbNegotiation := range dbNegotiations {
+		item, err := dbNegotiation.MarshalToDomainNegotiation()
+		if err != nil {
+			return nil, err
+		}
+		result[dbNegotiation.CustomerID] = append(result[dbNegotiation.CustomerID], *item)
+	}
+	return result, nil
+}
+
+func (r SQLiteTransferRepository) SaveHandoffContent(ctx context.Context, customerID, transferID string, content types.NursingHandoffContent) error {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	const query = `INSERT INTO transfer_handoff_content (transfer_id, customer_id, content) VALUES (?, ?, ?)
+		ON CONFLICT(transfer_id) DO UPDATE SET content = excluded.content`
+	if _, err = tx.ExecContext(ctx, query, transferID, customerID, string(data)); err != nil {
+		return fmt.Errorf("unable to store nursing handoff content: %w", err)
+	}
+	return nil
+}
+
+func (r SQLiteTransferRepository) FindHandoffContent(ctx context.Context, customerID, transferID string) (*types.NursingHandoffContent, error) {
+	tx, err := sqlUtil.GetTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	const query = `SELECT content FROM transfer_handoff_content WHERE customer_id = ? AND transfer_id = ?`
+
+	var data string
+	err = tx.GetContext(ctx, &data, query, customerID, transferID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to find nursing handoff content: %w", err)
+	}
+	content := &types.NursingHandoffContent{}
+	if err = json.Unmarshal([]byte(data), content); err != nil {
+		return nil, fmt.Errorf("invalid nursing handoff content: %w", err)
+	}
+	return content, nil
+}
@@ -4,6 +4,8 @@
 package types
 
 import (
+	"time"
+
 	openapi_types "github.com/oapi-codegen/runtime/types"
 )
 
@@ -11,6 +13,19 @@ const (
 	BearerAuthScopes = "bearerAuth.Scopes"
 )
 
+// Defines values for AllergyCriticality.
+const (
+	High           AllergyCriticality = "high"
+	Low            AllergyCriticality = "low"
+	UnableToAssess AllergyCriticality = "unable-to-assess"
+)
+
+// Defines values for DocumentFormat.
+const (
+	Html DocumentFormat = "html"
+	Pdf  DocumentFormat = "pdf"
+)
+
 // Defines values for EpisodeStatus.
 const (
 	EpisodeStatusActive         EpisodeStatus = "active"
@@ -29,6 +44,7 @@ const (
 	FHIRTaskStatusCompleted  FHIRTaskStatus = "completed"
 	FHIRTaskStatusInProgress FHIRTaskStatus = "in-progress"
 	FHIRTaskStatusOnHold     FHIRTaskStatus = "on-hold"
+	FHIRTaskStatusRejected   FHIRTaskStatus = "rejected"
 	FHIRTaskStatusRequested  FHIRTaskStatus = "requested"
 )
 
@@ -45,10 +61,21 @@ const (
 	InboxEntryTypeTransferRequest InboxEntryType = "transferRequest"
 )
 
+// Defines values for InterventionFrequencyPeriodUnit.
+const (
+	D  InterventionFrequencyPeriodUnit = "d"
+	H  InterventionFrequencyPeriodUnit = "h"
+	Mo InterventionFrequencyPeriodUnit = "mo"
+	Wk InterventionFrequencyPeriodUnit = "wk"
+)
+
 // Defines values for ProblemStatus.
 const (
-	ProblemStatusActive   ProblemStatus = "active"
-	ProblemStatusInactive ProblemStatus = "inactive"
+	ProblemStatusActive     ProblemStatus = "active"
+	ProblemStatusInactive   ProblemStatus = "inactive"
+	ProblemStatusRecurrence ProblemStatus = "recurrence"
+	ProblemStatusRemission  ProblemStatus = "remission"
+	ProblemStatusResolved   ProblemStatus = "resolved"
 )
 
 // Defines values for TokenResponseStatus.
@@ -57,6 +84,27 @@ const (
 	TokenResponseStatusPending TokenResponseStatus = "pending"
 )
 
+// Defines values for TransferEventType.
+const (
+	AuthorizationGranted TransferEventType = "authorization-granted"
+	AuthorizationRevoked TransferEventType = "authorization-revoked"
+	HandoffImported      TransferEventType = "handoff-imported"
+	NotificationFailed   TransferEventType = "notification-failed"
+	NotificationReceived TransferEventType = "notification-received"
+	NotificationSent     TransferEventType = "notification-sent"
+	StateChanged         TransferEventType = "state-changed"
+	TransferCancelled    TransferEventType = "transfer-cancelled"
+	TransferCreated      TransferEventType = "transfer-created"
+	TransferUpdated      TransferEventType = "transfer-updated"
+)
+
+// Defines values for TransferNotificationStatus.
+const (
+	TransferNotificationStatusDelivered TransferNotificationStatus = "delivered"
+	TransferNotificationStatusFailed    TransferNotificationStatus = "failed"
+	TransferNotificationStatusPending   TransferNotificationStatus = "pending"
+)
+
 // Defines values for TransferStatus.
 const (
 	Assigned  TransferStatus = "assigned"
@@ -66,11 +114,39 @@ const (
 	Requested TransferStatus = "requested"
 )
 
+// Allergy Allergy or intolerance of the patient.
+type Allergy struct {
+	Criticality *AllergyCriticality `json:"criticality,omitempty"`
+	Reaction    *string             `json:"reaction,omitempty"`
+	Substance   string              `json:"substance"`
+}
+
+// AllergyCriticality defines model for Allergy.Criticality.
+type AllergyCriticality string
+
+// BroadcastTransferNegotiationRequest A request to start transfer negotiations with all care organizations matching a Discovery Service query.
+type BroadcastTransferNegotiationRequest struct {
+	// DiscoveryServiceID Only start negotiations with care organizations that registered for the given Discovery Service. If not supplied, all Discovery Services are searched.
+	DiscoveryServiceID *string `json:"discoveryServiceID,omitempty"`
+
+	// Query The search query, key-value string properties. E.g.: 'credentialSubject.organization.city: Amsterdam'
+	Query map[string]string `json:"query"`
+}
+
 // BaseProps defines model for BaseProps.
 type BaseProps struct {
 	ObjectID string `json:"ObjectID"`
 }
 
+// CodedConcept A concept from a code system, e.g. SNOMED CT or NANDA-I.
+type CodedConcept struct {
+	Code    string `json:"code"`
+	Display string `json:"display"`
+
+	// System The URI of the code system.
+	System string `json:"system"`
+}
+
 // Collaboration An object that represents the relation between an episode and a collaborator
 type Collaboration struct {
 	// EpisodeID An internal object UUID which can be used as unique identifier for entities.
@@ -86,6 +162,13 @@ type Collaboration struct {
 	OrganizationName string `json:"organizationName"`
 }
 
+// ContactPerson Person to contact regarding the care of the patient, e.g. a family member.
+type ContactPerson struct {
+	Name         string  `json:"name"`
+	Relationship *string `json:"relationship,omitempty"`
+	Telephone    *string `json:"telephone,omitempty"`
+}
+
 // CreateCarePlanRequest Request to create a care plan
 type CreateCarePlanRequest struct {
 	// DossierID An internal object UUID which can be used as unique identifier for entities.
@@ -132,7 +215,10 @@ type CreateTransferRequest struct {
 
 	// DossierID An internal object UUID which can be used as unique identifier for entities.
 	DossierID ObjectID `json:"dossierID"`
-	Patient   Patient  `json:"patient"`
+
+	// HandoffContent Clinical content of the nursing handoff. In contrast to the care plan it is not part of the advance notice, it is only shared with the care organization the transfer is assigned to.
+	HandoffContent *NursingHandoffContent `json:"handoffContent,omitempty"`
+	Patient        Patient                `json:"patient"`
 
 	// TransferDate Transfer date as proposed by the sending XIS. It is populated/updated by the last negotiation that was started.
 	TransferDate openapi_types.Date `json:"transferDate"`
@@ -156,6 +242,9 @@ type Customer struct {
 	Name string `json:"name"`
 }
 
+// DocumentFormat Format of a rendered document.
+type DocumentFormat string
+
 // Dossier defines model for Dossier.
 type Dossier struct {
 	// Id An internal object UUID which can be used as unique identifier for entities.
@@ -192,10 +281,16 @@ type Gender string
 
 // InboxEntry defines model for InboxEntry.
 type InboxEntry struct {
+	// Archived If true, the current user archived the entry.
+	Archived bool `json:"archived"`
+
 	// Date Date/time of the entry.
 	Date string `json:"date"`
 
-	// RequiresAttention If true, this inbox entry requires attention of an end user (e.g. data has been changed by a remote system).
+	// Read If true, the current user has read the entry since it last changed.
+	Read bool `json:"read"`
+
+	// RequiresAttention If true, this inbox entry requires attention of an end user: it is unread (e.g. data has been changed by a remote system) or it awaits an action of the receiving care organization.
 	RequiresAttention bool `json:"requiresAttention"`
 
 	// ResourceID ID that should be used when retrieving the source document of the inbox entry, e.g. a transfer request.
@@ -217,15 +312,76 @@ type InboxEntry struct {
 // InboxEntryType Type of the entry
 type InboxEntryType string
 
+// InboxEntryUpdate defines model for InboxEntryUpdate.
+type InboxEntryUpdate struct {
+	// Archived Archives the entry or restores it to the inbox.
+	Archived *bool `json:"archived,omitempty"`
+
+	// Read Marks the entry as read or unread. The entry becomes unread again when the source document changes.
+	Read *bool `json:"read,omitempty"`
+}
+
 // InboxInfo defines model for InboxInfo.
 type InboxInfo struct {
-	// MessageCount Number of new messages in the inbox.
+	// MessageCount Number of unread entries in the inbox of the current user, archived entries are not counted.
 	MessageCount int `json:"messageCount"`
 }
 
+// InboxPage defines model for InboxPage.
+type InboxPage struct {
+	Entries []InboxEntry `json:"entries"`
+
+	// Total Total number of entries that match the filters.
+	Total int `json:"total"`
+}
+
 // Intervention defines model for Intervention.
 type Intervention struct {
-	Comment string `json:"comment"`
+	// Code A concept from a code system, e.g. SNOMED CT or NANDA-I.
+	Code    *CodedConcept `json:"code,omitempty"`
+	Comment string        `json:"comment"`
+
+	// Frequency How often the intervention is performed, e.g. 3 times per 1 day.
+	Frequency *InterventionFrequency `json:"frequency,omitempty"`
+}
+
+// InterventionFrequency How often the intervention is performed, e.g. 3 times per 1 day.
+type InterventionFrequency struct {
+	// Frequency The number of times the intervention is performed in the period.
+	Frequency int     `json:"frequency"`
+	Period    float32 `json:"period"`
+
+	// PeriodUnit The unit of the period (UCUM), hour, day, week or month.
+	PeriodUnit InterventionFrequencyPeriodUnit `json:"periodUnit"`
+}
+
+// InterventionFrequencyPeriodUnit The unit of the period (UCUM), hour, day, week or month.
+type InterventionFrequencyPeriodUnit string
+
+// Medication Medication the patient uses.
+type Medication struct {
+	Comment *string `json:"comment,omitempty"`
+
+	// Dosage Dosage instructions, e.g. "2 times a day 1 tablet".
+	Dosage *string `json:"dosage,omitempty"`
+	Name   string  `json:"name"`
+}
+
+// NursingHandoffContent Clinical content of the nursing handoff. In contrast to the care plan it is not part of the advance notice, it is only shared with the care organization the transfer is assigned to.
+type NursingHandoffContent struct {
+	Allergies      *[]Allergy       `json:"allergies,omitempty"`
+	ContactPersons *[]ContactPerson `json:"contactPersons,omitempty"`
+
+	// DailyActivities Description of the help the patient needs with the activities of daily living (ADL).
+	DailyActivities *string       `json:"dailyActivities,omitempty"`
+	Medications     *[]Medication `json:"medications,omitempty"`
+
+	// Mobility Description of the mobility of the patient, e.g. the use of walking aids.
+	Mobility *string `json:"mobility,omitempty"`
+
+	// ResponsiblePractitioner Practitioner responsible for the care of the patient at the sending care organization.
+	ResponsiblePractitioner *ResponsiblePractitioner `json:"responsiblePractitioner,omitempty"`
+	WoundCare               *[]WoundCare             `json:"woundCare,omitempty"`
 }
 
 // ObjectID An internal object UUID which can be used as unique identifier for entities.
@@ -286,6 +442,16 @@ type PatientProblem struct {
 	Problem       Problem        `json:"problem"`
 }
 
+// PatientPage A page of the patients matching a search.
+type PatientPage struct {
+	// Next Cursor of the next page, absent when there are no more patients.
+	Next     *string   `json:"next,omitempty"`
+	Patients []Patient `json:"patients"`
+
+	// Total Number of patients matching the search, absent when the FHIR server doesn't report it.
+	Total *int `json:"total,omitempty"`
+}
+
 // PatientProperties A patient in the EHR system. Containing the basic information about the like name, adress, dob etc.
 type PatientProperties struct {
 	AvatarUrl *string `json:"avatar_url,omitempty"`
@@ -320,11 +486,18 @@ type Period struct {
 
 // Problem defines model for Problem.
 type Problem struct {
-	Name   string        `json:"name"`
+	// Code A concept from a code system, e.g. SNOMED CT or NANDA-I.
+	Code *CodedConcept `json:"code,omitempty"`
+	Name string        `json:"name"`
+
+	// OnsetDate The date the problem started.
+	OnsetDate *openapi_types.Date `json:"onsetDate,omitempty"`
+
+	// Status The clinical status of the problem.
 	Status ProblemStatus `json:"status"`
 }
 
-// ProblemStatus defines model for Problem.Status.
+// ProblemStatus The clinical status of the problem.
 type ProblemStatus string
 
 // RemotePatientFile A patient file from a remote XIS.
@@ -350,6 +523,13 @@ type Report struct {
 	Value     string   `json:"value"`
 }
 
+// ResponsiblePractitioner Practitioner responsible for the care of the patient at the sending care organization.
+type ResponsiblePractitioner struct {
+	Name      string  `json:"name"`
+	Role      *string `json:"role,omitempty"`
+	Telephone *string `json:"telephone,omitempty"`
+}
+
 // SessionToken Result of a signing session.
 type SessionToken struct {
 	// Token the result from a signing session. It's an updated JWT.
@@ -393,6 +573,9 @@ type Transfer struct {
 	// FhirNursingHandoffComposition Reference to the FHIR composition resource that describes the nursing handoff, according to the Nictiz eOverdracht FHIR specification.
 	FhirNursingHandoffComposition *string `json:"fhirNursingHandoffComposition,omitempty"`
 
+	// HandoffContent Clinical content of the nursing handoff. In contrast to the care plan it is not part of the advance notice, it is only shared with the care organization the transfer is assigned to.
+	HandoffContent *NursingHandoffContent `json:"handoffContent,omitempty"`
+
 	// Id An internal object UUID which can be used as unique identifier for entities.
 	Id      ObjectID `json:"id"`
 	Patient Patient  `json:"patient"`
@@ -407,6 +590,37 @@ type Transfer struct {
 // TransferStatus Status of the transfer. If the state is "completed" or "cancelled" the transfer dossier becomes read-only. In that case no additional negotiations can be sent (for this transfer) or accepted. Possible values: - Created: the new transfer dossier is created, but no requests were sent (to receiving care organizations) yet. - Requested: one or more requests were sent to care organizations - Assigned: The transfer is assigned to one the receiving care organizations thet accepted the transfer. - Completed: the patient transfer is completed and marked as such by the receiving care organization. - Cancelled: the transfer is cancelled by the sending care organization.
 type TransferStatus string
 
+// TransferEvent An entry in the audit trail of a transfer. Events are recorded by both the sending and receiving care organization and are never changed or removed.
+type TransferEvent struct {
+	// Actor Identifier of the user that performed the action. Empty when the event was caused by the other care organization or the system.
+	Actor     *string   `json:"actor,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Details Human readable details of the event.
+	Details *string `json:"details,omitempty"`
+
+	// Id An internal object UUID which can be used as unique identifier for entities.
+	Id ObjectID `json:"id"`
+
+	// NegotiationID ID of the negotiation the event is about. Only set by the sending organization.
+	NegotiationID *string `json:"negotiationID,omitempty"`
+
+	// OrganizationID Decentralized Identifier of the other care organization involved in the event.
+	OrganizationID *string `json:"organizationID,omitempty"`
+
+	// Status State of the transfer or negotiation after the event.
+	Status *string `json:"status,omitempty"`
+
+	// TaskID The id of the FHIR Task resource the event is about.
+	TaskID *string `json:"taskID,omitempty"`
+
+	// Type Kind of event: transfer-created, transfer-updated and transfer-cancelled are changes to the transfer itself, state-changed is a change of the state of a negotiation (FHIR Task), notification-sent, notification-failed and notification-received are notifications exchanged with the other care organization, authorization-granted and authorization-revoked are changes to the access of the receiving organization.
+	Type TransferEventType `json:"type"`
+}
+
+// TransferEventType Kind of event: transfer-created, transfer-updated and transfer-cancelled are changes to the transfer itself, state-changed is a change of the state of a negotiation (FHIR Task), notification-sent, notification-failed and notification-received are notifications exchanged with the other care organization, authorization-granted and authorization-revoked are changes to the access of the receiving organization, handoff-imported is the import of the nursing handoff into the record of the receiving organization.
+type TransferEventType string
+
 // TransferNegotiation defines model for TransferNegotiation.
 type TransferNegotiation struct {
 	// Id An internal object UUID which can be used as unique identifier for entities.
@@ -437,11 +651,57 @@ type TransferNegotiationStatus struct {
 	Status FHIRTaskStatus `json:"status"`
 }
 
+// TransferNegotiationResult The result of starting a transfer negotiation with a single care organization.
+type TransferNegotiationResult struct {
+	// Error Reason the negotiation could not be started, absent when the negotiation was started.
+	Error *string `json:"error,omitempty"`
+
+	Negotiation *TransferNegotiation `json:"negotiation,omitempty"`
+
+	// Organization A care organization available through the Nuts Network to exchange information.
+	Organization Organization `json:"organization"`
+
+	// OrganizationID Decentralized Identifier of the organization to which transfer of a patient is requested.
+	OrganizationID string `json:"organizationID"`
+}
+
+// TransferNotification A notification to a receiving care organization that an eOverdracht FHIR task has been updated.
+type TransferNotification struct {
+	// Attempts Number of delivery attempts.
+	Attempts    int        `json:"attempts"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	DeliveredAt *time.Time `json:"deliveredAt,omitempty"`
+
+	// Id An internal object UUID which can be used as unique identifier for entities.
+	Id ObjectID `json:"id"`
+
+	// LastError Error of the last failed delivery attempt.
+	LastError *string `json:"lastError,omitempty"`
+
+	// NextAttemptAt Time of the next delivery attempt, if the notification is pending.
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+
+	// OrganizationID Decentralized Identifier of the organization that is notified.
+	OrganizationID string `json:"organizationID"`
+
+	// Status Delivery status of the notification.
+	Status TransferNotificationStatus `json:"status"`
+
+	// TaskID The id of the FHIR Task resource the notification is about.
+	TaskID string `json:"taskID"`
+}
+
+// TransferNotificationStatus Delivery status of the notification.
+type TransferNotificationStatus string
+
 // TransferProperties Properties of a transfer. These values can be updated over time.
 type TransferProperties struct {
 	// CarePlan CarePlan as defined by https://decor.nictiz.nl/pub/eoverdracht/e-overdracht-html-20210510T093529/tr-2.16.840.1.113883.2.4.3.11.60.30.4.63-2021-01-27T000000.html#_2.16.840.1.113883.2.4.3.11.60.30.22.4.529_20210126000000
 	CarePlan EOverdrachtCarePlan `json:"carePlan"`
-	Patient  Patient             `json:"patient"`
+
+	// HandoffContent Clinical content of the nursing handoff. In contrast to the care plan it is not part of the advance notice, it is only shared with the care organization the transfer is assigned to.
+	HandoffContent *NursingHandoffContent `json:"handoffContent,omitempty"`
+	Patient        Patient                `json:"patient"`
 
 	// TransferDate Transfer date as proposed by the sending XIS. It is populated/updated by the last negotiation that was started.
 	TransferDate openapi_types.Date `json:"transferDate"`
@@ -452,6 +712,9 @@ type TransferRequest struct {
 	// AdvanceNotice Properties of a transfer. These values can be updated over time.
 	AdvanceNotice TransferProperties `json:"advanceNotice"`
 
+	// AlternativeDate Alternative transfer date as proposed by the receiving care organization.
+	AlternativeDate *openapi_types.Date `json:"alternativeDate,omitempty"`
+
 	// NursingHandoff Properties of a transfer. These values can be updated over time.
 	NursingHandoff *TransferProperties `json:"nursingHandoff,omitempty"`
 
@@ -465,6 +728,24 @@ type TransferRequest struct {
 	TransferDate *openapi_types.Date `json:"transferDate,omitempty"`
 }
 
+// TransferRequestStateChange defines model for TransferRequestStateChange.
+type TransferRequestStateChange struct {
+	// AlternativeDate Alternative transfer date proposed by the receiving care organization.
+	AlternativeDate *openapi_types.Date `json:"alternativeDate,omitempty"`
+
+	// Status Status of the negotiation, maps to FHIR eOverdracht task states (https://informatiestandaarden.nictiz.nl/wiki/vpk:V4.0_FHIR_eOverdracht#Using_Task_to_manage_the_workflow).
+	Status FHIRTaskStatus `json:"status"`
+}
+
+// WoundCare A wound of the patient and how it should be treated.
+type WoundCare struct {
+	Description *string `json:"description,omitempty"`
+
+	// Location Location of the wound on the body.
+	Location  string  `json:"location"`
+	Treatment *string `json:"treatment,omitempty"`
+}
+
 // CreateAuthorizationRequestParams defines parameters for CreateAuthorizationRequest.
 type CreateAuthorizationRequestParams struct {
 	// Verifier The DID of the verifier
@@ -498,6 +779,30 @@ type SearchOrganizationsJSONBody struct {
 	Query map[string]string `json:"query"`
 }
 
+// GetInboxParams defines parameters for GetInbox.
+type GetInboxParams struct {
+	// Status Only return entries with one of the given states.
+	Status *[]FHIRTaskStatus `form:"status,omitempty" json:"status,omitempty"`
+
+	// Sender Only return entries sent by the care organization with the given DID.
+	Sender *string `form:"sender,omitempty" json:"sender,omitempty"`
+
+	// From Only return entries received on or after this date.
+	From *openapi_types.Date `form:"from,omitempty" json:"from,omitempty"`
+
+	// To Only return entries received on or before this date.
+	To *openapi_types.Date `form:"to,omitempty" json:"to,omitempty"`
+
+	// Archived If true, only archived entries are returned. Otherwise only entries that are not archived are returned.
+	Archived *bool `form:"archived,omitempty" json:"archived,omitempty"`
+
+	// Page Page to return, starting at 1. Defaults to 1.
+	Page *int `form:"page,omitempty" json:"page,omitempty"`
+
+	// PageSize Number of entries per page. Defaults to 20, at most 100.
+	PageSize *int `form:"pageSize,omitempty" json:"pageSize,omitempty"`
+}
+
 // GetRemotePatientParams defines parameters for GetRemotePatient.
 type GetRemotePatientParams struct {
 	// PatientSSN The patient's SSN
@@ -522,6 +827,12 @@ type GetReportsParams struct {
 	EpisodeID *string `form:"episodeID,omitempty" json:"episodeID,omitempty"`
 }
 
+// LookupConceptsParams defines parameters for LookupConcepts.
+type LookupConceptsParams struct {
+	// Query Text the display or code of the concepts must contain. If not set, all concepts of the value set are returned.
+	Query *string `form:"query,omitempty" json:"query,omitempty"`
+}
+
 // GetPatientTransfersParams defines parameters for GetPatientTransfers.
 type GetPatientTransfersParams struct {
 	// PatientID The patient ID
@@ -540,6 +851,27 @@ type ChangeTransferRequestStateParams struct {
 	Token string `form:"token" json:"token"`
 }
 
+// GetTransferRequestDocumentParams defines parameters for GetTransferRequestDocument.
+type GetTransferRequestDocumentParams struct {
+	// Token The access token
+	Token string `form:"token" json:"token"`
+
+	// Format Format of the document, defaults to html.
+	Format *DocumentFormat `form:"format,omitempty" json:"format,omitempty"`
+}
+
+// ImportTransferRequestParams defines parameters for ImportTransferRequest.
+type ImportTransferRequestParams struct {
+	// Token The access token
+	Token string `form:"token" json:"token"`
+}
+
+// GetTransferDocumentParams defines parameters for GetTransferDocument.
+type GetTransferDocumentParams struct {
+	// Format Format of the document, defaults to html.
+	Format *DocumentFormat `form:"format,omitempty" json:"format,omitempty"`
+}
+
 // SetCustomerJSONRequestBody defines body for SetCustomer for application/json ContentType.
 type SetCustomerJSONRequestBody = Customer
 
@@ -561,6 +893,9 @@ type CreateCollaborationJSONRequestBody = CreateCollaborationRequest
 // SearchOrganizationsJSONRequestBody defines body for SearchOrganizations for application/json ContentType.
 type SearchOrganizationsJSONRequestBody SearchOrganizationsJSONBody
 
+// UpdateInboxEntryJSONRequestBody defines body for UpdateInboxEntry for application/json ContentType.
+type UpdateInboxEntryJSONRequestBody = InboxEntryUpdate
+
 // UpdatePatientJSONRequestBody defines body for UpdatePatient for application/json ContentType.
 type UpdatePatientJSONRequestBody = PatientProperties
 
@@ -574,7 +909,7 @@ type CreateReportJSONRequestBody = Report
 type CreateTransferJSONRequestBody = CreateTransferRequest
 
 // ChangeTransferRequestStateJSONRequestBody defines body for ChangeTransferRequestState for application/json ContentType.
-type ChangeTransferRequestStateJSONRequestBody = TransferNegotiationStatus
+type ChangeTransferRequestStateJSONRequestBody = TransferRequestStateChange
 
 // UpdateTransferJSONRequestBody defines body for UpdateTransfer for application/json ContentType.
 type UpdateTransferJSONRequestBody = TransferProperties
@@ -585,5 +920,8 @@ type AssignTransferDirectJSONRequestBody = CreateTransferNegotiationRequest
 // StartTransferNegotiationJSONRequestBody defines body for StartTransferNegotiation for application/json ContentType.
 type StartTransferNegotiationJSONRequestBody = CreateTransferNegotiationRequest
 
+// BroadcastTransferNegotiationJSONRequestBody defines body for BroadcastTransferNegotiation for application/json ContentType.
+type BroadcastTransferNegotiationJSONRequestBody = BroadcastTransferNegotiationRequest
+
 // UpdateTransferNegotiationStatusJSONRequestBody defines body for UpdateTransferNegotiationStatus for application/json ContentType.
 type UpdateTransferNegotiationStatusJSONRequestBody = TransferNegotiationStatus
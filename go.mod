@@ -3,7 +3,7 @@ module github.com/nuts-foundation/nuts-demo-ehr
 go 1.22
 
 require (
-	github.com/avast/retry-go/v4 v4.6.0
+	github.com/go-pdf/fpdf v0.9.0
 	github.com/go-resty/resty/v2 v2.13.1
 	github.com/google/uuid v1.6.0
 	github.com/jmoiron/sqlx v1.4.0
@@ -8,6 +8,7 @@ import (
 	"embed"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/acl"
@@ -18,7 +19,9 @@ import (
 	"io"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -31,11 +34,18 @@ import (
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/customers"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/dossier"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/episode"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/export"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir/embedded"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir/eoverdracht"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/notification"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/patients"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/reports"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/tenants"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/terminology"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/history"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/outbox"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/receiver"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/transfer/sender"
 	"github.com/nuts-foundation/nuts-demo-ehr/domain/types"
@@ -78,7 +88,14 @@ func main() {
 	logrus.SetLevel(logrusLevel)
 
 	if config.FHIR.Server.Type == "" {
-		logrus.Fatal("Invalid FHIR server type, valid options are: 'hapi-multi-tenant', 'hapi' or 'other'")
+		logrus.Fatal("Invalid FHIR server type, valid options are: 'hapi-multi-tenant', 'hapi', 'embedded' or 'other'")
+	}
+
+	if args := loadFlagSet(os.Args[1:]).Args(); len(args) > 0 && args[0] == "tenant" {
+		if err := runTenantCommand(config, args[1:], os.Stdout); err != nil {
+			logrus.Fatal(err)
+		}
+		return
 	}
 
 	// Read the authentication key
@@ -155,10 +172,28 @@ func registerEHR(server *echo.Echo, config Config, customerRepository customers.
 		fhirNotifier.TLSConfig = tlsClientConfig
 	}
 
+	if config.FHIR.Server.Type == embeddedFHIRServerType {
+		if err = startEmbeddedFHIRServer(config.FHIR.Server.Address); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fhirVersion, err := fhir.ParseVersion(config.FHIR.Server.Version)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tenantRegistry, err := tenants.NewRegistry(sqlDB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fhirTenancy, err := config.FHIR.Server.Tenancy(tenantRegistry)
+	if err != nil {
+		log.Fatal(err)
+	}
 	fhirClientFactory := fhir.NewFactory(
 		fhir.WithURL(config.FHIR.Server.Address),
-		fhir.WithMultiTenancyEnabled(config.FHIR.Server.SupportsMultiTenancy()),
+		fhir.WithTenancy(fhirTenancy),
 		fhir.WithTLS(tlsClientConfig),
+		fhir.WithVersion(fhirVersion),
 	)
 	patientRepository := patients.NewFHIRPatientRepository(patients.Factory{}, fhirClientFactory)
 	reportRepository := reports.NewFHIRRepository(fhirClientFactory)
@@ -166,18 +201,45 @@ func registerEHR(server *echo.Echo, config Config, customerRepository customers.
 	dossierRepository := dossier.NewSQLiteDossierRepository(dossier.Factory{}, sqlDB)
 	transferSenderRepo := sender.NewTransferRepository(sqlDB)
 	transferReceiverRepo := receiver.NewTransferRepository(sqlDB)
-	transferSenderService := sender.NewTransferService(nodeClient, pipClient, fhirClientFactory, transferSenderRepo, customerRepository, dossierRepository, patientRepository, orgRegistry, fhirNotifier)
-	transferReceiverService := receiver.NewTransferService(nodeClient, fhirClientFactory, transferReceiverRepo, customerRepository, orgRegistry, fhirNotifier)
-	tenantInitializer := func(tenant string) error {
+	transferHistory := history.NewRepository(sqlDB)
+	notificationOutbox := outbox.NewRepository(sqlDB)
+	notificationDispatcher := outbox.NewDispatcher(sqlDB, notificationOutbox, nodeClient, orgRegistry, fhirNotifier, transferHistory, outbox.Config{
+		Interval:       config.Notifications.Interval,
+		MaxAttempts:    config.Notifications.MaxAttempts,
+		InitialBackoff: config.Notifications.InitialBackoff,
+		MaxBackoff:     config.Notifications.MaxBackoff,
+	})
+	notificationDispatcher.Start(context.Background())
+	transferSenderService := sender.NewTransferService(nodeClient, pipClient, fhirClientFactory, transferSenderRepo, customerRepository, dossierRepository, patientRepository, orgRegistry, notificationOutbox, transferHistory, config.Validation.Strict)
+	sender.NewScheduler(sqlDB, transferSenderRepo, transferSenderService, sender.SchedulerConfig{
+		Interval:      config.Scheduler.Interval,
+		CompleteAfter: config.Scheduler.CompleteAfter,
+		AnswerBefore:  config.Scheduler.AnswerBefore,
+	}).Start(context.Background())
+	transferReceiverService := receiver.NewTransferService(nodeClient, fhirClientFactory, transferReceiverRepo, customerRepository, patientRepository, dossierRepository, orgRegistry, fhirNotifier, transferHistory)
+	receiver.NewReconciler(sqlDB, transferReceiverRepo, transferReceiverService, receiver.ReconcilerConfig{
+		Interval:       config.Reconciler.Interval,
+		InitialBackoff: config.Reconciler.InitialBackoff,
+		MaxBackoff:     config.Reconciler.MaxBackoff,
+	}).Start(context.Background())
+	tenantInitializer := func(ctx context.Context, tenant string) error {
 		if !config.FHIR.Server.SupportsMultiTenancy() {
 			return nil
 		}
-
-		return fhir.InitializeTenant(config.FHIR.Server.Address, tenant)
+		partition, err := tenantRegistry.Register(ctx, tenant)
+		if err != nil {
+			return err
+		}
+		// the embedded FHIR server creates partitions when they're first used
+		if config.FHIR.Server.Type == embeddedFHIRServerType {
+			return nil
+		}
+		return fhir.InitializeTenant(config.FHIR.Server.Address, partition.ID, partition.Name)
 	}
 
 	// Shared Care Plan
 	var scpService *sharedcareplan.Service
+	exportService := export.Service{FHIRClientFactory: fhirClientFactory, DossierRepository: dossierRepository, TransferRepository: transferSenderRepo}
 	if config.SharedCarePlanning.Enabled() {
 		scpRepository, err := sharedcareplan.NewRepository(sqlDB)
 		if err != nil {
@@ -185,6 +247,7 @@ func registerEHR(server *echo.Echo, config Config, customerRepository customers.
 		}
 		scpFHIRClient := fhir.NewFactory(fhir.WithURL(config.SharedCarePlanning.CarePlanService.FHIRBaseURL))()
 		scpService = &sharedcareplan.Service{DossierRepository: dossierRepository, PatientRepository: patientRepository, Repository: scpRepository, FHIRClient: scpFHIRClient}
+		exportService.SharedCarePlanRepository = &scpRepository
 	}
 
 	if config.LoadTestPatients {
@@ -193,10 +256,13 @@ func registerEHR(server *echo.Echo, config Config, customerRepository customers.
 			log.Fatal(err)
 		}
 		for _, customer := range allCustomers {
-			if err := tenantInitializer(customer.Id); err != nil {
+			err := sql.ExecuteTransactional(sqlDB, func(ctx context.Context) error {
+				return tenantInitializer(ctx, customer.Id)
+			})
+			if err != nil {
 				log.Fatal(err)
 			}
-			registerPatients(patientRepository, sqlDB, customer.Id)
+			registerPatients(patientRepository, customer.Id)
 		}
 	}
 	auth := api.NewAuth(config.sessionKey, customerRepository, passwd)
@@ -205,6 +271,10 @@ func registerEHR(server *echo.Echo, config Config, customerRepository customers.
 	if err != nil {
 		log.Fatal(err)
 	}
+	terminologyLookup, err := terminology.NewLookup()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Initialize wrapper
 	apiWrapper := api.Wrapper{
@@ -220,12 +290,16 @@ func registerEHR(server *echo.Echo, config Config, customerRepository customers.
 		TransferSenderService:   transferSenderService,
 		TransferReceiverService: transferReceiverService,
 		TransferReceiverRepo:    transferReceiverRepo,
+		NotificationOutbox:      notificationDispatcher,
 		ZorginzageService:       domain.ZorginzageService{NutsClient: nodeClient},
 		SharedCarePlanService:   scpService,
 		FHIRService:             fhir.Service{ClientFactory: fhirClientFactory},
 		EpisodeService:          episode.NewService(fhirClientFactory, nodeClient, orgRegistry, aclRepository),
+		ExportService:           exportService,
+		Terminology:             terminologyLookup,
 		TenantInitializer:       tenantInitializer,
 		NotificationHandler:     notification.NewHandler(nodeClient, fhirClientFactory, transferReceiverService, orgRegistry),
+		IntrospectNotifications: config.IncomingNotifications.Introspect,
 	}
 
 	// JWT checking for correct claims
@@ -242,7 +316,28 @@ func registerEHR(server *echo.Echo, config Config, customerRepository customers.
 	server.GET("/*", echo.WrapHandler(assetHandler))
 }
 
-func registerPatients(repository patients.Repository, db *sqlx.DB, customerID string) {
+// startEmbeddedFHIRServer serves the in-memory FHIR server on the host, port and path of the address. It's listening
+// when this function returns, so the test patients can be registered right away.
+func startEmbeddedFHIRServer(address string) error {
+	serverURL, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("invalid address of the embedded FHIR server: %w", err)
+	}
+	listener, err := net.Listen("tcp", serverURL.Host)
+	if err != nil {
+		return fmt.Errorf("unable to start the embedded FHIR server: %w", err)
+	}
+	handler := http.StripPrefix(strings.TrimSuffix(serverURL.Path, "/"), embedded.NewServer())
+	go func() {
+		logrus.Infof("Embedded FHIR server listening on %s", address)
+		if err := http.Serve(listener, handler); err != nil {
+			logrus.Errorf("Embedded FHIR server stopped: %s", err)
+		}
+	}()
+	return nil
+}
+
+func registerPatients(repository patients.Repository, customerID string) {
 	pdate := func(value time.Time) *openapiTypes.Date {
 		val := openapiTypes.Date{Time: value}
 		return &val
@@ -284,15 +379,8 @@ func registerPatients(repository patients.Repository, db *sqlx.DB, customerID st
 			Zipcode:   "7777AX",
 		},
 	}
-	if err := sql.ExecuteTransactional(db, func(ctx context.Context) error {
-		for _, prop := range props {
-			if _, err := repository.NewPatient(ctx, customerID, prop); err != nil {
-				return fmt.Errorf("unable to register test patient: %w", err)
-			}
-		}
-		return nil
-	}); err != nil {
-		log.Fatal(err)
+	if _, err := repository.NewPatients(context.Background(), customerID, props); err != nil {
+		log.Fatalf("unable to register test patients: %s", err)
 	}
 }
 
@@ -309,7 +397,15 @@ func httpErrorHandler(err error, c echo.Context) {
 	)
 	type Map map[string]interface{}
 
-	if he, ok := err.(*echo.HTTPError); ok {
+	var validationErr eoverdracht.ValidationError
+	if errors.As(err, &validationErr) {
+		// resources that don't conform to the eOverdracht profiles are reported as FHIR OperationOutcome
+		code = http.StatusBadRequest
+		msg = validationErr.OperationOutcome()
+	} else if status, ok := fhirErrorStatus(err); ok {
+		code = status
+		msg = err.Error()
+	} else if he, ok := err.(*echo.HTTPError); ok {
 		code = he.Code
 		msg = he.Message
 		if he.Internal != nil {
@@ -336,6 +432,22 @@ func httpErrorHandler(err error, c echo.Context) {
 	}
 }
 
+// fhirErrorStatus returns the HTTP status with which a failed request to the FHIR server is reported to the frontend.
+// If the FHIR server refused access, it's reported as 403 since 401 would make the frontend end the session.
+func fhirErrorStatus(err error) (int, bool) {
+	switch {
+	case errors.Is(err, fhir.ErrNotFound):
+		return http.StatusNotFound, true
+	case errors.Is(err, fhir.ErrGone):
+		return http.StatusGone, true
+	case errors.Is(err, fhir.ErrConflict):
+		return http.StatusConflict, true
+	case errors.Is(err, fhir.ErrUnauthorized):
+		return http.StatusForbidden, true
+	}
+	return 0, false
+}
+
 type fhirBinder struct{}
 
 func (cb *fhirBinder) Bind(i interface{}, c echo.Context) (err error) {
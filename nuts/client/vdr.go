@@ -32,6 +32,14 @@ func (c HTTPClient) ResolveServiceEndpoint(ctx context.Context, verifierID strin
 	return "", errors.New("service not found")
 }
 
+// VDR resolves the DIDs of the customers.
+type VDR interface {
+	// ListSubjectDIDs returns the DIDs of the subject of the customer.
+	ListSubjectDIDs(ctx context.Context, customerID string) ([]string, error)
+}
+
+var _ VDR = HTTPClient{}
+
 func (c HTTPClient) ListSubjectDIDs(ctx context.Context, customerID string) ([]string, error) {
 	response, err := c.vdr().SubjectDIDs(ctx, customerID)
 	if err != nil {
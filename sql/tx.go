@@ -3,6 +3,7 @@ package sql
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
@@ -29,8 +30,12 @@ func Transactional(db *sqlx.DB) echo.MiddlewareFunc {
 }
 
 type TransactionManager struct {
-	db *sqlx.DB
-	tx *sqlx.Tx
+	db               *sqlx.DB
+	tx               *sqlx.Tx
+	rollbackHandlers []func()
+	commitHandlers   []func()
+	// savepoints is the number of savepoints which have been created, to give every savepoint a unique name
+	savepoints int
 }
 
 func (tm *TransactionManager) getTransaction() (*sqlx.Tx, error) {
@@ -48,6 +53,8 @@ func (tm *TransactionManager) Rollback() {
 		}
 		tm.tx = nil
 	}
+	tm.commitHandlers = nil
+	tm.runRollbackHandlers()
 }
 
 func (tm *TransactionManager) Commit() error {
@@ -55,9 +62,76 @@ func (tm *TransactionManager) Commit() error {
 	if tm.tx != nil {
 		if err = tm.tx.Commit(); err != nil {
 			logrus.Errorf("Error while committing transaction: %v", err)
+			tm.commitHandlers = nil
+			tm.runRollbackHandlers()
 		}
 		tm.tx = nil
 	}
+	tm.rollbackHandlers = nil
+	handlers := tm.commitHandlers
+	tm.commitHandlers = nil
+	for _, handler := range handlers {
+		handler()
+	}
+	return err
+}
+
+// OnRollback registers a handler which is called when the transaction is rolled back or fails to commit.
+// It is used to undo changes outside the database which were made as part of the transaction.
+func (tm *TransactionManager) OnRollback(handler func()) {
+	tm.rollbackHandlers = append(tm.rollbackHandlers, handler)
+}
+
+// OnCommit registers a handler which is called after the transaction has been committed.
+// It is used for changes outside the database which can't be undone, so they must only be made when the transaction succeeds.
+func (tm *TransactionManager) OnCommit(handler func()) {
+	tm.commitHandlers = append(tm.commitHandlers, handler)
+}
+
+func (tm *TransactionManager) runRollbackHandlers() {
+	handlers := tm.rollbackHandlers
+	tm.rollbackHandlers = nil
+	// undo in the reverse order of the changes
+	for i := len(handlers) - 1; i >= 0; i-- {
+		handlers[i]()
+	}
+}
+
+// Savepoint executes the acceptor in a savepoint of the transaction in the context. When the acceptor fails, only its
+// changes are rolled back (including the rollback handlers it registered), the transaction itself can still be committed.
+// The commit handlers it registered are discarded.
+func Savepoint(ctx context.Context, acceptor func(ctx context.Context) error) error {
+	tm, err := GetTransactionManager(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := tm.getTransaction()
+	if err != nil {
+		return err
+	}
+	tm.savepoints++
+	name := fmt.Sprintf("savepoint_%d", tm.savepoints)
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	handlers := len(tm.rollbackHandlers)
+	commitHandlers := len(tm.commitHandlers)
+	if err := acceptor(ctx); err != nil {
+		if _, rollbackErr := tx.Exec("ROLLBACK TO SAVEPOINT " + name); rollbackErr != nil {
+			logrus.Errorf("Error while rolling back to savepoint: %v", rollbackErr)
+		}
+		if _, releaseErr := tx.Exec("RELEASE SAVEPOINT " + name); releaseErr != nil {
+			logrus.Errorf("Error while releasing savepoint: %v", releaseErr)
+		}
+		savepointHandlers := tm.rollbackHandlers[handlers:]
+		tm.rollbackHandlers = tm.rollbackHandlers[:handlers:handlers]
+		tm.commitHandlers = tm.commitHandlers[:commitHandlers:commitHandlers]
+		for i := len(savepointHandlers) - 1; i >= 0; i-- {
+			savepointHandlers[i]()
+		}
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
 	return err
 }
 
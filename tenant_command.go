@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/customers"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/fhir"
+	"github.com/nuts-foundation/nuts-demo-ehr/domain/tenants"
+	"github.com/nuts-foundation/nuts-demo-ehr/sql"
+)
+
+const tenantCommandUsage = `usage: nuts-demo-ehr tenant <command>
+  list                   lists the FHIR partitions of the customers
+  create <customer ID>   creates the FHIR partition of the customer
+  drop <customer ID>     drops the FHIR partition of the customer`
+
+// runTenantCommand manages the partitions of the customers on the FHIR server. It writes its results to the output.
+// The demo EHR caches the partitions, so partitions should only be dropped when it isn't running.
+func runTenantCommand(config Config, args []string, output io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(tenantCommandUsage)
+	}
+	if !config.FHIR.Server.SupportsMultiTenancy() {
+		return fmt.Errorf("FHIR server type %s doesn't support partitions", config.FHIR.Server.Type)
+	}
+	sqlDB := sqlx.MustConnect("sqlite3", config.DBConnectionString)
+	defer sqlDB.Close()
+	registry, err := tenants.NewRegistry(sqlDB)
+	if err != nil {
+		return err
+	}
+	// the partitions of the embedded FHIR server only exist while the demo EHR runs
+	manageFHIRServer := config.FHIR.Server.Type != embeddedFHIRServerType
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		return sql.ExecuteTransactional(sqlDB, func(ctx context.Context) error {
+			partitions, err := registry.All(ctx)
+			if err != nil {
+				return err
+			}
+			writer := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(writer, "CUSTOMER\tPARTITION ID\tNAME\tCREATED")
+			for _, partition := range partitions {
+				_, _ = fmt.Fprintf(writer, "%s\t%d\t%s\t%s\n", partition.CustomerID, partition.ID, partition.Name, partition.CreatedAt.Format("2006-01-02 15:04:05"))
+			}
+			return writer.Flush()
+		})
+	case args[0] == "create" && len(args) == 2:
+		customerID := args[1]
+		customer, err := customers.NewJsonFileRepository(config.CustomersFile).FindByID(customerID)
+		if err != nil {
+			return err
+		}
+		if customer == nil {
+			return fmt.Errorf("unknown customer (customer=%s)", customerID)
+		}
+		return sql.ExecuteTransactional(sqlDB, func(ctx context.Context) error {
+			partition, err := registry.Register(ctx, customerID)
+			if err != nil {
+				return err
+			}
+			if manageFHIRServer {
+				if err := fhir.InitializeTenant(config.FHIR.Server.Address, partition.ID, partition.Name); err != nil {
+					return err
+				}
+			}
+			_, _ = fmt.Fprintf(output, "Partition of customer %s: %d (name=%s)\n", customerID, partition.ID, partition.Name)
+			return nil
+		})
+	case args[0] == "drop" && len(args) == 2:
+		customerID := args[1]
+		return sql.ExecuteTransactional(sqlDB, func(ctx context.Context) error {
+			partition, err := registry.Find(ctx, customerID)
+			if err != nil {
+				return err
+			}
+			if partition == nil {
+				return fmt.Errorf("customer doesn't have a partition (customer=%s)", customerID)
+			}
+			if err := registry.Remove(ctx, customerID); err != nil {
+				return err
+			}
+			if manageFHIRServer {
+				if err := fhir.DropTenant(config.FHIR.Server.Address, partition.ID); err != nil {
+					return err
+				}
+			}
+			_, _ = fmt.Fprintf(output, "Dropped partition of customer %s: %d (name=%s)\n", customerID, partition.ID, partition.Name)
+			return nil
+		})
+	default:
+		return errors.New(tenantCommandUsage)
+	}
+}
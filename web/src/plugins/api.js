@@ -24,6 +24,9 @@ function wrapClientCall(client, functionName, apiOptions, router) {
                     // Otherwise, return the more technical API client error message.
                     if (result.response.data && result.response.data.error) {
                         return Promise.reject(result.response.data.error)
+                    } else if (result.response.data && result.response.data.resourceType === 'OperationOutcome') {
+                        // FHIR resources that don't conform to the eOverdracht profiles
+                        return Promise.reject(result.response.data.issue.map(issue => issue.diagnostics).join('\n'))
                     } else {
                         return Promise.reject(result.message)
                     }